@@ -0,0 +1,117 @@
+// Package archivos guarda el contenido de los EPUB y PDF de los libros fuera de la
+// base de datos, que solo registra sus datos (models.ArchivoLibro).
+package archivos
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrClaveInvalida se devuelve con una clave que no es una ruta relativa limpia.
+var ErrClaveInvalida = errors.New("clave de archivo inválida")
+
+// Almacen guarda contenidos por clave. La aplicación usa como clave el SHA-256 del
+// contenido, así que un mismo archivo subido a dos libros se guarda una sola vez.
+type Almacen interface {
+	// Guardar escribe el contenido de 'clave', reemplazando el que hubiera.
+	Guardar(clave string, contenido io.Reader) error
+	// Abrir devuelve el contenido de 'clave', o un error que cumple errors.Is(err, fs.ErrNotExist).
+	Abrir(clave string) (io.ReadSeekCloser, error)
+	// Eliminar borra el contenido de 'clave'. No es un error que no exista.
+	Eliminar(clave string) error
+	// Claves devuelve todas las claves guardadas.
+	Claves() ([]string, error)
+}
+
+// prefijoTemporal marca los archivos a medio escribir, que Claves ignora.
+const prefijoTemporal = ".tmp-"
+
+// AlmacenLocal guarda cada clave como un archivo bajo un directorio raíz. Las claves
+// se reparten en subdirectorios por sus dos primeros caracteres, ej. "ab/abcdef...".
+type AlmacenLocal struct {
+	raiz string
+}
+
+// NuevoAlmacenLocal crea, si no existe, el directorio 'raiz' y devuelve su almacén.
+func NuevoAlmacenLocal(raiz string) (*AlmacenLocal, error) {
+	if err := os.MkdirAll(raiz, 0o755); err != nil {
+		return nil, fmt.Errorf("crear directorio de archivos: %w", err)
+	}
+	return &AlmacenLocal{raiz: raiz}, nil
+}
+
+func (a *AlmacenLocal) ruta(clave string) (string, error) {
+	if len(clave) < 3 || !fs.ValidPath(clave) || strings.ContainsAny(clave, `/\`) || strings.HasPrefix(clave, prefijoTemporal) {
+		return "", ErrClaveInvalida
+	}
+	return filepath.Join(a.raiz, clave[:2], clave), nil
+}
+
+// Guardar escribe primero en un archivo temporal y lo renombra al terminar, para que
+// nunca se lea un contenido a medias.
+func (a *AlmacenLocal) Guardar(clave string, contenido io.Reader) error {
+	ruta, err := a.ruta(clave)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(ruta), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(ruta), prefijoTemporal+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No tiene efecto si ya se renombró
+
+	if _, err := io.Copy(tmp, contenido); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), ruta)
+}
+
+func (a *AlmacenLocal) Abrir(clave string) (io.ReadSeekCloser, error) {
+	ruta, err := a.ruta(clave)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(ruta)
+}
+
+func (a *AlmacenLocal) Eliminar(clave string) error {
+	ruta, err := a.ruta(clave)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(ruta); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (a *AlmacenLocal) Claves() ([]string, error) {
+	var claves []string
+	err := filepath.WalkDir(a.raiz, func(ruta string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() && !strings.HasPrefix(d.Name(), prefijoTemporal) {
+			claves = append(claves, d.Name())
+		}
+		return nil
+	})
+	return claves, err
+}
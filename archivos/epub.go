@@ -0,0 +1,113 @@
+package archivos
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"time"
+
+	"libroselectronicos/epub"
+	"libroselectronicos/models"
+)
+
+// rolesMARC traduce los roles MARC relator de un EPUB a los papeles de la aplicación;
+// los demás (ilustrador, prologuista, ...) no se importan.
+var rolesMARC = map[string]string{"aut": models.RolAutor, "trl": models.RolTraductor, "edt": models.RolEditor}
+
+// PrepararDesdeEPUB guarda el contenido de un EPUB y devuelve un libro sin guardar
+// rellenado con sus metadatos, para revisarlo antes de crearlo, y la portada del EPUB
+// si tiene. El libro lleva en Archivos el EPUB, aún sin LibroID, que se asocia con
+// Adjuntar una vez creado.
+func (s *Servicio) PrepararDesdeEPUB(nombre string, contenido io.Reader) (*models.Libro, *epub.Portada, error) {
+	archivo, tmp, err := s.recibir(nombre, contenido)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	if archivo.Formato != models.FormatoEPUB {
+		return nil, nil, fmt.Errorf("%w: se esperaba un EPUB", models.ErrFormatoNoSoportado)
+	}
+
+	metadatos, err := epub.Leer(tmp, archivo.Tamano)
+	if err != nil {
+		return nil, nil, models.ErroresValidacion{"archivo": err.Error()}
+	}
+	// Si el libro no llega a crearse, el contenido lo borrará "archivos limpiar"
+	if err := s.Contenidos.Guardar(archivo.SHA256, tmp); err != nil {
+		return nil, nil, err
+	}
+
+	libro := libroDesdeMetadatos(metadatos)
+	libro.Archivos = []models.ArchivoLibro{*archivo}
+	return libro, metadatos.Portada, nil
+}
+
+// PrepararDesdeFormulario es PrepararDesdeEPUB con el campo "archivo" de un formulario
+// multipart/form-data.
+func (s *Servicio) PrepararDesdeFormulario(w http.ResponseWriter, r *http.Request) (*models.Libro, *epub.Portada, error) {
+	parte, err := s.parteArchivo(w, r)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.PrepararDesdeEPUB(parte.FileName(), parte)
+}
+
+// libroDesdeMetadatos rellena un libro con los metadatos del EPUB. El ISBN y el idioma
+// que no son válidos se descartan para que el formulario no los rechace.
+func libroDesdeMetadatos(m *epub.Metadatos) *models.Libro {
+	libro := &models.Libro{Titulo: m.Titulo, Anio: m.Anio(), Editorial: m.Editorial, Sinopsis: m.Descripcion, Disponible: true}
+	for _, c := range m.Creadores {
+		if rol, ok := rolesMARC[c.Rol]; ok {
+			libro.Autores = append(libro.Autores, models.CreditoAutor{Nombre: c.Nombre, Rol: rol})
+		}
+	}
+	libro.Autor = models.NombresAutores(libro.Autores)
+	if isbn, err := models.NormalizarISBN(m.ISBN()); err == nil {
+		libro.ISBN = isbn
+	}
+	if models.EsEtiquetaIdioma(m.Idioma) {
+		libro.Idioma = m.Idioma
+	}
+	return libro
+}
+
+// Adjuntar asocia al libro un contenido que ya está en el almacén, como el EPUB de
+// PrepararDesdeEPUB. El formato y el tamaño se vuelven a obtener del contenido.
+func (s *Servicio) Adjuntar(libroID int, clave, nombre string) (*models.ArchivoLibro, error) {
+	contenido, err := s.Contenidos.Abrir(clave)
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, ErrClaveInvalida) {
+		return nil, models.ErrArchivoNoEncontrado
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer contenido.Close()
+
+	cabecera := make([]byte, 512)
+	n, err := io.ReadFull(contenido, cabecera)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	formato, tipo, err := models.DetectarFormato(cabecera[:n])
+	if err != nil {
+		return nil, err
+	}
+	tamano, err := contenido.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.registrar(&models.ArchivoLibro{
+		LibroID:  libroID,
+		Formato:  formato,
+		MIME:     tipo,
+		Tamano:   tamano,
+		SHA256:   clave,
+		Nombre:   nombre,
+		SubidoEn: time.Now().UTC(),
+	})
+}
@@ -0,0 +1,244 @@
+package archivos
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"libroselectronicos/db"
+	"libroselectronicos/models"
+)
+
+// Servicio une el almacén de contenidos y la base de datos para subir, descargar y
+// eliminar los archivos de los libros.
+type Servicio struct {
+	Contenidos   Almacen
+	Libros       db.LibroAlmacenamiento
+	TamanoMaximo int64 // En bytes; models.TamanoMaximoArchivo si es 0
+}
+
+func NuevoServicio(contenidos Almacen, libros db.LibroAlmacenamiento) *Servicio {
+	return &Servicio{Contenidos: contenidos, Libros: libros}
+}
+
+func (s *Servicio) tamanoMaximo() int64 {
+	if s.TamanoMaximo > 0 {
+		return s.TamanoMaximo
+	}
+	return models.TamanoMaximoArchivo
+}
+
+// Subir guarda 'contenido' como el archivo del libro en su formato, que se detecta por
+// los primeros bytes, y reemplaza el que tuviera en ese formato. Devuelve
+// ErrArchivoDemasiadoGrande, ErrFormatoNoSoportado o ErrLibroNoEncontrado.
+func (s *Servicio) Subir(libroID int, nombre string, contenido io.Reader) (*models.ArchivoLibro, error) {
+	// Antes de leer nada, para no dejar en el almacén un contenido que no usa ningún libro
+	if _, err := s.Libros.ObtenerLibro(libroID); err != nil {
+		return nil, err
+	}
+	archivo, tmp, err := s.recibir(nombre, contenido)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if err := s.Contenidos.Guardar(archivo.SHA256, tmp); err != nil {
+		return nil, err
+	}
+	archivo.LibroID = libroID
+	return s.registrar(archivo)
+}
+
+// recibir copia 'contenido' a un archivo temporal, que el llamador debe cerrar y borrar,
+// para conocer su tamaño, su SHA-256, que es la clave, y su formato antes de guardarlo.
+// El temporal queda al principio.
+func (s *Servicio) recibir(nombre string, contenido io.Reader) (*models.ArchivoLibro, *os.File, error) {
+	tmp, err := os.CreateTemp("", "subida-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	archivo, err := s.copiar(tmp, nombre, contenido)
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, nil, err
+	}
+	return archivo, tmp, nil
+}
+
+func (s *Servicio) copiar(tmp *os.File, nombre string, contenido io.Reader) (*models.ArchivoLibro, error) {
+	suma := sha256.New()
+	maximo := s.tamanoMaximo()
+	tamano, err := io.Copy(io.MultiWriter(tmp, suma), io.LimitReader(contenido, maximo+1))
+	var errMax *http.MaxBytesError
+	if tamano > maximo || errors.As(err, &errMax) {
+		return nil, fmt.Errorf("%w (%d MB)", models.ErrArchivoDemasiadoGrande, maximo>>20)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cabecera := make([]byte, 512)
+	n, err := tmp.ReadAt(cabecera, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	formato, tipo, err := models.DetectarFormato(cabecera[:n])
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	return &models.ArchivoLibro{
+		Formato:  formato,
+		MIME:     tipo,
+		Tamano:   tamano,
+		SHA256:   hex.EncodeToString(suma.Sum(nil)),
+		Nombre:   filepath.Base(filepath.Clean("/" + nombre)), // Sin directorios del cliente
+		SubidoEn: time.Now().UTC(),
+	}, nil
+}
+
+// registrar guarda en la base de datos el archivo, cuyo contenido ya está en el almacén,
+// y libera el contenido al que reemplaza.
+func (s *Servicio) registrar(archivo *models.ArchivoLibro) (*models.ArchivoLibro, error) {
+	// Si el registro falla, el contenido queda sin usar hasta el próximo "archivos limpiar"
+	anterior, err := s.Libros.GuardarArchivoLibro(archivo)
+	if err != nil {
+		return nil, err
+	}
+	if anterior != "" {
+		s.liberar(anterior)
+	}
+	return archivo, nil
+}
+
+// SubirDesdeFormulario lee el campo "archivo" de un formulario multipart/form-data sin
+// cargarlo entero en memoria y lo sube como en Subir.
+func (s *Servicio) SubirDesdeFormulario(w http.ResponseWriter, r *http.Request, libroID int) (*models.ArchivoLibro, error) {
+	parte, err := s.parteArchivo(w, r)
+	if err != nil {
+		return nil, err
+	}
+	return s.Subir(libroID, parte.FileName(), parte)
+}
+
+// parteArchivo avanza el formulario multipart/form-data hasta el campo "archivo".
+func (s *Servicio) parteArchivo(w http.ResponseWriter, r *http.Request) (*multipart.Part, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, s.tamanoMaximo()+1<<20) // Margen para el resto del formulario
+	lector, err := r.MultipartReader()
+	if err != nil {
+		return nil, models.ErroresValidacion{"archivo": "se esperaba un formulario multipart/form-data"}
+	}
+	for {
+		parte, err := lector.NextPart()
+		if err == io.EOF {
+			return nil, models.ErroresValidacion{"archivo": "falta el archivo"}
+		}
+		var errMax *http.MaxBytesError
+		if errors.As(err, &errMax) {
+			return nil, fmt.Errorf("%w (%d MB)", models.ErrArchivoDemasiadoGrande, s.tamanoMaximo()>>20)
+		}
+		if err != nil {
+			return nil, models.ErroresValidacion{"archivo": "formulario mal formado"}
+		}
+		if parte.FormName() == "archivo" && parte.FileName() != "" {
+			return parte, nil
+		}
+	}
+}
+
+// Eliminar quita el archivo de un libro en un formato y borra su contenido si ningún
+// otro libro lo usa.
+func (s *Servicio) Eliminar(libroID int, formato string) error {
+	archivo, err := s.Libros.ObtenerArchivoLibro(libroID, formato)
+	if err != nil {
+		return err
+	}
+	if err := s.Libros.EliminarArchivoLibro(libroID, formato); err != nil {
+		return err
+	}
+	s.liberar(archivo.SHA256)
+	return nil
+}
+
+// liberar borra un contenido si ya no lo usa ningún libro. Los fallos solo se registran:
+// el contenido que quede lo borrará Limpiar.
+func (s *Servicio) liberar(clave string) {
+	enUso, err := s.Libros.ArchivoEnUso(clave)
+	if err == nil && !enUso {
+		err = s.Contenidos.Eliminar(clave)
+	}
+	if err != nil {
+		log.Printf("Error al liberar el contenido %s: %v", clave, err)
+	}
+}
+
+// Limpiar borra los contenidos que no usa ningún libro, como los de libros eliminados,
+// y devuelve cuántos borró.
+func (s *Servicio) Limpiar() (int, error) {
+	claves, err := s.Contenidos.Claves()
+	if err != nil {
+		return 0, err
+	}
+	borrados := 0
+	for _, clave := range claves {
+		enUso, err := s.Libros.ArchivoEnUso(clave)
+		if err != nil {
+			return borrados, err
+		}
+		if enUso {
+			continue
+		}
+		if err := s.Contenidos.Eliminar(clave); err != nil {
+			return borrados, err
+		}
+		borrados++
+	}
+	return borrados, nil
+}
+
+// PuedeDescargar indica si el usuario puede descargar los archivos de un libro: los
+// administradores siempre, y los demás mientras lo tengan alquilado.
+func (s *Servicio) PuedeDescargar(usuario *models.Usuario, libroID int) (bool, error) {
+	if usuario == nil {
+		return false, nil
+	}
+	if usuario.GetRol() == models.RolAdministrador {
+		return true, nil
+	}
+	return s.Libros.TieneAlquilerActivo(usuario.GetID(), libroID)
+}
+
+// Descargar envía el archivo de un libro en un formato. Admite peticiones con Range,
+// para reanudar descargas o leer un PDF por partes, e If-None-Match con el SHA-256.
+func (s *Servicio) Descargar(w http.ResponseWriter, r *http.Request, libroID int, formato string) error {
+	archivo, err := s.Libros.ObtenerArchivoLibro(libroID, formato)
+	if err != nil {
+		return err
+	}
+	contenido, err := s.Contenidos.Abrir(archivo.SHA256)
+	if err != nil {
+		return fmt.Errorf("abrir contenido %s: %w", archivo.SHA256, err)
+	}
+	defer contenido.Close()
+
+	w.Header().Set("Content-Type", archivo.MIME)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": archivo.Nombre}))
+	w.Header().Set("ETag", `"`+archivo.SHA256+`"`)
+	w.Header().Set("Cache-Control", "private") // Solo para quien tiene acceso
+	http.ServeContent(w, r, archivo.Nombre, archivo.SubidoEn, contenido)
+	return nil
+}
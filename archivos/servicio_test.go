@@ -0,0 +1,263 @@
+package archivos_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"libroselectronicos/archivos"
+	"libroselectronicos/db"
+	"libroselectronicos/models"
+)
+
+// epubMinimo genera un EPUB con la entrada "mimetype" sin comprimir al principio, como
+// exige el formato.
+func epubMinimo(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("application/epub+zip"))
+	w, _ = zw.Create("META-INF/container.xml")
+	w.Write([]byte(`<?xml version="1.0"?><container/>`))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func nuevoServicio(t *testing.T) (*archivos.Servicio, db.LibroAlmacenamiento) {
+	t.Helper()
+	dir := t.TempDir()
+	almacen := db.NewAlmacenForTest(filepath.Join(dir, "libros.db"))
+	if almacen == nil {
+		t.Fatal("No se pudo crear la base de datos de prueba")
+	}
+	t.Cleanup(func() { almacen.Close() })
+	contenidos, err := archivos.NuevoAlmacenLocal(filepath.Join(dir, "archivos"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return archivos.NuevoServicio(contenidos, almacen), almacen
+}
+
+func TestDetectarFormato(t *testing.T) {
+	casos := []struct {
+		nombre    string
+		contenido []byte
+		formato   string
+	}{
+		{"PDF", []byte("%PDF-1.7\n..."), models.FormatoPDF},
+		{"EPUB", epubMinimo(t), models.FormatoEPUB},
+		{"ZIP que no es EPUB", func() []byte {
+			var buf bytes.Buffer
+			zw := zip.NewWriter(&buf)
+			w, _ := zw.Create("leeme.txt")
+			w.Write([]byte("hola"))
+			zw.Close()
+			return buf.Bytes()
+		}(), ""},
+		{"Texto", []byte("no es un libro"), ""},
+		{"Vacío", nil, ""},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			formato, _, err := models.DetectarFormato(c.contenido)
+			if c.formato == "" {
+				if !errors.Is(err, models.ErrFormatoNoSoportado) {
+					t.Errorf("Se esperaba ErrFormatoNoSoportado, se obtuvo %q, %v", formato, err)
+				}
+			} else if formato != c.formato || err != nil {
+				t.Errorf("Se esperaba %q, se obtuvo %q, %v", c.formato, formato, err)
+			}
+		})
+	}
+}
+
+func TestSubirYDescargar(t *testing.T) {
+	servicio, almacen := nuevoServicio(t)
+	libro, _ := almacen.AgregarLibro(models.NuevoLibro(0, "Niebla", "Miguel de Unamuno", 1914))
+	otro, _ := almacen.AgregarLibro(models.NuevoLibro(0, "San Manuel Bueno, mártir", "Miguel de Unamuno", 1931))
+
+	pdf := []byte("%PDF-1.4\n" + strings.Repeat("contenido ", 100))
+	archivo, err := servicio.Subir(libro.ID, "C:\\libros\\niebla.pdf", bytes.NewReader(pdf))
+	if err != nil {
+		t.Fatalf("Error al subir PDF: %v", err)
+	}
+	if archivo.Formato != models.FormatoPDF || archivo.Tamano != int64(len(pdf)) || len(archivo.SHA256) != 64 {
+		t.Errorf("Archivo incorrecto: %+v", archivo)
+	}
+	if _, err := servicio.Subir(libro.ID, "niebla.epub", bytes.NewReader(epubMinimo(t))); err != nil {
+		t.Fatalf("Error al subir EPUB: %v", err)
+	}
+	obtenido, _ := almacen.ObtenerLibro(libro.ID)
+	if len(obtenido.Archivos) != 2 || obtenido.Archivos[0].Formato != models.FormatoEPUB {
+		t.Errorf("Se esperaban los archivos EPUB y PDF: %+v", obtenido.Archivos)
+	}
+
+	if _, err := servicio.Subir(libro.ID, "notas.txt", strings.NewReader("texto")); !errors.Is(err, models.ErrFormatoNoSoportado) {
+		t.Errorf("Se esperaba ErrFormatoNoSoportado, se obtuvo %v", err)
+	}
+	servicio.TamanoMaximo = 100
+	if _, err := servicio.Subir(libro.ID, "grande.pdf", bytes.NewReader(pdf)); !errors.Is(err, models.ErrArchivoDemasiadoGrande) {
+		t.Errorf("Se esperaba ErrArchivoDemasiadoGrande, se obtuvo %v", err)
+	}
+	servicio.TamanoMaximo = 0
+
+	// Descarga parcial con Range
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Range", "bytes=0-7")
+	rr := httptest.NewRecorder()
+	if err := servicio.Descargar(rr, req, libro.ID, models.FormatoPDF); err != nil {
+		t.Fatalf("Error al descargar: %v", err)
+	}
+	if rr.Code != http.StatusPartialContent || rr.Body.String() != "%PDF-1.4" {
+		t.Errorf("Descarga parcial incorrecta: %d %q", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("Content-Type") != "application/pdf" || !strings.Contains(rr.Header().Get("Content-Disposition"), "niebla.pdf") {
+		t.Errorf("Cabeceras incorrectas: %v", rr.Header())
+	}
+
+	// Con el ETag del archivo la respuesta es 304
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("If-None-Match", rr.Header().Get("ETag"))
+	rr = httptest.NewRecorder()
+	servicio.Descargar(rr, req, libro.ID, models.FormatoPDF)
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("Se esperaba 304, se obtuvo %d", rr.Code)
+	}
+
+	// El mismo contenido en otro libro se guarda una vez y no se borra mientras se use
+	if _, err := servicio.Subir(otro.ID, "copia.pdf", bytes.NewReader(pdf)); err != nil {
+		t.Fatalf("Error al subir copia: %v", err)
+	}
+	if err := servicio.Eliminar(libro.ID, models.FormatoPDF); err != nil {
+		t.Fatalf("Error al eliminar archivo: %v", err)
+	}
+	rr = httptest.NewRecorder()
+	if err := servicio.Descargar(rr, httptest.NewRequest("GET", "/", nil), otro.ID, models.FormatoPDF); err != nil || !bytes.Equal(rr.Body.Bytes(), pdf) {
+		t.Errorf("El contenido compartido no debería haberse borrado: %v", err)
+	}
+	if err := servicio.Descargar(httptest.NewRecorder(), req, libro.ID, models.FormatoPDF); !errors.Is(err, models.ErrArchivoNoEncontrado) {
+		t.Errorf("Se esperaba ErrArchivoNoEncontrado, se obtuvo %v", err)
+	}
+
+	// Al eliminar el libro su EPUB queda sin usar hasta que se limpia
+	almacen.EliminarLibro(libro.ID)
+	borrados, err := servicio.Limpiar()
+	if err != nil || borrados != 1 {
+		t.Errorf("Se esperaba borrar 1 archivo, se borraron %d: %v", borrados, err)
+	}
+}
+
+func TestSubirALibroInexistente(t *testing.T) {
+	servicio, _ := nuevoServicio(t)
+	if _, err := servicio.Subir(999, "niebla.pdf", strings.NewReader("%PDF-1.4")); !errors.Is(err, models.ErrLibroNoEncontrado) {
+		t.Fatalf("Se esperaba ErrLibroNoEncontrado, se obtuvo %v", err)
+	}
+	// No debe quedar en el almacén ningún contenido huérfano
+	if borrados, err := servicio.Limpiar(); err != nil || borrados != 0 {
+		t.Errorf("No debería haberse guardado nada, Limpiar borró %d: %v", borrados, err)
+	}
+}
+
+func TestPuedeDescargar(t *testing.T) {
+	servicio, almacen := nuevoServicio(t)
+	libro, _ := almacen.AgregarLibro(models.NuevoLibro(0, "Niebla", "Miguel de Unamuno", 1914))
+	lector := &models.Usuario{Username: "lector", Password: "x", Rol: models.RolLector}
+	if err := almacen.AgregarUsuario(lector); err != nil {
+		t.Fatal(err)
+	}
+	admin := &models.Usuario{ID: 99, Rol: models.RolAdministrador}
+
+	casos := []struct {
+		nombre    string
+		usuario   *models.Usuario
+		alquilado bool
+		esperado  bool
+	}{
+		{"Anónimo", nil, false, false},
+		{"Administrador", admin, false, true},
+		{"Lector sin alquiler", lector, false, false},
+		{"Lector con el libro alquilado", lector, true, true},
+	}
+	for _, c := range casos {
+		if c.alquilado {
+			if _, err := almacen.AlquilarLibro(lector.ID, libro.ID); err != nil {
+				t.Fatal(err)
+			}
+		}
+		permitido, err := servicio.PuedeDescargar(c.usuario, libro.ID)
+		if err != nil || permitido != c.esperado {
+			t.Errorf("%s: se esperaba %v, se obtuvo %v (%v)", c.nombre, c.esperado, permitido, err)
+		}
+	}
+
+	// Tras devolverlo ya no puede descargarlo
+	almacen.DevolverLibro(lector.ID, libro.ID)
+	if permitido, _ := servicio.PuedeDescargar(lector, libro.ID); permitido {
+		t.Error("Un libro devuelto no debería poder descargarse")
+	}
+}
+
+func TestPrepararDesdeEPUB(t *testing.T) {
+	servicio, almacen := nuevoServicio(t)
+	datos, err := os.ReadFile("../epub/testdata/epub3.epub")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	borrador, portada, err := servicio.PrepararDesdeEPUB("soledad.epub", bytes.NewReader(datos))
+	if err != nil {
+		t.Fatalf("Error al preparar el libro: %v", err)
+	}
+	if borrador.Titulo != "One Hundred Years of Solitude" || borrador.Autor != "Gabriel García Márquez" ||
+		borrador.Anio != 2006 || borrador.ISBN != "9780060883287" || borrador.Idioma != "en-US" {
+		t.Errorf("Libro mal rellenado: %+v", borrador)
+	}
+	if portada == nil || portada.MIME != "image/png" {
+		t.Errorf("Se esperaba la portada PNG del EPUB: %+v", portada)
+	}
+	if len(borrador.Autores) != 2 || borrador.Autores[1].Rol != models.RolTraductor {
+		t.Errorf("Se esperaba el traductor en los créditos: %+v", borrador.Autores)
+	}
+	datos2, err := os.ReadFile("../epub/testdata/epub2.epub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if otro, _, err := servicio.PrepararDesdeEPUB("cien.epub", bytes.NewReader(datos2)); err != nil || otro.Idioma != "es" || otro.Editorial != "Editorial Sudamericana" {
+		t.Errorf("Se esperaban el idioma y la editorial del EPUB 2: %+v, %v", otro, err)
+	}
+	if _, _, err := servicio.PrepararDesdeEPUB("libro.pdf", strings.NewReader("%PDF-1.4")); !errors.Is(err, models.ErrFormatoNoSoportado) {
+		t.Errorf("Se esperaba ErrFormatoNoSoportado con un PDF, se obtuvo %v", err)
+	}
+
+	// Una vez creado el libro, se le adjunta el EPUB ya guardado
+	creado, err := almacen.AgregarLibro(borrador)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if guardado, err := almacen.ObtenerLibro(creado.ID); err != nil || guardado.Idioma != "en-US" {
+		t.Errorf("El idioma del EPUB no se guardó con el libro: %+v, %v", guardado, err)
+	}
+	epub := borrador.Archivos[0]
+	if _, err := servicio.Adjuntar(creado.ID, epub.SHA256, epub.Nombre); err != nil {
+		t.Fatalf("Error al adjuntar el EPUB: %v", err)
+	}
+	archivo, err := almacen.ObtenerArchivoLibro(creado.ID, models.FormatoEPUB)
+	if err != nil || archivo.Tamano != int64(len(datos)) || archivo.Nombre != "soledad.epub" {
+		t.Errorf("Archivo adjuntado incorrecto: %+v, %v", archivo, err)
+	}
+	if _, err := servicio.Adjuntar(creado.ID, "../../libros.db", "x"); !errors.Is(err, models.ErrArchivoNoEncontrado) {
+		t.Errorf("Se esperaba ErrArchivoNoEncontrado con una clave inválida, se obtuvo %v", err)
+	}
+}
@@ -0,0 +1,156 @@
+// Package bloqueos protege el inicio de sesión con contraseña frente a ataques de fuerza
+// bruta: cuenta los fallos seguidos de cada usuario y de cada IP en la base de datos, los
+// bloquea temporalmente cuando superan los permitidos, con una espera que se dobla en
+// cada nuevo fallo, y anota los intentos fallidos en un registro de auditoría.
+package bloqueos
+
+import (
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"libroselectronicos/db"
+	"libroselectronicos/models"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Servicio comprueba usuario y contraseña aplicando las políticas de bloqueo.
+type Servicio struct {
+	Almacen db.LibroAlmacenamiento
+	Usuario models.PoliticaBloqueo
+	IP      models.PoliticaBloqueo
+	Ahora   func() time.Time
+}
+
+func NuevoServicio(almacen db.LibroAlmacenamiento) *Servicio {
+	return &Servicio{
+		Almacen: almacen,
+		Usuario: models.PoliticaBloqueoUsuario,
+		IP:      models.PoliticaBloqueoIP,
+		Ahora:   time.Now,
+	}
+}
+
+// Autenticar devuelve el usuario si la contraseña es la suya. Si el usuario o la IP de
+// la petición están bloqueados, devuelve un *models.ErrorBloqueo sin comprobar la
+// contraseña; si no existe o la contraseña no coincide, ErrCredencialesInvalidas. Los
+// fallos se registran y cuentan para el bloqueo; un acierto pone a cero los del usuario.
+// Con la contraseña correcta pero el correo sin verificar, devuelve ErrEmailNoVerificado:
+// solo entonces, para no revelar qué cuentas están sin verificar.
+func (s *Servicio) Autenticar(r *http.Request, username, password string) (*models.Usuario, error) {
+	ip := IPCliente(r)
+	if restante, err := s.restante(username, ip); err != nil {
+		return nil, err
+	} else if restante > 0 {
+		s.registrarIntento(r, username, ip, models.MotivoBloqueado)
+		return nil, &models.ErrorBloqueo{Restante: restante}
+	}
+
+	usuario, err := s.Almacen.ObtenerUsuarioPorUsername(username)
+	if errors.Is(err, models.ErrUsuarioNoEncontrado) {
+		return nil, s.registrarFallo(r, username, ip, models.MotivoUsuarioInexistente)
+	} else if err != nil {
+		return nil, err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(usuario.Password), []byte(password)) != nil {
+		return nil, s.registrarFallo(r, username, ip, models.MotivoContrasenaIncorrecta)
+	}
+
+	// Los fallos de la IP no se borran: iniciar sesión en una cuenta propia no debe
+	// permitir seguir probando contraseñas de otras
+	if err := s.Almacen.ReiniciarBloqueoLogin(models.BloqueoPorUsuario, ClaveUsuario(username)); err != nil {
+		log.Printf("Error al reiniciar los fallos de inicio de sesión de %s: %v", username, err)
+	}
+	if !usuario.EmailVerificado() {
+		return nil, models.ErrEmailNoVerificado
+	}
+	return usuario, nil
+}
+
+// restante devuelve cuánto falta para que el usuario y la IP puedan volver a intentarlo.
+func (s *Servicio) restante(username, ip string) (time.Duration, error) {
+	var restante time.Duration
+	for _, b := range []struct{ tipo, clave string }{
+		{models.BloqueoPorUsuario, ClaveUsuario(username)},
+		{models.BloqueoPorIP, ip},
+	} {
+		bloqueo, err := s.Almacen.ObtenerBloqueoLogin(b.tipo, b.clave)
+		if errors.Is(err, models.ErrBloqueoNoEncontrado) {
+			continue
+		} else if err != nil {
+			return 0, err
+		}
+		restante = max(restante, bloqueo.Restante(s.Ahora()))
+	}
+	return restante, nil
+}
+
+// registrarFallo anota el fallo, lo suma al usuario y a la IP y devuelve el error para
+// el llamador: ErrCredencialesInvalidas, o un *models.ErrorBloqueo si este fallo bloquea.
+func (s *Servicio) registrarFallo(r *http.Request, username, ip, motivo string) error {
+	s.registrarIntento(r, username, ip, motivo)
+
+	var restante time.Duration
+	for _, b := range []struct {
+		tipo, clave string
+		politica    models.PoliticaBloqueo
+	}{
+		{models.BloqueoPorUsuario, ClaveUsuario(username), s.Usuario},
+		{models.BloqueoPorIP, ip, s.IP},
+	} {
+		bloqueo, err := s.Almacen.RegistrarFalloLogin(b.tipo, b.clave, b.politica, s.Ahora())
+		if err != nil {
+			log.Printf("Error al registrar el fallo de inicio de sesión de %s %s: %v", b.tipo, b.clave, err)
+			continue
+		}
+		if espera := bloqueo.Restante(s.Ahora()); espera > 0 {
+			log.Printf("AUDITORÍA: %s %s bloqueado durante %s tras %d fallos seguidos", b.tipo, b.clave, espera.Round(time.Second), bloqueo.Fallos)
+			restante = max(restante, espera)
+		}
+	}
+	if restante > 0 {
+		return &models.ErrorBloqueo{Restante: restante}
+	}
+	return models.ErrCredencialesInvalidas
+}
+
+// registrarIntento guarda el intento fallido en el registro de auditoría y en el log.
+func (s *Servicio) registrarIntento(r *http.Request, username, ip, motivo string) {
+	log.Printf("AUDITORÍA: inicio de sesión fallido de %q desde %s: %s", username, ip, motivo)
+	intento := &models.IntentoLogin{Username: username, IP: ip, UserAgent: r.UserAgent(), Motivo: motivo, Fecha: s.Ahora()}
+	if err := s.Almacen.RegistrarIntentoLogin(intento); err != nil {
+		log.Printf("Error al registrar el intento de inicio de sesión: %v", err)
+	}
+}
+
+// Limpiar borra los fallos que ya no cuentan para ningún bloqueo y los intentos más
+// antiguos que models.RetencionIntentosLogin.
+func (s *Servicio) Limpiar() error {
+	ahora := s.Ahora()
+	if _, err := s.Almacen.LimpiarBloqueosLogin(ahora.Add(-max(s.Usuario.Olvido, s.IP.Olvido))); err != nil {
+		return err
+	}
+	_, err := s.Almacen.LimpiarIntentosLogin(ahora.Add(-models.RetencionIntentosLogin))
+	return err
+}
+
+// IPCliente devuelve la dirección IP desde la que llega la petición. Detrás de un proxy
+// inverso es la del proxy, así que todos los clientes comparten el bloqueo por IP.
+func IPCliente(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ClaveUsuario es la clave del bloqueo de un usuario: sin distinguir mayúsculas, para
+// que no se pueda esquivar escribiendo el nombre de otra forma. Quien reinicie el
+// bloqueo de un usuario fuera de este paquete debe usarla para dar con el mismo.
+func ClaveUsuario(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
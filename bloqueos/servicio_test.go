@@ -0,0 +1,161 @@
+package bloqueos_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"libroselectronicos/bloqueos"
+	"libroselectronicos/db"
+	"libroselectronicos/models"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func nuevoServicio(t *testing.T) (*bloqueos.Servicio, db.LibroAlmacenamiento, *time.Time) {
+	t.Helper()
+	almacen := db.NewAlmacenForTest(filepath.Join(t.TempDir(), "libros.db"))
+	if almacen == nil {
+		t.Fatalf("No se pudo inicializar el almacén de prueba")
+	}
+	t.Cleanup(func() { almacen.Close() })
+
+	ahora := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secreto"), bcrypt.MinCost)
+	ana := models.NuevoUsuario(0, "ana", string(hash), "ana@example.com", models.RolLector)
+	ana.EmailVerificadoEn = &ahora
+	if err := almacen.AgregarUsuario(ana); err != nil {
+		t.Fatalf("Error al agregar usuario: %v", err)
+	}
+
+	servicio := bloqueos.NuevoServicio(almacen)
+	servicio.Ahora = func() time.Time { return ahora }
+	return servicio, almacen, &ahora
+}
+
+// intentar inicia sesión desde 'ip'.
+func intentar(servicio *bloqueos.Servicio, ip, username, password string) error {
+	req := httptest.NewRequest("POST", "/login", nil)
+	req.RemoteAddr = ip + ":51000"
+	_, err := servicio.Autenticar(req, username, password)
+	return err
+}
+
+func TestBloqueoPorUsuario(t *testing.T) {
+	servicio, almacen, ahora := nuevoServicio(t)
+
+	if err := intentar(servicio, "10.0.0.1", "ana", "secreto"); err != nil {
+		t.Fatalf("La contraseña correcta debería aceptarse: %v", err)
+	}
+	if err := intentar(servicio, "10.0.0.1", "nadie", "secreto"); !errors.Is(err, models.ErrCredencialesInvalidas) {
+		t.Errorf("Un usuario inexistente debería dar ErrCredencialesInvalidas, obtenido: %v", err)
+	}
+
+	// Los fallos cuentan sin distinguir mayúsculas
+	for i := 1; i <= models.PoliticaBloqueoUsuario.FallosPermitidos; i++ {
+		username := "ana"
+		if i%2 == 0 {
+			username = "ANA"
+		}
+		if err := intentar(servicio, "10.0.0.1", username, "incorrecta"); !errors.Is(err, models.ErrCredencialesInvalidas) {
+			t.Fatalf("Fallo %d: se esperaba ErrCredencialesInvalidas, obtenido: %v", i, err)
+		}
+	}
+	err := intentar(servicio, "10.0.0.1", "ana", "incorrecta")
+	var bloqueo *models.ErrorBloqueo
+	if !errors.As(err, &bloqueo) || bloqueo.Restante != time.Minute {
+		t.Fatalf("Se esperaba un bloqueo de 1 minuto, obtenido: %v", err)
+	}
+
+	// Bloqueado, ni la contraseña correcta vale, ni desde otra IP
+	if err := intentar(servicio, "10.0.0.2", "ana", "secreto"); !errors.Is(err, models.ErrDemasiadosIntentos) {
+		t.Errorf("Un usuario bloqueado no debería poder iniciar sesión, obtenido: %v", err)
+	}
+
+	// Cada fallo tras el bloqueo lo dobla
+	*ahora = ahora.Add(time.Minute)
+	if err := intentar(servicio, "10.0.0.1", "ana", "incorrecta"); !errors.As(err, &bloqueo) || bloqueo.Restante != 2*time.Minute {
+		t.Fatalf("Se esperaba un bloqueo de 2 minutos, obtenido: %v", err)
+	}
+
+	// Al acabar el bloqueo, acertar pone a cero los fallos del usuario
+	*ahora = ahora.Add(2 * time.Minute)
+	if err := intentar(servicio, "10.0.0.1", "ana", "secreto"); err != nil {
+		t.Fatalf("La contraseña correcta debería aceptarse al acabar el bloqueo: %v", err)
+	}
+	if _, err := almacen.ObtenerBloqueoLogin(models.BloqueoPorUsuario, "ana"); !errors.Is(err, models.ErrBloqueoNoEncontrado) {
+		t.Errorf("Los fallos del usuario deberían haberse borrado, obtenido: %v", err)
+	}
+	ip, err := almacen.ObtenerBloqueoLogin(models.BloqueoPorIP, "10.0.0.1")
+	if err != nil || ip.GetFallos() != 8 {
+		t.Errorf("Los fallos de la IP deberían conservarse: %+v, %v", ip, err)
+	}
+
+	// Todos los fallos, también los rechazados por el bloqueo, quedan en el registro
+	intentos, err := almacen.ListarIntentosLogin(100)
+	if err != nil {
+		t.Fatalf("Error al listar intentos: %v", err)
+	}
+	if len(intentos) != 9 || intentos[0].Motivo != models.MotivoContrasenaIncorrecta || intentos[0].IP != "10.0.0.1" {
+		t.Errorf("Registro de intentos incorrecto: %d intentos, el último %+v", len(intentos), intentos[0])
+	}
+	motivos := map[string]int{}
+	for _, intento := range intentos {
+		motivos[intento.Motivo]++
+	}
+	// Los nombres de usuario distinguen mayúsculas: "ANA" no existe, aunque sus fallos cuenten para "ana"
+	if motivos[models.MotivoUsuarioInexistente] != 3 || motivos[models.MotivoBloqueado] != 1 {
+		t.Errorf("Motivos registrados incorrectos: %v", motivos)
+	}
+}
+
+func TestBloqueoPorIP(t *testing.T) {
+	servicio, almacen, ahora := nuevoServicio(t)
+
+	// Probar una contraseña en muchas cuentas desde la misma IP acaba bloqueando la IP
+	for i := 1; i <= models.PoliticaBloqueoIP.FallosPermitidos; i++ {
+		if err := intentar(servicio, "10.0.0.9", fmt.Sprintf("usuario%d", i), "123456"); !errors.Is(err, models.ErrCredencialesInvalidas) {
+			t.Fatalf("Fallo %d: se esperaba ErrCredencialesInvalidas, obtenido: %v", i, err)
+		}
+	}
+	if err := intentar(servicio, "10.0.0.9", "otro", "123456"); !errors.Is(err, models.ErrDemasiadosIntentos) {
+		t.Fatalf("Se esperaba el bloqueo de la IP, obtenido: %v", err)
+	}
+	if err := intentar(servicio, "10.0.0.9", "ana", "secreto"); !errors.Is(err, models.ErrDemasiadosIntentos) {
+		t.Errorf("Desde una IP bloqueada no debería poder iniciarse sesión, obtenido: %v", err)
+	}
+	if err := intentar(servicio, "10.0.0.10", "ana", "secreto"); err != nil {
+		t.Errorf("Desde otra IP debería poder iniciarse sesión: %v", err)
+	}
+
+	// Un administrador puede desbloquearla
+	bloqueos, err := almacen.ListarBloqueosLogin()
+	if err != nil {
+		t.Fatalf("Error al listar bloqueos: %v", err)
+	}
+	for _, b := range bloqueos {
+		if b.GetTipo() == models.BloqueoPorIP {
+			if err := almacen.EliminarBloqueoLogin(b.GetID()); err != nil {
+				t.Fatalf("Error al eliminar bloqueo: %v", err)
+			}
+		}
+	}
+	if err := intentar(servicio, "10.0.0.9", "ana", "secreto"); err != nil {
+		t.Errorf("La IP desbloqueada debería poder iniciar sesión: %v", err)
+	}
+
+	// Pasado el tiempo de olvido, la limpieza borra los fallos y el registro los conserva
+	*ahora = ahora.Add(models.PoliticaBloqueoIP.Olvido + time.Minute)
+	if err := servicio.Limpiar(); err != nil {
+		t.Fatalf("Error al limpiar: %v", err)
+	}
+	if bloqueos, _ := almacen.ListarBloqueosLogin(); len(bloqueos) != 0 {
+		t.Errorf("No deberían quedar fallos tras la limpieza: %d", len(bloqueos))
+	}
+	if intentos, _ := almacen.ListarIntentosLogin(100); len(intentos) != models.PoliticaBloqueoIP.FallosPermitidos+2 {
+		t.Errorf("Los intentos deberían conservarse hasta su retención, quedan %d", len(intentos))
+	}
+}
@@ -0,0 +1,108 @@
+// Package caratulas guarda en el servidor las carátulas de los libros, subidas o
+// descargadas de una URL, y las sirve en los tamaños que usan las páginas.
+package caratulas
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif" // Registra el decodificador
+	"image/jpeg"
+	_ "image/png" // Registra el decodificador
+	"math"
+
+	"libroselectronicos/models"
+)
+
+// Tamano es una caja en la que se encaja la carátula conservando su proporción.
+type Tamano struct {
+	Nombre string
+	Ancho  int
+	Alto   int
+}
+
+// Tamanos son los tamaños que se generan de cada carátula.
+var Tamanos = []Tamano{
+	{models.CaratulaMiniatura, 160, 240},
+	{models.CaratulaDetalle, 480, 720},
+}
+
+// pixelesMaximos limita las dimensiones de la imagen antes de decodificarla, para que
+// un archivo pequeño no reserve gigabytes de memoria.
+const pixelesMaximos = 25_000_000
+
+const calidadJPEG = 85
+
+// decodificar lee una imagen JPEG, PNG o GIF y la aplana sobre fondo blanco, ya que
+// las miniaturas se guardan en JPEG, que no tiene transparencia.
+func decodificar(datos []byte) (*image.RGBA, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(datos))
+	if err != nil {
+		return nil, models.ErrImagenInvalida
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, models.ErrImagenInvalida
+	}
+	if config.Width*config.Height > pixelesMaximos {
+		return nil, fmt.Errorf("%w: %dx%d píxeles", models.ErrImagenDemasiadoGrande, config.Width, config.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(datos))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", models.ErrImagenInvalida, err)
+	}
+	limites := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, limites.Dx(), limites.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(rgba, rgba.Bounds(), img, limites.Min, draw.Over)
+	return rgba, nil
+}
+
+// escalar reduce 'src' para que quepa en el tamaño, conservando la proporción. Cada
+// píxel de destino es la media de los píxeles de origen que cubre, lo que evita el
+// aliasing al reducir mucho. Las imágenes que ya caben no se amplían.
+func escalar(src *image.RGBA, t Tamano) *image.RGBA {
+	ancho, alto := src.Bounds().Dx(), src.Bounds().Dy()
+	escala := math.Min(float64(t.Ancho)/float64(ancho), float64(t.Alto)/float64(alto))
+	if escala >= 1 {
+		return src
+	}
+	dAncho := max(1, int(math.Round(float64(ancho)*escala)))
+	dAlto := max(1, int(math.Round(float64(alto)*escala)))
+
+	dst := image.NewRGBA(image.Rect(0, 0, dAncho, dAlto))
+	for y := 0; y < dAlto; y++ {
+		y0 := y * alto / dAlto
+		y1 := max(y0+1, (y+1)*alto/dAlto)
+		for x := 0; x < dAncho; x++ {
+			x0 := x * ancho / dAncho
+			x1 := max(x0+1, (x+1)*ancho/dAncho)
+
+			var suma [4]int
+			for sy := y0; sy < y1; sy++ {
+				i := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					for c := 0; c < 4; c++ {
+						suma[c] += int(src.Pix[i+c])
+					}
+					i += 4
+				}
+			}
+			n := (y1 - y0) * (x1 - x0)
+			j := dst.PixOffset(x, y)
+			for c := 0; c < 4; c++ {
+				dst.Pix[j+c] = uint8(suma[c] / n)
+			}
+		}
+	}
+	return dst
+}
+
+func codificarJPEG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: calidadJPEG}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,235 @@
+package caratulas
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"syscall"
+	"time"
+
+	"libroselectronicos/archivos"
+	"libroselectronicos/db"
+	"libroselectronicos/models"
+)
+
+// Servicio guarda y sirve las carátulas. Cada carátula se guarda con el SHA-256 de la
+// imagen original como clave, que forma parte de su URL, así que una URL siempre
+// devuelve la misma imagen y se puede cachear sin límite.
+type Servicio struct {
+	Imagenes archivos.Almacen
+	Libros   db.LibroAlmacenamiento
+	Cliente  *http.Client // Para descargar carátulas de una URL
+}
+
+func NuevoServicio(imagenes archivos.Almacen, libros db.LibroAlmacenamiento) *Servicio {
+	return &Servicio{Imagenes: imagenes, Libros: libros, Cliente: nuevoCliente()}
+}
+
+// Guardar lee una imagen JPEG, PNG o GIF, guarda el original y sus tamaños en JPEG y
+// devuelve la CaratulaURL local. Devuelve ErrImagenInvalida o ErrImagenDemasiadoGrande.
+func (s *Servicio) Guardar(contenido io.Reader) (string, error) {
+	datos, err := io.ReadAll(io.LimitReader(contenido, models.TamanoMaximoCaratula+1))
+	if err != nil {
+		return "", err
+	}
+	if len(datos) > models.TamanoMaximoCaratula {
+		return "", fmt.Errorf("%w (%d MB)", models.ErrImagenDemasiadoGrande, models.TamanoMaximoCaratula>>20)
+	}
+	img, err := decodificar(datos)
+	if err != nil {
+		return "", err
+	}
+
+	suma := sha256.Sum256(datos)
+	clave := hex.EncodeToString(suma[:])
+	// El original se conserva para poder generar otros tamaños más adelante
+	if err := s.Imagenes.Guardar(clave, bytes.NewReader(datos)); err != nil {
+		return "", err
+	}
+	for _, t := range Tamanos {
+		jpg, err := codificarJPEG(escalar(img, t))
+		if err != nil {
+			return "", err
+		}
+		if err := s.Imagenes.Guardar(claveTamano(clave, t.Nombre), bytes.NewReader(jpg)); err != nil {
+			return "", err
+		}
+	}
+	return models.URLCaratula(clave), nil
+}
+
+// Descargar trae la imagen de una URL externa y la guarda como en Guardar. Devuelve
+// ErrDescargaCaratula si la URL no responde con una imagen.
+func (s *Servicio) Descargar(url string) (string, error) {
+	if !models.EsCaratulaExterna(url) {
+		return "", fmt.Errorf("%w: %q no es una URL http(s)", models.ErrDescargaCaratula, url)
+	}
+	resp, err := s.Cliente.Get(url)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", models.ErrDescargaCaratula, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: %s respondió %s", models.ErrDescargaCaratula, url, resp.Status)
+	}
+	return s.Guardar(resp.Body)
+}
+
+// Servir envía una carátula local en uno de los Tamanos. Devuelve ErrCaratulaNoEncontrada
+// si no existe.
+func (s *Servicio) Servir(w http.ResponseWriter, r *http.Request, clave, tamano string) error {
+	if !esTamano(tamano) {
+		return models.ErrCaratulaNoEncontrada
+	}
+	imagen, err := s.Imagenes.Abrir(claveTamano(clave, tamano))
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, archivos.ErrClaveInvalida) {
+		return models.ErrCaratulaNoEncontrada
+	}
+	if err != nil {
+		return err
+	}
+	defer imagen.Close()
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("ETag", `"`+clave+"-"+tamano+`"`)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	http.ServeContent(w, r, "", time.Time{}, imagen)
+	return nil
+}
+
+// Localizar descarga las carátulas externas de todos los libros y las sustituye por
+// las locales. Las que no se pueden descargar se registran y se dejan como estaban.
+// Devuelve cuántas se sustituyeron.
+func (s *Servicio) Localizar() (int, error) {
+	libros, err := s.Libros.LibrosConCaratulaExterna()
+	if err != nil {
+		return 0, err
+	}
+	sustituidas := 0
+	for _, libro := range libros {
+		url, err := s.Descargar(libro.CaratulaURL)
+		if err != nil {
+			log.Printf("No se pudo descargar la carátula del libro %d (%s): %v", libro.ID, libro.CaratulaURL, err)
+			continue
+		}
+		if err := s.Libros.ActualizarLibro(libro.ID, models.LibroPatch{CaratulaURL: &url}); err != nil {
+			return sustituidas, err
+		}
+		sustituidas++
+	}
+	return sustituidas, nil
+}
+
+// Limpiar borra las carátulas, con todos sus tamaños, que no usa ningún libro, y
+// devuelve cuántas borró.
+func (s *Servicio) Limpiar() (int, error) {
+	claves, err := s.Imagenes.Claves()
+	if err != nil {
+		return 0, err
+	}
+	borradas := 0
+	for _, clave := range claves {
+		if strings.Contains(clave, "-") {
+			continue // Los tamaños se borran con su original
+		}
+		enUso, err := s.Libros.CaratulaEnUso(clave)
+		if err != nil {
+			return borradas, err
+		}
+		if enUso {
+			continue
+		}
+		for _, t := range Tamanos {
+			if err := s.Imagenes.Eliminar(claveTamano(clave, t.Nombre)); err != nil {
+				return borradas, err
+			}
+		}
+		if err := s.Imagenes.Eliminar(clave); err != nil {
+			return borradas, err
+		}
+		borradas++
+	}
+	return borradas, nil
+}
+
+func claveTamano(clave, tamano string) string {
+	return clave + "-" + tamano
+}
+
+func esTamano(nombre string) bool {
+	for _, t := range Tamanos {
+		if t.Nombre == nombre {
+			return true
+		}
+	}
+	return false
+}
+
+// nuevoCliente devuelve un cliente HTTP con tiempos límite que solo se conecta a
+// direcciones públicas, para que una URL de carátula no sirva para llegar a servicios
+// internos. La comprobación se hace al conectar, también tras las redirecciones.
+func nuevoCliente() *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, Control: soloDireccionesPublicas}
+	return &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 10 * time.Second,
+		},
+	}
+}
+
+// redesNoPublicas son los rangos reservados que IsGlobalUnicast e IsPrivate no excluyen
+// pero que tampoco llevan a Internet (RFC 6890 y registro de IANA de direcciones de
+// propósito especial).
+var redesNoPublicas = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "Esta red"
+	netip.MustParsePrefix("100.64.0.0/10"),   // NAT de operador (CGNAT)
+	netip.MustParsePrefix("192.0.0.0/24"),    // Asignaciones de protocolo de la IETF
+	netip.MustParsePrefix("192.0.2.0/24"),    // Documentación (TEST-NET-1)
+	netip.MustParsePrefix("198.18.0.0/15"),   // Pruebas de rendimiento
+	netip.MustParsePrefix("198.51.100.0/24"), // Documentación (TEST-NET-2)
+	netip.MustParsePrefix("203.0.113.0/24"),  // Documentación (TEST-NET-3)
+	netip.MustParsePrefix("240.0.0.0/4"),     // Reservadas, incluida la de difusión
+	netip.MustParsePrefix("64:ff9b::/96"),    // NAT64: lleva a una IPv4 cualquiera
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // NAT64 local
+	netip.MustParsePrefix("100::/64"),        // Descarte
+	netip.MustParsePrefix("2001::/23"),       // Asignaciones de protocolo de la IETF, incluido Teredo
+	netip.MustParsePrefix("2001:db8::/32"),   // Documentación
+	netip.MustParsePrefix("2002::/16"),       // 6to4: lleva a una IPv4 cualquiera
+	netip.MustParsePrefix("fec0::/10"),       // Locales de sitio (obsoletas)
+}
+
+func soloDireccionesPublicas(_, direccion string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(direccion)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil || !esDireccionPublica(ip.Unmap()) {
+		return fmt.Errorf("dirección %s no permitida", host)
+	}
+	return nil
+}
+
+func esDireccionPublica(ip netip.Addr) bool {
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+	for _, red := range redesNoPublicas {
+		if red.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
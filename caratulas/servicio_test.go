@@ -0,0 +1,279 @@
+package caratulas
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"libroselectronicos/archivos"
+	"libroselectronicos/db"
+	"libroselectronicos/models"
+)
+
+func nuevoServicio(t *testing.T) (*Servicio, db.LibroAlmacenamiento) {
+	t.Helper()
+	dir := t.TempDir()
+	almacen := db.NewAlmacenForTest(filepath.Join(dir, "libros.db"))
+	if almacen == nil {
+		t.Fatal("No se pudo crear la base de datos de prueba")
+	}
+	t.Cleanup(func() { almacen.Close() })
+	imagenes, err := archivos.NuevoAlmacenLocal(filepath.Join(dir, "caratulas"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NuevoServicio(imagenes, almacen), almacen
+}
+
+func imagenPNG(t *testing.T, ancho, alto int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, ancho, alto))
+	for y := 0; y < alto; y++ {
+		for x := 0; x < ancho; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 200, 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// pngGigante devuelve un PNG válido cuya cabecera declara 'lado'x'lado' píxeles, para
+// comprobar que se rechaza sin decodificarlo.
+func pngGigante(t *testing.T, lado uint32) []byte {
+	datos := imagenPNG(t, 1, 1)
+	ihdr := datos[8+8 : 8+8+13] // Tras la firma y la longitud y el tipo del fragmento
+	binary.BigEndian.PutUint32(ihdr[0:4], lado)
+	binary.BigEndian.PutUint32(ihdr[4:8], lado)
+	binary.BigEndian.PutUint32(datos[8+8+13:], crc32.ChecksumIEEE(datos[12:8+8+13]))
+	return datos
+}
+
+func servir(s *Servicio, url string, cabeceras map[string]string) *httptest.ResponseRecorder {
+	partes := strings.Split(strings.TrimPrefix(url, models.RutaCaratulas), "/")
+	req := httptest.NewRequest("GET", url, nil)
+	for k, v := range cabeceras {
+		req.Header.Set(k, v)
+	}
+	rr := httptest.NewRecorder()
+	if err := s.Servir(rr, req, partes[0], partes[1]); err != nil {
+		rr.Code = http.StatusNotFound
+	}
+	return rr
+}
+
+func TestGuardarYServir(t *testing.T) {
+	servicio, _ := nuevoServicio(t)
+
+	url, err := servicio.Guardar(bytes.NewReader(imagenPNG(t, 600, 900)))
+	if err != nil {
+		t.Fatalf("Error al guardar la carátula: %v", err)
+	}
+	clave := models.ClaveCaratula(url)
+	if len(clave) != 64 || url != models.URLCaratula(clave) {
+		t.Fatalf("URL de carátula inesperada: %q", url)
+	}
+
+	casos := []struct {
+		tamano      string
+		ancho, alto int
+	}{
+		{models.CaratulaMiniatura, 160, 240},
+		{models.CaratulaDetalle, 480, 720},
+	}
+	for _, c := range casos {
+		rr := servir(servicio, models.RutaCaratulas+clave+"/"+c.tamano, nil)
+		if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "image/jpeg" {
+			t.Fatalf("%s: respuesta inesperada %d %v", c.tamano, rr.Code, rr.Header())
+		}
+		if !strings.Contains(rr.Header().Get("Cache-Control"), "immutable") || rr.Header().Get("ETag") == "" {
+			t.Errorf("%s: faltan las cabeceras de caché: %v", c.tamano, rr.Header())
+		}
+		img, err := jpeg.Decode(rr.Body)
+		if err != nil {
+			t.Fatalf("%s: no es un JPEG: %v", c.tamano, err)
+		}
+		if b := img.Bounds(); b.Dx() != c.ancho || b.Dy() != c.alto {
+			t.Errorf("%s: se esperaba %dx%d, se obtuvo %dx%d", c.tamano, c.ancho, c.alto, b.Dx(), b.Dy())
+		}
+
+		etag := rr.Header().Get("ETag")
+		if rr := servir(servicio, models.RutaCaratulas+clave+"/"+c.tamano, map[string]string{"If-None-Match": etag}); rr.Code != http.StatusNotModified {
+			t.Errorf("%s: se esperaba 304 con el ETag, se obtuvo %d", c.tamano, rr.Code)
+		}
+	}
+
+	if err := servicio.Servir(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), clave, "original"); !errors.Is(err, models.ErrCaratulaNoEncontrada) {
+		t.Errorf("Se esperaba ErrCaratulaNoEncontrada con un tamaño desconocido, se obtuvo %v", err)
+	}
+	if err := servicio.Servir(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), strings.Repeat("0", 64), models.CaratulaDetalle); !errors.Is(err, models.ErrCaratulaNoEncontrada) {
+		t.Errorf("Se esperaba ErrCaratulaNoEncontrada con una clave desconocida, se obtuvo %v", err)
+	}
+}
+
+func TestGuardarInvalida(t *testing.T) {
+	servicio, _ := nuevoServicio(t)
+
+	if _, err := servicio.Guardar(strings.NewReader("<html>no es una imagen</html>")); !errors.Is(err, models.ErrImagenInvalida) {
+		t.Errorf("Se esperaba ErrImagenInvalida, se obtuvo %v", err)
+	}
+	if _, err := servicio.Guardar(bytes.NewReader(pngGigante(t, 20000))); !errors.Is(err, models.ErrImagenDemasiadoGrande) {
+		t.Errorf("Se esperaba ErrImagenDemasiadoGrande por las dimensiones, se obtuvo %v", err)
+	}
+	if _, err := servicio.Guardar(bytes.NewReader(make([]byte, models.TamanoMaximoCaratula+1))); !errors.Is(err, models.ErrImagenDemasiadoGrande) {
+		t.Errorf("Se esperaba ErrImagenDemasiadoGrande por el tamaño, se obtuvo %v", err)
+	}
+}
+
+func TestEscalar(t *testing.T) {
+	// Una imagen que ya cabe no se amplía
+	pequena := image.NewRGBA(image.Rect(0, 0, 100, 50))
+	if escalar(pequena, Tamano{"x", 160, 240}) != pequena {
+		t.Error("No se debería ampliar una imagen que ya cabe")
+	}
+
+	// Franjas verticales blancas y negras de un píxel se reducen a gris
+	rayas := image.NewRGBA(image.Rect(0, 0, 400, 400))
+	for y := 0; y < 400; y++ {
+		for x := 0; x < 400; x++ {
+			if x%2 == 0 {
+				rayas.Set(x, y, color.White)
+			} else {
+				rayas.Set(x, y, color.Black)
+			}
+		}
+	}
+	reducida := escalar(rayas, Tamano{"x", 100, 200})
+	if b := reducida.Bounds(); b.Dx() != 100 || b.Dy() != 100 {
+		t.Fatalf("Se esperaba 100x100, se obtuvo %dx%d", b.Dx(), b.Dy())
+	}
+	if gris := reducida.RGBAAt(50, 50).R; gris < 120 || gris > 135 {
+		t.Errorf("Se esperaba un gris medio, se obtuvo %d", gris)
+	}
+}
+
+func TestDescargar(t *testing.T) {
+	servicio, almacen := nuevoServicio(t)
+	portada := imagenPNG(t, 50, 75)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/portada.png":
+			w.Write(portada)
+		case "/pagina.html":
+			w.Write([]byte("<html></html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	// El cliente por defecto no se conecta a direcciones locales como la del servidor de prueba
+	if _, err := servicio.Descargar(srv.URL + "/portada.png"); !errors.Is(err, models.ErrDescargaCaratula) {
+		t.Errorf("Se esperaba ErrDescargaCaratula con una dirección local, se obtuvo %v", err)
+	}
+
+	servicio.Cliente = srv.Client()
+	url, err := servicio.Descargar(srv.URL + "/portada.png")
+	if err != nil || models.ClaveCaratula(url) == "" {
+		t.Fatalf("Error al descargar la carátula: %q, %v", url, err)
+	}
+	if _, err := servicio.Descargar(srv.URL + "/no-existe.png"); !errors.Is(err, models.ErrDescargaCaratula) {
+		t.Errorf("Se esperaba ErrDescargaCaratula con un 404, se obtuvo %v", err)
+	}
+	if _, err := servicio.Descargar(srv.URL + "/pagina.html"); !errors.Is(err, models.ErrImagenInvalida) {
+		t.Errorf("Se esperaba ErrImagenInvalida con una página HTML, se obtuvo %v", err)
+	}
+
+	// Localizar sustituye las carátulas externas que se pueden descargar
+	conPortada, _ := almacen.AgregarLibro(models.NuevoLibroConCaratula(0, "Niebla", "Miguel de Unamuno", 1914, srv.URL+"/portada.png"))
+	rota, _ := almacen.AgregarLibro(models.NuevoLibroConCaratula(0, "Abel Sánchez", "Miguel de Unamuno", 1917, srv.URL+"/no-existe.png"))
+	sustituidas, err := servicio.Localizar()
+	if err != nil || sustituidas != 1 {
+		t.Fatalf("Se esperaba sustituir 1 carátula, se sustituyeron %d: %v", sustituidas, err)
+	}
+	if libro, _ := almacen.ObtenerLibro(conPortada.ID); libro.CaratulaURL != url {
+		t.Errorf("Se esperaba la carátula local %q, se obtuvo %q", url, libro.CaratulaURL)
+	}
+	if libro, _ := almacen.ObtenerLibro(rota.ID); libro.CaratulaURL != srv.URL+"/no-existe.png" {
+		t.Errorf("La carátula que no se pudo descargar debería quedar igual: %q", libro.CaratulaURL)
+	}
+
+	// Limpiar conserva la carátula en uso y borra la que ya no usa nadie
+	if _, err := servicio.Guardar(bytes.NewReader(imagenPNG(t, 10, 10))); err != nil {
+		t.Fatal(err)
+	}
+	borradas, err := servicio.Limpiar()
+	if err != nil || borradas != 1 {
+		t.Errorf("Se esperaba borrar 1 carátula, se borraron %d: %v", borradas, err)
+	}
+	if rr := servir(servicio, url, nil); rr.Code != http.StatusOK {
+		t.Errorf("La carátula en uso no debería haberse borrado: %d", rr.Code)
+	}
+}
+
+func TestSoloDireccionesPublicas(t *testing.T) {
+	tests := []struct {
+		direccion string
+		permitida bool
+	}{
+		{"93.184.216.34:443", true},
+		{"[2606:2800:220:1:248:1893:25c8:1946]:443", true},
+		{"127.0.0.1:80", false},
+		{"10.1.2.3:80", false},
+		{"169.254.169.254:80", false},
+		{"100.64.0.1:80", false},
+		{"100.127.255.254:80", false},
+		{"192.0.0.8:80", false},
+		{"198.18.0.1:80", false},
+		{"198.19.255.255:80", false},
+		{"240.0.0.1:80", false},
+		{"255.255.255.255:80", false},
+		{"[::1]:80", false},
+		{"[::ffff:100.64.0.1]:80", false},
+		{"[64:ff9b::a01:203]:80", false},
+		{"[2002:a01:203::1]:80", false},
+		{"[fd00::1]:80", false},
+	}
+	for _, tt := range tests {
+		if err := soloDireccionesPublicas("tcp", tt.direccion, nil); (err == nil) != tt.permitida {
+			t.Errorf("%s: se esperaba permitida=%v, se obtuvo %v", tt.direccion, tt.permitida, err)
+		}
+	}
+}
+
+func TestDescargarRedireccionNoPublica(t *testing.T) {
+	servicio, _ := nuevoServicio(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://100.64.0.1/portada.png", http.StatusFound)
+	}))
+	defer srv.Close()
+
+	// El cliente de la aplicación, pero dejándole llegar al servidor de prueba
+	servicio.Cliente = nuevoCliente()
+	dialer := &net.Dialer{Control: func(red, direccion string, c syscall.RawConn) error {
+		if direccion == srv.Listener.Addr().String() {
+			return nil
+		}
+		return soloDireccionesPublicas(red, direccion, c)
+	}}
+	servicio.Cliente.Transport.(*http.Transport).DialContext = dialer.DialContext
+
+	_, err := servicio.Descargar(srv.URL + "/portada.png")
+	if !errors.Is(err, models.ErrDescargaCaratula) || !strings.Contains(err.Error(), "100.64.0.1 no permitida") {
+		t.Errorf("Se esperaba rechazar la redirección a una dirección CGNAT, se obtuvo %v", err)
+	}
+}
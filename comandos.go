@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"libroselectronicos/archivos"
+	"libroselectronicos/caratulas"
+	"libroselectronicos/config"
+	"libroselectronicos/cuentas"
+	"libroselectronicos/db"
+	"libroselectronicos/exportacion"
+	"libroselectronicos/importacion"
+	"libroselectronicos/models"
+)
+
+const usoComandos = `Uso:
+  libroselectronicos [flags]                     inicia el servidor web
+  libroselectronicos [flags] migrar estado       muestra las migraciones aplicadas y pendientes
+  libroselectronicos [flags] migrar subir        aplica todas las migraciones pendientes
+  libroselectronicos [flags] migrar a <versión>  sube o baja el esquema hasta <versión> (0 lo revierte todo)
+  libroselectronicos [flags] archivos limpiar    borra los EPUB y PDF que ya no usa ningún libro
+  libroselectronicos [flags] caratulas localizar descarga al servidor las carátulas que apuntan a otras webs
+  libroselectronicos [flags] caratulas limpiar   borra las carátulas que ya no usa ningún libro
+  libroselectronicos [flags] importar [-simular] <archivo.csv|archivo.jsonl>
+                                                 importa libros en bloque; con -simular solo los comprueba
+  libroselectronicos [flags] exportar [-o <archivo>] <libros|usuarios|alquileres> <csv|jsonl|marcxml>
+                                                 exporta los datos a un archivo o a la salida estándar
+  libroselectronicos [flags] admin crear <usuario> <email>
+                                                 crea el primer administrador; lee la contraseña de la entrada estándar
+
+Flags (también configurables por variables de entorno o con un archivo JSON):
+  -config <archivo>     archivo de configuración JSON          (LIBROS_CONFIG)
+  -entorno <nombre>     desarrollo o produccion                (LIBROS_ENTORNO)
+  -direccion <dir>      dirección de escucha, ej. :8080        (LIBROS_DIRECCION)
+  -db <ruta>            archivo SQLite, ej. ./libros.db        (LIBROS_DB)
+  -clave-sesion <clave> clave de las cookies de sesión         (LIBROS_CLAVE_SESION)
+  -archivos <dir>       directorio de los EPUB y PDF           (LIBROS_ARCHIVOS)
+  -caratulas <dir>      directorio de las carátulas            (LIBROS_CARATULAS)
+  -url-publica <url>    URL de los enlaces de los correos      (LIBROS_URL_PUBLICA)
+  -smtp <host:puerto>   servidor SMTP; sin él, a archivos      (LIBROS_SMTP)
+  -smtp-usuario <usr>   usuario SMTP                           (LIBROS_SMTP_USUARIO)
+                        la contraseña SMTP no tiene flag       (LIBROS_SMTP_CONTRASENA)
+  -remitente <dir>      remitente de los correos               (LIBROS_REMITENTE)
+  -correos <dir>        directorio de los correos sin SMTP     (LIBROS_CORREOS)`
+
+// ejecutarComando atiende los subcomandos de línea de órdenes.
+func ejecutarComando(cfg config.Config, nombre string, args []string) error {
+	switch nombre {
+	case "migrar":
+		return comandoMigrar(cfg, args)
+	case "archivos":
+		return comandoArchivos(cfg, args)
+	case "caratulas":
+		return comandoCaratulas(cfg, args)
+	case "importar":
+		return comandoImportar(cfg, args)
+	case "exportar":
+		return comandoExportar(cfg, args)
+	case "admin":
+		return comandoAdmin(cfg, args)
+	case "ayuda":
+		fmt.Println(usoComandos)
+		return nil
+	default:
+		return fmt.Errorf("comando desconocido %q\n%s", nombre, usoComandos)
+	}
+}
+
+func comandoMigrar(cfg config.Config, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("falta la acción de migrar\n%s", usoComandos)
+	}
+
+	conexion, err := db.AbrirSQLite(cfg.RutaDB)
+	if err != nil {
+		return err
+	}
+	defer conexion.Close()
+
+	migrador, err := db.NuevoMigrador(conexion)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "estado":
+		estados, err := migrador.Estado()
+		if err != nil {
+			return err
+		}
+		for _, e := range estados {
+			estado := "pendiente"
+			if e.Aplicada {
+				estado = "aplicada el " + e.AplicadaEn.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(os.Stdout, "%04d_%s\t%s\n", e.Version, e.Nombre, estado)
+		}
+		return nil
+	case "subir":
+		if err := migrador.Subir(); err != nil {
+			return err
+		}
+	case "a":
+		if len(args) < 2 {
+			return fmt.Errorf("falta la versión de destino\n%s", usoComandos)
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("versión inválida %q", args[1])
+		}
+		if err := migrador.MigrarA(version); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("acción de migrar desconocida %q\n%s", args[0], usoComandos)
+	}
+
+	version, err := migrador.VersionActual()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Esquema en la versión %d\n", version)
+	return nil
+}
+
+func comandoArchivos(cfg config.Config, args []string) error {
+	if len(args) == 0 || args[0] != "limpiar" {
+		return fmt.Errorf("acción de archivos desconocida o ausente\n%s", usoComandos)
+	}
+
+	almacen := db.NuevoAlmacen(cfg.RutaDB)
+	if almacen == nil {
+		return fmt.Errorf("no se pudo abrir la base de datos %s", cfg.RutaDB)
+	}
+	defer almacen.Close()
+	contenidos, err := archivos.NuevoAlmacenLocal(cfg.Archivos)
+	if err != nil {
+		return err
+	}
+
+	borrados, err := archivos.NuevoServicio(contenidos, almacen).Limpiar()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d archivo(s) sin usar borrado(s)\n", borrados)
+	return nil
+}
+
+func comandoCaratulas(cfg config.Config, args []string) error {
+	if len(args) == 0 || (args[0] != "localizar" && args[0] != "limpiar") {
+		return fmt.Errorf("acción de carátulas desconocida o ausente\n%s", usoComandos)
+	}
+
+	almacen := db.NuevoAlmacen(cfg.RutaDB)
+	if almacen == nil {
+		return fmt.Errorf("no se pudo abrir la base de datos %s", cfg.RutaDB)
+	}
+	defer almacen.Close()
+	imagenes, err := archivos.NuevoAlmacenLocal(cfg.Caratulas)
+	if err != nil {
+		return err
+	}
+	servicio := caratulas.NuevoServicio(imagenes, almacen)
+
+	if args[0] == "localizar" {
+		sustituidas, err := servicio.Localizar()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d carátula(s) descargada(s) al servidor\n", sustituidas)
+		return nil
+	}
+	borradas, err := servicio.Limpiar()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d carátula(s) sin usar borrada(s)\n", borradas)
+	return nil
+}
+
+func comandoImportar(cfg config.Config, args []string) error {
+	fs := flag.NewFlagSet("importar", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	simular := fs.Bool("simular", false, "comprueba las filas sin importarlas")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		return fmt.Errorf("uso: importar [-simular] <archivo>\n%s", usoComandos)
+	}
+	ruta := fs.Arg(0)
+
+	var formato string
+	switch strings.ToLower(filepath.Ext(ruta)) {
+	case ".csv":
+		formato = models.FormatoCSV
+	case ".jsonl", ".ndjson":
+		formato = models.FormatoJSONL
+	default:
+		return fmt.Errorf("no se reconoce el formato de %s: use la extensión .csv o .jsonl", ruta)
+	}
+	f, err := os.Open(ruta)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	almacen := db.NuevoAlmacen(cfg.RutaDB)
+	if almacen == nil {
+		return fmt.Errorf("no se pudo abrir la base de datos %s", cfg.RutaDB)
+	}
+	defer almacen.Close()
+
+	informe, err := importacion.Importar(almacen, f, formato, *simular)
+	if err != nil {
+		return err
+	}
+	for _, e := range informe.Errores {
+		fmt.Printf("Fila %d: %s\n", e.Fila, describirErrorFila(e))
+	}
+	fmt.Printf("%d fila(s) leída(s), %d válida(s), %d libro(s) importado(s)\n", informe.Filas, informe.Validas, informe.Importados)
+	if !informe.Correcto() {
+		return fmt.Errorf("%d fila(s) con errores: no se importó ningún libro", len(informe.Errores))
+	}
+	if informe.Simulacion {
+		fmt.Println("Simulación: todas las filas se pueden importar")
+	}
+	return nil
+}
+
+// describirErrorFila resume en una línea por qué no se puede importar una fila.
+func describirErrorFila(e models.ErrorFila) string {
+	var motivos []string
+	if e.Duplicado != "" {
+		motivos = append(motivos, "duplicado: "+e.Duplicado)
+	}
+	campos := make([]string, 0, len(e.Campos))
+	for campo := range e.Campos {
+		campos = append(campos, campo)
+	}
+	sort.Strings(campos)
+	for _, campo := range campos {
+		motivos = append(motivos, campo+" "+e.Campos[campo])
+	}
+	return strings.Join(motivos, "; ")
+}
+
+func comandoExportar(cfg config.Config, args []string) error {
+	fs := flag.NewFlagSet("exportar", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	salida := fs.String("o", "", "archivo de salida; por defecto la salida estándar")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 2 {
+		return fmt.Errorf("uso: exportar [-o <archivo>] <datos> <formato>\n%s", usoComandos)
+	}
+	datos, formato := fs.Arg(0), fs.Arg(1)
+	if err := exportacion.Comprobar(datos, formato); err != nil {
+		return err
+	}
+
+	almacen := db.NuevoAlmacen(cfg.RutaDB)
+	if almacen == nil {
+		return fmt.Errorf("no se pudo abrir la base de datos %s", cfg.RutaDB)
+	}
+	defer almacen.Close()
+
+	if *salida == "" {
+		return exportacion.Exportar(almacen, os.Stdout, datos, formato)
+	}
+	f, err := os.Create(*salida)
+	if err != nil {
+		return err
+	}
+	if err := exportacion.Exportar(almacen, f, datos, formato); err != nil {
+		f.Close()
+		os.Remove(*salida) // No dejar un archivo a medias
+		return err
+	}
+	return f.Close()
+}
+
+// comandoAdmin crea el primer administrador de una instalación nueva. La contraseña se
+// lee de la entrada estándar para que no quede en el historial ni en la lista de procesos.
+func comandoAdmin(cfg config.Config, args []string) error {
+	if len(args) != 3 || args[0] != "crear" {
+		return fmt.Errorf("uso: admin crear <usuario> <email>\n%s", usoComandos)
+	}
+	username, email := args[1], args[2]
+
+	fmt.Fprint(os.Stderr, "Contraseña del administrador: ")
+	linea, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && linea == "" {
+		return fmt.Errorf("leer la contraseña: %w", err)
+	}
+	password := strings.TrimRight(linea, "\r\n")
+
+	almacen := db.NuevoAlmacen(cfg.RutaDB)
+	if almacen == nil {
+		return fmt.Errorf("no se pudo abrir la base de datos %s", cfg.RutaDB)
+	}
+	defer almacen.Close()
+
+	admin, err := cuentas.CrearAdministrador(almacen, username, email, password, time.Now())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Administrador %s creado; ya puede iniciar sesión y nombrar a otros en /admin/usuarios\n", admin.Username)
+	return nil
+}
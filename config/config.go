@@ -0,0 +1,216 @@
+// Package config reúne la configuración del servidor. Los valores se toman, de menor
+// a mayor prioridad, de los valores por defecto, de un archivo JSON opcional, de las
+// variables de entorno y de los flags de la línea de órdenes.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Entornos reconocidos.
+const (
+	EntornoDesarrollo = "desarrollo"
+	EntornoProduccion = "produccion"
+)
+
+// ClaveSesionPorDefecto es la clave de desarrollo. El servidor se niega a arrancar
+// con ella en producción.
+const ClaveSesionPorDefecto = "super-secret-key-that-should-be-long-and-random"
+
+// longitudMinimaClaveProduccion es la longitud mínima de la clave de sesión en producción.
+const longitudMinimaClaveProduccion = 32
+
+// Variables de entorno que sobrescriben el archivo de configuración.
+const (
+	EnvArchivo     = "LIBROS_CONFIG"
+	EnvEntorno     = "LIBROS_ENTORNO"
+	EnvDireccion   = "LIBROS_DIRECCION"
+	EnvRutaDB      = "LIBROS_DB"
+	EnvClaveSesion = "LIBROS_CLAVE_SESION"
+	EnvArchivos    = "LIBROS_ARCHIVOS"
+	EnvCaratulas   = "LIBROS_CARATULAS"
+
+	EnvURLPublica     = "LIBROS_URL_PUBLICA"
+	EnvSMTP           = "LIBROS_SMTP"
+	EnvSMTPUsuario    = "LIBROS_SMTP_USUARIO"
+	EnvSMTPContrasena = "LIBROS_SMTP_CONTRASENA"
+	EnvRemitente      = "LIBROS_REMITENTE"
+	EnvCorreos        = "LIBROS_CORREOS"
+)
+
+// Config es la configuración del servidor.
+type Config struct {
+	Entorno     string `json:"entorno"`      // "desarrollo" o "produccion"
+	Direccion   string `json:"direccion"`    // Dirección de escucha, ej. ":8080"
+	RutaDB      string `json:"ruta_db"`      // Archivo SQLite
+	ClaveSesion string `json:"clave_sesion"` // Clave para firmar las cookies de sesión
+	Archivos    string `json:"archivos"`     // Directorio donde se guardan los EPUB y PDF
+	Caratulas   string `json:"caratulas"`    // Directorio donde se guardan las carátulas y sus miniaturas
+
+	// Correos de verificación de la cuenta y de restablecimiento de contraseña
+	URLPublica     string `json:"url_publica"`     // URL con la que se llega al servidor, para los enlaces de los correos
+	SMTP           string `json:"smtp"`            // Servidor SMTP, ej. "smtp.example.com:587"; vacío para guardar los correos en archivos
+	SMTPUsuario    string `json:"smtp_usuario"`    // Vacío si el servidor SMTP no pide autenticación
+	SMTPContrasena string `json:"smtp_contrasena"` // Sin flag, para que no se vea en la lista de procesos
+	Remitente      string `json:"remitente"`       // Dirección From de los correos
+	Correos        string `json:"correos"`         // Directorio donde se guardan los correos si no hay SMTP
+}
+
+// PorDefecto devuelve la configuración de desarrollo.
+func PorDefecto() Config {
+	return Config{
+		Entorno:     EntornoDesarrollo,
+		Direccion:   ":8080",
+		RutaDB:      "./libros.db",
+		ClaveSesion: ClaveSesionPorDefecto,
+		Archivos:    "./datos/archivos",
+		Caratulas:   "./datos/caratulas",
+		URLPublica:  "http://localhost:8080",
+		Remitente:   "Libros Electrónicos <libros@localhost>",
+		Correos:     "./datos/correos",
+	}
+}
+
+// EsProduccion indica si el servidor corre en modo producción.
+func (c Config) EsProduccion() bool {
+	return c.Entorno == EntornoProduccion
+}
+
+// Cargar construye la configuración a partir de los argumentos (sin el nombre del
+// programa) y de las variables de entorno que devuelve getenv. Devuelve también los
+// argumentos que quedan tras los flags, que son el subcomando a ejecutar, si lo hay.
+func Cargar(args []string, getenv func(string) string) (Config, []string, error) {
+	cfg := PorDefecto()
+
+	fs := flag.NewFlagSet("libroselectronicos", flag.ContinueOnError)
+	fs.SetOutput(io.Discard) // Los errores se devuelven; el uso lo imprime quien llama
+	archivo := fs.String("config", "", "archivo de configuración JSON (también "+EnvArchivo+")")
+	entorno := fs.String("entorno", "", "entorno: desarrollo o produccion (también "+EnvEntorno+")")
+	direccion := fs.String("direccion", "", "dirección de escucha, ej. :8080 (también "+EnvDireccion+")")
+	rutaDB := fs.String("db", "", "ruta del archivo SQLite (también "+EnvRutaDB+")")
+	claveSesion := fs.String("clave-sesion", "", "clave para firmar las cookies de sesión (también "+EnvClaveSesion+")")
+	archivos := fs.String("archivos", "", "directorio de los archivos de los libros (también "+EnvArchivos+")")
+	caratulas := fs.String("caratulas", "", "directorio de las carátulas (también "+EnvCaratulas+")")
+	urlPublica := fs.String("url-publica", "", "URL pública del servidor, para los enlaces de los correos (también "+EnvURLPublica+")")
+	smtp := fs.String("smtp", "", "servidor SMTP host:puerto; sin él, los correos se guardan en archivos (también "+EnvSMTP+")")
+	smtpUsuario := fs.String("smtp-usuario", "", "usuario SMTP; la contraseña, solo en "+EnvSMTPContrasena+" o en el archivo (también "+EnvSMTPUsuario+")")
+	remitente := fs.String("remitente", "", "remitente de los correos (también "+EnvRemitente+")")
+	correos := fs.String("correos", "", "directorio de los correos si no hay SMTP (también "+EnvCorreos+")")
+	if err := fs.Parse(args); err != nil {
+		return Config{}, nil, err
+	}
+
+	if *archivo == "" {
+		*archivo = getenv(EnvArchivo)
+	}
+	if *archivo != "" {
+		if err := cfg.cargarArchivo(*archivo); err != nil {
+			return Config{}, nil, err
+		}
+	}
+
+	sobrescribir(&cfg.Entorno, getenv(EnvEntorno), *entorno)
+	sobrescribir(&cfg.Direccion, getenv(EnvDireccion), *direccion)
+	sobrescribir(&cfg.RutaDB, getenv(EnvRutaDB), *rutaDB)
+	sobrescribir(&cfg.ClaveSesion, getenv(EnvClaveSesion), *claveSesion)
+	sobrescribir(&cfg.Archivos, getenv(EnvArchivos), *archivos)
+	sobrescribir(&cfg.Caratulas, getenv(EnvCaratulas), *caratulas)
+	sobrescribir(&cfg.URLPublica, getenv(EnvURLPublica), *urlPublica)
+	sobrescribir(&cfg.SMTP, getenv(EnvSMTP), *smtp)
+	sobrescribir(&cfg.SMTPUsuario, getenv(EnvSMTPUsuario), *smtpUsuario)
+	sobrescribir(&cfg.SMTPContrasena, getenv(EnvSMTPContrasena))
+	sobrescribir(&cfg.Remitente, getenv(EnvRemitente), *remitente)
+	sobrescribir(&cfg.Correos, getenv(EnvCorreos), *correos)
+
+	if err := cfg.Validar(); err != nil {
+		return Config{}, nil, err
+	}
+	return cfg, fs.Args(), nil
+}
+
+// sobrescribir aplica, en orden, los valores no vacíos de 'fuentes' sobre 'campo'.
+func sobrescribir(campo *string, fuentes ...string) {
+	for _, valor := range fuentes {
+		if valor != "" {
+			*campo = valor
+		}
+	}
+}
+
+// cargarArchivo sobrescribe la configuración con los campos presentes en un archivo JSON.
+func (c *Config) cargarArchivo(ruta string) error {
+	f, err := os.Open(ruta)
+	if err != nil {
+		return fmt.Errorf("abrir archivo de configuración: %w", err)
+	}
+	defer f.Close()
+
+	decoder := json.NewDecoder(f)
+	decoder.DisallowUnknownFields() // Un campo mal escrito no debe ignorarse en silencio
+	if err := decoder.Decode(c); err != nil {
+		return fmt.Errorf("leer archivo de configuración %s: %w", ruta, err)
+	}
+	return nil
+}
+
+// Validar comprueba que la configuración sea coherente y segura para su entorno.
+func (c Config) Validar() error {
+	var errs []string
+
+	if c.Entorno != EntornoDesarrollo && c.Entorno != EntornoProduccion {
+		errs = append(errs, fmt.Sprintf("entorno %q inválido (use %q o %q)", c.Entorno, EntornoDesarrollo, EntornoProduccion))
+	}
+	if _, _, err := net.SplitHostPort(c.Direccion); err != nil {
+		errs = append(errs, fmt.Sprintf("dirección de escucha %q inválida: %v", c.Direccion, err))
+	}
+	if strings.TrimSpace(c.RutaDB) == "" {
+		errs = append(errs, "la ruta de la base de datos no puede estar vacía")
+	}
+	if strings.TrimSpace(c.Archivos) == "" {
+		errs = append(errs, "el directorio de archivos no puede estar vacío")
+	}
+	if strings.TrimSpace(c.Caratulas) == "" {
+		errs = append(errs, "el directorio de carátulas no puede estar vacío")
+	} else if filepath.Clean(c.Caratulas) == filepath.Clean(c.Archivos) {
+		// Cada almacén borra al limpiar lo que no reconoce como suyo
+		errs = append(errs, "los directorios de archivos y de carátulas deben ser distintos")
+	}
+	if c.ClaveSesion == "" {
+		errs = append(errs, "la clave de sesión no puede estar vacía")
+	}
+	if u, err := url.Parse(c.URLPublica); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, fmt.Sprintf("URL pública %q inválida (use p. ej. https://libros.example.com)", c.URLPublica))
+	}
+	if c.SMTP != "" {
+		if _, _, err := net.SplitHostPort(c.SMTP); err != nil {
+			errs = append(errs, fmt.Sprintf("servidor SMTP %q inválido: %v", c.SMTP, err))
+		}
+	} else if strings.TrimSpace(c.Correos) == "" {
+		errs = append(errs, "sin servidor SMTP, el directorio de correos no puede estar vacío")
+	}
+	if _, err := mail.ParseAddress(c.Remitente); err != nil {
+		errs = append(errs, fmt.Sprintf("remitente %q inválido: %v", c.Remitente, err))
+	}
+	if c.EsProduccion() {
+		if c.ClaveSesion == ClaveSesionPorDefecto {
+			errs = append(errs, "no se puede usar la clave de sesión por defecto en producción")
+		} else if len(c.ClaveSesion) < longitudMinimaClaveProduccion {
+			errs = append(errs, fmt.Sprintf("la clave de sesión debe tener al menos %d caracteres en producción", longitudMinimaClaveProduccion))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New("configuración inválida: " + strings.Join(errs, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// entorno simula las variables de entorno.
+func entorno(vars map[string]string) func(string) string {
+	return func(clave string) string { return vars[clave] }
+}
+
+func TestCargarPorDefecto(t *testing.T) {
+	cfg, args, err := Cargar(nil, entorno(nil))
+	if err != nil {
+		t.Fatalf("Error al cargar configuración por defecto: %v", err)
+	}
+	if cfg != PorDefecto() {
+		t.Errorf("Configuración inesperada: %+v", cfg)
+	}
+	if len(args) != 0 {
+		t.Errorf("No se esperaban argumentos restantes: %v", args)
+	}
+}
+
+func TestCargarPrioridad(t *testing.T) {
+	archivo := filepath.Join(t.TempDir(), "config.json")
+	contenido := `{"direccion": ":9000", "ruta_db": "archivo.db", "clave_sesion": "clave-del-archivo"}`
+	if err := os.WriteFile(archivo, []byte(contenido), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	vars := map[string]string{
+		EnvArchivo:        archivo,
+		EnvRutaDB:         "entorno.db",
+		EnvDireccion:      ":9100",
+		EnvSMTPContrasena: "contraseña-smtp",
+	}
+	cfg, args, err := Cargar([]string{"-direccion", ":9200", "migrar", "estado"}, entorno(vars))
+	if err != nil {
+		t.Fatalf("Error al cargar configuración: %v", err)
+	}
+
+	if cfg.ClaveSesion != "clave-del-archivo" {
+		t.Errorf("La clave debería venir del archivo, obtenida %q", cfg.ClaveSesion)
+	}
+	if cfg.RutaDB != "entorno.db" {
+		t.Errorf("La variable de entorno debería ganar al archivo, obtenida %q", cfg.RutaDB)
+	}
+	if cfg.Direccion != ":9200" {
+		t.Errorf("El flag debería ganar a la variable de entorno, obtenida %q", cfg.Direccion)
+	}
+	if cfg.SMTPContrasena != "contraseña-smtp" {
+		t.Errorf("La contraseña SMTP debería venir de la variable de entorno, obtenida %q", cfg.SMTPContrasena)
+	}
+	if strings.Join(args, " ") != "migrar estado" {
+		t.Errorf("Argumentos restantes incorrectos: %v", args)
+	}
+}
+
+func TestCargarArchivoConCampoDesconocido(t *testing.T) {
+	archivo := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(archivo, []byte(`{"puerto": 8080}`), 0o600)
+
+	if _, _, err := Cargar([]string{"-config", archivo}, entorno(nil)); err == nil {
+		t.Errorf("Se esperaba error por un campo desconocido")
+	}
+}
+
+func TestValidar(t *testing.T) {
+	claveLarga := strings.Repeat("k", 40)
+	tests := []struct {
+		name    string
+		cambiar func(*Config)
+		valida  bool
+	}{
+		{"Desarrollo con clave por defecto", func(c *Config) {}, true},
+		{"Producción con clave por defecto", func(c *Config) { c.Entorno = EntornoProduccion }, false},
+		{"Producción con clave corta", func(c *Config) { c.Entorno = EntornoProduccion; c.ClaveSesion = "corta" }, false},
+		{"Producción con clave propia", func(c *Config) { c.Entorno = EntornoProduccion; c.ClaveSesion = claveLarga }, true},
+		{"Entorno desconocido", func(c *Config) { c.Entorno = "staging" }, false},
+		{"Dirección sin puerto", func(c *Config) { c.Direccion = "localhost" }, false},
+		{"Ruta de base de datos vacía", func(c *Config) { c.RutaDB = " " }, false},
+		{"Directorio de archivos vacío", func(c *Config) { c.Archivos = "" }, false},
+		{"Carátulas en el directorio de archivos", func(c *Config) { c.Caratulas = c.Archivos + "/" }, false},
+		{"URL pública relativa", func(c *Config) { c.URLPublica = "/libros" }, false},
+		{"URL pública sin http", func(c *Config) { c.URLPublica = "ftp://libros.example.com" }, false},
+		{"Servidor SMTP", func(c *Config) { c.SMTP = "smtp.example.com:587"; c.Correos = "" }, true},
+		{"Servidor SMTP sin puerto", func(c *Config) { c.SMTP = "smtp.example.com" }, false},
+		{"Sin SMTP ni directorio de correos", func(c *Config) { c.Correos = "" }, false},
+		{"Remitente inválido", func(c *Config) { c.Remitente = "libros" }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := PorDefecto()
+			tt.cambiar(&cfg)
+			err := cfg.Validar()
+			if tt.valida && err != nil {
+				t.Errorf("Se esperaba configuración válida, error: %v", err)
+			}
+			if !tt.valida && err == nil {
+				t.Errorf("Se esperaba configuración inválida")
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"libroselectronicos/archivos"
+	"libroselectronicos/models"
+
+	"github.com/gorilla/mux"
+)
+
+// ArchivoController sube, descarga y elimina los EPUB y PDF de los libros vía API.
+type ArchivoController struct {
+	Archivos *archivos.Servicio
+}
+
+func NuevoArchivoController(servicio *archivos.Servicio) *ArchivoController {
+	return &ArchivoController{Archivos: servicio}
+}
+
+// SubirArchivo recibe el campo "archivo" de un formulario multipart/form-data y lo
+// guarda como el EPUB o PDF del libro {id}, según su contenido.
+func (ac *ArchivoController) SubirArchivo(w http.ResponseWriter, r *http.Request) {
+	id, ok := idDeRuta(w, r)
+	if !ok {
+		return
+	}
+
+	archivo, err := ac.Archivos.SubirDesdeFormulario(w, r, id)
+	if err != nil {
+		var errs models.ErroresValidacion
+		if errors.As(err, &errs) {
+			responderErrorValidacion(w, errs)
+		} else if errors.Is(err, models.ErrArchivoDemasiadoGrande) {
+			responderError(w, http.StatusRequestEntityTooLarge, err.Error())
+		} else if errors.Is(err, models.ErrFormatoNoSoportado) {
+			responderError(w, http.StatusUnsupportedMediaType, err.Error())
+		} else if errors.Is(err, models.ErrLibroNoEncontrado) {
+			responderError(w, http.StatusNotFound, "Libro no encontrado")
+		} else {
+			log.Printf("Error al subir archivo del libro %d vía API: %v", id, err)
+			responderError(w, http.StatusInternalServerError, "Error interno al subir archivo")
+		}
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/libros/%d/archivos/%s", id, archivo.Formato))
+	responderJSON(w, http.StatusCreated, archivo)
+}
+
+// DescargarArchivo envía el archivo del libro {id} en {formato} a los administradores
+// y a quien tiene el libro alquilado. Admite peticiones parciales con Range.
+func (ac *ArchivoController) DescargarArchivo(w http.ResponseWriter, r *http.Request) {
+	id, ok := idDeRuta(w, r)
+	if !ok {
+		return
+	}
+
+	permitido, err := ac.Archivos.PuedeDescargar(UsuarioAutenticado(r), id)
+	if err != nil {
+		log.Printf("Error al comprobar el acceso al libro %d: %v", id, err)
+		responderError(w, http.StatusInternalServerError, "Error interno al descargar archivo")
+		return
+	}
+	if !permitido {
+		responderError(w, http.StatusForbidden, "Necesitas tener el libro alquilado para descargarlo")
+		return
+	}
+
+	if err := ac.Archivos.Descargar(w, r, id, mux.Vars(r)["formato"]); err != nil {
+		if errors.Is(err, models.ErrArchivoNoEncontrado) {
+			responderError(w, http.StatusNotFound, "El libro no tiene archivo en ese formato")
+		} else {
+			log.Printf("Error al descargar archivo del libro %d vía API: %v", id, err)
+			responderError(w, http.StatusInternalServerError, "Error interno al descargar archivo")
+		}
+	}
+}
+
+// EliminarArchivo quita el archivo del libro {id} en {formato}.
+func (ac *ArchivoController) EliminarArchivo(w http.ResponseWriter, r *http.Request) {
+	id, ok := idDeRuta(w, r)
+	if !ok {
+		return
+	}
+	formato := mux.Vars(r)["formato"]
+
+	if err := ac.Archivos.Eliminar(id, formato); err != nil {
+		if errors.Is(err, models.ErrArchivoNoEncontrado) {
+			responderError(w, http.StatusNotFound, "El libro no tiene archivo en ese formato")
+		} else {
+			log.Printf("Error al eliminar archivo del libro %d vía API: %v", id, err)
+			responderError(w, http.StatusInternalServerError, "Error interno al eliminar archivo")
+		}
+		return
+	}
+	responderJSON(w, http.StatusOK, MensajeAPI{Mensaje: fmt.Sprintf("Archivo %s del libro %d eliminado", formato, id)})
+}
@@ -0,0 +1,190 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"libroselectronicos/bloqueos"
+	"libroselectronicos/db"
+	"libroselectronicos/models"
+
+	"github.com/gorilla/mux"
+)
+
+// PoliticaAPI asocia el nombre de una ruta de la API con los roles que pueden usarla.
+// Las rutas sin nombre o cuyo nombre no aparece en la política son públicas.
+type PoliticaAPI map[string][]string
+
+type claveContexto string
+
+// claveUsuarioAPI guarda en el contexto el usuario autenticado, con su rol efectivo.
+const claveUsuarioAPI claveContexto = "usuario_api"
+
+// prefijoToken identifica a simple vista los tokens de esta aplicación.
+const prefijoToken = "le_"
+
+// GenerarToken crea un token aleatorio. Devuelve el token en claro (que solo se muestra
+// una vez), su prefijo visible y el hash que se guarda en la base de datos.
+func GenerarToken() (token, prefijo, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", err
+	}
+	token = prefijoToken + hex.EncodeToString(b)
+	return token, token[:len(prefijoToken)+8], models.HashToken(token), nil
+}
+
+// UsuarioAutenticado devuelve el usuario resuelto por MiddlewareAutenticacion, o nil.
+// Su Rol es el rol efectivo de la credencial usada, no necesariamente el de la base de datos.
+func UsuarioAutenticado(r *http.Request) *models.Usuario {
+	usuario, _ := r.Context().Value(claveUsuarioAPI).(*models.Usuario)
+	return usuario
+}
+
+// MiddlewareAutenticacion autentica las peticiones a la API con "Authorization: Bearer <token>"
+// o, para obtener el primer token, con HTTP Basic (usuario y contraseña), y aplica la política.
+// Sin credenciales las rutas protegidas responden 401; con un rol insuficiente, o con las
+// de una cuenta cuyo correo no está verificado, 403.
+func MiddlewareAutenticacion(almacen db.LibroAlmacenamiento, politica PoliticaAPI) mux.MiddlewareFunc {
+	return middlewareAutenticacion(almacen, politica, `Bearer realm="api"`)
+}
+
+// MiddlewareAutenticacionBasic es MiddlewareAutenticacion para clientes que solo saben
+// usar HTTP Basic, como las aplicaciones de lectura: el 401 pide usuario y contraseña,
+// así que el cliente los solicita al lector. En lugar de la contraseña vale un token de API.
+func MiddlewareAutenticacionBasic(almacen db.LibroAlmacenamiento, politica PoliticaAPI, realm string) mux.MiddlewareFunc {
+	return middlewareAutenticacion(almacen, politica, `Basic realm="`+realm+`", charset="UTF-8"`)
+}
+
+// middlewareAutenticacion aplica la política respondiendo a las peticiones sin
+// credenciales válidas con el desafío WWW-Authenticate indicado.
+func middlewareAutenticacion(almacen db.LibroAlmacenamiento, politica PoliticaAPI, desafio string) mux.MiddlewareFunc {
+	servicioBloqueos := bloqueos.NuevoServicio(almacen)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			usuario, err := autenticar(almacen, servicioBloqueos, r)
+			var bloqueo *models.ErrorBloqueo
+			if errors.As(err, &bloqueo) {
+				w.Header().Set("Retry-After", strconv.Itoa(bloqueo.SegundosRestantes()))
+				responderError(w, http.StatusTooManyRequests,
+					"Demasiados intentos fallidos. Vuelve a intentarlo dentro de "+models.EsperaLegible(bloqueo.Restante))
+				return
+			}
+			if errors.Is(err, models.ErrEmailNoVerificado) {
+				responderError(w, http.StatusForbidden, "Confirma tu correo antes de usar la cuenta: abre el enlace que te enviamos al registrarte")
+				return
+			}
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", desafio)
+				responderError(w, http.StatusUnauthorized, "Credenciales inválidas")
+				return
+			}
+
+			var roles []string
+			protegida := false
+			if ruta := mux.CurrentRoute(r); ruta != nil {
+				roles, protegida = politica[ruta.GetName()]
+			}
+			if protegida {
+				if usuario == nil {
+					w.Header().Set("WWW-Authenticate", desafio)
+					responderError(w, http.StatusUnauthorized, "Se requiere autenticación")
+					return
+				}
+				if !tieneRol(usuario, roles) {
+					responderError(w, http.StatusForbidden, "No tienes permiso para esta operación")
+					return
+				}
+			}
+
+			if usuario != nil {
+				r = r.WithContext(context.WithValue(r.Context(), claveUsuarioAPI, usuario))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// errCredenciales indica que se enviaron credenciales pero no son válidas.
+var errCredenciales = errors.New("credenciales inválidas")
+
+// autenticar resuelve el usuario de la cabecera Authorization. Devuelve (nil, nil) si no
+// se enviaron credenciales. Las contraseñas se comprueban con 'servicioBloqueos', que
+// rechaza las de un usuario o una IP con demasiados fallos. Las credenciales de una cuenta
+// sin verificar dan models.ErrEmailNoVerificado.
+func autenticar(almacen db.LibroAlmacenamiento, servicioBloqueos *bloqueos.Servicio, r *http.Request) (*models.Usuario, error) {
+	cabecera := r.Header.Get("Authorization")
+	if cabecera == "" {
+		return nil, nil
+	}
+
+	if token, ok := strings.CutPrefix(cabecera, "Bearer "); ok {
+		return autenticarToken(almacen, strings.TrimSpace(token))
+	}
+
+	if username, password, ok := r.BasicAuth(); ok {
+		if strings.HasPrefix(password, prefijoToken) {
+			// Un token como contraseña, para clientes que solo admiten HTTP Basic
+			usuario, err := autenticarToken(almacen, password)
+			if errors.Is(err, models.ErrEmailNoVerificado) {
+				return nil, err
+			} else if err != nil || usuario.Username != username {
+				return nil, errCredenciales
+			}
+			return usuario, nil
+		}
+		usuario, err := servicioBloqueos.Autenticar(r, username, password)
+		if errors.Is(err, models.ErrDemasiadosIntentos) || errors.Is(err, models.ErrEmailNoVerificado) {
+			return nil, err
+		} else if err != nil {
+			if !errors.Is(err, models.ErrCredencialesInvalidas) {
+				log.Printf("Error al comprobar la contraseña de %s: %v", username, err)
+			}
+			return nil, errCredenciales
+		}
+		return usuario, nil
+	}
+
+	return nil, errCredenciales
+}
+
+// autenticarToken resuelve el usuario de un token de API, con el rol efectivo del token.
+// Los tokens de una cuenta sin verificar no valen, aunque se crearan antes de exigirlo.
+func autenticarToken(almacen db.LibroAlmacenamiento, token string) (*models.Usuario, error) {
+	tokenAPI, err := almacen.ObtenerTokenAPIPorHash(models.HashToken(token))
+	if err != nil {
+		if !errors.Is(err, models.ErrTokenNoEncontrado) {
+			log.Printf("Error al buscar token de API: %v", err)
+		}
+		return nil, errCredenciales
+	}
+	usuario, err := almacen.ObtenerUsuarioPorID(tokenAPI.UsuarioID)
+	if err != nil {
+		log.Printf("Error al obtener el usuario %d del token %d: %v", tokenAPI.UsuarioID, tokenAPI.ID, err)
+		return nil, errCredenciales
+	}
+	if !usuario.EmailVerificado() {
+		return nil, models.ErrEmailNoVerificado
+	}
+	if err := almacen.RegistrarUsoTokenAPI(tokenAPI.ID); err != nil {
+		log.Printf("Error al registrar uso del token %d: %v", tokenAPI.ID, err)
+	}
+	efectivo := *usuario
+	efectivo.Rol = tokenAPI.RolEfectivo(usuario)
+	return &efectivo, nil
+}
+
+func tieneRol(usuario *models.Usuario, roles []string) bool {
+	for _, rol := range roles {
+		if usuario.GetRol() == rol {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,286 @@
+package controllers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"libroselectronicos/controllers"
+	"libroselectronicos/db"
+	"libroselectronicos/models"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// mockTokensAlmacen guarda usuarios y tokens en memoria.
+type mockTokensAlmacen struct {
+	db.LibroAlmacenamiento
+	usuarios map[int]*models.Usuario
+	tokens   []*models.TokenAPI
+	bloqueos map[string]*models.BloqueoLogin // Por "tipo:clave"
+}
+
+func (m *mockTokensAlmacen) ObtenerUsuarioPorID(id int) (*models.Usuario, error) {
+	if u, ok := m.usuarios[id]; ok {
+		return u, nil
+	}
+	return nil, models.ErrUsuarioNoEncontrado
+}
+
+func (m *mockTokensAlmacen) ObtenerUsuarioPorUsername(username string) (*models.Usuario, error) {
+	for _, u := range m.usuarios {
+		if u.Username == username {
+			return u, nil
+		}
+	}
+	return nil, models.ErrUsuarioNoEncontrado
+}
+
+func (m *mockTokensAlmacen) AgregarTokenAPI(token *models.TokenAPI) error {
+	token.ID = len(m.tokens) + 1
+	m.tokens = append(m.tokens, token)
+	return nil
+}
+
+func (m *mockTokensAlmacen) ObtenerTokenAPIPorHash(hash string) (*models.TokenAPI, error) {
+	for _, tk := range m.tokens {
+		if tk.Hash == hash && !tk.EstaRevocado() {
+			return tk, nil
+		}
+	}
+	return nil, models.ErrTokenNoEncontrado
+}
+
+func (m *mockTokensAlmacen) RegistrarUsoTokenAPI(tokenID int) error {
+	return nil
+}
+
+func (m *mockTokensAlmacen) ObtenerBloqueoLogin(tipo, clave string) (*models.BloqueoLogin, error) {
+	if b, ok := m.bloqueos[tipo+":"+clave]; ok {
+		return b, nil
+	}
+	return nil, models.ErrBloqueoNoEncontrado
+}
+
+func (m *mockTokensAlmacen) RegistrarFalloLogin(tipo, clave string, politica models.PoliticaBloqueo, ahora time.Time) (*models.BloqueoLogin, error) {
+	if m.bloqueos == nil {
+		m.bloqueos = map[string]*models.BloqueoLogin{}
+	}
+	b, ok := m.bloqueos[tipo+":"+clave]
+	if !ok {
+		b = &models.BloqueoLogin{Tipo: tipo, Clave: clave}
+		m.bloqueos[tipo+":"+clave] = b
+	}
+	b.Fallos++
+	b.UltimoFallo = ahora
+	if espera := politica.Espera(b.Fallos); espera > 0 {
+		hasta := ahora.Add(espera)
+		b.BloqueadoHasta = &hasta
+	}
+	return b, nil
+}
+
+func (m *mockTokensAlmacen) ReiniciarBloqueoLogin(tipo, clave string) error {
+	delete(m.bloqueos, tipo+":"+clave)
+	return nil
+}
+
+func (m *mockTokensAlmacen) RegistrarIntentoLogin(intento *models.IntentoLogin) error {
+	return nil
+}
+
+// verificado marca como confirmado el correo del usuario, como el de una cuenta en uso.
+func verificado(u *models.Usuario) *models.Usuario {
+	ahora := time.Now()
+	u.EmailVerificadoEn = &ahora
+	return u
+}
+
+// nuevoRouterTokens monta la ruta de creación de tokens y una ruta solo para administradores.
+func nuevoRouterTokens(almacen db.LibroAlmacenamiento) *mux.Router {
+	lectores := []string{models.RolLector, models.RolAdministrador}
+	router := mux.NewRouter()
+	api := router.PathPrefix("/api/v1").Subrouter()
+	api.Use(controllers.MiddlewareAutenticacion(almacen, controllers.PoliticaAPI{
+		"tokens.crear": lectores,
+		"admin":        {models.RolAdministrador},
+	}))
+	api.HandleFunc("/tokens", controllers.NuevoTokenController(almacen).CrearToken).Methods("POST").Name("tokens.crear")
+	api.HandleFunc("/admin", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }).Name("admin")
+	api.HandleFunc("/publica", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	return router
+}
+
+// crearToken pide un token con HTTP Basic y devuelve su valor en claro.
+func crearToken(t *testing.T, router *mux.Router, username, password, cuerpo string) (string, int) {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/api/v1/tokens", bytes.NewBufferString(cuerpo))
+	req.SetBasicAuth(username, password)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	var creado controllers.TokenCreado
+	json.Unmarshal(rr.Body.Bytes(), &creado)
+	return creado.Token, rr.Code
+}
+
+func TestMiddlewareAutenticacion(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secreto"), bcrypt.MinCost)
+	almacen := &mockTokensAlmacen{usuarios: map[int]*models.Usuario{
+		1: verificado(models.NuevoUsuario(1, "lector", string(hash), "", models.RolLector)),
+		2: verificado(models.NuevoUsuario(2, "admin", string(hash), "", models.RolAdministrador)),
+	}}
+	router := nuevoRouterTokens(almacen)
+
+	tokenAdmin, status := crearToken(t, router, "admin", "secreto", `{"nombre":"script"}`)
+	if status != http.StatusCreated || tokenAdmin == "" {
+		t.Fatalf("No se pudo crear el token de administrador: estado %d", status)
+	}
+	tokenAdminLector, _ := crearToken(t, router, "admin", "secreto", `{"nombre":"solo lectura","alcance":"lector"}`)
+	tokenLector, _ := crearToken(t, router, "lector", "secreto", `{"nombre":"script"}`)
+
+	if _, status := crearToken(t, router, "lector", "secreto", `{"nombre":"x","alcance":"administrador"}`); status != http.StatusForbidden {
+		t.Errorf("Un lector no debería poder crear tokens de administrador: estado %d", status)
+	}
+	if _, status := crearToken(t, router, "admin", "incorrecta", `{"nombre":"x"}`); status != http.StatusUnauthorized {
+		t.Errorf("Se esperaba 401 con contraseña incorrecta: estado %d", status)
+	}
+	if almacen.tokens[0].Hash == tokenAdmin {
+		t.Errorf("El token no debe guardarse en claro")
+	}
+
+	tests := []struct {
+		name           string
+		path           string
+		autorizacion   string
+		expectedStatus int
+	}{
+		{"Ruta pública sin credenciales", "/api/v1/publica", "", http.StatusOK},
+		{"Ruta protegida sin credenciales", "/api/v1/admin", "", http.StatusUnauthorized},
+		{"Token inválido", "/api/v1/publica", "Bearer le_noexiste", http.StatusUnauthorized},
+		{"Token de administrador", "/api/v1/admin", "Bearer " + tokenAdmin, http.StatusOK},
+		{"Token de administrador con alcance lector", "/api/v1/admin", "Bearer " + tokenAdminLector, http.StatusForbidden},
+		{"Token de lector", "/api/v1/admin", "Bearer " + tokenLector, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.autorizacion != "" {
+				req.Header.Set("Authorization", tt.autorizacion)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Código de estado incorrecto: esperado %d, obtenido %d. Cuerpo: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+		})
+	}
+
+	// Para clientes que solo saben HTTP Basic, el token vale como contraseña de su usuario
+	basic := []struct {
+		name           string
+		username       string
+		password       string
+		expectedStatus int
+	}{
+		{"Token de administrador como contraseña", "admin", tokenAdmin, http.StatusOK},
+		{"Token de lector como contraseña", "lector", tokenLector, http.StatusForbidden},
+		{"Token de otro usuario", "lector", tokenAdmin, http.StatusUnauthorized},
+		{"Token inexistente", "admin", "le_noexiste", http.StatusUnauthorized},
+	}
+	for _, tt := range basic {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/v1/admin", nil)
+			req.SetBasicAuth(tt.username, tt.password)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Código de estado incorrecto: esperado %d, obtenido %d. Cuerpo: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+		})
+	}
+
+	// Si el administrador pasa a ser lector, su token de administrador deja de valer como tal
+	almacen.usuarios[2].Rol = models.RolLector
+	req := httptest.NewRequest("GET", "/api/v1/admin", nil)
+	req.Header.Set("Authorization", "Bearer "+tokenAdmin)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Se esperaba 403 tras degradar al usuario, obtenido %d", rr.Code)
+	}
+
+	// Tras demasiadas contraseñas incorrectas, el usuario queda bloqueado aunque acierte
+	for i := 0; i < models.PoliticaBloqueoUsuario.FallosPermitidos; i++ {
+		if _, status := crearToken(t, router, "lector", "incorrecta", `{"nombre":"x"}`); status != http.StatusUnauthorized {
+			t.Fatalf("Se esperaba 401 en el fallo %d, obtenido %d", i+1, status)
+		}
+	}
+	req = httptest.NewRequest("POST", "/api/v1/tokens", bytes.NewBufferString(`{"nombre":"x"}`))
+	req.SetBasicAuth("lector", "incorrecta")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("Se esperaba 429 con Retry-After al bloquear al usuario, obtenido %d", rr.Code)
+	}
+	if _, status := crearToken(t, router, "lector", "secreto", `{"nombre":"x"}`); status != http.StatusTooManyRequests {
+		t.Errorf("Un usuario bloqueado no debería poder autenticarse, obtenido %d", status)
+	}
+	// Los tokens no se adivinan, así que el bloqueo no les afecta
+	req = httptest.NewRequest("GET", "/api/v1/publica", nil)
+	req.Header.Set("Authorization", "Bearer "+tokenLector)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("El token de un usuario bloqueado debería seguir valiendo, obtenido %d", rr.Code)
+	}
+}
+
+func TestAutenticacionSinVerificarElCorreo(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secreto"), bcrypt.MinCost)
+	almacen := &mockTokensAlmacen{usuarios: map[int]*models.Usuario{
+		1: models.NuevoUsuario(1, "nuevo", string(hash), "nuevo@example.com", models.RolLector),
+	}}
+	router := nuevoRouterTokens(almacen)
+
+	if _, status := crearToken(t, router, "nuevo", "secreto", `{"nombre":"script"}`); status != http.StatusForbidden {
+		t.Errorf("Sin verificar el correo no se debería poder crear un token: estado %d", status)
+	}
+	if len(almacen.tokens) != 0 {
+		t.Errorf("No debería haberse guardado ningún token")
+	}
+	if _, status := crearToken(t, router, "nuevo", "incorrecta", `{"nombre":"script"}`); status != http.StatusUnauthorized {
+		t.Errorf("Con la contraseña incorrecta se esperaba 401, no revelar la verificación: estado %d", status)
+	}
+
+	pedir := func(nombre string, credenciales func(*http.Request)) {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/api/v1/publica", nil)
+		credenciales(req)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("%s: se esperaba 403 sin verificar el correo, obtenido %d", nombre, rr.Code)
+		}
+	}
+	pedir("HTTP Basic", func(r *http.Request) { r.SetBasicAuth("nuevo", "secreto") })
+
+	// Un token creado antes de exigir la verificación tampoco vale
+	token, prefijo, hashToken, _ := controllers.GenerarToken()
+	almacen.AgregarTokenAPI(&models.TokenAPI{UsuarioID: 1, Nombre: "antiguo", Prefijo: prefijo, Hash: hashToken, Alcance: models.RolLector})
+	pedir("Bearer", func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) })
+	pedir("Token como contraseña", func(r *http.Request) { r.SetBasicAuth("nuevo", token) })
+
+	// Tras verificar, todo vale
+	almacen.usuarios[1] = verificado(almacen.usuarios[1])
+	if _, status := crearToken(t, router, "nuevo", "secreto", `{"nombre":"script"}`); status != http.StatusCreated {
+		t.Errorf("Tras verificar el correo se debería poder crear el token: estado %d", status)
+	}
+}
@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"libroselectronicos/db"
+	"libroselectronicos/models"
+
+	"github.com/gorilla/mux"
+)
+
+// AutorController expone los autores y sus libros en la API.
+type AutorController struct {
+	Almacen db.LibroAlmacenamiento
+}
+
+func NuevoAutorController(almacen db.LibroAlmacenamiento) *AutorController {
+	return &AutorController{Almacen: almacen}
+}
+
+// AutorConObras es la respuesta de GET /api/v1/autores/{slug}.
+type AutorConObras struct {
+	Autor *models.Autor       `json:"autor"`
+	Obras []*models.ObraAutor `json:"obras"`
+}
+
+// SolicitudFusion es el cuerpo de POST /api/v1/autores/{id}/fusionar.
+type SolicitudFusion struct {
+	DestinoID int `json:"destino_id"`
+}
+
+// ObtenerAutor devuelve el autor del parámetro {slug} y los libros en que participa.
+func (ac *AutorController) ObtenerAutor(w http.ResponseWriter, r *http.Request) {
+	slug := mux.Vars(r)["slug"]
+	autor, err := ac.Almacen.ObtenerAutorPorSlug(slug)
+	if err != nil {
+		if errors.Is(err, models.ErrAutorNoEncontrado) {
+			responderError(w, http.StatusNotFound, "Autor no encontrado")
+		} else {
+			log.Printf("Error al obtener autor %q vía API: %v", slug, err)
+			responderError(w, http.StatusInternalServerError, "Error interno al obtener autor")
+		}
+		return
+	}
+
+	obras, err := ac.Almacen.ListarObrasDeAutor(autor.ID)
+	if err != nil {
+		log.Printf("Error al listar los libros del autor %d vía API: %v", autor.ID, err)
+		responderError(w, http.StatusInternalServerError, "Error interno al listar los libros del autor")
+		return
+	}
+	responderJSON(w, http.StatusOK, AutorConObras{Autor: autor, Obras: obras})
+}
+
+// FusionarAutor pasa los libros del autor {id} al autor "destino_id" y elimina el primero.
+func (ac *AutorController) FusionarAutor(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		responderError(w, http.StatusBadRequest, "ID de autor inválido")
+		return
+	}
+
+	var solicitud SolicitudFusion
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&solicitud); err != nil {
+		responderError(w, http.StatusBadRequest, "Solicitud JSON inválida: "+err.Error())
+		return
+	}
+
+	err = ac.Almacen.FusionarAutores(id, solicitud.DestinoID)
+	if err != nil {
+		if errors.Is(err, models.ErrAutorNoEncontrado) {
+			responderError(w, http.StatusNotFound, "Autor no encontrado")
+		} else if errors.Is(err, models.ErrValidacion) {
+			responderError(w, http.StatusBadRequest, "El autor de destino debe ser otro autor")
+		} else {
+			log.Printf("Error al fusionar el autor %d con %d: %v", id, solicitud.DestinoID, err)
+			responderError(w, http.StatusInternalServerError, "Error interno al fusionar autores")
+		}
+		return
+	}
+
+	responderJSON(w, http.StatusOK, MensajeAPI{Mensaje: fmt.Sprintf("Autor con ID %d fusionado con el autor %d", id, solicitud.DestinoID)})
+}
@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+
+	"libroselectronicos/caratulas"
+	"libroselectronicos/db"
+	"libroselectronicos/models"
+)
+
+// CaratulaController guarda en el servidor la carátula de un libro vía API.
+type CaratulaController struct {
+	Almacen   db.LibroAlmacenamiento
+	Caratulas *caratulas.Servicio
+}
+
+func NuevoCaratulaController(almacen db.LibroAlmacenamiento, servicio *caratulas.Servicio) *CaratulaController {
+	return &CaratulaController{Almacen: almacen, Caratulas: servicio}
+}
+
+// SubirCaratula cambia la carátula del libro {id} por la imagen del campo "imagen" de
+// un formulario multipart/form-data, o por la que descarga de {"url": "..."}, y
+// devuelve el libro actualizado.
+func (cc *CaratulaController) SubirCaratula(w http.ResponseWriter, r *http.Request) {
+	id, ok := idDeRuta(w, r)
+	if !ok {
+		return
+	}
+
+	url, err := cc.caratulaDePeticion(w, r)
+	if err == nil {
+		err = cc.Almacen.ActualizarLibro(id, models.LibroPatch{CaratulaURL: &url})
+	}
+	if err != nil {
+		var errs models.ErroresValidacion
+		if errors.As(err, &errs) {
+			responderErrorValidacion(w, errs)
+		} else if errors.Is(err, models.ErrImagenInvalida) || errors.Is(err, models.ErrDescargaCaratula) {
+			responderErrorValidacion(w, models.ErroresValidacion{"imagen": err.Error()})
+		} else if errors.Is(err, models.ErrImagenDemasiadoGrande) {
+			responderError(w, http.StatusRequestEntityTooLarge, err.Error())
+		} else if errors.Is(err, models.ErrLibroNoEncontrado) {
+			responderError(w, http.StatusNotFound, "Libro no encontrado")
+		} else {
+			log.Printf("Error al guardar la carátula del libro %d vía API: %v", id, err)
+			responderError(w, http.StatusInternalServerError, "Error interno al guardar la carátula")
+		}
+		return
+	}
+
+	libro, err := cc.Almacen.ObtenerLibro(id)
+	if err != nil {
+		log.Printf("Error al releer libro %d tras cambiar su carátula: %v", id, err)
+		responderError(w, http.StatusInternalServerError, "Error interno al obtener libro actualizado")
+		return
+	}
+	responderJSON(w, http.StatusOK, libro)
+}
+
+func (cc *CaratulaController) caratulaDePeticion(w http.ResponseWriter, r *http.Request) (string, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, models.TamanoMaximoCaratula+1<<20)
+	tipo, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if tipo == "application/json" {
+		var cuerpo struct {
+			URL string `json:"url"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&cuerpo); err != nil {
+			return "", models.ErroresValidacion{"url": "JSON inválido"}
+		}
+		if !models.EsCaratulaExterna(cuerpo.URL) {
+			return "", models.ErroresValidacion{"url": "debe ser una URL http(s)"}
+		}
+		return cc.Caratulas.Descargar(cuerpo.URL)
+	}
+
+	imagen, _, err := r.FormFile("imagen")
+	var errMax *http.MaxBytesError
+	if errors.As(err, &errMax) {
+		return "", models.ErrImagenDemasiadoGrande
+	}
+	if err != nil {
+		return "", models.ErroresValidacion{"imagen": "se esperaba un formulario multipart/form-data con el campo imagen, o JSON con url"}
+	}
+	defer imagen.Close()
+	return cc.Caratulas.Guardar(imagen)
+}
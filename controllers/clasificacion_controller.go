@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"libroselectronicos/db"
+	"libroselectronicos/models"
+)
+
+// ClasificacionController expone en la API los géneros, las etiquetas y las facetas
+// del listado de libros.
+type ClasificacionController struct {
+	Almacen db.LibroAlmacenamiento
+}
+
+func NuevoClasificacionController(almacen db.LibroAlmacenamiento) *ClasificacionController {
+	return &ClasificacionController{Almacen: almacen}
+}
+
+// ListarGeneros devuelve el árbol de géneros, cada uno seguido de sus subgéneros.
+func (cc *ClasificacionController) ListarGeneros(w http.ResponseWriter, r *http.Request) {
+	generos, err := cc.Almacen.ListarGeneros()
+	if err != nil {
+		log.Printf("Error al listar géneros vía API: %v", err)
+		responderError(w, http.StatusInternalServerError, "Error interno al listar géneros")
+		return
+	}
+	responderJSON(w, http.StatusOK, generos)
+}
+
+// ListarEtiquetas devuelve las etiquetas en uso con el número de libros de cada una.
+func (cc *ClasificacionController) ListarEtiquetas(w http.ResponseWriter, r *http.Request) {
+	etiquetas, err := cc.Almacen.ListarEtiquetas()
+	if err != nil {
+		log.Printf("Error al listar etiquetas vía API: %v", err)
+		responderError(w, http.StatusInternalServerError, "Error interno al listar etiquetas")
+		return
+	}
+	responderJSON(w, http.StatusOK, etiquetas)
+}
+
+// ObtenerFacetas cuenta por género y por etiqueta los libros que cumplen los filtros
+// de la URL, los mismos que acepta GET /api/v1/libros.
+func (cc *ClasificacionController) ObtenerFacetas(w http.ResponseWriter, r *http.Request) {
+	consulta, err := models.ParsearConsultaLibros(r.URL.Query())
+	if err != nil {
+		responderError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	facetas, err := cc.Almacen.ContarFacetas(consulta)
+	if err != nil {
+		if errors.Is(err, models.ErrConsultaInvalida) {
+			responderError(w, http.StatusBadRequest, err.Error())
+		} else {
+			log.Printf("Error al contar facetas vía API: %v", err)
+			responderError(w, http.StatusInternalServerError, "Error interno al contar facetas")
+		}
+		return
+	}
+	responderJSON(w, http.StatusOK, facetas)
+}
@@ -0,0 +1,65 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"libroselectronicos/importacion"
+	"libroselectronicos/models"
+)
+
+// TamanoMaximoImportacion limita el cuerpo de una importación.
+const TamanoMaximoImportacion = 50 << 20
+
+// ImportarLibros importa en bloque los libros del cuerpo, en CSV (Content-Type text/csv)
+// o JSON Lines (application/x-ndjson), o en el formato que indique ?formato=csv|jsonl.
+// Con ?simular=true solo comprueba las filas. Responde con el informe de la importación:
+// 200 si todas las filas son válidas y 422 si alguna no lo es, en cuyo caso no se
+// importa ningún libro.
+func (lc *LibroController) ImportarLibros(w http.ResponseWriter, r *http.Request) {
+	formato := r.URL.Query().Get("formato")
+	if formato == "" {
+		formato = formatoDeContenido(r.Header.Get("Content-Type"))
+	}
+	simular, _ := strconv.ParseBool(r.URL.Query().Get("simular"))
+
+	r.Body = http.MaxBytesReader(w, r.Body, TamanoMaximoImportacion)
+	defer r.Body.Close()
+	informe, err := importacion.Importar(lc.Almacen, r.Body, formato, simular)
+	if err != nil {
+		var errs models.ErroresValidacion
+		var errMax *http.MaxBytesError
+		if errors.Is(err, importacion.ErrFormatoDesconocido) {
+			responderError(w, http.StatusUnsupportedMediaType, err.Error())
+		} else if errors.As(err, &errs) {
+			responderErrorValidacion(w, errs)
+		} else if errors.As(err, &errMax) {
+			responderError(w, http.StatusRequestEntityTooLarge, "El archivo supera el tamaño máximo de importación")
+		} else {
+			log.Printf("Error al importar libros vía API: %v", err)
+			responderError(w, http.StatusInternalServerError, "Error interno al importar libros")
+		}
+		return
+	}
+
+	status := http.StatusOK
+	if !informe.Correcto() {
+		status = http.StatusUnprocessableEntity
+	}
+	responderJSON(w, status, informe)
+}
+
+// formatoDeContenido devuelve el formato de importación de un Content-Type.
+func formatoDeContenido(contentType string) string {
+	tipo, _, _ := mime.ParseMediaType(contentType)
+	switch tipo {
+	case "text/csv":
+		return models.FormatoCSV
+	case "application/x-ndjson", "application/jsonl", "application/x-jsonlines":
+		return models.FormatoJSONL
+	}
+	return ""
+}
@@ -1,9 +1,10 @@
-package db
+package controllers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
@@ -14,6 +15,7 @@ import (
 	"github.com/gorilla/mux"
 )
 
+// LibroController expone las operaciones de libros como API JSON.
 type LibroController struct {
 	Almacen db.LibroAlmacenamiento
 }
@@ -22,129 +24,237 @@ func NuevoLibroController(almacen db.LibroAlmacenamiento) *LibroController {
 	return &LibroController{Almacen: almacen}
 }
 
+// idDeRuta lee el parámetro {id} de la ruta. Si no es válido, responde 400 y devuelve false.
+func idDeRuta(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		responderError(w, http.StatusBadRequest, "ID de libro inválido")
+		return 0, false
+	}
+	return id, true
+}
+
+// CrearLibro agrega un libro. El ID y el slug los asigna el almacén, así que el cuerpo
+// no puede incluirlos: un campo desconocido o inválido, un autor_id que no existe o un
+// género desconocido se responden con 422.
 func (lc *LibroController) CrearLibro(w http.ResponseWriter, r *http.Request) {
-	var nuevoLibro models.Libro // Aquí recibimos la estructura completa, incluyendo CaratulaURL
-	body, err := ioutil.ReadAll(r.Body)
+	var campos map[string]json.RawMessage
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&campos); err != nil {
+		responderError(w, http.StatusBadRequest, "Solicitud JSON inválida: "+err.Error())
+		return
+	}
+
+	nuevoLibro, err := models.LibroDesdeJSON(campos)
 	if err != nil {
-		http.Error(w, "Error al leer el cuerpo de la solicitud", http.StatusBadRequest)
+		var errsCampos models.ErroresValidacion
+		if errors.As(err, &errsCampos) {
+			responderErrorValidacion(w, errsCampos)
+		} else {
+			responderError(w, http.StatusBadRequest, err.Error())
+		}
 		return
 	}
-	defer r.Body.Close()
 
-	if err := json.Unmarshal(body, &nuevoLibro); err != nil {
-		http.Error(w, "Error al decodificar el libro: "+err.Error(), http.StatusBadRequest)
+	creado, err := lc.Almacen.AgregarLibro(nuevoLibro)
+	if err != nil {
+		var errsCampos models.ErroresValidacion
+		if errors.As(err, &errsCampos) {
+			responderErrorValidacion(w, errsCampos)
+		} else if errors.Is(err, models.ErrISBNDuplicado) {
+			responderError(w, http.StatusConflict, "Ya existe un libro con ese ISBN")
+		} else {
+			log.Printf("Error al agregar libro vía API: %v", err)
+			responderError(w, http.StatusInternalServerError, "Error interno al agregar libro")
+		}
 		return
 	}
 
-	// ¡CORRECCIÓN AQUÍ!
-	// Utiliza NuevoLibroConCaratula y pasa todos los campos, incluyendo CaratulaURL
-	// La función AgregarLibro de la interfaz espera *models.Libro
-	libroParaAlmacenar := models.NuevoLibroConCaratula(
-		nuevoLibro.ID,
-		nuevoLibro.Titulo,
-		nuevoLibro.Autor,
-		nuevoLibro.Anio,
-		nuevoLibro.CaratulaURL, // Añadido CaratulaURL
-	)
+	w.Header().Set("Location", fmt.Sprintf("%s/%d", r.URL.Path, creado.ID))
+	responderJSON(w, http.StatusCreated, creado)
+}
 
-	err = lc.Almacen.AgregarLibro(libroParaAlmacenar)
+// ObtenerLibros lista los libros por páginas o, si se indica ?q=, los que coinciden con
+// la búsqueda de texto completo, ordenados por relevancia y con un fragmento resaltado.
+// El listado acepta los parámetros de models.ParsearConsultaLibros; el total va en la
+// cabecera X-Total-Count y los enlaces a otras páginas en la cabecera Link.
+func (lc *LibroController) ObtenerLibros(w http.ResponseWriter, r *http.Request) {
+	if consulta := r.URL.Query().Get("q"); consulta != "" {
+		resultados, err := lc.Almacen.BuscarLibros(consulta, models.OpcionesBusqueda{})
+		if err != nil {
+			log.Printf("Error al buscar libros: %v", err)
+			responderError(w, http.StatusInternalServerError, "Error interno del servidor")
+			return
+		}
+		responderJSON(w, http.StatusOK, resultados)
+		return
+	}
+
+	consulta, err := models.ParsearConsultaLibros(r.URL.Query())
 	if err != nil {
-		if strings.Contains(err.Error(), "UNIQUE constraint failed") { // Cambio a un error más específico de SQLite
-			http.Error(w, fmt.Sprintf("Error: El libro con ID %d ya existe.", nuevoLibro.ID), http.StatusConflict)
+		responderError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	pagina, err := lc.Almacen.ListarLibros(consulta)
+	if err != nil {
+		if errors.Is(err, models.ErrConsultaInvalida) {
+			responderError(w, http.StatusBadRequest, err.Error())
 		} else {
-			http.Error(w, "Error al agregar libro: "+err.Error(), http.StatusInternalServerError)
+			log.Printf("Error al listar libros vía API: %v", err)
+			responderError(w, http.StatusInternalServerError, "Error interno al listar libros")
 		}
 		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(libroParaAlmacenar)
+	w.Header().Set("X-Total-Count", strconv.Itoa(pagina.Total))
+	if enlaces := enlacesPaginacion(r.URL.Path, consulta, pagina); enlaces != "" {
+		w.Header().Set("Link", enlaces)
+	}
+	responderJSON(w, http.StatusOK, pagina.Libros)
 }
 
-func (lc *LibroController) ObtenerLibros(w http.ResponseWriter, r *http.Request) {
-	libros := lc.Almacen.ListarLibros()
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(libros)
+// enlacesPaginacion construye la cabecera Link (RFC 8288) con las páginas primera,
+// anterior y siguiente de un listado.
+func enlacesPaginacion(ruta string, consulta models.ConsultaLibros, pagina *models.PaginaLibros) string {
+	var enlaces []string
+	enlace := func(cursor, rel string) {
+		url := ruta
+		if valores := consulta.ConCursor(cursor).Valores().Encode(); valores != "" {
+			url += "?" + valores
+		}
+		enlaces = append(enlaces, fmt.Sprintf(`<%s>; rel="%s"`, url, rel))
+	}
+
+	if pagina.CursorAnterior != "" {
+		enlace("", "first")
+		enlace(pagina.CursorAnterior, "prev")
+	}
+	if pagina.CursorSiguiente != "" {
+		enlace(pagina.CursorSiguiente, "next")
+	}
+	return strings.Join(enlaces, ", ")
 }
 
 func (lc *LibroController) ObtenerLibroPorID(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	idStr := vars["id"]
-	id, err := strconv.Atoi(idStr)
-	if err != nil {
-		http.Error(w, "ID de libro inválido", http.StatusBadRequest)
+	id, ok := idDeRuta(w, r)
+	if !ok {
 		return
 	}
 
 	libro, err := lc.Almacen.ObtenerLibro(id)
 	if err != nil {
-		if err == models.ErrLibroNoEncontrado {
-			http.Error(w, "Libro no encontrado", http.StatusNotFound)
+		if errors.Is(err, models.ErrLibroNoEncontrado) {
+			responderError(w, http.StatusNotFound, "Libro no encontrado")
 		} else {
-			http.Error(w, "Error al obtener libro: "+err.Error(), http.StatusInternalServerError)
+			log.Printf("Error al obtener libro %d vía API: %v", id, err)
+			responderError(w, http.StatusInternalServerError, "Error interno al obtener libro")
 		}
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(libro)
+	responderJSON(w, http.StatusOK, libro)
 }
 
-func (lc *LibroController) ActualizarLibro(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	idStr := vars["id"]
-	id, err := strconv.Atoi(idStr)
+// ObtenerLibroPorSlug devuelve el libro cuyo slug coincide con el parámetro {slug} de la ruta.
+func (lc *LibroController) ObtenerLibroPorSlug(w http.ResponseWriter, r *http.Request) {
+	slug := mux.Vars(r)["slug"]
+	libro, err := lc.Almacen.ObtenerLibroPorSlug(slug)
 	if err != nil {
-		http.Error(w, "ID de libro inválido", http.StatusBadRequest)
+		if errors.Is(err, models.ErrLibroNoEncontrado) {
+			responderError(w, http.StatusNotFound, "Libro no encontrado")
+		} else {
+			log.Printf("Error al obtener libro %q vía API: %v", slug, err)
+			responderError(w, http.StatusInternalServerError, "Error interno al obtener libro")
+		}
 		return
 	}
 
-	var updates map[string]interface{}
-	body, err := ioutil.ReadAll(r.Body)
+	responderJSON(w, http.StatusOK, libro)
+}
+
+// ObtenerLibroPorISBN devuelve el libro con el ISBN-10 o ISBN-13 del parámetro {isbn}.
+func (lc *LibroController) ObtenerLibroPorISBN(w http.ResponseWriter, r *http.Request) {
+	isbn := mux.Vars(r)["isbn"]
+	libro, err := lc.Almacen.ObtenerLibroPorISBN(isbn)
 	if err != nil {
-		http.Error(w, "Error al leer el cuerpo de la solicitud", http.StatusBadRequest)
+		if errors.Is(err, models.ErrISBNInvalido) {
+			responderError(w, http.StatusBadRequest, "ISBN inválido")
+		} else if errors.Is(err, models.ErrLibroNoEncontrado) {
+			responderError(w, http.StatusNotFound, "Libro no encontrado")
+		} else {
+			log.Printf("Error al obtener libro con ISBN %q vía API: %v", isbn, err)
+			responderError(w, http.StatusInternalServerError, "Error interno al obtener libro")
+		}
 		return
 	}
-	defer r.Body.Close()
 
-	if err := json.Unmarshal(body, &updates); err != nil {
-		http.Error(w, "Error al decodificar los datos de actualización: "+err.Error(), http.StatusBadRequest)
+	responderJSON(w, http.StatusOK, libro)
+}
+
+// ActualizarLibro modifica los campos de un libro presentes en el cuerpo JSON. Si algún
+// campo es desconocido o inválido responde 422 con todos ellos en "campos".
+func (lc *LibroController) ActualizarLibro(w http.ResponseWriter, r *http.Request) {
+	id, ok := idDeRuta(w, r)
+	if !ok {
+		return
+	}
+
+	var campos map[string]json.RawMessage
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&campos); err != nil {
+		responderError(w, http.StatusBadRequest, "Solicitud JSON inválida: "+err.Error())
+		return
+	}
+	if len(campos) == 0 {
+		responderError(w, http.StatusBadRequest, "No se proporcionaron campos para actualizar")
 		return
 	}
 
-	err = lc.Almacen.ActualizarLibro(id, updates)
+	patch, err := models.LibroPatchDesdeJSON(campos)
+	if err == nil {
+		err = lc.Almacen.ActualizarLibro(id, patch)
+	}
 	if err != nil {
-		if err == models.ErrLibroNoEncontrado {
-			http.Error(w, "Libro no encontrado", http.StatusNotFound)
+		var errsCampos models.ErroresValidacion
+		if errors.As(err, &errsCampos) {
+			responderErrorValidacion(w, errsCampos)
+		} else if errors.Is(err, models.ErrLibroNoEncontrado) {
+			responderError(w, http.StatusNotFound, "Libro no encontrado")
+		} else if errors.Is(err, models.ErrISBNDuplicado) {
+			responderError(w, http.StatusConflict, "Ya existe un libro con ese ISBN")
 		} else {
-			http.Error(w, "Error al actualizar libro: "+err.Error(), http.StatusInternalServerError)
+			log.Printf("Error al actualizar libro %d vía API: %v", id, err)
+			responderError(w, http.StatusInternalServerError, "Error interno al actualizar libro")
 		}
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, "Libro con ID %d actualizado exitosamente", id)
+	// Devolvemos el libro tal como quedó en la base de datos
+	libro, err := lc.Almacen.ObtenerLibro(id)
+	if err != nil {
+		log.Printf("Error al releer libro %d tras actualizarlo: %v", id, err)
+		responderError(w, http.StatusInternalServerError, "Error interno al obtener libro actualizado")
+		return
+	}
+	responderJSON(w, http.StatusOK, libro)
 }
 
 func (lc *LibroController) EliminarLibro(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	idStr := vars["id"]
-	id, err := strconv.Atoi(idStr)
-	if err != nil {
-		http.Error(w, "ID de libro inválido", http.StatusBadRequest)
+	id, ok := idDeRuta(w, r)
+	if !ok {
 		return
 	}
 
-	err = lc.Almacen.EliminarLibro(id)
+	err := lc.Almacen.EliminarLibro(id)
 	if err != nil {
-		if err == models.ErrLibroNoEncontrado {
-			http.Error(w, "Libro no encontrado", http.StatusNotFound)
+		if errors.Is(err, models.ErrLibroNoEncontrado) {
+			responderError(w, http.StatusNotFound, "Libro no encontrado")
 		} else {
-			http.Error(w, "Error al eliminar libro: "+err.Error(), http.StatusInternalServerError)
+			log.Printf("Error al eliminar libro %d vía API: %v", id, err)
+			responderError(w, http.StatusInternalServerError, "Error interno al eliminar libro")
 		}
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, "Libro con ID %d eliminado exitosamente", id)
+	responderJSON(w, http.StatusOK, MensajeAPI{Mensaje: fmt.Sprintf("Libro con ID %d eliminado exitosamente", id)})
 }
@@ -0,0 +1,650 @@
+package controllers_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"libroselectronicos/controllers"
+	"libroselectronicos/db"
+	"libroselectronicos/models"
+
+	"github.com/gorilla/mux"
+)
+
+// MockApiAlmacen es una implementación mock de db.LibroAlmacenamiento para pruebas de API.
+// Los métodos que los tests no necesitan se delegan en la interfaz embebida (nil),
+// así que llamarlos hace fallar el test con un panic.
+type MockApiAlmacen struct {
+	db.LibroAlmacenamiento
+
+	MockAgregarLibro    func(libro *models.Libro) (*models.Libro, error)
+	MockListarLibros    func(consulta models.ConsultaLibros) (*models.PaginaLibros, error)
+	MockObtenerLibro    func(id int) (*models.Libro, error)
+	MockObtenerPorSlug  func(slug string) (*models.Libro, error)
+	MockObtenerPorISBN  func(isbn string) (*models.Libro, error)
+	MockActualizarLibro func(id int, patch models.LibroPatch) error
+	MockEliminarLibro   func(id int) error
+	MockBuscarLibros    func(consulta string, opts models.OpcionesBusqueda) ([]*models.ResultadoBusqueda, error)
+	MockImportarLibros  func(filas []models.FilaImportacion, simular bool) ([]models.ErrorFila, int, error)
+}
+
+func (m *MockApiAlmacen) AgregarLibro(libro *models.Libro) (*models.Libro, error) {
+	if m.MockAgregarLibro != nil {
+		return m.MockAgregarLibro(libro)
+	}
+	return nil, errors.New("AgregarLibro no implementado en mock")
+}
+
+func (m *MockApiAlmacen) ListarLibros(consulta models.ConsultaLibros) (*models.PaginaLibros, error) {
+	if m.MockListarLibros != nil {
+		return m.MockListarLibros(consulta)
+	}
+	return &models.PaginaLibros{Libros: []*models.Libro{}}, nil
+}
+
+func (m *MockApiAlmacen) ObtenerLibro(id int) (*models.Libro, error) {
+	if m.MockObtenerLibro != nil {
+		return m.MockObtenerLibro(id)
+	}
+	return nil, models.ErrLibroNoEncontrado
+}
+
+func (m *MockApiAlmacen) ObtenerLibroPorSlug(slug string) (*models.Libro, error) {
+	if m.MockObtenerPorSlug != nil {
+		return m.MockObtenerPorSlug(slug)
+	}
+	return nil, models.ErrLibroNoEncontrado
+}
+
+func (m *MockApiAlmacen) ObtenerLibroPorISBN(isbn string) (*models.Libro, error) {
+	if m.MockObtenerPorISBN != nil {
+		return m.MockObtenerPorISBN(isbn)
+	}
+	return nil, models.ErrLibroNoEncontrado
+}
+
+func (m *MockApiAlmacen) ActualizarLibro(id int, patch models.LibroPatch) error {
+	if m.MockActualizarLibro != nil {
+		return m.MockActualizarLibro(id, patch)
+	}
+	return errors.New("ActualizarLibro no implementado en mock")
+}
+
+func (m *MockApiAlmacen) EliminarLibro(id int) error {
+	if m.MockEliminarLibro != nil {
+		return m.MockEliminarLibro(id)
+	}
+	return errors.New("EliminarLibro no implementado en mock")
+}
+
+func (m *MockApiAlmacen) BuscarLibros(consulta string, opts models.OpcionesBusqueda) ([]*models.ResultadoBusqueda, error) {
+	if m.MockBuscarLibros != nil {
+		return m.MockBuscarLibros(consulta, opts)
+	}
+	return nil, errors.New("BuscarLibros no implementado en mock")
+}
+
+func (m *MockApiAlmacen) ImportarLibros(filas []models.FilaImportacion, simular bool) ([]models.ErrorFila, int, error) {
+	if m.MockImportarLibros != nil {
+		return m.MockImportarLibros(filas, simular)
+	}
+	return nil, 0, errors.New("ImportarLibros no implementado en mock")
+}
+
+// nuevoRouterAPI monta el controlador igual que main.go, bajo /api/v1.
+func nuevoRouterAPI(almacen db.LibroAlmacenamiento) *mux.Router {
+	controller := controllers.NuevoLibroController(almacen)
+	router := mux.NewRouter()
+	api := router.PathPrefix("/api/v1").Subrouter()
+	api.HandleFunc("/libros", controller.ObtenerLibros).Methods("GET")
+	api.HandleFunc("/libros", controller.CrearLibro).Methods("POST")
+	api.HandleFunc("/libros/importar", controller.ImportarLibros).Methods("POST")
+	api.HandleFunc("/libros/slug/{slug}", controller.ObtenerLibroPorSlug).Methods("GET")
+	api.HandleFunc("/libros/isbn/{isbn}", controller.ObtenerLibroPorISBN).Methods("GET")
+	api.HandleFunc("/libros/{id}", controller.ObtenerLibroPorID).Methods("GET")
+	api.HandleFunc("/libros/{id}", controller.ActualizarLibro).Methods("PUT")
+	api.HandleFunc("/libros/{id}", controller.EliminarLibro).Methods("DELETE")
+	return router
+}
+
+// comprobarRespuesta verifica el código de estado, el tipo de contenido y el cuerpo JSON.
+func comprobarRespuesta(t *testing.T, rr *httptest.ResponseRecorder, expectedStatus int, expectedBody string) {
+	t.Helper()
+	if status := rr.Code; status != expectedStatus {
+		t.Errorf("Manejador devolvió código de estado incorrecto: esperado %d, obtenido %d. Cuerpo: %s", expectedStatus, status, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+		t.Errorf("Content-Type incorrecto: %q", ct)
+	}
+	if rr.Body.String() != expectedBody {
+		t.Errorf("Manejador devolvió cuerpo incorrecto: esperado %q, obtenido %q", expectedBody, rr.Body.String())
+	}
+}
+
+// TestObtenerLibrosAPI prueba la ruta GET /api/v1/libros
+func TestObtenerLibrosAPI(t *testing.T) {
+	mockAlmacen := &MockApiAlmacen{
+		MockListarLibros: func(consulta models.ConsultaLibros) (*models.PaginaLibros, error) {
+			return &models.PaginaLibros{Total: 2, Libros: []*models.Libro{
+				models.NuevoLibroConCaratula(1, "Libro Uno", "Autor A", 2000, "url1.jpg"),
+				models.NuevoLibroConCaratula(2, "Libro Dos", "Autor B", 2005, "url2.jpg"),
+			}}, nil
+		},
+	}
+
+	req := httptest.NewRequest("GET", "/api/v1/libros", nil)
+	rr := httptest.NewRecorder()
+	nuevoRouterAPI(mockAlmacen).ServeHTTP(rr, req)
+
+	expectedBody := `[{"id":1,"slug":"","titulo":"Libro Uno","autor":"Autor A","anio":2000,"isbn":"","idioma":"","editorial":"","caratula_url":"url1.jpg","sinopsis":"","disponible":true},` +
+		`{"id":2,"slug":"","titulo":"Libro Dos","autor":"Autor B","anio":2005,"isbn":"","idioma":"","editorial":"","caratula_url":"url2.jpg","sinopsis":"","disponible":true}]` + "\n"
+	comprobarRespuesta(t, rr, http.StatusOK, expectedBody)
+}
+
+// TestObtenerLibrosPaginadosAPI prueba los parámetros de listado y las cabeceras de paginación.
+func TestObtenerLibrosPaginadosAPI(t *testing.T) {
+	var consultaRecibida models.ConsultaLibros
+	mockAlmacen := &MockApiAlmacen{
+		MockListarLibros: func(consulta models.ConsultaLibros) (*models.PaginaLibros, error) {
+			consultaRecibida = consulta
+			return &models.PaginaLibros{
+				Libros:          []*models.Libro{models.NuevoLibro(3, "Libro Tres", "Autor A", 2010)},
+				Total:           7,
+				CursorAnterior:  "ant",
+				CursorSiguiente: "sig",
+			}, nil
+		},
+	}
+
+	req := httptest.NewRequest("GET", "/api/v1/libros?limite=1&orden=anio&direccion=desc&autor=Autor+A&disponible=true&cursor=abc", nil)
+	rr := httptest.NewRecorder()
+	nuevoRouterAPI(mockAlmacen).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Código de estado incorrecto: esperado %d, obtenido %d. Cuerpo: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if c := consultaRecibida; c.Limite != 1 || c.Orden != models.OrdenAnio || c.Direccion != models.DireccionDesc ||
+		c.Autor != "Autor A" || c.Disponible == nil || !*c.Disponible || c.Cursor != "abc" {
+		t.Errorf("Consulta mal interpretada: %+v", c)
+	}
+	if total := rr.Header().Get("X-Total-Count"); total != "7" {
+		t.Errorf("X-Total-Count incorrecto: %q", total)
+	}
+	expectedLink := `</api/v1/libros?autor=Autor+A&direccion=desc&disponible=true&limite=1&orden=anio>; rel="first", ` +
+		`</api/v1/libros?autor=Autor+A&cursor=ant&direccion=desc&disponible=true&limite=1&orden=anio>; rel="prev", ` +
+		`</api/v1/libros?autor=Autor+A&cursor=sig&direccion=desc&disponible=true&limite=1&orden=anio>; rel="next"`
+	if link := rr.Header().Get("Link"); link != expectedLink {
+		t.Errorf("Cabecera Link incorrecta:\n esperada %s\n obtenida %s", expectedLink, link)
+	}
+
+	// Parámetros inválidos
+	for _, query := range []string{"limite=0x", "limite=1000", "orden=sinopsis", "direccion=arriba", "disponible=quizas", "anio_desde=2000&anio_hasta=1990"} {
+		req := httptest.NewRequest("GET", "/api/v1/libros?"+query, nil)
+		rr := httptest.NewRecorder()
+		nuevoRouterAPI(mockAlmacen).ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("?%s: se esperaba %d, obtenido %d", query, http.StatusBadRequest, rr.Code)
+		}
+	}
+}
+
+// TestBuscarLibrosAPI prueba la ruta GET /api/v1/libros?q=
+func TestBuscarLibrosAPI(t *testing.T) {
+	var consultaRecibida string
+	mockAlmacen := &MockApiAlmacen{
+		MockBuscarLibros: func(consulta string, opts models.OpcionesBusqueda) ([]*models.ResultadoBusqueda, error) {
+			consultaRecibida = consulta
+			return []*models.ResultadoBusqueda{
+				{Libro: models.NuevoLibro(1, "Libro Uno", "Autor A", 2000), Puntuacion: 1.5, Titulo: "<mark>Libro</mark> Uno", Fragmento: "<mark>Libro</mark> Uno"},
+			}, nil
+		},
+	}
+
+	req := httptest.NewRequest("GET", "/api/v1/libros?q=libro+uno", nil)
+	rr := httptest.NewRecorder()
+	nuevoRouterAPI(mockAlmacen).ServeHTTP(rr, req)
+
+	if consultaRecibida != "libro uno" {
+		t.Errorf("Consulta incorrecta: esperada %q, obtenida %q", "libro uno", consultaRecibida)
+	}
+	expectedBody := `[{"libro":{"id":1,"slug":"","titulo":"Libro Uno","autor":"Autor A","anio":2000,"isbn":"","idioma":"","editorial":"","caratula_url":"","sinopsis":"","disponible":true},` +
+		`"puntuacion":1.5,"titulo":"\u003cmark\u003eLibro\u003c/mark\u003e Uno","fragmento":"\u003cmark\u003eLibro\u003c/mark\u003e Uno"}]` + "\n"
+	comprobarRespuesta(t, rr, http.StatusOK, expectedBody)
+}
+
+// TestObtenerLibroPorIDAPI prueba la ruta GET /api/v1/libros/{id}
+func TestObtenerLibroPorIDAPI(t *testing.T) {
+	tests := []struct {
+		name           string
+		id             string
+		mockBook       *models.Libro
+		mockError      error
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Libro encontrado",
+			id:             "1",
+			mockBook:       models.NuevoLibroConCaratula(1, "Libro de Prueba", "Autor Prueba", 2020, "url.jpg"),
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"id":1,"slug":"","titulo":"Libro de Prueba","autor":"Autor Prueba","anio":2020,"isbn":"","idioma":"","editorial":"","caratula_url":"url.jpg","sinopsis":"","disponible":true}` + "\n",
+		},
+		{
+			name:           "Libro no encontrado",
+			id:             "99",
+			mockError:      models.ErrLibroNoEncontrado,
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"error":"Libro no encontrado"}` + "\n",
+		},
+		{
+			name:           "ID inválido",
+			id:             "abc",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"ID de libro inválido"}` + "\n",
+		},
+		{
+			name:           "Error de la base de datos",
+			id:             "1",
+			mockError:      errors.New("disco lleno"),
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   `{"error":"Error interno al obtener libro"}` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockAlmacen := &MockApiAlmacen{
+				MockObtenerLibro: func(id int) (*models.Libro, error) {
+					return tt.mockBook, tt.mockError
+				},
+			}
+
+			req := httptest.NewRequest("GET", "/api/v1/libros/"+tt.id, nil)
+			rr := httptest.NewRecorder()
+			nuevoRouterAPI(mockAlmacen).ServeHTTP(rr, req)
+
+			comprobarRespuesta(t, rr, tt.expectedStatus, tt.expectedBody)
+		})
+	}
+}
+
+// TestObtenerLibroPorSlugAPI prueba la ruta GET /api/v1/libros/slug/{slug}
+func TestObtenerLibroPorSlugAPI(t *testing.T) {
+	mockAlmacen := &MockApiAlmacen{
+		MockObtenerPorSlug: func(slug string) (*models.Libro, error) {
+			if slug != "rayuela" {
+				return nil, models.ErrLibroNoEncontrado
+			}
+			return &models.Libro{ID: 3, Slug: "rayuela", Titulo: "Rayuela", Autor: "Julio Cortázar", Anio: 1963, Disponible: true}, nil
+		},
+	}
+
+	req := httptest.NewRequest("GET", "/api/v1/libros/slug/rayuela", nil)
+	rr := httptest.NewRecorder()
+	nuevoRouterAPI(mockAlmacen).ServeHTTP(rr, req)
+	comprobarRespuesta(t, rr, http.StatusOK, `{"id":3,"slug":"rayuela","titulo":"Rayuela","autor":"Julio Cortázar","anio":1963,"isbn":"","idioma":"","editorial":"","caratula_url":"","sinopsis":"","disponible":true}`+"\n")
+
+	req = httptest.NewRequest("GET", "/api/v1/libros/slug/no-existe", nil)
+	rr = httptest.NewRecorder()
+	nuevoRouterAPI(mockAlmacen).ServeHTTP(rr, req)
+	comprobarRespuesta(t, rr, http.StatusNotFound, `{"error":"Libro no encontrado"}`+"\n")
+}
+
+// TestObtenerLibroPorISBNAPI prueba la ruta GET /api/v1/libros/isbn/{isbn}
+func TestObtenerLibroPorISBNAPI(t *testing.T) {
+	mockAlmacen := &MockApiAlmacen{
+		MockObtenerPorISBN: func(isbn string) (*models.Libro, error) {
+			switch isbn {
+			case "843760494X":
+				return &models.Libro{ID: 3, Slug: "rayuela", Titulo: "Rayuela", Autor: "Julio Cortázar", Anio: 1963, ISBN: "9788437604947", Disponible: true}, nil
+			case "123":
+				return nil, fmt.Errorf("%w: debe tener 10 o 13 dígitos", models.ErrISBNInvalido)
+			}
+			return nil, models.ErrLibroNoEncontrado
+		},
+	}
+
+	tests := []struct {
+		isbn           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"843760494X", http.StatusOK, `{"id":3,"slug":"rayuela","titulo":"Rayuela","autor":"Julio Cortázar","anio":1963,"isbn":"9788437604947","idioma":"","editorial":"","caratula_url":"","sinopsis":"","disponible":true}` + "\n"},
+		{"123", http.StatusBadRequest, `{"error":"ISBN inválido"}` + "\n"},
+		{"9780306406157", http.StatusNotFound, `{"error":"Libro no encontrado"}` + "\n"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/api/v1/libros/isbn/"+tt.isbn, nil)
+		rr := httptest.NewRecorder()
+		nuevoRouterAPI(mockAlmacen).ServeHTTP(rr, req)
+		comprobarRespuesta(t, rr, tt.expectedStatus, tt.expectedBody)
+	}
+}
+
+// TestCrearLibroAPI prueba la ruta POST /api/v1/libros
+func TestCrearLibroAPI(t *testing.T) {
+	tests := []struct {
+		name             string
+		inputJSON        string
+		mockError        error
+		expectedStatus   int
+		expectedBody     string
+		expectedLocation string
+	}{
+		{
+			name:             "Creación exitosa",
+			inputJSON:        `{"titulo":"Nuevo Libro","autor":"Nuevo Autor","anio":2024,"idioma":"es","editorial":"Alfaguara","caratula_url":"https://example.com/new.jpg","sinopsis":"Resumen"}`,
+			expectedStatus:   http.StatusCreated,
+			expectedBody:     `{"id":7,"slug":"nuevo-libro","titulo":"Nuevo Libro","autor":"Nuevo Autor","anio":2024,"isbn":"","idioma":"es","editorial":"Alfaguara","caratula_url":"https://example.com/new.jpg","sinopsis":"Resumen","disponible":true}` + "\n",
+			expectedLocation: "/api/v1/libros/7",
+		},
+		{
+			name:           "El ID no se acepta",
+			inputJSON:      `{"id":1,"titulo":"Libro con ID","autor":"Autor","anio":2020}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedBody:   `{"error":"Datos inválidos","campos":{"id":"campo desconocido"}}` + "\n",
+		},
+		{
+			name:           "Campos obligatorios e inválidos",
+			inputJSON:      `{"titulo":"","slug":"mi-slug"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedBody:   `{"error":"Datos inválidos","campos":{"anio":"es obligatorio","autor":"es obligatorio","slug":"campo desconocido","titulo":"no puede estar vacío"}}` + "\n",
+		},
+		{
+			name:           "JSON inválido",
+			inputJSON:      `{"titulo":"Nuevo Libro"`,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"Solicitud JSON inválida: unexpected EOF"}` + "\n",
+		},
+		{
+			name:           "ISBN inválido",
+			inputJSON:      `{"titulo":"Nuevo Libro","autor":"Nuevo Autor","anio":2024,"isbn":"978-0-306-40615-8"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedBody:   `{"error":"Datos inválidos","campos":{"isbn":"no es un ISBN-10 o ISBN-13 válido"}}` + "\n",
+		},
+		{
+			name:           "Idioma inválido",
+			inputJSON:      `{"titulo":"Nuevo Libro","autor":"Nuevo Autor","anio":2024,"idioma":"español"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedBody:   `{"error":"Datos inválidos","campos":{"idioma":"debe ser una etiqueta de idioma como es o en-US"}}` + "\n",
+		},
+		{
+			name:           "ISBN duplicado",
+			inputJSON:      `{"titulo":"Nuevo Libro","autor":"Nuevo Autor","anio":2024,"isbn":"0-306-40615-2"}`,
+			mockError:      models.ErrISBNDuplicado,
+			expectedStatus: http.StatusConflict,
+			expectedBody:   `{"error":"Ya existe un libro con ese ISBN"}` + "\n",
+		},
+		{
+			name:           "Error del almacén",
+			inputJSON:      `{"titulo":"Nuevo Libro","autor":"Nuevo Autor","anio":2024}`,
+			mockError:      errors.New("disco lleno"),
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   `{"error":"Error interno al agregar libro"}` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockAlmacen := &MockApiAlmacen{
+				MockAgregarLibro: func(libro *models.Libro) (*models.Libro, error) {
+					if tt.mockError != nil {
+						return nil, tt.mockError
+					}
+					creado := *libro
+					creado.ID, creado.Slug = 7, models.GenerarSlug(libro.Titulo)
+					return &creado, nil
+				},
+			}
+
+			req := httptest.NewRequest("POST", "/api/v1/libros", bytes.NewBufferString(tt.inputJSON))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			nuevoRouterAPI(mockAlmacen).ServeHTTP(rr, req)
+
+			comprobarRespuesta(t, rr, tt.expectedStatus, tt.expectedBody)
+			if loc := rr.Header().Get("Location"); loc != tt.expectedLocation {
+				t.Errorf("Location incorrecto: esperado %q, obtenido %q", tt.expectedLocation, loc)
+			}
+		})
+	}
+}
+
+// TestCrearLibroAPIReferenciasInexistentes crea libros contra una base de datos real para
+// comprobar que las referencias que solo valida el almacén también se responden con 422.
+func TestCrearLibroAPIReferenciasInexistentes(t *testing.T) {
+	almacen := db.NewAlmacenForTest(filepath.Join(t.TempDir(), "libros.db"))
+	if almacen == nil {
+		t.Fatal("No se pudo crear el almacén de prueba")
+	}
+	defer almacen.Close()
+
+	tests := []struct {
+		name         string
+		inputJSON    string
+		expectedBody string
+	}{
+		{
+			name:         "Autor inexistente",
+			inputJSON:    `{"titulo":"Niebla","anio":1914,"autores":[{"autor_id":99,"rol":"autor"}]}`,
+			expectedBody: `{"error":"Datos inválidos","campos":{"autores[0].autor_id":"autor no encontrado"}}` + "\n",
+		},
+		{
+			name:         "Género inexistente",
+			inputJSON:    `{"titulo":"Niebla","autor":"Miguel de Unamuno","anio":1914,"generos":["nivola"]}`,
+			expectedBody: `{"error":"Datos inválidos","campos":{"generos":"género desconocido: \"nivola\""}}` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/v1/libros", bytes.NewBufferString(tt.inputJSON))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			nuevoRouterAPI(almacen).ServeHTTP(rr, req)
+
+			comprobarRespuesta(t, rr, http.StatusUnprocessableEntity, tt.expectedBody)
+		})
+	}
+	if pagina, err := almacen.ListarLibros(models.ConsultaLibros{}); err != nil || len(pagina.Libros) != 0 {
+		t.Errorf("No debería haberse guardado ningún libro: %v, %v", pagina, err)
+	}
+}
+
+// TestImportarLibrosAPI prueba la ruta POST /api/v1/libros/importar
+func TestImportarLibrosAPI(t *testing.T) {
+	tests := []struct {
+		name           string
+		url            string
+		contentType    string
+		cuerpo         string
+		duplicado      bool
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Importación CSV",
+			url:            "/api/v1/libros/importar",
+			contentType:    "text/csv; charset=utf-8",
+			cuerpo:         "titulo,autor,anio\nNiebla,Miguel de Unamuno,1914\n",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"simulacion":false,"filas":1,"validas":1,"importados":1,"errores":[]}` + "\n",
+		},
+		{
+			name:           "Simulación JSON Lines con errores",
+			url:            "/api/v1/libros/importar?formato=jsonl&simular=true",
+			cuerpo:         `{"titulo":"Niebla","autor":"Miguel de Unamuno","anio":1914}` + "\n" + `{"titulo":"Sin año","autor":"X"}` + "\n",
+			duplicado:      true,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedBody:   `{"simulacion":true,"filas":2,"validas":0,"importados":0,"errores":[{"fila":1,"duplicado":"coincide con el libro 1 del catálogo"},{"fila":2,"campos":{"anio":"es obligatorio"}}]}` + "\n",
+		},
+		{
+			name:           "Formato desconocido",
+			url:            "/api/v1/libros/importar",
+			contentType:    "application/json",
+			cuerpo:         `[]`,
+			expectedStatus: http.StatusUnsupportedMediaType,
+			expectedBody:   `{"error":"formato de importación desconocido: use csv o jsonl"}` + "\n",
+		},
+		{
+			name:           "Cabecera CSV inválida",
+			url:            "/api/v1/libros/importar?formato=csv",
+			cuerpo:         "titulo,precio\n",
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedBody:   `{"error":"Datos inválidos","campos":{"cabecera":"columna desconocida \"precio\""}}` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockAlmacen := &MockApiAlmacen{
+				MockImportarLibros: func(filas []models.FilaImportacion, simular bool) ([]models.ErrorFila, int, error) {
+					if tt.duplicado {
+						return []models.ErrorFila{{Fila: filas[0].Numero, Duplicado: "coincide con el libro 1 del catálogo"}}, 0, nil
+					}
+					if simular {
+						return nil, 0, nil
+					}
+					return nil, len(filas), nil
+				},
+			}
+
+			req := httptest.NewRequest("POST", tt.url, bytes.NewBufferString(tt.cuerpo))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rr := httptest.NewRecorder()
+			nuevoRouterAPI(mockAlmacen).ServeHTTP(rr, req)
+
+			comprobarRespuesta(t, rr, tt.expectedStatus, tt.expectedBody)
+		})
+	}
+}
+
+// TestActualizarLibroAPI prueba la ruta PUT /api/v1/libros/{id}
+func TestActualizarLibroAPI(t *testing.T) {
+	tests := []struct {
+		name                  string
+		id                    string
+		inputJSON             string
+		mockUpdateErr         error
+		mockGetAfterUpdate    *models.Libro
+		mockGetAfterUpdateErr error
+		expectedStatus        int
+		expectedBody          string
+	}{
+		{
+			name:               "Actualización exitosa",
+			id:                 "1",
+			inputJSON:          `{"titulo":"Título Actualizado","anio":2025,"caratula_url":"http://example.com/updated.jpg"}`,
+			mockGetAfterUpdate: models.NuevoLibroConCaratula(1, "Título Actualizado", "Autor Existente", 2025, "http://example.com/updated.jpg"),
+			expectedStatus:     http.StatusOK,
+			expectedBody:       `{"id":1,"slug":"","titulo":"Título Actualizado","autor":"Autor Existente","anio":2025,"isbn":"","idioma":"","editorial":"","caratula_url":"http://example.com/updated.jpg","sinopsis":"","disponible":true}` + "\n",
+		},
+		{
+			name:           "Campos inválidos y desconocidos",
+			id:             "1",
+			inputJSON:      `{"titulo":"  ","anio":99999,"caratula_url":"javascript:alert(1)","autor":7,"sinopsis":null,"id = 1; --":"x"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedBody: `{"error":"Datos inválidos","campos":{"anio":"debe estar entre -3000 y ` + strconv.Itoa(time.Now().Year()+1) + `",` +
+				`"autor":"tipo inválido","caratula_url":"debe ser una URL http(s) o una ruta que empiece por /",` +
+				`"id = 1; --":"campo desconocido","sinopsis":"no puede ser null","titulo":"no puede estar vacío"}}` + "\n",
+		},
+		{
+			name:           "Libro no encontrado para actualizar",
+			id:             "99",
+			inputJSON:      `{"titulo":"Inexistente"}`,
+			mockUpdateErr:  models.ErrLibroNoEncontrado,
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"error":"Libro no encontrado"}` + "\n",
+		},
+		{
+			name:           "ID inválido",
+			id:             "abc",
+			inputJSON:      `{"titulo":"Test"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"ID de libro inválido"}` + "\n",
+		},
+		{
+			name:           "Sin campos",
+			id:             "1",
+			inputJSON:      `{}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"No se proporcionaron campos para actualizar"}` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockAlmacen := &MockApiAlmacen{
+				MockActualizarLibro: func(id int, patch models.LibroPatch) error {
+					return tt.mockUpdateErr
+				},
+				MockObtenerLibro: func(id int) (*models.Libro, error) {
+					return tt.mockGetAfterUpdate, tt.mockGetAfterUpdateErr
+				},
+			}
+
+			req := httptest.NewRequest("PUT", "/api/v1/libros/"+tt.id, bytes.NewBufferString(tt.inputJSON))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			nuevoRouterAPI(mockAlmacen).ServeHTTP(rr, req)
+
+			comprobarRespuesta(t, rr, tt.expectedStatus, tt.expectedBody)
+		})
+	}
+}
+
+// TestEliminarLibroAPI prueba la ruta DELETE /api/v1/libros/{id}
+func TestEliminarLibroAPI(t *testing.T) {
+	tests := []struct {
+		name           string
+		id             string
+		mockError      error
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Eliminación exitosa",
+			id:             "1",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"mensaje":"Libro con ID 1 eliminado exitosamente"}` + "\n",
+		},
+		{
+			name:           "Libro no encontrado para eliminar",
+			id:             "99",
+			mockError:      models.ErrLibroNoEncontrado,
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"error":"Libro no encontrado"}` + "\n",
+		},
+		{
+			name:           "ID inválido",
+			id:             "abc",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"ID de libro inválido"}` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockAlmacen := &MockApiAlmacen{
+				MockEliminarLibro: func(id int) error {
+					return tt.mockError
+				},
+			}
+
+			req := httptest.NewRequest("DELETE", "/api/v1/libros/"+tt.id, nil)
+			rr := httptest.NewRecorder()
+			nuevoRouterAPI(mockAlmacen).ServeHTTP(rr, req)
+
+			comprobarRespuesta(t, rr, tt.expectedStatus, tt.expectedBody)
+		})
+	}
+}
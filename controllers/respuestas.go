@@ -0,0 +1,39 @@
+package controllers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"libroselectronicos/models"
+)
+
+// ErrorAPI es el cuerpo JSON de todas las respuestas de error de la API.
+type ErrorAPI struct {
+	Error  string            `json:"error"`
+	Campos map[string]string `json:"campos,omitempty"` // Motivo por campo, en errores de validación
+}
+
+// MensajeAPI es el cuerpo JSON de las respuestas que no devuelven un recurso.
+type MensajeAPI struct {
+	Mensaje string `json:"mensaje"`
+}
+
+// responderJSON escribe 'v' como JSON con el código de estado indicado.
+func responderJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error al codificar respuesta JSON: %v", err)
+	}
+}
+
+// responderError escribe un ErrorAPI con el código de estado indicado.
+func responderError(w http.ResponseWriter, status int, mensaje string) {
+	responderJSON(w, status, ErrorAPI{Error: mensaje})
+}
+
+// responderErrorValidacion responde 422 con el motivo de cada campo inválido.
+func responderErrorValidacion(w http.ResponseWriter, errs models.ErroresValidacion) {
+	responderJSON(w, http.StatusUnprocessableEntity, ErrorAPI{Error: "Datos inválidos", Campos: errs})
+}
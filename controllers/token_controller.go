@@ -0,0 +1,113 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"libroselectronicos/db"
+	"libroselectronicos/models"
+
+	"github.com/gorilla/mux"
+)
+
+// TokenController gestiona los tokens de API del usuario autenticado.
+type TokenController struct {
+	Almacen db.LibroAlmacenamiento
+}
+
+func NuevoTokenController(almacen db.LibroAlmacenamiento) *TokenController {
+	return &TokenController{Almacen: almacen}
+}
+
+// SolicitudToken es el cuerpo de POST /api/v1/tokens.
+type SolicitudToken struct {
+	Nombre  string `json:"nombre"`
+	Alcance string `json:"alcance"` // Opcional: por defecto, el rol del usuario
+}
+
+// TokenCreado es la respuesta a la creación de un token. Token solo se devuelve aquí.
+type TokenCreado struct {
+	Token    string           `json:"token"`
+	TokenAPI *models.TokenAPI `json:"token_api"`
+}
+
+func (tc *TokenController) CrearToken(w http.ResponseWriter, r *http.Request) {
+	usuario := UsuarioAutenticado(r)
+
+	var solicitud SolicitudToken
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&solicitud); err != nil {
+		responderError(w, http.StatusBadRequest, "Solicitud JSON inválida: "+err.Error())
+		return
+	}
+	if solicitud.Nombre == "" {
+		responderError(w, http.StatusBadRequest, "El nombre del token es requerido")
+		return
+	}
+	if solicitud.Alcance == "" {
+		solicitud.Alcance = usuario.GetRol()
+	}
+	if !models.EsRolValido(solicitud.Alcance) {
+		responderError(w, http.StatusBadRequest, fmt.Sprintf("Alcance inválido: %q", solicitud.Alcance))
+		return
+	}
+	// Una credencial no puede emitir tokens con más privilegios que los suyos
+	if solicitud.Alcance == models.RolAdministrador && usuario.GetRol() != models.RolAdministrador {
+		responderError(w, http.StatusForbidden, "No puedes crear tokens de administrador")
+		return
+	}
+
+	token, prefijo, hash, err := GenerarToken()
+	if err != nil {
+		log.Printf("Error al generar token: %v", err)
+		responderError(w, http.StatusInternalServerError, "Error interno al generar token")
+		return
+	}
+	tokenAPI := models.NuevoTokenAPI(usuario.GetID(), solicitud.Nombre, prefijo, hash, solicitud.Alcance)
+	if err := tc.Almacen.AgregarTokenAPI(tokenAPI); err != nil {
+		log.Printf("Error al guardar token para el usuario %d: %v", usuario.GetID(), err)
+		responderError(w, http.StatusInternalServerError, "Error interno al guardar token")
+		return
+	}
+
+	responderJSON(w, http.StatusCreated, TokenCreado{Token: token, TokenAPI: tokenAPI})
+}
+
+func (tc *TokenController) ListarTokens(w http.ResponseWriter, r *http.Request) {
+	usuario := UsuarioAutenticado(r)
+
+	tokens, err := tc.Almacen.ListarTokensAPIPorUsuario(usuario.GetID())
+	if err != nil {
+		log.Printf("Error al listar tokens del usuario %d: %v", usuario.GetID(), err)
+		responderError(w, http.StatusInternalServerError, "Error interno al listar tokens")
+		return
+	}
+	responderJSON(w, http.StatusOK, tokens)
+}
+
+func (tc *TokenController) RevocarToken(w http.ResponseWriter, r *http.Request) {
+	usuario := UsuarioAutenticado(r)
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		responderError(w, http.StatusBadRequest, "ID de token inválido")
+		return
+	}
+
+	err = tc.Almacen.RevocarTokenAPI(usuario.GetID(), id)
+	if err != nil {
+		if errors.Is(err, models.ErrTokenNoEncontrado) {
+			responderError(w, http.StatusNotFound, "Token no encontrado")
+		} else {
+			log.Printf("Error al revocar token %d: %v", id, err)
+			responderError(w, http.StatusInternalServerError, "Error interno al revocar token")
+		}
+		return
+	}
+
+	responderJSON(w, http.StatusOK, MensajeAPI{Mensaje: fmt.Sprintf("Token con ID %d revocado", id)})
+}
@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"libroselectronicos/db"
+	"libroselectronicos/models"
+
+	"github.com/gorilla/mux"
+)
+
+// UsuarioController gestiona las cuentas de usuario. Sus rutas son solo para administradores.
+type UsuarioController struct {
+	Almacen db.LibroAlmacenamiento
+}
+
+func NuevoUsuarioController(almacen db.LibroAlmacenamiento) *UsuarioController {
+	return &UsuarioController{Almacen: almacen}
+}
+
+// RevocarSesiones cierra todas las sesiones de navegador del usuario {id}, p. ej. si su
+// cuenta se ha visto comprometida. Sus tokens de API se revocan aparte.
+func (uc *UsuarioController) RevocarSesiones(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		responderError(w, http.StatusBadRequest, "ID de usuario inválido")
+		return
+	}
+
+	if _, err := uc.Almacen.ObtenerUsuarioPorID(id); err != nil {
+		if errors.Is(err, models.ErrUsuarioNoEncontrado) {
+			responderError(w, http.StatusNotFound, "Usuario no encontrado")
+		} else {
+			log.Printf("Error al obtener el usuario %d: %v", id, err)
+			responderError(w, http.StatusInternalServerError, "Error interno al revocar sesiones")
+		}
+		return
+	}
+	revocadas, err := uc.Almacen.EliminarSesionesDeUsuario(id, 0)
+	if err != nil {
+		log.Printf("Error al revocar las sesiones del usuario %d: %v", id, err)
+		responderError(w, http.StatusInternalServerError, "Error interno al revocar sesiones")
+		return
+	}
+
+	log.Printf("%s revocó %d sesión(es) del usuario %d", UsuarioAutenticado(r).GetUsername(), revocadas, id)
+	responderJSON(w, http.StatusOK, MensajeAPI{Mensaje: fmt.Sprintf("%d sesión(es) del usuario %d revocada(s)", revocadas, id)})
+}
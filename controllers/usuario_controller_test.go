@@ -0,0 +1,71 @@
+package controllers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"libroselectronicos/controllers"
+	"libroselectronicos/models"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// mockSesionesAlmacen añade a mockTokensAlmacen el número de sesiones abiertas por usuario.
+type mockSesionesAlmacen struct {
+	*mockTokensAlmacen
+	sesiones map[int]int
+}
+
+func (m *mockSesionesAlmacen) EliminarSesionesDeUsuario(usuarioID, exceptoID int) (int, error) {
+	n := m.sesiones[usuarioID]
+	delete(m.sesiones, usuarioID)
+	return n, nil
+}
+
+func TestRevocarSesiones(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secreto"), bcrypt.MinCost)
+	almacen := &mockSesionesAlmacen{
+		mockTokensAlmacen: &mockTokensAlmacen{usuarios: map[int]*models.Usuario{
+			1: verificado(models.NuevoUsuario(1, "lector", string(hash), "", models.RolLector)),
+			2: verificado(models.NuevoUsuario(2, "admin", string(hash), "", models.RolAdministrador)),
+		}},
+		sesiones: map[int]int{1: 3},
+	}
+	router := mux.NewRouter()
+	api := router.PathPrefix("/api/v1").Subrouter()
+	api.Use(controllers.MiddlewareAutenticacion(almacen, controllers.PoliticaAPI{
+		"api.usuarios.sesiones": {models.RolAdministrador},
+	}))
+	api.HandleFunc("/usuarios/{id}/sesiones", controllers.NuevoUsuarioController(almacen).RevocarSesiones).Methods("DELETE").Name("api.usuarios.sesiones")
+
+	tests := []struct {
+		name           string
+		path           string
+		username       string
+		expectedStatus int
+	}{
+		{"Un lector no puede revocar sesiones", "/api/v1/usuarios/1/sesiones", "lector", http.StatusForbidden},
+		{"Usuario inexistente", "/api/v1/usuarios/99/sesiones", "admin", http.StatusNotFound},
+		{"ID inválido", "/api/v1/usuarios/abc/sesiones", "admin", http.StatusBadRequest},
+		{"Revocar las sesiones de un usuario", "/api/v1/usuarios/1/sesiones", "admin", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("DELETE", tt.path, nil)
+			req.SetBasicAuth(tt.username, "secreto")
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Código de estado incorrecto: esperado %d, obtenido %d. Cuerpo: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+		})
+	}
+
+	if _, ok := almacen.sesiones[1]; ok {
+		t.Errorf("Las sesiones del usuario 1 deberían haberse revocado")
+	}
+}
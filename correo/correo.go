@@ -0,0 +1,142 @@
+// Package correo envía los correos de la aplicación, como los de verificación de la
+// cuenta y los de restablecimiento de contraseña, a través de la interfaz Mailer: por
+// SMTP en producción, o guardándolos en archivos en desarrollo y en los tests.
+package correo
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrDestinatarioInvalido es un error que se devuelve cuando la dirección de destino no es válida.
+var ErrDestinatarioInvalido = errors.New("dirección de correo inválida")
+
+// Mensaje es un correo de texto plano.
+type Mensaje struct {
+	Para   string
+	Asunto string
+	Texto  string
+}
+
+// Mailer envía correos.
+type Mailer interface {
+	Enviar(m Mensaje) error
+}
+
+// SMTP envía los correos a un servidor SMTP. Usa STARTTLS si el servidor lo ofrece y,
+// si hay usuario, se autentica con PLAIN, que net/smtp solo permite cifrado o en localhost.
+type SMTP struct {
+	Direccion  string // "host:puerto"
+	Usuario    string
+	Contrasena string
+	Remitente  string
+}
+
+func NuevoSMTP(direccion, usuario, contrasena, remitente string) *SMTP {
+	return &SMTP{Direccion: direccion, Usuario: usuario, Contrasena: contrasena, Remitente: remitente}
+}
+
+func (s *SMTP) Enviar(m Mensaje) error {
+	datos, err := componer(s.Remitente, m, time.Now())
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if s.Usuario != "" {
+		host, _, err := net.SplitHostPort(s.Direccion)
+		if err != nil {
+			return fmt.Errorf("dirección SMTP %q inválida: %w", s.Direccion, err)
+		}
+		auth = smtp.PlainAuth("", s.Usuario, s.Contrasena, host)
+	}
+	return smtp.SendMail(s.Direccion, auth, direccion(s.Remitente), []string{direccion(m.Para)}, datos)
+}
+
+// Archivo guarda cada correo en un archivo .eml del directorio, que se puede abrir con
+// cualquier cliente de correo, y lo anota en el log. Sirve para desarrollo y para tests.
+type Archivo struct {
+	Directorio string
+	Remitente  string
+}
+
+func NuevoArchivo(directorio, remitente string) *Archivo {
+	return &Archivo{Directorio: directorio, Remitente: remitente}
+}
+
+func (a *Archivo) Enviar(m Mensaje) error {
+	ahora := time.Now()
+	datos, err := componer(a.Remitente, m, ahora)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(a.Directorio, 0o700); err != nil {
+		return err
+	}
+	sufijo := make([]byte, 4)
+	rand.Read(sufijo)
+	ruta := filepath.Join(a.Directorio, ahora.UTC().Format("20060102T150405")+"-"+hex.EncodeToString(sufijo)+".eml")
+	if err := os.WriteFile(ruta, datos, 0o600); err != nil {
+		return err
+	}
+	log.Printf("Correo para %s (%q) guardado en %s", m.Para, m.Asunto, ruta)
+	return nil
+}
+
+// componer construye el mensaje con sus cabeceras, en UTF-8 y quoted-printable.
+func componer(remitente string, m Mensaje, fecha time.Time) ([]byte, error) {
+	para, err := mail.ParseAddress(m.Para)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", ErrDestinatarioInvalido, m.Para)
+	}
+	de, err := mail.ParseAddress(remitente)
+	if err != nil {
+		return nil, fmt.Errorf("remitente %q inválido: %w", remitente, err)
+	}
+	if strings.ContainsAny(m.Asunto, "\r\n") {
+		return nil, errors.New("el asunto no puede tener saltos de línea")
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", de.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", para.String())
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Asunto))
+	fmt.Fprintf(&buf, "Date: %s\r\n", fecha.Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%d.%s>\r\n", fecha.UnixNano(), dominio(de.Address))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	qp := quotedprintable.NewWriter(&buf)
+	qp.Write([]byte(strings.ReplaceAll(m.Texto, "\n", "\r\n")))
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// direccion devuelve solo la dirección de 'texto', sin el nombre, para el sobre SMTP.
+func direccion(texto string) string {
+	if d, err := mail.ParseAddress(texto); err == nil {
+		return d.Address
+	}
+	return texto
+}
+
+func dominio(direccion string) string {
+	if _, d, ok := strings.Cut(direccion, "@"); ok {
+		return d
+	}
+	return "localhost"
+}
@@ -0,0 +1,149 @@
+package correo_test
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"libroselectronicos/correo"
+)
+
+var mensaje = correo.Mensaje{
+	Para:   "Ana <ana@example.com>",
+	Asunto: "Confirma tu cuenta en Libros Electrónicos",
+	Texto:  "Hola, ana:\n\nAbre este enlace: http://localhost:8080/verificar?token=abc\n",
+}
+
+// leer interpreta un correo compuesto y devuelve su asunto y su texto decodificados.
+func leer(t *testing.T, r io.Reader) (*mail.Message, string, string) {
+	t.Helper()
+	m, err := mail.ReadMessage(r)
+	if err != nil {
+		t.Fatalf("Correo mal formado: %v", err)
+	}
+	asunto, err := new(mime.WordDecoder).DecodeHeader(m.Header.Get("Subject"))
+	if err != nil {
+		t.Fatalf("Asunto mal codificado: %v", err)
+	}
+	texto, err := io.ReadAll(quotedprintable.NewReader(m.Body))
+	if err != nil {
+		t.Fatalf("Texto mal codificado: %v", err)
+	}
+	return m, asunto, strings.ReplaceAll(string(texto), "\r\n", "\n")
+}
+
+func TestArchivo(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "correos")
+	mailer := correo.NuevoArchivo(dir, "Libros <libros@example.com>")
+
+	if err := mailer.Enviar(mensaje); err != nil {
+		t.Fatalf("Error al enviar: %v", err)
+	}
+	archivos, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(archivos) != 1 {
+		t.Fatalf("Se esperaba un archivo .eml, hay %d", len(archivos))
+	}
+	f, err := os.Open(archivos[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	m, asunto, texto := leer(t, f)
+	if asunto != mensaje.Asunto || texto != mensaje.Texto {
+		t.Errorf("Contenido incorrecto: %q, %q", asunto, texto)
+	}
+	if m.Header.Get("To") != `"Ana" <ana@example.com>` || m.Header.Get("From") != `"Libros" <libros@example.com>` {
+		t.Errorf("Cabeceras incorrectas: %v", m.Header)
+	}
+
+	invalidos := []correo.Mensaje{
+		{Para: "no-es-un-correo", Asunto: "x", Texto: "x"},
+		{Para: "ana@example.com\r\nBcc: otro@example.com", Asunto: "x", Texto: "x"},
+		{Para: "ana@example.com", Asunto: "x\r\nBcc: otro@example.com", Texto: "x"},
+	}
+	for _, m := range invalidos {
+		if err := mailer.Enviar(m); err == nil {
+			t.Errorf("Se esperaba un error con %+v", m)
+		}
+	}
+	if err := mailer.Enviar(invalidos[0]); !errors.Is(err, correo.ErrDestinatarioInvalido) {
+		t.Errorf("Se esperaba ErrDestinatarioInvalido, obtenido: %v", err)
+	}
+}
+
+// servidorSMTP acepta una conexión SMTP sin extensiones y devuelve lo recibido.
+func servidorSMTP(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recibido := make(chan string, 1)
+	go func() {
+		defer ln.Close()
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		var sesion strings.Builder
+		io.WriteString(conn, "220 prueba ESMTP\r\n")
+		for {
+			linea, err := r.ReadString('\n')
+			if err != nil {
+				recibido <- sesion.String()
+				return
+			}
+			sesion.WriteString(linea)
+			switch orden := strings.ToUpper(strings.TrimSpace(linea)); {
+			case strings.HasPrefix(orden, "EHLO"), strings.HasPrefix(orden, "HELO"):
+				io.WriteString(conn, "250 prueba\r\n")
+			case orden == "DATA":
+				io.WriteString(conn, "354 adelante\r\n")
+				for {
+					linea, err := r.ReadString('\n')
+					if err != nil || linea == ".\r\n" {
+						break
+					}
+					sesion.WriteString(linea)
+				}
+				io.WriteString(conn, "250 aceptado\r\n")
+			case orden == "QUIT":
+				io.WriteString(conn, "221 adiós\r\n")
+				recibido <- sesion.String()
+				return
+			default:
+				io.WriteString(conn, "250 vale\r\n")
+			}
+		}
+	}()
+	return ln.Addr().String(), recibido
+}
+
+func TestSMTP(t *testing.T) {
+	direccion, recibido := servidorSMTP(t)
+	mailer := correo.NuevoSMTP(direccion, "", "", "Libros <libros@example.com>")
+
+	if err := mailer.Enviar(mensaje); err != nil {
+		t.Fatalf("Error al enviar por SMTP: %v", err)
+	}
+	sesion := <-recibido
+	if !strings.Contains(sesion, "MAIL FROM:<libros@example.com>") || !strings.Contains(sesion, "RCPT TO:<ana@example.com>") {
+		t.Errorf("Sobre SMTP incorrecto:\n%s", sesion)
+	}
+	_, datos, _ := strings.Cut(sesion, "DATA\r\n")
+	datos, _, _ = strings.Cut(datos, "QUIT\r\n")
+	if _, asunto, texto := leer(t, strings.NewReader(datos)); asunto != mensaje.Asunto || texto != mensaje.Texto {
+		t.Errorf("Contenido incorrecto: %q, %q", asunto, texto)
+	}
+}
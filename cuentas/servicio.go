@@ -0,0 +1,245 @@
+// Package cuentas verifica el correo de los usuarios y les permite restablecer la
+// contraseña con enlaces de un solo uso enviados por correo. Los enlaces llevan un token
+// aleatorio del que solo se guarda el hash, caducan y dejan de valer al usarse.
+package cuentas
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"libroselectronicos/bloqueos"
+	"libroselectronicos/correo"
+	"libroselectronicos/db"
+	"libroselectronicos/models"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// EsperaReenvio es el tiempo mínimo entre dos correos del mismo tipo a un usuario, para
+// que los formularios públicos no sirvan para llenarle el buzón.
+const EsperaReenvio = 5 * time.Minute
+
+// Servicio crea los enlaces, los envía por correo y los comprueba.
+type Servicio struct {
+	Almacen    db.LibroAlmacenamiento
+	Mailer     correo.Mailer
+	URLPublica string // URL con la que los usuarios llegan a la aplicación, p. ej. "https://libros.example.com"
+	Ahora      func() time.Time
+}
+
+func NuevoServicio(almacen db.LibroAlmacenamiento, mailer correo.Mailer, urlPublica string) *Servicio {
+	return &Servicio{
+		Almacen:    almacen,
+		Mailer:     mailer,
+		URLPublica: strings.TrimRight(urlPublica, "/"),
+		Ahora:      time.Now,
+	}
+}
+
+// ValidarEmail comprueba que 'email' sea una dirección sin nombre, como "ana@example.com".
+func ValidarEmail(email string) error {
+	direccion, err := mail.ParseAddress(email)
+	if err != nil || direccion.Address != email {
+		return fmt.Errorf("%w: %q", correo.ErrDestinatarioInvalido, email)
+	}
+	return nil
+}
+
+// EnviarVerificacion envía al usuario el enlace para confirmar su correo.
+func (s *Servicio) EnviarVerificacion(usuario *models.Usuario) error {
+	token, err := s.crearToken(usuario, models.PropositoVerificacion, models.DuracionTokenVerificacion)
+	if err != nil {
+		return err
+	}
+	return s.Mailer.Enviar(correo.Mensaje{
+		Para:   usuario.Email,
+		Asunto: "Confirma tu correo en Libros Electrónicos",
+		Texto: fmt.Sprintf("Hola, %s:\n\n"+
+			"Para terminar de crear tu cuenta, confirma tu correo abriendo este enlace:\n\n%s\n\n"+
+			"El enlace caduca en %s. Si no has creado ninguna cuenta, ignora este correo.\n",
+			usuario.Username, s.enlace("/verificar", token), duracionLegible(models.DuracionTokenVerificacion)),
+	})
+}
+
+// Verificar usa un enlace de verificación y devuelve el usuario, ya con el correo verificado.
+// Si el enlace no existe, ya se usó o caducó, devuelve ErrTokenUsuarioInvalido.
+func (s *Servicio) Verificar(token string) (*models.Usuario, error) {
+	t, err := s.Almacen.VerificarEmailConToken(models.HashToken(token), s.Ahora())
+	if err != nil {
+		return nil, err
+	}
+	usuario, err := s.Almacen.ObtenerUsuarioPorID(t.UsuarioID)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("AUDITORÍA: %s ha verificado su correo", usuario.Username)
+	return usuario, nil
+}
+
+// ReenviarVerificacion vuelve a enviar el enlace de verificación a las cuentas sin
+// verificar con ese correo. No dice si hay alguna, para no revelar qué correos están
+// registrados.
+func (s *Servicio) ReenviarVerificacion(email string) error {
+	return s.enviarACuentas(email, models.PropositoVerificacion, func(u *models.Usuario) bool { return !u.EmailVerificado() }, s.EnviarVerificacion)
+}
+
+// SolicitarRestablecimiento envía un enlace para elegir una contraseña nueva a cada
+// cuenta con ese correo. Como ReenviarVerificacion, no dice si hay alguna.
+func (s *Servicio) SolicitarRestablecimiento(email string) error {
+	return s.enviarACuentas(email, models.PropositoRestablecer, func(*models.Usuario) bool { return true }, s.enviarRestablecimiento)
+}
+
+func (s *Servicio) enviarRestablecimiento(usuario *models.Usuario) error {
+	token, err := s.crearToken(usuario, models.PropositoRestablecer, models.DuracionTokenRestablecer)
+	if err != nil {
+		return err
+	}
+	return s.Mailer.Enviar(correo.Mensaje{
+		Para:   usuario.Email,
+		Asunto: "Restablece tu contraseña de Libros Electrónicos",
+		Texto: fmt.Sprintf("Hola, %s:\n\n"+
+			"Alguien ha pedido restablecer la contraseña de tu cuenta. Para elegir una nueva, abre este enlace:\n\n%s\n\n"+
+			"El enlace caduca en %s y solo se puede usar una vez. Si no lo has pedido tú, ignora este correo: tu contraseña no cambiará.\n",
+			usuario.Username, s.enlace("/restablecer", token), duracionLegible(models.DuracionTokenRestablecer)),
+	})
+}
+
+// enviarACuentas llama a 'enviar' para cada cuenta con ese correo que cumpla 'incluir' y
+// a la que no se le haya enviado un correo del mismo tipo en los últimos EsperaReenvio.
+// Los fallos de envío se anotan en el log pero no se devuelven: solo los de la base de datos.
+func (s *Servicio) enviarACuentas(email, proposito string, incluir func(*models.Usuario) bool, enviar func(*models.Usuario) error) error {
+	email = strings.TrimSpace(email)
+	if ValidarEmail(email) != nil {
+		return nil
+	}
+	usuarios, err := s.Almacen.ListarUsuariosPorEmail(email)
+	if err != nil {
+		return err
+	}
+	for _, usuario := range usuarios {
+		if !incluir(usuario) {
+			continue
+		}
+		recientes, err := s.Almacen.ContarTokensUsuarioDesde(usuario.ID, proposito, s.Ahora().Add(-EsperaReenvio))
+		if err != nil {
+			return err
+		}
+		if recientes > 0 {
+			log.Printf("No se envía otro correo de %s a %s: ya se envió uno hace menos de %s", proposito, usuario.Username, EsperaReenvio)
+			continue
+		}
+		if err := enviar(usuario); err != nil {
+			log.Printf("Error al enviar el correo de %s a %s: %v", proposito, usuario.Username, err)
+		}
+	}
+	return nil
+}
+
+// ComprobarRestablecimiento devuelve el usuario de un enlace de restablecimiento válido,
+// sin usarlo, para mostrar el formulario de la contraseña nueva.
+func (s *Servicio) ComprobarRestablecimiento(token string) (*models.Usuario, error) {
+	t, err := s.Almacen.ObtenerTokenUsuario(models.HashToken(token), models.PropositoRestablecer, s.Ahora())
+	if err != nil {
+		return nil, err
+	}
+	return s.Almacen.ObtenerUsuarioPorID(t.UsuarioID)
+}
+
+// Restablecer usa un enlace de restablecimiento para cambiar la contraseña. Revoca los
+// tokens de API y cierra todas las sesiones del usuario, por si alguien más conocía la
+// contraseña anterior, y pone a cero sus inicios de sesión fallidos.
+func (s *Servicio) Restablecer(token, password string) (*models.Usuario, error) {
+	if password == "" {
+		return nil, errors.New("la contraseña no puede estar vacía")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	t, err := s.Almacen.RestablecerPasswordConToken(models.HashToken(token), string(hash), s.Ahora())
+	if err != nil {
+		return nil, err
+	}
+	usuario, err := s.Almacen.ObtenerUsuarioPorID(t.UsuarioID)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("AUDITORÍA: %s ha restablecido su contraseña; sus tokens de API quedan revocados y sus sesiones cerradas", usuario.Username)
+
+	if err := s.Almacen.ReiniciarBloqueoLogin(models.BloqueoPorUsuario, bloqueos.ClaveUsuario(usuario.Username)); err != nil {
+		log.Printf("Error al reiniciar los fallos de inicio de sesión de %s: %v", usuario.Username, err)
+	}
+	return usuario, nil
+}
+
+// CrearAdministrador crea el primer administrador, con el correo ya verificado, para
+// poder entrar a la aplicación recién instalada. Si ya hay alguno devuelve
+// ErrYaHayAdministrador: los demás se nombran desde la administración de usuarios.
+func CrearAdministrador(almacen db.LibroAlmacenamiento, username, email, password string, ahora time.Time) (*models.Usuario, error) {
+	username, email = strings.TrimSpace(username), strings.TrimSpace(email)
+	if username == "" || password == "" {
+		return nil, errors.New("el nombre de usuario y la contraseña son obligatorios")
+	}
+	if err := ValidarEmail(email); err != nil {
+		return nil, err
+	}
+	administradores, err := almacen.ContarUsuariosPorRol(models.RolAdministrador)
+	if err != nil {
+		return nil, err
+	}
+	if administradores > 0 {
+		return nil, models.ErrYaHayAdministrador
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	usuario := models.NuevoUsuario(0, username, string(hash), email, models.RolAdministrador)
+	verificado := ahora.UTC()
+	usuario.EmailVerificadoEn = &verificado
+	if err := almacen.AgregarUsuario(usuario); err != nil {
+		return nil, err
+	}
+	log.Printf("AUDITORÍA: creado el administrador inicial %s", username)
+	return almacen.ObtenerUsuarioPorUsername(username)
+}
+
+// crearToken guarda un token nuevo para el usuario y lo devuelve en claro.
+func (s *Servicio) crearToken(usuario *models.Usuario, proposito string, duracion time.Duration) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+	ahora := s.Ahora()
+	err := s.Almacen.AgregarTokenUsuario(&models.TokenUsuario{
+		UsuarioID: usuario.ID,
+		Proposito: proposito,
+		Hash:      models.HashToken(token),
+		CreadoEn:  ahora,
+		ExpiraEn:  ahora.Add(duracion),
+	})
+	return token, err
+}
+
+func (s *Servicio) enlace(ruta, token string) string {
+	return s.URLPublica + ruta + "?" + url.Values{"token": {token}}.Encode()
+}
+
+func duracionLegible(d time.Duration) string {
+	if d%time.Hour == 0 {
+		if d == time.Hour {
+			return "1 hora"
+		}
+		return fmt.Sprintf("%d horas", d/time.Hour)
+	}
+	return models.EsperaLegible(d)
+}
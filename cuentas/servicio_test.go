@@ -0,0 +1,205 @@
+package cuentas_test
+
+import (
+	"errors"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"libroselectronicos/correo"
+	"libroselectronicos/cuentas"
+	"libroselectronicos/db"
+	"libroselectronicos/models"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// buzon guarda los correos enviados en lugar de enviarlos.
+type buzon struct {
+	mensajes []correo.Mensaje
+}
+
+func (b *buzon) Enviar(m correo.Mensaje) error {
+	b.mensajes = append(b.mensajes, m)
+	return nil
+}
+
+var reEnlace = regexp.MustCompile(`http://libros\.example\.com(/\S+)`)
+
+// token devuelve la ruta y el token del enlace del último correo enviado a 'para'.
+func (b *buzon) token(t *testing.T, para string) (string, string) {
+	t.Helper()
+	for i := len(b.mensajes) - 1; i >= 0; i-- {
+		if b.mensajes[i].Para != para {
+			continue
+		}
+		m := reEnlace.FindStringSubmatch(b.mensajes[i].Texto)
+		if m == nil {
+			t.Fatalf("El correo no tiene enlace: %q", b.mensajes[i].Texto)
+		}
+		u, _ := url.Parse(m[1])
+		return u.Path, u.Query().Get("token")
+	}
+	t.Fatalf("No hay correos para %s", para)
+	return "", ""
+}
+
+func nuevoServicio(t *testing.T) (*cuentas.Servicio, db.LibroAlmacenamiento, *buzon, *time.Time) {
+	t.Helper()
+	almacen := db.NewAlmacenForTest(filepath.Join(t.TempDir(), "libros.db"))
+	if almacen == nil {
+		t.Fatalf("No se pudo inicializar el almacén de prueba")
+	}
+	t.Cleanup(func() { almacen.Close() })
+
+	b := &buzon{}
+	ahora := time.Now().UTC().Truncate(time.Second)
+	servicio := cuentas.NuevoServicio(almacen, b, "http://libros.example.com/")
+	servicio.Ahora = func() time.Time { return ahora }
+	return servicio, almacen, b, &ahora
+}
+
+func agregarUsuario(t *testing.T, almacen db.LibroAlmacenamiento, username, email string) *models.Usuario {
+	t.Helper()
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secreto"), bcrypt.MinCost)
+	if err := almacen.AgregarUsuario(models.NuevoUsuario(0, username, string(hash), email, models.RolLector)); err != nil {
+		t.Fatalf("Error al agregar usuario: %v", err)
+	}
+	usuario, err := almacen.ObtenerUsuarioPorUsername(username)
+	if err != nil {
+		t.Fatalf("Error al obtener usuario: %v", err)
+	}
+	return usuario
+}
+
+func TestVerificacion(t *testing.T) {
+	servicio, almacen, b, ahora := nuevoServicio(t)
+	ana := agregarUsuario(t, almacen, "ana", "ana@example.com")
+
+	if err := servicio.EnviarVerificacion(ana); err != nil {
+		t.Fatalf("Error al enviar la verificación: %v", err)
+	}
+	ruta, token := b.token(t, "ana@example.com")
+	if ruta != "/verificar" || token == "" {
+		t.Fatalf("Enlace de verificación incorrecto: %s?token=%s", ruta, token)
+	}
+
+	// Reenviar enseguida no manda otro correo; pasada la espera, sí
+	if err := servicio.ReenviarVerificacion("ANA@example.com"); err != nil || len(b.mensajes) != 1 {
+		t.Errorf("No debería reenviarse tan pronto: %d correos, %v", len(b.mensajes), err)
+	}
+	*ahora = ahora.Add(cuentas.EsperaReenvio)
+	if err := servicio.ReenviarVerificacion("ANA@example.com"); err != nil || len(b.mensajes) != 2 {
+		t.Fatalf("Debería haberse reenviado: %d correos, %v", len(b.mensajes), err)
+	}
+	_, nuevo := b.token(t, "ana@example.com")
+
+	if _, err := servicio.Verificar("inventado"); !errors.Is(err, models.ErrTokenUsuarioInvalido) {
+		t.Errorf("Se esperaba ErrTokenUsuarioInvalido con un token inventado, obtenido: %v", err)
+	}
+	usuario, err := servicio.Verificar(nuevo)
+	if err != nil || !usuario.EmailVerificado() {
+		t.Fatalf("El correo debería quedar verificado: %+v, %v", usuario, err)
+	}
+	// Verificado el correo, los demás enlaces ya no valen y no se reenvían más
+	if _, err := servicio.Verificar(token); !errors.Is(err, models.ErrTokenUsuarioInvalido) {
+		t.Errorf("El primer enlace no debería valer tras verificar, obtenido: %v", err)
+	}
+	*ahora = ahora.Add(cuentas.EsperaReenvio)
+	if err := servicio.ReenviarVerificacion("ana@example.com"); err != nil || len(b.mensajes) != 2 {
+		t.Errorf("No debería reenviarse a una cuenta verificada: %d correos, %v", len(b.mensajes), err)
+	}
+}
+
+func TestRestablecimiento(t *testing.T) {
+	servicio, almacen, b, ahora := nuevoServicio(t)
+	ana := agregarUsuario(t, almacen, "ana", "ana@example.com")
+	sesion := &models.Sesion{Hash: "h", UsuarioID: ana.ID, Datos: []byte{}, CreadaEn: *ahora, UltimoAcceso: *ahora, ExpiraEn: ahora.Add(time.Hour)}
+	if err := almacen.GuardarSesion(sesion); err != nil {
+		t.Fatalf("Error al guardar sesión: %v", err)
+	}
+	if _, err := almacen.RegistrarFalloLogin(models.BloqueoPorUsuario, "ana", models.PoliticaBloqueoUsuario, *ahora); err != nil {
+		t.Fatalf("Error al registrar fallo: %v", err)
+	}
+	// Un token de API creado con la contraseña anterior
+	if err := almacen.AgregarTokenAPI(models.NuevoTokenAPI(ana.ID, "script", "le_1234", "hash-api", models.RolLector)); err != nil {
+		t.Fatalf("Error al agregar token de API: %v", err)
+	}
+
+	// Un correo desconocido o inválido no da error, para no revelar qué correos hay
+	for _, email := range []string{"nadie@example.com", "no-es-un-correo"} {
+		if err := servicio.SolicitarRestablecimiento(email); err != nil {
+			t.Errorf("Error al solicitar con %q: %v", email, err)
+		}
+	}
+	if len(b.mensajes) != 0 {
+		t.Fatalf("No debería haberse enviado ningún correo: %+v", b.mensajes)
+	}
+
+	if err := servicio.SolicitarRestablecimiento("ana@example.com"); err != nil {
+		t.Fatalf("Error al solicitar el restablecimiento: %v", err)
+	}
+	ruta, token := b.token(t, "ana@example.com")
+	if ruta != "/restablecer" {
+		t.Fatalf("Enlace de restablecimiento incorrecto: %s", ruta)
+	}
+	if usuario, err := servicio.ComprobarRestablecimiento(token); err != nil || usuario.ID != ana.ID {
+		t.Fatalf("El enlace debería valer: %+v, %v", usuario, err)
+	}
+
+	usuario, err := servicio.Restablecer(token, "nueva")
+	if err != nil {
+		t.Fatalf("Error al restablecer: %v", err)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(usuario.Password), []byte("nueva")) != nil || !usuario.EmailVerificado() {
+		t.Errorf("Contraseña no cambiada o correo no verificado: %+v", usuario)
+	}
+	if sesiones, _ := almacen.ListarSesionesPorUsuario(ana.ID); len(sesiones) != 0 {
+		t.Errorf("Deberían haberse cerrado las sesiones: %d", len(sesiones))
+	}
+	if _, err := almacen.ObtenerBloqueoLogin(models.BloqueoPorUsuario, "ana"); !errors.Is(err, models.ErrBloqueoNoEncontrado) {
+		t.Errorf("Deberían haberse borrado los fallos de inicio de sesión, obtenido: %v", err)
+	}
+	if _, err := almacen.ObtenerTokenAPIPorHash("hash-api"); !errors.Is(err, models.ErrTokenNoEncontrado) {
+		t.Errorf("Debería haberse revocado el token de API, obtenido: %v", err)
+	}
+
+	// Un solo uso
+	if _, err := servicio.Restablecer(token, "otra"); !errors.Is(err, models.ErrTokenUsuarioInvalido) {
+		t.Errorf("El enlace no debería valer dos veces, obtenido: %v", err)
+	}
+
+	// Caducidad
+	*ahora = ahora.Add(cuentas.EsperaReenvio)
+	if err := servicio.SolicitarRestablecimiento("ana@example.com"); err != nil {
+		t.Fatalf("Error al solicitar el restablecimiento: %v", err)
+	}
+	_, token = b.token(t, "ana@example.com")
+	*ahora = ahora.Add(models.DuracionTokenRestablecer)
+	if _, err := servicio.ComprobarRestablecimiento(token); !errors.Is(err, models.ErrTokenUsuarioInvalido) {
+		t.Errorf("Un enlace caducado no debería valer, obtenido: %v", err)
+	}
+}
+
+func TestCrearAdministrador(t *testing.T) {
+	_, almacen, _, ahora := nuevoServicio(t)
+	agregarUsuario(t, almacen, "bea", "bea@example.com")
+
+	if _, err := cuentas.CrearAdministrador(almacen, "admin", "no-es-un-correo", "secreto", *ahora); !errors.Is(err, correo.ErrDestinatarioInvalido) {
+		t.Errorf("Se esperaba un error con un correo inválido, obtenido: %v", err)
+	}
+	admin, err := cuentas.CrearAdministrador(almacen, "admin", "admin@example.com", "secreto", *ahora)
+	if err != nil {
+		t.Fatalf("Error al crear el administrador: %v", err)
+	}
+	if admin.Rol != models.RolAdministrador || !admin.EmailVerificado() || bcrypt.CompareHashAndPassword([]byte(admin.Password), []byte("secreto")) != nil {
+		t.Errorf("Administrador creado incorrecto: %+v", admin)
+	}
+
+	// Solo el primero: los demás se nombran desde la administración de usuarios
+	if _, err := cuentas.CrearAdministrador(almacen, "otro", "otro@example.com", "secreto", *ahora); !errors.Is(err, models.ErrYaHayAdministrador) {
+		t.Errorf("Se esperaba ErrYaHayAdministrador, obtenido: %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+
+	"libroselectronicos/models"
+)
+
+// --- Operaciones de Alquiler ---
+
+// AlquilarLibro registra el alquiler de un libro por parte de un usuario.
+// El cambio de disponibilidad y la inserción del alquiler ocurren en la misma
+// transacción: si dos usuarios piden el mismo libro a la vez, solo uno lo consigue
+// y el otro recibe models.ErrLibroNoDisponible.
+func (s *sqliteAlmacenamiento) AlquilarLibro(usuarioID, libroID int) (*models.Alquiler, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback() // No tiene efecto si ya se hizo Commit
+
+	// Solo se marca como alquilado si seguía disponible
+	res, err := tx.Exec("UPDATE libros SET disponible = 0 WHERE id = ? AND disponible = 1", libroID)
+	if err != nil {
+		return nil, err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected == 0 {
+		var existe int
+		err := tx.QueryRow("SELECT COUNT(*) FROM libros WHERE id = ?", libroID).Scan(&existe)
+		if err != nil {
+			return nil, err
+		}
+		if existe == 0 {
+			return nil, models.ErrLibroNoEncontrado
+		}
+		return nil, models.ErrLibroNoDisponible
+	}
+
+	alquiler := models.NuevoAlquiler(usuarioID, libroID, time.Now().UTC(), models.DiasAlquilerPorDefecto)
+	res, err = tx.Exec("INSERT INTO alquileres(usuario_id, libro_id, fecha_alquiler, fecha_vencimiento) VALUES(?, ?, ?, ?)",
+		alquiler.UsuarioID, alquiler.LibroID, alquiler.FechaAlquiler, alquiler.FechaVencimiento)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	alquiler.ID = int(id)
+	return alquiler, nil
+}
+
+// DevolverLibro marca como devuelto el alquiler activo del usuario sobre el libro
+// y vuelve a dejar el libro disponible, todo en una única transacción.
+func (s *sqliteAlmacenamiento) DevolverLibro(usuarioID, libroID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("UPDATE alquileres SET fecha_devolucion = ? WHERE usuario_id = ? AND libro_id = ? AND fecha_devolucion IS NULL",
+		time.Now().UTC(), usuarioID, libroID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return models.ErrAlquilerNoEncontrado // El usuario no tiene ese libro alquilado
+	}
+
+	_, err = tx.Exec("UPDATE libros SET disponible = 1 WHERE id = ?", libroID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListarAlquileresPorUsuario devuelve todos los alquileres de un usuario, del más reciente al más antiguo.
+func (s *sqliteAlmacenamiento) ListarAlquileresPorUsuario(usuarioID int) ([]*models.Alquiler, error) {
+	rows, err := s.db.Query(`
+		SELECT a.id, a.usuario_id, a.libro_id, a.fecha_alquiler, a.fecha_vencimiento, a.fecha_devolucion,
+		       l.slug, l.titulo, l.autor, l.anio, l.isbn, l.caratula_url, l.sinopsis
+		FROM alquileres a
+		LEFT JOIN libros l ON l.id = a.libro_id
+		WHERE a.usuario_id = ?
+		ORDER BY a.fecha_alquiler DESC, a.id DESC`, usuarioID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	alquileres := []*models.Alquiler{}
+	for rows.Next() {
+		alquiler := &models.Alquiler{}
+		var devolucion sql.NullTime
+		var slug, titulo, autor, isbn, caratulaURL, sinopsis sql.NullString
+		var anio sql.NullInt64
+		err := rows.Scan(&alquiler.ID, &alquiler.UsuarioID, &alquiler.LibroID, &alquiler.FechaAlquiler, &alquiler.FechaVencimiento, &devolucion,
+			&slug, &titulo, &autor, &anio, &isbn, &caratulaURL, &sinopsis)
+		if err != nil {
+			return nil, err
+		}
+		if devolucion.Valid {
+			alquiler.FechaDevolucion = &devolucion.Time
+		}
+		if titulo.Valid { // El libro puede haberse eliminado después del alquiler
+			alquiler.Libro = models.NuevoLibroCompleto(alquiler.LibroID, titulo.String, autor.String, int(anio.Int64), caratulaURL.String, sinopsis.String)
+			alquiler.Libro.Slug = slug.String
+			alquiler.Libro.ISBN = isbn.String
+		}
+		alquileres = append(alquileres, alquiler)
+	}
+	return alquileres, rows.Err()
+}
+
+// TieneAlquilerActivo indica si el usuario tiene alquilado el libro, sin devolver y sin vencer.
+func (s *sqliteAlmacenamiento) TieneAlquilerActivo(usuarioID, libroID int) (bool, error) {
+	alquiler := &models.Alquiler{}
+	err := s.db.QueryRow("SELECT fecha_vencimiento FROM alquileres WHERE usuario_id = ? AND libro_id = ? AND fecha_devolucion IS NULL",
+		usuarioID, libroID).Scan(&alquiler.FechaVencimiento)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !alquiler.EstaVencido(), nil
+}
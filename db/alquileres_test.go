@@ -0,0 +1,169 @@
+package db_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"libroselectronicos/models"
+)
+
+// TestAlquilarYDevolverLibro
+func TestAlquilarYDevolverLibro(t *testing.T) {
+	almacen := setupTestDB(t)
+	defer teardownTestDB(almacen)
+
+	almacen.AgregarLibro(models.NuevoLibroConCaratula(1, "Libro Alquilable", "Autor", 2020, "url.jpg"))
+
+	alquiler, err := almacen.AlquilarLibro(7, 1)
+	if err != nil {
+		t.Fatalf("Error al alquilar libro: %v", err)
+	}
+	if alquiler.GetID() == 0 {
+		t.Errorf("Se esperaba un ID de alquiler asignado")
+	}
+	if !alquiler.FechaVencimiento.After(alquiler.FechaAlquiler) {
+		t.Errorf("La fecha de vencimiento debe ser posterior a la de alquiler")
+	}
+
+	// Un segundo alquiler del mismo libro debe fallar mientras esté activo
+	_, err = almacen.AlquilarLibro(8, 1)
+	if !errors.Is(err, models.ErrLibroNoDisponible) {
+		t.Errorf("Se esperaba ErrLibroNoDisponible, obtenido: %v", err)
+	}
+
+	// Solo quien lo alquiló puede devolverlo
+	err = almacen.DevolverLibro(8, 1)
+	if !errors.Is(err, models.ErrAlquilerNoEncontrado) {
+		t.Errorf("Se esperaba ErrAlquilerNoEncontrado al devolver un libro ajeno, obtenido: %v", err)
+	}
+
+	if err := almacen.DevolverLibro(7, 1); err != nil {
+		t.Fatalf("Error al devolver libro: %v", err)
+	}
+
+	// Devolver dos veces no es posible
+	err = almacen.DevolverLibro(7, 1)
+	if !errors.Is(err, models.ErrAlquilerNoEncontrado) {
+		t.Errorf("Se esperaba ErrAlquilerNoEncontrado al devolver dos veces, obtenido: %v", err)
+	}
+
+	// Tras la devolución, otro usuario puede alquilarlo
+	if _, err := almacen.AlquilarLibro(8, 1); err != nil {
+		t.Errorf("Error al alquilar libro devuelto: %v", err)
+	}
+}
+
+// TestAlquilarLibroInexistente
+func TestAlquilarLibroInexistente(t *testing.T) {
+	almacen := setupTestDB(t)
+	defer teardownTestDB(almacen)
+
+	_, err := almacen.AlquilarLibro(1, 99)
+	if !errors.Is(err, models.ErrLibroNoEncontrado) {
+		t.Errorf("Se esperaba ErrLibroNoEncontrado, obtenido: %v", err)
+	}
+}
+
+// TestListarAlquileresPorUsuario
+func TestListarAlquileresPorUsuario(t *testing.T) {
+	almacen := setupTestDB(t)
+	defer teardownTestDB(almacen)
+
+	almacen.AgregarLibro(models.NuevoLibroConCaratula(1, "Libro Uno", "Autor Uno", 2020, "url1.jpg"))
+	almacen.AgregarLibro(models.NuevoLibroConCaratula(2, "Libro Dos", "Autor Dos", 2021, "url2.jpg"))
+	almacen.AlquilarLibro(1, 1)
+	almacen.AlquilarLibro(1, 2)
+	almacen.DevolverLibro(1, 1)
+
+	alquileres, err := almacen.ListarAlquileresPorUsuario(1)
+	if err != nil {
+		t.Fatalf("Error al listar alquileres: %v", err)
+	}
+	if len(alquileres) != 2 {
+		t.Fatalf("Se esperaban 2 alquileres, se obtuvieron %d", len(alquileres))
+	}
+
+	devueltos := 0
+	for _, a := range alquileres {
+		if a.GetLibro() == nil {
+			t.Errorf("Se esperaba el libro cargado en el alquiler %d", a.GetID())
+		}
+		if a.EstaDevuelto() {
+			devueltos++
+		}
+	}
+	if devueltos != 1 {
+		t.Errorf("Se esperaba 1 alquiler devuelto, obtenidos %d", devueltos)
+	}
+
+	// Otro usuario no ve esos alquileres
+	otros, err := almacen.ListarAlquileresPorUsuario(2)
+	if err != nil {
+		t.Fatalf("Error al listar alquileres: %v", err)
+	}
+	if len(otros) != 0 {
+		t.Errorf("Se esperaba lista vacía para otro usuario, se obtuvieron %d", len(otros))
+	}
+}
+
+// TestAlquilarCambiaDisponibilidad
+func TestAlquilarCambiaDisponibilidad(t *testing.T) {
+	almacen := setupTestDB(t)
+	defer teardownTestDB(almacen)
+
+	almacen.AgregarLibro(models.NuevoLibroConCaratula(1, "Libro", "Autor", 2020, "url.jpg"))
+
+	libro, _ := almacen.ObtenerLibro(1)
+	if !libro.EstaDisponible() {
+		t.Fatalf("Un libro nuevo debe estar disponible")
+	}
+
+	almacen.AlquilarLibro(1, 1)
+	libro, _ = almacen.ObtenerLibro(1)
+	if libro.EstaDisponible() || libro.GetEstado() != "Alquilado" {
+		t.Errorf("Se esperaba el libro alquilado, estado: %s", libro.GetEstado())
+	}
+
+	almacen.DevolverLibro(1, 1)
+	libro, _ = almacen.ObtenerLibro(1)
+	if !libro.EstaDisponible() {
+		t.Errorf("Se esperaba el libro disponible tras la devolución")
+	}
+}
+
+// TestAlquilerConcurrente comprueba que dos peticiones simultáneas no alquilan el mismo libro.
+func TestAlquilerConcurrente(t *testing.T) {
+	almacen := setupTestDB(t)
+	defer teardownTestDB(almacen)
+
+	almacen.AgregarLibro(models.NuevoLibroConCaratula(1, "Libro Disputado", "Autor", 2020, "url.jpg"))
+
+	const intentos = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, intentos)
+	for i := 1; i <= intentos; i++ {
+		wg.Add(1)
+		go func(usuarioID int) {
+			defer wg.Done()
+			_, err := almacen.AlquilarLibro(usuarioID, 1)
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	exitos := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			exitos++
+		case errors.Is(err, models.ErrLibroNoDisponible):
+		default:
+			t.Errorf("Error inesperado en alquiler concurrente: %v", err)
+		}
+	}
+	if exitos != 1 {
+		t.Errorf("Se esperaba exactamente 1 alquiler exitoso, obtenidos %d", exitos)
+	}
+}
@@ -0,0 +1,110 @@
+package db
+
+import (
+	"database/sql"
+
+	"libroselectronicos/models"
+)
+
+// --- Operaciones de Archivos de Libros ---
+
+const columnasArchivo = "libro_id, formato, mime, tamano, sha256, nombre, subido_en"
+
+func escanearArchivo(fila filaEscaneable) (*models.ArchivoLibro, error) {
+	a := &models.ArchivoLibro{}
+	if err := fila.Scan(&a.LibroID, &a.Formato, &a.MIME, &a.Tamano, &a.SHA256, &a.Nombre, &a.SubidoEn); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// GuardarArchivoLibro registra el archivo de un libro en su formato, reemplazando el
+// que hubiera. Devuelve el SHA-256 del archivo reemplazado, o "" si no había, para que
+// quien llama pueda borrar su contenido si ya no se usa.
+func (s *sqliteAlmacenamiento) GuardarArchivoLibro(archivo *models.ArchivoLibro) (string, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback() // No tiene efecto si ya se hizo Commit
+
+	var existe bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM libros WHERE id = ?)", archivo.LibroID).Scan(&existe); err != nil {
+		return "", err
+	}
+	if !existe {
+		return "", models.ErrLibroNoEncontrado
+	}
+
+	var anterior string
+	err = tx.QueryRow("SELECT sha256 FROM archivos_libro WHERE libro_id = ? AND formato = ?", archivo.LibroID, archivo.Formato).Scan(&anterior)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+
+	_, err = tx.Exec("INSERT OR REPLACE INTO archivos_libro ("+columnasArchivo+") VALUES (?, ?, ?, ?, ?, ?, ?)",
+		archivo.LibroID, archivo.Formato, archivo.MIME, archivo.Tamano, archivo.SHA256, archivo.Nombre, archivo.SubidoEn)
+	if err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	if anterior == archivo.SHA256 {
+		return "", nil // Se volvió a subir el mismo contenido
+	}
+	return anterior, nil
+}
+
+// ObtenerArchivoLibro devuelve el archivo de un libro en un formato.
+func (s *sqliteAlmacenamiento) ObtenerArchivoLibro(libroID int, formato string) (*models.ArchivoLibro, error) {
+	archivo, err := escanearArchivo(s.db.QueryRow("SELECT "+columnasArchivo+" FROM archivos_libro WHERE libro_id = ? AND formato = ?", libroID, formato))
+	if err == sql.ErrNoRows {
+		return nil, models.ErrArchivoNoEncontrado
+	}
+	return archivo, err
+}
+
+// EliminarArchivoLibro quita el archivo de un libro en un formato. El contenido sigue
+// en el almacén de archivos.
+func (s *sqliteAlmacenamiento) EliminarArchivoLibro(libroID int, formato string) error {
+	res, err := s.db.Exec("DELETE FROM archivos_libro WHERE libro_id = ? AND formato = ?", libroID, formato)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return models.ErrArchivoNoEncontrado
+	}
+	return nil
+}
+
+// ArchivoEnUso indica si algún libro tiene un archivo con ese SHA-256.
+func (s *sqliteAlmacenamiento) ArchivoEnUso(sha256 string) (bool, error) {
+	var enUso bool
+	err := s.db.QueryRow("SELECT EXISTS (SELECT 1 FROM archivos_libro WHERE sha256 = ?)", sha256).Scan(&enUso)
+	return enUso, err
+}
+
+// cargarArchivos rellena Archivos en cada libro, EPUB antes que PDF.
+func cargarArchivos(q consultor, libros ...*models.Libro) error {
+	if len(libros) == 0 {
+		return nil
+	}
+	marcadores, args, porID := idsLibros(libros)
+
+	rows, err := q.Query("SELECT "+columnasArchivo+" FROM archivos_libro WHERE libro_id IN ("+marcadores+") ORDER BY libro_id, formato", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		archivo, err := escanearArchivo(rows)
+		if err != nil {
+			return err
+		}
+		porID[archivo.LibroID].Archivos = append(porID[archivo.LibroID].Archivos, *archivo)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,268 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"libroselectronicos/models"
+)
+
+// --- Operaciones de Autores ---
+
+// ObtenerAutorPorSlug busca un autor por el slug de sus URLs.
+func (s *sqliteAlmacenamiento) ObtenerAutorPorSlug(slug string) (*models.Autor, error) {
+	autor := &models.Autor{}
+	err := s.db.QueryRow("SELECT id, slug, nombre FROM autores WHERE slug = ?", slug).Scan(&autor.ID, &autor.Slug, &autor.Nombre)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrAutorNoEncontrado
+	}
+	return autor, err
+}
+
+// ListarAutores devuelve los autores que tienen algún libro, por orden alfabético sin
+// distinguir mayúsculas ni tildes.
+func (s *sqliteAlmacenamiento) ListarAutores() ([]*models.Autor, error) {
+	rows, err := s.db.Query("SELECT id, slug, nombre FROM autores WHERE id IN (SELECT autor_id FROM libros_autores) ORDER BY slug")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	autores := []*models.Autor{}
+	for rows.Next() {
+		autor := &models.Autor{}
+		if err := rows.Scan(&autor.ID, &autor.Slug, &autor.Nombre); err != nil {
+			return nil, err
+		}
+		autores = append(autores, autor)
+	}
+	return autores, rows.Err()
+}
+
+// ListarObrasDeAutor devuelve los libros en que participa un autor, del más reciente al
+// más antiguo, con su papel en cada uno. Un libro aparece una vez por cada papel.
+func (s *sqliteAlmacenamiento) ListarObrasDeAutor(autorID int) ([]*models.ObraAutor, error) {
+	rows, err := s.db.Query(`SELECT la.rol, l.id, l.slug, l.titulo, l.autor, l.anio, IFNULL(l.isbn, ''), l.idioma, l.editorial, l.caratula_url, l.sinopsis, l.disponible
+		FROM libros_autores la JOIN libros l ON l.id = la.libro_id
+		WHERE la.autor_id = ?
+		ORDER BY l.anio DESC, l.id DESC, la.rol`, autorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	obras := []*models.ObraAutor{}
+	for rows.Next() {
+		obra := &models.ObraAutor{Libro: &models.Libro{}}
+		libro := obra.Libro
+		err := rows.Scan(&obra.Rol, &libro.ID, &libro.Slug, &libro.Titulo, &libro.Autor, &libro.Anio, &libro.ISBN, &libro.Idioma, &libro.Editorial, &libro.CaratulaURL, &libro.Sinopsis, &libro.Disponible)
+		if err != nil {
+			return nil, err
+		}
+		obras = append(obras, obra)
+	}
+	return obras, rows.Err()
+}
+
+// FusionarAutores pasa todos los créditos del autor 'origenID' al autor 'destinoID' y
+// elimina el primero. Sirve para unir las variantes de un mismo nombre, como
+// "García Márquez" y "Gabriel García Márquez".
+func (s *sqliteAlmacenamiento) FusionarAutores(origenID, destinoID int) error {
+	if origenID == destinoID {
+		return fmt.Errorf("%w: no se puede fusionar un autor consigo mismo", models.ErrValidacion)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // No tiene efecto si ya se hizo Commit
+
+	for _, id := range []int{origenID, destinoID} {
+		var existe bool
+		if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM autores WHERE id = ?)", id).Scan(&existe); err != nil {
+			return err
+		}
+		if !existe {
+			return models.ErrAutorNoEncontrado
+		}
+	}
+
+	var libroIDs []int
+	rows, err := tx.Query("SELECT DISTINCT libro_id FROM libros_autores WHERE autor_id = ?", origenID)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		libroIDs = append(libroIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// Si el destino ya tenía ese papel en el libro, se queda con su crédito
+	_, err = tx.Exec(`INSERT OR IGNORE INTO libros_autores (libro_id, autor_id, rol, posicion)
+		SELECT libro_id, ?, rol, posicion FROM libros_autores WHERE autor_id = ?`, destinoID, origenID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM libros_autores WHERE autor_id = ?", origenID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM autores WHERE id = ?", origenID); err != nil {
+		return err
+	}
+
+	for _, libroID := range libroIDs {
+		creditos, err := creditosDeLibro(tx, libroID)
+		if err != nil {
+			return err
+		}
+		if err := actualizarTextoAutor(tx, libroID, creditos); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// consultor es lo que tienen en común *sql.DB y *sql.Tx para leer.
+type consultor interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// cargarAutores rellena Autores en cada libro con una sola consulta.
+func cargarAutores(q consultor, libros ...*models.Libro) error {
+	if len(libros) == 0 {
+		return nil
+	}
+	marcadores, args, porID := idsLibros(libros)
+
+	rows, err := q.Query(`SELECT la.libro_id, a.id, a.nombre, a.slug, la.rol
+		FROM libros_autores la JOIN autores a ON a.id = la.autor_id
+		WHERE la.libro_id IN (`+marcadores+`)
+		ORDER BY la.libro_id, la.posicion`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var libroID int
+		var c models.CreditoAutor
+		if err := rows.Scan(&libroID, &c.AutorID, &c.Nombre, &c.Slug, &c.Rol); err != nil {
+			return err
+		}
+		if libro := porID[libroID]; libro != nil {
+			libro.Autores = append(libro.Autores, c)
+		}
+	}
+	return rows.Err()
+}
+
+// idsLibros prepara una cláusula IN con los IDs de 'libros': devuelve los marcadores
+// "?, ?, ...", los argumentos y los libros por ID. 'libros' no puede estar vacío.
+func idsLibros(libros []*models.Libro) (string, []interface{}, map[int]*models.Libro) {
+	porID := make(map[int]*models.Libro, len(libros))
+	args := make([]interface{}, len(libros))
+	for i, libro := range libros {
+		porID[libro.ID] = libro
+		args[i] = libro.ID
+	}
+	return "?" + strings.Repeat(", ?", len(libros)-1), args, porID
+}
+
+// cargarRelaciones rellena en cada libro los autores, los géneros, las etiquetas y los archivos.
+func cargarRelaciones(q consultor, libros ...*models.Libro) error {
+	if err := cargarAutores(q, libros...); err != nil {
+		return err
+	}
+	if err := cargarClasificacion(q, libros...); err != nil {
+		return err
+	}
+	return cargarArchivos(q, libros...)
+}
+
+// creditosDeLibro devuelve los créditos guardados de un libro, en su orden.
+func creditosDeLibro(tx *sql.Tx, libroID int) ([]models.CreditoAutor, error) {
+	libro := &models.Libro{ID: libroID}
+	if err := cargarAutores(tx, libro); err != nil {
+		return nil, err
+	}
+	return libro.Autores, nil
+}
+
+// guardarCreditos reemplaza los créditos de un libro y devuelve cómo quedaron, con el
+// ID, el nombre y el slug de cada autor. Los autores indicados por nombre se crean si
+// no existen. También actualiza libros.autor.
+func guardarCreditos(tx *sql.Tx, libroID int, creditos []models.CreditoAutor) ([]models.CreditoAutor, error) {
+	if _, err := tx.Exec("DELETE FROM libros_autores WHERE libro_id = ?", libroID); err != nil {
+		return nil, err
+	}
+
+	guardados := make([]models.CreditoAutor, 0, len(creditos))
+	for i, c := range creditos {
+		autor, err := resolverAutor(tx, c)
+		if err != nil {
+			if errors.Is(err, models.ErrAutorNoEncontrado) {
+				return nil, models.ErroresValidacion{fmt.Sprintf("autores[%d].autor_id", i): "autor no encontrado"}
+			}
+			return nil, err
+		}
+		// Repetir el mismo autor con el mismo papel no añade otro crédito
+		res, err := tx.Exec("INSERT OR IGNORE INTO libros_autores (libro_id, autor_id, rol, posicion) VALUES (?, ?, ?, ?)",
+			libroID, autor.ID, c.Rol, i)
+		if err != nil {
+			return nil, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			guardados = append(guardados, models.CreditoAutor{AutorID: autor.ID, Nombre: autor.Nombre, Slug: autor.Slug, Rol: c.Rol})
+		}
+	}
+
+	return guardados, actualizarTextoAutor(tx, libroID, guardados)
+}
+
+// resolverAutor devuelve el autor de un crédito: el de AutorID, o el que tiene el slug
+// del nombre, que se crea si no existe.
+func resolverAutor(tx *sql.Tx, c models.CreditoAutor) (*models.Autor, error) {
+	autor := &models.Autor{}
+	if c.AutorID > 0 {
+		err := tx.QueryRow("SELECT id, slug, nombre FROM autores WHERE id = ?", c.AutorID).Scan(&autor.ID, &autor.Slug, &autor.Nombre)
+		if err == sql.ErrNoRows {
+			return nil, models.ErrAutorNoEncontrado
+		}
+		return autor, err
+	}
+
+	nombre := strings.TrimSpace(c.Nombre)
+	slug := models.GenerarSlugAutor(nombre)
+	err := tx.QueryRow("SELECT id, slug, nombre FROM autores WHERE slug = ?", slug).Scan(&autor.ID, &autor.Slug, &autor.Nombre)
+	if err != sql.ErrNoRows {
+		return autor, err
+	}
+
+	res, err := tx.Exec("INSERT INTO autores (slug, nombre) VALUES (?, ?)", slug, nombre)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return &models.Autor{ID: int(id), Slug: slug, Nombre: nombre}, nil
+}
+
+// actualizarTextoAutor guarda en libros.autor los nombres de los créditos con rol autor.
+// Solo escribe si cambian, para no reindexar el libro en la búsqueda sin necesidad.
+func actualizarTextoAutor(tx *sql.Tx, libroID int, creditos []models.CreditoAutor) error {
+	_, err := tx.Exec("UPDATE libros SET autor = ?1 WHERE id = ?2 AND autor IS NOT ?1", models.NombresAutores(creditos), libroID)
+	return err
+}
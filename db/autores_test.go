@@ -0,0 +1,110 @@
+package db_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"libroselectronicos/models"
+)
+
+// TestAutores comprueba los créditos de los libros y las obras de cada autor.
+func TestAutores(t *testing.T) {
+	almacen := setupTestDB(t)
+	defer teardownTestDB(almacen)
+
+	// Los nombres que solo difieren en tildes o mayúsculas son el mismo autor
+	cien, err := almacen.AgregarLibro(models.NuevoLibro(0, "Cien años de soledad", "Gabriel García Márquez", 1967))
+	if err != nil {
+		t.Fatalf("Error al agregar libro: %v", err)
+	}
+	otoño, _ := almacen.AgregarLibro(models.NuevoLibro(0, "El otoño del patriarca", "gabriel garcia marquez", 1975))
+	if otoño.Autor != "Gabriel García Márquez" || len(otoño.Autores) != 1 || otoño.Autores[0].AutorID != cien.Autores[0].AutorID {
+		t.Errorf("Se esperaba el mismo autor en ambos libros: %+v, %+v", cien.Autores, otoño.Autores)
+	}
+
+	// Un libro con autor y traductor
+	traducido := models.NuevoLibro(0, "El extranjero", "", 1942)
+	traducido.Autores = []models.CreditoAutor{
+		{Nombre: "Albert Camus", Rol: models.RolAutor},
+		{Nombre: "José Ángel Valente", Rol: models.RolTraductor},
+	}
+	extranjero, err := almacen.AgregarLibro(traducido)
+	if err != nil {
+		t.Fatalf("Error al agregar libro con traductor: %v", err)
+	}
+	if extranjero.Autor != "Albert Camus" {
+		t.Errorf("Autor incorrecto: %q", extranjero.Autor)
+	}
+
+	obtenido, _ := almacen.ObtenerLibro(extranjero.ID)
+	if len(obtenido.Autores) != 2 || obtenido.Autores[1].Slug != "jose-angel-valente" || obtenido.Autores[1].Rol != models.RolTraductor {
+		t.Errorf("Créditos incorrectos: %+v", obtenido.Autores)
+	}
+
+	// Cambiar el autor conserva el traductor
+	camus := "A. Camus"
+	if err := almacen.ActualizarLibro(extranjero.ID, models.LibroPatch{Autor: &camus}); err != nil {
+		t.Fatalf("Error al actualizar autor: %v", err)
+	}
+	obtenido, _ = almacen.ObtenerLibro(extranjero.ID)
+	if obtenido.Autor != "A. Camus" || len(obtenido.Autores) != 2 || obtenido.Autores[1].Rol != models.RolTraductor {
+		t.Errorf("Créditos tras cambiar el autor: %q %+v", obtenido.Autor, obtenido.Autores)
+	}
+
+	// Fusionar "A. Camus" con "Albert Camus" actualiza el texto del libro
+	original, _ := almacen.ObtenerAutorPorSlug("albert-camus")
+	variante, _ := almacen.ObtenerAutorPorSlug("a-camus")
+	if err := almacen.FusionarAutores(variante.ID, original.ID); err != nil {
+		t.Fatalf("Error al fusionar autores: %v", err)
+	}
+	obtenido, _ = almacen.ObtenerLibro(extranjero.ID)
+	if obtenido.Autor != "Albert Camus" {
+		t.Errorf("Autor tras la fusión: %q", obtenido.Autor)
+	}
+	if _, err := almacen.ObtenerAutorPorSlug("a-camus"); !errors.Is(err, models.ErrAutorNoEncontrado) {
+		t.Errorf("El autor fusionado debería haberse eliminado, obtenido: %v", err)
+	}
+	if err := almacen.FusionarAutores(original.ID, 999); !errors.Is(err, models.ErrAutorNoEncontrado) {
+		t.Errorf("Se esperaba ErrAutorNoEncontrado, obtenido: %v", err)
+	}
+
+	// Las obras de un autor, de la más reciente a la más antigua
+	garcia, err := almacen.ObtenerAutorPorSlug("gabriel-garcia-marquez")
+	if err != nil {
+		t.Fatalf("Error al obtener autor: %v", err)
+	}
+	obras, _ := almacen.ListarObrasDeAutor(garcia.ID)
+	if len(obras) != 2 || obras[0].Libro.ID != otoño.ID || obras[1].Rol != models.RolAutor {
+		t.Errorf("Obras incorrectas: %+v", obras)
+	}
+
+	// Al eliminar un libro desaparecen sus créditos
+	almacen.EliminarLibro(otoño.ID)
+	if obras, _ := almacen.ListarObrasDeAutor(garcia.ID); len(obras) != 1 {
+		t.Errorf("Se esperaba 1 obra tras eliminar un libro, obtenidas %d", len(obras))
+	}
+
+	// Los autores con créditos, ordenados por slug; el fusionado ya no aparece
+	autores, err := almacen.ListarAutores()
+	if err != nil {
+		t.Fatalf("Error al listar autores: %v", err)
+	}
+	var slugs []string
+	for _, a := range autores {
+		slugs = append(slugs, a.Slug)
+	}
+	if strings.Join(slugs, ",") != "albert-camus,gabriel-garcia-marquez,jose-angel-valente" {
+		t.Errorf("Autores incorrectos: %v", slugs)
+	}
+
+	// Un autor_id inexistente es un error de validación
+	patch := models.LibroPatch{Autores: &[]models.CreditoAutor{{AutorID: 999, Rol: models.RolAutor}}}
+	if err := almacen.ActualizarLibro(cien.ID, patch); !errors.Is(err, models.ErrValidacion) {
+		t.Errorf("Se esperaba ErrValidacion con un autor inexistente, obtenido: %v", err)
+	}
+	sinAutor := models.LibroPatch{Autores: &[]models.CreditoAutor{{Nombre: "Alguien", Rol: models.RolEditor}}}
+	if err := almacen.ActualizarLibro(cien.ID, sinAutor); !errors.Is(err, models.ErrValidacion) {
+		t.Errorf("Se esperaba ErrValidacion sin ningún autor con rol autor, obtenido: %v", err)
+	}
+}
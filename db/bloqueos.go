@@ -0,0 +1,178 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+
+	"libroselectronicos/models"
+)
+
+// --- Operaciones de Bloqueos de Inicio de Sesión ---
+
+const columnasBloqueoLogin = "id, tipo, clave, fallos, ultimo_fallo, bloqueado_hasta"
+
+// ObtenerBloqueoLogin devuelve los fallos seguidos de un usuario o una IP.
+func (s *sqliteAlmacenamiento) ObtenerBloqueoLogin(tipo, clave string) (*models.BloqueoLogin, error) {
+	row := s.db.QueryRow("SELECT "+columnasBloqueoLogin+" FROM bloqueos_login WHERE tipo = ? AND clave = ?", tipo, clave)
+	bloqueo, err := escanearBloqueoLogin(row)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrBloqueoNoEncontrado
+	}
+	return bloqueo, err
+}
+
+// RegistrarFalloLogin suma un fallo al usuario o la IP y, si supera los permitidos por
+// la política, lo bloquea. Los fallos más antiguos que politica.Olvido no cuentan.
+// Devuelve el bloqueo actualizado.
+func (s *sqliteAlmacenamiento) RegistrarFalloLogin(tipo, clave string, politica models.PoliticaBloqueo, ahora time.Time) (*models.BloqueoLogin, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback() // No tiene efecto si ya se hizo Commit
+
+	bloqueo, err := escanearBloqueoLogin(tx.QueryRow("SELECT "+columnasBloqueoLogin+" FROM bloqueos_login WHERE tipo = ? AND clave = ?", tipo, clave))
+	if err == sql.ErrNoRows {
+		bloqueo = &models.BloqueoLogin{Tipo: tipo, Clave: clave}
+	} else if err != nil {
+		return nil, err
+	}
+	if ahora.Sub(bloqueo.UltimoFallo) >= politica.Olvido {
+		bloqueo.Fallos = 0
+	}
+	bloqueo.Fallos++
+	bloqueo.UltimoFallo = ahora.UTC()
+	if espera := politica.Espera(bloqueo.Fallos); espera > 0 {
+		hasta := bloqueo.UltimoFallo.Add(espera)
+		bloqueo.BloqueadoHasta = &hasta
+	}
+
+	var hasta sql.NullTime
+	if bloqueo.BloqueadoHasta != nil {
+		hasta = sql.NullTime{Time: *bloqueo.BloqueadoHasta, Valid: true}
+	}
+	err = tx.QueryRow(`INSERT INTO bloqueos_login(tipo, clave, fallos, ultimo_fallo, bloqueado_hasta) VALUES(?, ?, ?, ?, ?)
+		ON CONFLICT(tipo, clave) DO UPDATE SET fallos = excluded.fallos, ultimo_fallo = excluded.ultimo_fallo,
+			bloqueado_hasta = excluded.bloqueado_hasta
+		RETURNING id`,
+		tipo, clave, bloqueo.Fallos, bloqueo.UltimoFallo, hasta).Scan(&bloqueo.ID)
+	if err != nil {
+		return nil, err
+	}
+	return bloqueo, tx.Commit()
+}
+
+// ReiniciarBloqueoLogin pone a cero los fallos de un usuario o una IP, p. ej. tras un
+// inicio de sesión correcto. No es un error que no tuviera fallos.
+func (s *sqliteAlmacenamiento) ReiniciarBloqueoLogin(tipo, clave string) error {
+	_, err := s.db.Exec("DELETE FROM bloqueos_login WHERE tipo = ? AND clave = ?", tipo, clave)
+	return err
+}
+
+// ListarBloqueosLogin devuelve los usuarios e IPs con fallos, del último fallo más
+// reciente al más antiguo.
+func (s *sqliteAlmacenamiento) ListarBloqueosLogin() ([]*models.BloqueoLogin, error) {
+	rows, err := s.db.Query("SELECT " + columnasBloqueoLogin + " FROM bloqueos_login ORDER BY ultimo_fallo DESC, id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bloqueos := []*models.BloqueoLogin{}
+	for rows.Next() {
+		bloqueo, err := escanearBloqueoLogin(rows)
+		if err != nil {
+			return nil, err
+		}
+		bloqueos = append(bloqueos, bloqueo)
+	}
+	return bloqueos, rows.Err()
+}
+
+// EliminarBloqueoLogin desbloquea un usuario o una IP y pone a cero sus fallos.
+func (s *sqliteAlmacenamiento) EliminarBloqueoLogin(id int) error {
+	res, err := s.db.Exec("DELETE FROM bloqueos_login WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return models.ErrBloqueoNoEncontrado
+	}
+	return nil
+}
+
+// LimpiarBloqueosLogin borra los fallos anteriores a 'antes' que ya no bloquean, y
+// devuelve cuántos eran.
+func (s *sqliteAlmacenamiento) LimpiarBloqueosLogin(antes time.Time) (int, error) {
+	res, err := s.db.Exec("DELETE FROM bloqueos_login WHERE ultimo_fallo < ? AND (bloqueado_hasta IS NULL OR bloqueado_hasta < ?)",
+		antes.UTC(), time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func escanearBloqueoLogin(fila filaEscaneable) (*models.BloqueoLogin, error) {
+	bloqueo := &models.BloqueoLogin{}
+	var hasta sql.NullTime
+	err := fila.Scan(&bloqueo.ID, &bloqueo.Tipo, &bloqueo.Clave, &bloqueo.Fallos, &bloqueo.UltimoFallo, &hasta)
+	if err != nil {
+		return nil, err
+	}
+	if hasta.Valid {
+		bloqueo.BloqueadoHasta = &hasta.Time
+	}
+	return bloqueo, nil
+}
+
+// --- Registro de Intentos de Inicio de Sesión Fallidos ---
+
+// RegistrarIntentoLogin guarda un inicio de sesión fallido en el registro de auditoría.
+func (s *sqliteAlmacenamiento) RegistrarIntentoLogin(intento *models.IntentoLogin) error {
+	res, err := s.db.Exec("INSERT INTO intentos_login(username, ip, user_agent, motivo, fecha) VALUES(?, ?, ?, ?, ?)",
+		intento.Username, intento.IP, intento.UserAgent, intento.Motivo, intento.Fecha.UTC())
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	intento.ID = int(id)
+	return nil
+}
+
+// ListarIntentosLogin devuelve los últimos 'limite' inicios de sesión fallidos, del más
+// reciente al más antiguo.
+func (s *sqliteAlmacenamiento) ListarIntentosLogin(limite int) ([]*models.IntentoLogin, error) {
+	rows, err := s.db.Query("SELECT id, username, ip, user_agent, motivo, fecha FROM intentos_login ORDER BY fecha DESC, id DESC LIMIT ?", limite)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	intentos := []*models.IntentoLogin{}
+	for rows.Next() {
+		intento := &models.IntentoLogin{}
+		if err := rows.Scan(&intento.ID, &intento.Username, &intento.IP, &intento.UserAgent, &intento.Motivo, &intento.Fecha); err != nil {
+			return nil, err
+		}
+		intentos = append(intentos, intento)
+	}
+	return intentos, rows.Err()
+}
+
+// LimpiarIntentosLogin borra del registro los intentos anteriores a 'antes' y devuelve cuántos eran.
+func (s *sqliteAlmacenamiento) LimpiarIntentosLogin(antes time.Time) (int, error) {
+	res, err := s.db.Exec("DELETE FROM intentos_login WHERE fecha < ?", antes.UTC())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
@@ -0,0 +1,90 @@
+package db_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"libroselectronicos/models"
+)
+
+// TestBloqueosLogin
+func TestBloqueosLogin(t *testing.T) {
+	almacen := setupTestDB(t)
+	defer teardownTestDB(almacen)
+
+	politica := models.PoliticaBloqueo{FallosPermitidos: 2, EsperaInicial: time.Minute, EsperaMaxima: 3 * time.Minute, Olvido: time.Hour}
+	ahora := time.Now().UTC().Truncate(time.Second)
+	fallar := func(en time.Time) *models.BloqueoLogin {
+		bloqueo, err := almacen.RegistrarFalloLogin(models.BloqueoPorUsuario, "ana", politica, en)
+		if err != nil {
+			t.Fatalf("Error al registrar fallo: %v", err)
+		}
+		return bloqueo
+	}
+
+	if b := fallar(ahora); b.GetFallos() != 1 || b.EstaBloqueado() {
+		t.Errorf("El primer fallo no debería bloquear: %+v", b)
+	}
+	fallar(ahora)
+	if b := fallar(ahora); b.GetFallos() != 3 || b.Restante(ahora) != time.Minute {
+		t.Errorf("El tercer fallo debería bloquear 1 minuto: %+v", b)
+	}
+	fallar(ahora)
+	if b := fallar(ahora); b.Restante(ahora) != 3*time.Minute {
+		t.Errorf("La espera debería doblarse hasta el máximo: %v", b.Restante(ahora))
+	}
+
+	obtenido, err := almacen.ObtenerBloqueoLogin(models.BloqueoPorUsuario, "ana")
+	if err != nil {
+		t.Fatalf("Error al obtener bloqueo: %v", err)
+	}
+	if obtenido.GetFallos() != 5 || obtenido.BloqueadoHasta == nil || !obtenido.BloqueadoHasta.Equal(ahora.Add(3*time.Minute)) {
+		t.Errorf("Bloqueo obtenido incorrecto: %+v", obtenido)
+	}
+
+	// Pasado el tiempo de olvido, la cuenta vuelve a empezar
+	if b := fallar(ahora.Add(2 * time.Hour)); b.GetFallos() != 1 || b.Restante(ahora.Add(2*time.Hour)) != 0 {
+		t.Errorf("Los fallos antiguos no deberían contar: %+v", b)
+	}
+
+	if _, err := almacen.RegistrarFalloLogin(models.BloqueoPorIP, "10.0.0.1", politica, ahora); err != nil {
+		t.Fatalf("Error al registrar fallo de IP: %v", err)
+	}
+	bloqueos, err := almacen.ListarBloqueosLogin()
+	if err != nil {
+		t.Fatalf("Error al listar bloqueos: %v", err)
+	}
+	if len(bloqueos) != 2 || bloqueos[0].GetClave() != "ana" {
+		t.Errorf("Listado de bloqueos incorrecto: %+v", bloqueos)
+	}
+
+	if err := almacen.ReiniciarBloqueoLogin(models.BloqueoPorUsuario, "ana"); err != nil {
+		t.Fatalf("Error al reiniciar bloqueo: %v", err)
+	}
+	if _, err := almacen.ObtenerBloqueoLogin(models.BloqueoPorUsuario, "ana"); !errors.Is(err, models.ErrBloqueoNoEncontrado) {
+		t.Errorf("Se esperaba ErrBloqueoNoEncontrado tras reiniciar, obtenido: %v", err)
+	}
+	if err := almacen.EliminarBloqueoLogin(bloqueos[0].GetID()); !errors.Is(err, models.ErrBloqueoNoEncontrado) {
+		t.Errorf("Se esperaba ErrBloqueoNoEncontrado al eliminar un bloqueo inexistente, obtenido: %v", err)
+	}
+	if err := almacen.EliminarBloqueoLogin(bloqueos[1].GetID()); err != nil {
+		t.Errorf("Error al eliminar bloqueo: %v", err)
+	}
+
+	// Registro de intentos
+	for _, fecha := range []time.Time{ahora.Add(-100 * 24 * time.Hour), ahora} {
+		intento := &models.IntentoLogin{Username: "ana", IP: "10.0.0.1", Motivo: models.MotivoContrasenaIncorrecta, Fecha: fecha}
+		if err := almacen.RegistrarIntentoLogin(intento); err != nil || intento.ID == 0 {
+			t.Fatalf("Error al registrar intento: %v", err)
+		}
+	}
+	n, err := almacen.LimpiarIntentosLogin(ahora.Add(-models.RetencionIntentosLogin))
+	if err != nil || n != 1 {
+		t.Errorf("Se esperaba borrar 1 intento antiguo: %d, %v", n, err)
+	}
+	intentos, err := almacen.ListarIntentosLogin(10)
+	if err != nil || len(intentos) != 1 || !intentos[0].Fecha.Equal(ahora) {
+		t.Errorf("Registro de intentos incorrecto: %+v, %v", intentos, err)
+	}
+}
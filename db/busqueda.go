@@ -0,0 +1,93 @@
+package db
+
+import (
+	"html"
+	"strings"
+	"unicode"
+
+	"libroselectronicos/models"
+)
+
+// Pesos de cada columna de libros_fts en la relevancia: un término en el título
+// cuenta más que en el autor, y este más que en la sinopsis.
+const (
+	pesoTitulo   = 10.0
+	pesoAutor    = 5.0
+	pesoSinopsis = 1.0
+)
+
+// Marcas que highlight() y snippet() ponen alrededor de los términos encontrados. Son caracteres de
+// control que no aparecen en los textos, para poder escapar el fragmento antes de
+// sustituirlas por <mark> y </mark>.
+const (
+	marcaInicio = "\x01"
+	marcaFin    = "\x02"
+)
+
+// BuscarLibros busca 'consulta' en el título, el autor y la sinopsis de los libros y
+// devuelve los resultados ordenados de más a menos relevante. Cada palabra de la
+// consulta debe aparecer en el libro; se aceptan prefijos ("cerv" encuentra "Cervantes")
+// y se ignoran mayúsculas y tildes.
+func (s *sqliteAlmacenamiento) BuscarLibros(consulta string, opts models.OpcionesBusqueda) ([]*models.ResultadoBusqueda, error) {
+	match := expresionMatch(consulta)
+	if match == "" {
+		return []*models.ResultadoBusqueda{}, nil
+	}
+	limite := opts.Limite
+	if limite <= 0 {
+		limite = models.LimiteBusquedaPorDefecto
+	}
+
+	// bm25() de FTS5 da valores negativos, más bajos cuanto más relevante; se cambia el
+	// signo para que la puntuación crezca con la relevancia
+	rows, err := s.db.Query(`SELECT l.id, l.slug, l.titulo, l.autor, l.anio, IFNULL(l.isbn, ''), l.idioma, l.editorial, l.caratula_url, l.sinopsis, l.disponible,
+			-bm25(libros_fts, ?, ?, ?) AS puntuacion,
+			highlight(libros_fts, 0, ?, ?),
+			snippet(libros_fts, -1, ?, ?, '…', 12)
+		FROM libros_fts JOIN libros l ON l.id = libros_fts.rowid
+		WHERE libros_fts MATCH ?
+		ORDER BY puntuacion DESC, l.id
+		LIMIT ? OFFSET ?`,
+		pesoTitulo, pesoAutor, pesoSinopsis, marcaInicio, marcaFin, marcaInicio, marcaFin, match, limite, opts.Desplazamiento)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	resultados := []*models.ResultadoBusqueda{}
+	for rows.Next() {
+		libro := &models.Libro{}
+		resultado := &models.ResultadoBusqueda{Libro: libro}
+		var titulo, fragmento string
+		err := rows.Scan(&libro.ID, &libro.Slug, &libro.Titulo, &libro.Autor, &libro.Anio, &libro.ISBN, &libro.Idioma, &libro.Editorial, &libro.CaratulaURL, &libro.Sinopsis, &libro.Disponible,
+			&resultado.Puntuacion, &titulo, &fragmento)
+		if err != nil {
+			return nil, err
+		}
+		resultado.Titulo = resaltar(titulo)
+		resultado.Fragmento = resaltar(fragmento)
+		resultados = append(resultados, resultado)
+	}
+	return resultados, rows.Err()
+}
+
+// expresionMatch convierte el texto que escribe el usuario en una expresión MATCH
+// segura: cada palabra va entre comillas y se busca como prefijo ("cerv" *), de modo
+// que los operadores de FTS5 (OR, NOT, NEAR, -, ^, comillas...) no se interpretan.
+func expresionMatch(consulta string) string {
+	palabras := strings.FieldsFunc(consulta, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	terminos := make([]string, len(palabras))
+	for i, palabra := range palabras {
+		terminos[i] = `"` + palabra + `" *`
+	}
+	return strings.Join(terminos, " ")
+}
+
+// resaltar escapa un texto de highlight() o snippet() y cambia las marcas por etiquetas <mark>.
+func resaltar(fragmento string) string {
+	fragmento = html.EscapeString(fragmento)
+	fragmento = strings.ReplaceAll(fragmento, marcaInicio, "<mark>")
+	return strings.ReplaceAll(fragmento, marcaFin, "</mark>")
+}
@@ -0,0 +1,111 @@
+package db_test
+
+import (
+	"strings"
+	"testing"
+
+	"libroselectronicos/models"
+)
+
+// TestBuscarLibros
+func TestBuscarLibros(t *testing.T) {
+	almacen := setupTestDB(t)
+	defer teardownTestDB(almacen)
+
+	almacen.AgregarLibro(models.NuevoLibroCompleto(1, "Cien años de soledad", "Gabriel García Márquez", 1967, "", "La historia de la familia Buendía en Macondo."))
+	almacen.AgregarLibro(models.NuevoLibroCompleto(2, "El amor en los tiempos del cólera", "Gabriel García Márquez", 1985, "", "Un amor que espera más de cincuenta años."))
+	almacen.AgregarLibro(models.NuevoLibroCompleto(3, "Don Quijote", "Miguel de Cervantes", 1605, "", "Un hidalgo enloquece leyendo libros de caballerías <sic>."))
+
+	tests := []struct {
+		name     string
+		consulta string
+		ids      []int
+	}{
+		{"Título antes que sinopsis", "años", []int{1, 2}},
+		{"Sin tildes ni mayúsculas", "MARQUEZ", []int{1, 2}},
+		{"Prefijo", "cerv", []int{3}},
+		{"Todas las palabras", "amor cólera", []int{2}},
+		{"Operadores como texto", `"hidalgo" -libros*`, []int{3}},
+		{"Sin resultados", "tolkien", []int{}},
+		{"Consulta vacía", "  ", []int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resultados, err := almacen.BuscarLibros(tt.consulta, models.OpcionesBusqueda{})
+			if err != nil {
+				t.Fatalf("Error al buscar %q: %v", tt.consulta, err)
+			}
+			if len(resultados) != len(tt.ids) {
+				t.Fatalf("Se esperaban %d resultados, se obtuvieron %d", len(tt.ids), len(resultados))
+			}
+			for i, r := range resultados {
+				if r.Libro.GetID() != tt.ids[i] {
+					t.Errorf("Resultado %d: esperado libro %d, obtenido %d", i, tt.ids[i], r.Libro.GetID())
+				}
+			}
+		})
+	}
+
+	// El fragmento resalta los términos y escapa el resto del texto
+	resultados, _ := almacen.BuscarLibros("caballerías", models.OpcionesBusqueda{})
+	if len(resultados) != 1 {
+		t.Fatalf("Se esperaba 1 resultado, se obtuvieron %d", len(resultados))
+	}
+	if f := resultados[0].Fragmento; !strings.Contains(f, "<mark>caballerías</mark>") || !strings.Contains(f, "&lt;sic&gt;") {
+		t.Errorf("Fragmento mal resaltado o sin escapar: %q", f)
+	}
+	// El título se devuelve entero, resaltado solo si contiene los términos
+	if titulo := resultados[0].Titulo; titulo != "Don Quijote" {
+		t.Errorf("Título sin términos mal devuelto: %q", titulo)
+	}
+	resultados, _ = almacen.BuscarLibros("quij", models.OpcionesBusqueda{})
+	if len(resultados) != 1 || resultados[0].Titulo != "Don <mark>Quijote</mark>" {
+		t.Errorf("Título mal resaltado: %+v", resultados)
+	}
+
+	// Límite y desplazamiento
+	resultados, _ = almacen.BuscarLibros("gabriel", models.OpcionesBusqueda{Limite: 1, Desplazamiento: 1})
+	if len(resultados) != 1 {
+		t.Errorf("Se esperaba 1 resultado con límite 1, se obtuvieron %d", len(resultados))
+	}
+}
+
+// TestBuscarLibrosSincronizado comprueba que el índice sigue a las altas, cambios y bajas.
+func TestBuscarLibrosSincronizado(t *testing.T) {
+	almacen := setupTestDB(t)
+	defer teardownTestDB(almacen)
+
+	buscar := func(consulta string) int {
+		resultados, err := almacen.BuscarLibros(consulta, models.OpcionesBusqueda{})
+		if err != nil {
+			t.Fatalf("Error al buscar %q: %v", consulta, err)
+		}
+		return len(resultados)
+	}
+
+	almacen.AgregarLibro(models.NuevoLibro(1, "Rayuela", "Julio Cortázar", 1963))
+	if n := buscar("rayuela"); n != 1 {
+		t.Errorf("El libro agregado no aparece en la búsqueda: %d resultados", n)
+	}
+
+	titulo := "Final del juego"
+	almacen.ActualizarLibro(1, models.LibroPatch{Titulo: &titulo})
+	if n := buscar("rayuela"); n != 0 {
+		t.Errorf("El título antiguo sigue en el índice: %d resultados", n)
+	}
+	if n := buscar("juego"); n != 1 {
+		t.Errorf("El título nuevo no está en el índice: %d resultados", n)
+	}
+
+	// Alquilar cambia la fila de libros; el índice debe seguir igual
+	almacen.AlquilarLibro(1, 1)
+	if n := buscar("cortazar"); n != 1 {
+		t.Errorf("El libro alquilado no aparece en la búsqueda: %d resultados", n)
+	}
+
+	almacen.EliminarLibro(1)
+	if n := buscar("cortazar"); n != 0 {
+		t.Errorf("El libro eliminado sigue en el índice: %d resultados", n)
+	}
+}
@@ -0,0 +1,32 @@
+package db
+
+import "libroselectronicos/models"
+
+// --- Operaciones de Carátulas ---
+
+// LibrosConCaratulaExterna devuelve los libros cuya carátula apunta a otro servidor.
+func (s *sqliteAlmacenamiento) LibrosConCaratulaExterna() ([]*models.Libro, error) {
+	rows, err := s.db.Query("SELECT " + columnasLibro + " FROM libros WHERE caratula_url LIKE 'http://%' OR caratula_url LIKE 'https://%' ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var libros []*models.Libro
+	for rows.Next() {
+		libro, err := escanearLibro(rows)
+		if err != nil {
+			return nil, err
+		}
+		libros = append(libros, libro)
+	}
+	return libros, rows.Err()
+}
+
+// CaratulaEnUso indica si algún libro usa la carátula local guardada con 'clave'.
+func (s *sqliteAlmacenamiento) CaratulaEnUso(clave string) (bool, error) {
+	prefijo := models.RutaCaratulas + clave + "/"
+	var enUso bool
+	err := s.db.QueryRow("SELECT EXISTS (SELECT 1 FROM libros WHERE substr(caratula_url, 1, ?) = ?)", len(prefijo), prefijo).Scan(&enUso)
+	return enUso, err
+}
@@ -0,0 +1,438 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"libroselectronicos/models"
+)
+
+// maxFacetasEtiqueta limita las etiquetas que devuelve ContarFacetas; las demás se
+// pueden seguir usando en ?tag=.
+const maxFacetasEtiqueta = 30
+
+// --- Operaciones de Géneros ---
+
+// ListarGeneros devuelve todos los géneros en el orden del árbol: cada género va
+// seguido de sus subgéneros, y los hermanos van por nombre. Nivel indica la profundidad.
+func (s *sqliteAlmacenamiento) ListarGeneros() ([]*models.Genero, error) {
+	rows, err := s.db.Query("SELECT id, slug, nombre, IFNULL(padre_id, 0) FROM generos ORDER BY nombre COLLATE NOCASE, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hijos := map[int][]*models.Genero{}
+	total := 0
+	for rows.Next() {
+		g := &models.Genero{}
+		if err := rows.Scan(&g.ID, &g.Slug, &g.Nombre, &g.PadreID); err != nil {
+			return nil, err
+		}
+		hijos[g.PadreID] = append(hijos[g.PadreID], g)
+		total++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	generos := make([]*models.Genero, 0, total)
+	var recorrer func(padreID, nivel int)
+	recorrer = func(padreID, nivel int) {
+		for _, g := range hijos[padreID] {
+			g.Nivel = nivel
+			generos = append(generos, g)
+			recorrer(g.ID, nivel+1)
+		}
+	}
+	recorrer(0, 0)
+	return generos, nil
+}
+
+// AgregarGenero crea un género y le asigna su ID y su slug, que se genera a partir del
+// nombre. Devuelve ErrGeneroYaExiste si otro género tiene el mismo slug.
+func (s *sqliteAlmacenamiento) AgregarGenero(genero *models.Genero) error {
+	nombre, err := validarNombreGenero(genero.Nombre)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // No tiene efecto si ya se hizo Commit
+
+	slug := models.GenerarSlugGenero(nombre)
+	if err := comprobarGenero(tx, 0, slug, genero.PadreID); err != nil {
+		return err
+	}
+	res, err := tx.Exec("INSERT INTO generos (slug, nombre, padre_id) VALUES (?, ?, ?)", slug, nombre, padreSQL(genero.PadreID))
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	genero.ID, genero.Slug, genero.Nombre = int(id), slug, nombre
+	return nil
+}
+
+// ActualizarGenero cambia el nombre (y con él el slug) y el padre del género genero.ID.
+// El padre no puede ser el propio género ni uno de sus subgéneros.
+func (s *sqliteAlmacenamiento) ActualizarGenero(genero *models.Genero) error {
+	nombre, err := validarNombreGenero(genero.Nombre)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // No tiene efecto si ya se hizo Commit
+
+	slug := models.GenerarSlugGenero(nombre)
+	if err := comprobarGenero(tx, genero.ID, slug, genero.PadreID); err != nil {
+		return err
+	}
+	res, err := tx.Exec("UPDATE generos SET slug = ?, nombre = ?, padre_id = ? WHERE id = ?", slug, nombre, padreSQL(genero.PadreID), genero.ID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return models.ErrGeneroNoEncontrado
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	genero.Slug, genero.Nombre = slug, nombre
+	return nil
+}
+
+// EliminarGenero elimina un género. Sus subgéneros pasan a colgar de su padre y sus
+// libros dejan de tenerlo, pero conservan los demás géneros.
+func (s *sqliteAlmacenamiento) EliminarGenero(id int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // No tiene efecto si ya se hizo Commit
+
+	var padreID sql.NullInt64
+	err = tx.QueryRow("SELECT padre_id FROM generos WHERE id = ?", id).Scan(&padreID)
+	if err == sql.ErrNoRows {
+		return models.ErrGeneroNoEncontrado
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE generos SET padre_id = ? WHERE padre_id = ?", padreID, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM libros_generos WHERE genero_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM generos WHERE id = ?", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func validarNombreGenero(nombre string) (string, error) {
+	nombre = strings.TrimSpace(nombre)
+	if nombre == "" {
+		return "", models.ErroresValidacion{"nombre": "no puede estar vacío"}
+	}
+	return nombre, nil
+}
+
+// comprobarGenero verifica que 'slug' no lo use otro género y que 'padreID' exista y no
+// sea el género 'id' ni uno de sus descendientes. 'id' es 0 para un género nuevo.
+func comprobarGenero(tx *sql.Tx, id int, slug string, padreID int) error {
+	var enUso bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM generos WHERE slug = ? AND id <> ?)", slug, id).Scan(&enUso); err != nil {
+		return err
+	}
+	if enUso {
+		return models.ErrGeneroYaExiste
+	}
+	if padreID == 0 {
+		return nil
+	}
+
+	var existe bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM generos WHERE id = ?)", padreID).Scan(&existe); err != nil {
+		return err
+	}
+	if !existe {
+		return models.ErroresValidacion{"padre_id": "género no encontrado"}
+	}
+
+	// Subiendo desde el padre no se puede llegar al propio género
+	var ciclo bool
+	err := tx.QueryRow(`WITH RECURSIVE ancestros(id) AS (
+			SELECT ? UNION SELECT g.padre_id FROM generos g JOIN ancestros a ON g.id = a.id WHERE g.padre_id IS NOT NULL
+		) SELECT EXISTS (SELECT 1 FROM ancestros WHERE id = ?)`, padreID, id).Scan(&ciclo)
+	if err != nil {
+		return err
+	}
+	if ciclo {
+		return models.ErroresValidacion{"padre_id": "no puede ser el propio género ni uno de sus subgéneros"}
+	}
+	return nil
+}
+
+// padreSQL guarda los géneros raíz con padre_id NULL.
+func padreSQL(padreID int) interface{} {
+	if padreID == 0 {
+		return nil
+	}
+	return padreID
+}
+
+// --- Operaciones de Etiquetas ---
+
+// ListarEtiquetas devuelve todas las etiquetas en uso, por orden alfabético, con el
+// número de libros que tiene cada una.
+func (s *sqliteAlmacenamiento) ListarEtiquetas() ([]*models.Etiqueta, error) {
+	return consultarEtiquetas(s.db, "SELECT etiqueta, COUNT(*) FROM libros_etiquetas GROUP BY etiqueta ORDER BY etiqueta")
+}
+
+// RenombrarEtiqueta cambia la etiqueta 'anterior' por 'nueva' en todos los libros. Si
+// 'nueva' ya existía, las dos se unen.
+func (s *sqliteAlmacenamiento) RenombrarEtiqueta(anterior, nueva string) error {
+	anterior, nueva = models.NormalizarEtiqueta(anterior), models.NormalizarEtiqueta(nueva)
+	etiquetas := []string{nueva}
+	if err := (models.LibroPatch{Etiquetas: &etiquetas}).Validar(); err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // No tiene efecto si ya se hizo Commit
+
+	if anterior == nueva {
+		var existe bool
+		if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM libros_etiquetas WHERE etiqueta = ?)", anterior).Scan(&existe); err != nil {
+			return err
+		}
+		if !existe {
+			return models.ErrEtiquetaNoEncontrada
+		}
+		return nil
+	}
+	_, err = tx.Exec(`INSERT OR IGNORE INTO libros_etiquetas (libro_id, etiqueta)
+		SELECT libro_id, ? FROM libros_etiquetas WHERE etiqueta = ?`, nueva, anterior)
+	if err != nil {
+		return err
+	}
+	if err := eliminarEtiqueta(tx, anterior); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// EliminarEtiqueta quita una etiqueta de todos los libros.
+func (s *sqliteAlmacenamiento) EliminarEtiqueta(etiqueta string) error {
+	return eliminarEtiqueta(s.db, models.NormalizarEtiqueta(etiqueta))
+}
+
+// ejecutor es lo que tienen en común *sql.DB y *sql.Tx para escribir.
+type ejecutor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func eliminarEtiqueta(e ejecutor, etiqueta string) error {
+	res, err := e.Exec("DELETE FROM libros_etiquetas WHERE etiqueta = ?", etiqueta)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return models.ErrEtiquetaNoEncontrada
+	}
+	return nil
+}
+
+func consultarEtiquetas(q consultor, query string, args ...interface{}) ([]*models.Etiqueta, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	etiquetas := []*models.Etiqueta{}
+	for rows.Next() {
+		e := &models.Etiqueta{}
+		if err := rows.Scan(&e.Nombre, &e.Cantidad); err != nil {
+			return nil, err
+		}
+		etiquetas = append(etiquetas, e)
+	}
+	return etiquetas, rows.Err()
+}
+
+// --- Facetas ---
+
+// ContarFacetas cuenta los libros que cumplen los filtros de 'consulta' por género y
+// por etiqueta. Un libro cuenta para su género y para todos los antecesores de este,
+// una sola vez aunque tenga varios subgéneros del mismo.
+func (s *sqliteAlmacenamiento) ContarFacetas(consulta models.ConsultaLibros) (*models.FacetasLibros, error) {
+	if err := consulta.Normalizar(); err != nil {
+		return nil, err
+	}
+	condiciones, args := filtroLibros(consulta)
+	filtrados := "SELECT id FROM libros" + clausulaWhere(condiciones)
+
+	rows, err := s.db.Query(`WITH RECURSIVE ancestros(genero_id, ancestro_id) AS (
+			SELECT id, id FROM generos
+			UNION
+			SELECT a.genero_id, g.padre_id FROM ancestros a JOIN generos g ON g.id = a.ancestro_id WHERE g.padre_id IS NOT NULL
+		)
+		SELECT a.ancestro_id, COUNT(DISTINCT lg.libro_id)
+		FROM libros_generos lg JOIN ancestros a ON a.genero_id = lg.genero_id
+		WHERE lg.libro_id IN (`+filtrados+`)
+		GROUP BY a.ancestro_id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cantidades := map[int]int{}
+	for rows.Next() {
+		var id, cantidad int
+		if err := rows.Scan(&id, &cantidad); err != nil {
+			return nil, err
+		}
+		cantidades[id] = cantidad
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	generos, err := s.ListarGeneros()
+	if err != nil {
+		return nil, err
+	}
+	facetas := &models.FacetasLibros{Generos: []*models.FacetaGenero{}}
+	for _, g := range generos {
+		if cantidad := cantidades[g.ID]; cantidad > 0 {
+			facetas.Generos = append(facetas.Generos, &models.FacetaGenero{Genero: *g, Cantidad: cantidad})
+		}
+	}
+
+	facetas.Etiquetas, err = consultarEtiquetas(s.db, fmt.Sprintf(`SELECT etiqueta, COUNT(*) FROM libros_etiquetas
+		WHERE libro_id IN (%s)
+		GROUP BY etiqueta ORDER BY COUNT(*) DESC, etiqueta LIMIT %d`, filtrados, maxFacetasEtiqueta), args...)
+	if err != nil {
+		return nil, err
+	}
+	return facetas, nil
+}
+
+// --- Géneros y etiquetas de los libros ---
+
+// cargarClasificacion rellena Generos y Etiquetas en cada libro.
+func cargarClasificacion(q consultor, libros ...*models.Libro) error {
+	if len(libros) == 0 {
+		return nil
+	}
+	marcadores, args, porID := idsLibros(libros)
+
+	rows, err := q.Query(`SELECT lg.libro_id, g.id, g.slug, g.nombre, IFNULL(g.padre_id, 0)
+		FROM libros_generos lg JOIN generos g ON g.id = lg.genero_id
+		WHERE lg.libro_id IN (`+marcadores+`)
+		ORDER BY lg.libro_id, g.nombre COLLATE NOCASE`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var libroID int
+		var g models.Genero
+		if err := rows.Scan(&libroID, &g.ID, &g.Slug, &g.Nombre, &g.PadreID); err != nil {
+			return err
+		}
+		porID[libroID].Generos = append(porID[libroID].Generos, g)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = q.Query("SELECT libro_id, etiqueta FROM libros_etiquetas WHERE libro_id IN ("+marcadores+") ORDER BY libro_id, etiqueta", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var libroID int
+		var etiqueta string
+		if err := rows.Scan(&libroID, &etiqueta); err != nil {
+			return err
+		}
+		porID[libroID].Etiquetas = append(porID[libroID].Etiquetas, etiqueta)
+	}
+	return rows.Err()
+}
+
+// guardarGeneros reemplaza los géneros de un libro por los de 'slugs' y devuelve cómo
+// quedaron. Un slug que no existe es un error de validación.
+func guardarGeneros(tx *sql.Tx, libroID int, slugs []string) ([]models.Genero, error) {
+	if _, err := tx.Exec("DELETE FROM libros_generos WHERE libro_id = ?", libroID); err != nil {
+		return nil, err
+	}
+
+	var generos []models.Genero
+	for _, slug := range slugs {
+		var g models.Genero
+		err := tx.QueryRow("SELECT id, slug, nombre, IFNULL(padre_id, 0) FROM generos WHERE slug = ?", slug).Scan(&g.ID, &g.Slug, &g.Nombre, &g.PadreID)
+		if err == sql.ErrNoRows {
+			return nil, models.ErroresValidacion{"generos": fmt.Sprintf("género desconocido: %q", slug)}
+		}
+		if err != nil {
+			return nil, err
+		}
+		res, err := tx.Exec("INSERT OR IGNORE INTO libros_generos (libro_id, genero_id) VALUES (?, ?)", libroID, g.ID)
+		if err != nil {
+			return nil, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			generos = append(generos, g)
+		}
+	}
+	return generos, nil
+}
+
+// guardarEtiquetas reemplaza las etiquetas de un libro y devuelve cómo quedaron,
+// normalizadas y sin repetir.
+func guardarEtiquetas(tx *sql.Tx, libroID int, etiquetas []string) ([]string, error) {
+	if _, err := tx.Exec("DELETE FROM libros_etiquetas WHERE libro_id = ?", libroID); err != nil {
+		return nil, err
+	}
+
+	var guardadas []string
+	for _, etiqueta := range etiquetas {
+		etiqueta = models.NormalizarEtiqueta(etiqueta)
+		res, err := tx.Exec("INSERT OR IGNORE INTO libros_etiquetas (libro_id, etiqueta) VALUES (?, ?)", libroID, etiqueta)
+		if err != nil {
+			return nil, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			guardadas = append(guardadas, etiqueta)
+		}
+	}
+	return guardadas, nil
+}
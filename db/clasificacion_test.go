@@ -0,0 +1,134 @@
+package db_test
+
+import (
+	"errors"
+	"testing"
+
+	"libroselectronicos/models"
+)
+
+// TestGenerosYEtiquetas comprueba el árbol de géneros, las etiquetas de los libros, los
+// filtros por género y etiqueta y las facetas.
+func TestGenerosYEtiquetas(t *testing.T) {
+	almacen := setupTestDB(t)
+	defer teardownTestDB(almacen)
+
+	novela := &models.Genero{Nombre: "Novela"}
+	if err := almacen.AgregarGenero(novela); err != nil {
+		t.Fatalf("Error al agregar género: %v", err)
+	}
+	negra := &models.Genero{Nombre: "Novela negra", PadreID: novela.ID}
+	if err := almacen.AgregarGenero(negra); err != nil {
+		t.Fatalf("Error al agregar subgénero: %v", err)
+	}
+	ensayo := &models.Genero{Nombre: "Ensayo"}
+	almacen.AgregarGenero(ensayo)
+	if negra.Slug != "novela-negra" {
+		t.Errorf("Slug incorrecto: %q", negra.Slug)
+	}
+	if err := almacen.AgregarGenero(&models.Genero{Nombre: "NOVELA"}); !errors.Is(err, models.ErrGeneroYaExiste) {
+		t.Errorf("Se esperaba ErrGeneroYaExiste, se obtuvo %v", err)
+	}
+
+	generos, _ := almacen.ListarGeneros()
+	var orden []string
+	for _, g := range generos {
+		orden = append(orden, g.Slug)
+	}
+	if len(generos) != 3 || orden[0] != "ensayo" || orden[1] != "novela" || orden[2] != "novela-negra" || generos[2].Nivel != 1 {
+		t.Errorf("Árbol de géneros incorrecto: %v", orden)
+	}
+
+	// Un género no puede colgar de sí mismo ni de un subgénero suyo
+	novela.PadreID = negra.ID
+	if err := almacen.ActualizarGenero(novela); !errors.Is(err, models.ErrValidacion) {
+		t.Errorf("Se esperaba un error de validación por ciclo, se obtuvo %v", err)
+	}
+	novela.PadreID = 0
+
+	libro := models.NuevoLibro(0, "El largo adiós", "Raymond Chandler", 1953)
+	libro.Generos = []models.Genero{{Slug: "novela-negra"}}
+	libro.Etiquetas = []string{"Los Ángeles", "detective"}
+	chandler, err := almacen.AgregarLibro(libro)
+	if err != nil {
+		t.Fatalf("Error al agregar libro con géneros: %v", err)
+	}
+	if len(chandler.Generos) != 1 || chandler.Generos[0].ID != negra.ID || len(chandler.Etiquetas) != 2 || chandler.Etiquetas[0] != "los ángeles" {
+		t.Errorf("Clasificación incorrecta: %+v %v", chandler.Generos, chandler.Etiquetas)
+	}
+	christie := models.NuevoLibro(0, "Diez negritos", "Agatha Christie", 1939)
+	christie.Generos = []models.Genero{{Slug: "novela-negra"}}
+	christie.Etiquetas = []string{"detective"}
+	almacen.AgregarLibro(christie)
+	montaigne := models.NuevoLibro(0, "Ensayos", "Michel de Montaigne", 1580)
+	montaigne.Generos = []models.Genero{{Slug: "ensayo"}}
+	almacen.AgregarLibro(montaigne)
+
+	libro.Generos = []models.Genero{{Slug: "poesia"}}
+	if _, err := almacen.AgregarLibro(libro); !errors.Is(err, models.ErrValidacion) {
+		t.Errorf("Se esperaba un error de validación por género desconocido, se obtuvo %v", err)
+	}
+
+	// Filtrar por el género padre incluye los subgéneros; las etiquetas se suman
+	pagina, _ := almacen.ListarLibros(models.ConsultaLibros{Genero: "novela"})
+	if pagina.Total != 2 {
+		t.Errorf("Se esperaban 2 novelas, se obtuvieron %d", pagina.Total)
+	}
+	pagina, _ = almacen.ListarLibros(models.ConsultaLibros{Genero: "novela", Etiquetas: []string{"detective", "los ángeles"}})
+	if pagina.Total != 1 || pagina.Libros[0].ID != chandler.ID {
+		t.Errorf("Filtro por etiquetas incorrecto: %+v", pagina.Libros)
+	}
+
+	facetas, err := almacen.ContarFacetas(models.ConsultaLibros{})
+	if err != nil {
+		t.Fatalf("Error al contar facetas: %v", err)
+	}
+	cantidades := map[string]int{}
+	for _, f := range facetas.Generos {
+		cantidades[f.Slug] = f.Cantidad
+	}
+	if cantidades["novela"] != 2 || cantidades["novela-negra"] != 2 || cantidades["ensayo"] != 1 {
+		t.Errorf("Facetas de género incorrectas: %v", cantidades)
+	}
+	if len(facetas.Etiquetas) != 2 || facetas.Etiquetas[0].Nombre != "detective" || facetas.Etiquetas[0].Cantidad != 2 {
+		t.Errorf("Facetas de etiqueta incorrectas: %+v", facetas.Etiquetas)
+	}
+	facetas, _ = almacen.ContarFacetas(models.ConsultaLibros{Etiquetas: []string{"los ángeles"}})
+	if len(facetas.Generos) != 2 || facetas.Generos[1].Cantidad != 1 {
+		t.Errorf("Las facetas no aplican los filtros: %+v", facetas.Generos)
+	}
+
+	// Renombrar una etiqueta con el nombre de otra las une
+	if err := almacen.RenombrarEtiqueta("los ángeles", "Detective"); err != nil {
+		t.Fatalf("Error al renombrar etiqueta: %v", err)
+	}
+	etiquetas, _ := almacen.ListarEtiquetas()
+	if len(etiquetas) != 1 || etiquetas[0].Nombre != "detective" || etiquetas[0].Cantidad != 2 {
+		t.Errorf("Etiquetas tras renombrar: %+v", etiquetas)
+	}
+	if err := almacen.EliminarEtiqueta("no existe"); !errors.Is(err, models.ErrEtiquetaNoEncontrada) {
+		t.Errorf("Se esperaba ErrEtiquetaNoEncontrada, se obtuvo %v", err)
+	}
+
+	// Actualizar con listas vacías quita los géneros y las etiquetas
+	vacio := []string{}
+	if err := almacen.ActualizarLibro(chandler.ID, models.LibroPatch{Generos: &vacio, Etiquetas: &vacio}); err != nil {
+		t.Fatalf("Error al quitar la clasificación: %v", err)
+	}
+	obtenido, _ := almacen.ObtenerLibro(chandler.ID)
+	if len(obtenido.Generos) != 0 || len(obtenido.Etiquetas) != 0 {
+		t.Errorf("Se esperaba el libro sin clasificar: %+v %v", obtenido.Generos, obtenido.Etiquetas)
+	}
+
+	// Al eliminar un género sus subgéneros pasan a su padre
+	if err := almacen.EliminarGenero(novela.ID); err != nil {
+		t.Fatalf("Error al eliminar género: %v", err)
+	}
+	generos, _ = almacen.ListarGeneros()
+	if len(generos) != 2 || generos[1].Slug != "novela-negra" || generos[1].PadreID != 0 {
+		t.Errorf("Géneros tras eliminar: %+v", generos)
+	}
+	if err := almacen.EliminarGenero(novela.ID); !errors.Is(err, models.ErrGeneroNoEncontrado) {
+		t.Errorf("Se esperaba ErrGeneroNoEncontrado, se obtuvo %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+
+	"libroselectronicos/models"
+)
+
+// --- Operaciones de Verificación de Correo y Restablecimiento de Contraseña ---
+
+// ListarUsuariosPorEmail devuelve los usuarios con ese correo, sin distinguir mayúsculas.
+func (s *sqliteAlmacenamiento) ListarUsuariosPorEmail(email string) ([]*models.Usuario, error) {
+	rows, err := s.db.Query("SELECT "+columnasUsuario+" FROM usuarios WHERE email = ? COLLATE NOCASE ORDER BY id", email)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usuarios := []*models.Usuario{}
+	for rows.Next() {
+		usuario, err := escanearUsuario(rows)
+		if err != nil {
+			return nil, err
+		}
+		usuarios = append(usuarios, usuario)
+	}
+	return usuarios, rows.Err()
+}
+
+// AgregarTokenUsuario guarda un nuevo token de verificación o de restablecimiento y le
+// asigna su ID.
+func (s *sqliteAlmacenamiento) AgregarTokenUsuario(token *models.TokenUsuario) error {
+	return s.db.QueryRow("INSERT INTO tokens_usuario(usuario_id, proposito, hash, creado_en, expira_en) VALUES(?, ?, ?, ?, ?) RETURNING id",
+		token.UsuarioID, token.Proposito, token.Hash, token.CreadoEn.UTC(), token.ExpiraEn.UTC()).Scan(&token.ID)
+}
+
+// ObtenerTokenUsuario busca un token sin usar ni caducado por su hash y su propósito.
+func (s *sqliteAlmacenamiento) ObtenerTokenUsuario(hash, proposito string, ahora time.Time) (*models.TokenUsuario, error) {
+	row := s.db.QueryRow("SELECT "+columnasTokenUsuario+" FROM tokens_usuario WHERE hash = ? AND proposito = ? AND usado_en IS NULL AND expira_en > ?",
+		hash, proposito, ahora.UTC())
+	token, err := escanearTokenUsuario(row)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrTokenUsuarioInvalido
+	}
+	return token, err
+}
+
+// ContarTokensUsuarioDesde cuenta los tokens de un propósito creados para el usuario
+// después de 'desde', para no enviar un correo tras otro.
+func (s *sqliteAlmacenamiento) ContarTokensUsuarioDesde(usuarioID int, proposito string, desde time.Time) (int, error) {
+	var n int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM tokens_usuario WHERE usuario_id = ? AND proposito = ? AND creado_en > ?",
+		usuarioID, proposito, desde.UTC()).Scan(&n)
+	return n, err
+}
+
+// VerificarEmailConToken usa un token de verificación y marca como verificado el correo
+// de su usuario. Los demás tokens de verificación del usuario dejan de valer.
+func (s *sqliteAlmacenamiento) VerificarEmailConToken(hash string, ahora time.Time) (*models.TokenUsuario, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback() // No tiene efecto si ya se hizo Commit
+
+	token, err := usarTokenUsuario(tx, hash, models.PropositoVerificacion, ahora)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("UPDATE usuarios SET email_verificado_en = COALESCE(email_verificado_en, ?) WHERE id = ?", ahora.UTC(), token.UsuarioID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("DELETE FROM tokens_usuario WHERE usuario_id = ? AND proposito = ? AND usado_en IS NULL",
+		token.UsuarioID, models.PropositoVerificacion); err != nil {
+		return nil, err
+	}
+	return token, tx.Commit()
+}
+
+// RestablecerPasswordConToken usa un token de restablecimiento y cambia la contraseña de
+// su usuario por 'password', que debe ser un hash. Como el enlace llegó a su correo, este
+// queda verificado. Los demás tokens sin usar del usuario dejan de valer, sus tokens de
+// API se revocan y sus sesiones se cierran: quien conociera la contraseña anterior pudo
+// crearlos. Todo ocurre en la misma transacción, así que la contraseña no cambia si no
+// se pueden cerrar las sesiones.
+func (s *sqliteAlmacenamiento) RestablecerPasswordConToken(hash, password string, ahora time.Time) (*models.TokenUsuario, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback() // No tiene efecto si ya se hizo Commit
+
+	token, err := usarTokenUsuario(tx, hash, models.PropositoRestablecer, ahora)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("UPDATE usuarios SET password = ?, email_verificado_en = COALESCE(email_verificado_en, ?) WHERE id = ?",
+		password, ahora.UTC(), token.UsuarioID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("DELETE FROM tokens_usuario WHERE usuario_id = ? AND usado_en IS NULL", token.UsuarioID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("UPDATE tokens_api SET revocado_en = ? WHERE usuario_id = ? AND revocado_en IS NULL",
+		ahora.UTC(), token.UsuarioID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("DELETE FROM sesiones WHERE usuario_id = ?", token.UsuarioID); err != nil {
+		return nil, err
+	}
+	return token, tx.Commit()
+}
+
+// LimpiarTokensUsuario borra los tokens caducados antes de 'antes', usados o no, y
+// devuelve cuántos eran.
+func (s *sqliteAlmacenamiento) LimpiarTokensUsuario(antes time.Time) (int, error) {
+	res, err := s.db.Exec("DELETE FROM tokens_usuario WHERE expira_en < ?", antes.UTC())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// usarTokenUsuario marca como usado un token válido. La condición va en el propio UPDATE
+// para que dos peticiones con el mismo enlace no puedan usarlo las dos.
+func usarTokenUsuario(tx *sql.Tx, hash, proposito string, ahora time.Time) (*models.TokenUsuario, error) {
+	row := tx.QueryRow(`UPDATE tokens_usuario SET usado_en = ?
+		WHERE hash = ? AND proposito = ? AND usado_en IS NULL AND expira_en > ?
+		RETURNING `+columnasTokenUsuario,
+		ahora.UTC(), hash, proposito, ahora.UTC())
+	token, err := escanearTokenUsuario(row)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrTokenUsuarioInvalido
+	}
+	return token, err
+}
+
+const columnasTokenUsuario = "id, usuario_id, proposito, hash, creado_en, expira_en, usado_en"
+
+func escanearTokenUsuario(fila filaEscaneable) (*models.TokenUsuario, error) {
+	token := &models.TokenUsuario{}
+	var usado sql.NullTime
+	err := fila.Scan(&token.ID, &token.UsuarioID, &token.Proposito, &token.Hash, &token.CreadoEn, &token.ExpiraEn, &usado)
+	if err != nil {
+		return nil, err
+	}
+	if usado.Valid {
+		token.UsadoEn = &usado.Time
+	}
+	return token, nil
+}
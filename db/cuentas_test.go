@@ -0,0 +1,98 @@
+package db_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"libroselectronicos/models"
+)
+
+// TestTokensUsuario
+func TestTokensUsuario(t *testing.T) {
+	almacen := setupTestDB(t)
+	defer teardownTestDB(almacen)
+
+	if err := almacen.AgregarUsuario(models.NuevoUsuario(0, "ana", "hash", "Ana@Example.com", models.RolLector)); err != nil {
+		t.Fatalf("Error al agregar usuario: %v", err)
+	}
+	ana, _ := almacen.ObtenerUsuarioPorUsername("ana")
+	if ana.EmailVerificado() {
+		t.Errorf("Un usuario nuevo no debería tener el correo verificado")
+	}
+	usuarios, err := almacen.ListarUsuariosPorEmail("ana@example.com")
+	if err != nil || len(usuarios) != 1 || usuarios[0].ID != ana.ID {
+		t.Fatalf("Búsqueda por correo incorrecta: %+v, %v", usuarios, err)
+	}
+
+	ahora := time.Now().UTC().Truncate(time.Second)
+	agregar := func(hash, proposito string, creado time.Time, duracion time.Duration) {
+		token := &models.TokenUsuario{UsuarioID: ana.ID, Proposito: proposito, Hash: hash, CreadoEn: creado, ExpiraEn: creado.Add(duracion)}
+		if err := almacen.AgregarTokenUsuario(token); err != nil || token.ID == 0 {
+			t.Fatalf("Error al agregar token: %v", err)
+		}
+	}
+	agregar("v1", models.PropositoVerificacion, ahora.Add(-time.Hour), models.DuracionTokenVerificacion)
+	agregar("v2", models.PropositoVerificacion, ahora, models.DuracionTokenVerificacion)
+	agregar("caducado", models.PropositoRestablecer, ahora.Add(-2*time.Hour), models.DuracionTokenRestablecer)
+
+	if n, err := almacen.ContarTokensUsuarioDesde(ana.ID, models.PropositoVerificacion, ahora.Add(-time.Minute)); err != nil || n != 1 {
+		t.Errorf("Se esperaba 1 token reciente: %d, %v", n, err)
+	}
+	if _, err := almacen.ObtenerTokenUsuario("v1", models.PropositoRestablecer, ahora); !errors.Is(err, models.ErrTokenUsuarioInvalido) {
+		t.Errorf("Un token no debería valer para otro propósito, obtenido: %v", err)
+	}
+	if _, err := almacen.ObtenerTokenUsuario("caducado", models.PropositoRestablecer, ahora); !errors.Is(err, models.ErrTokenUsuarioInvalido) {
+		t.Errorf("Un token caducado no debería valer, obtenido: %v", err)
+	}
+
+	// Verificar con un token invalida los demás de verificación
+	token, err := almacen.VerificarEmailConToken("v2", ahora)
+	if err != nil || token.UsuarioID != ana.ID || token.UsadoEn == nil {
+		t.Fatalf("Error al verificar: %+v, %v", token, err)
+	}
+	if ana, _ = almacen.ObtenerUsuarioPorID(ana.ID); !ana.EmailVerificado() || !ana.EmailVerificadoEn.Equal(ahora) {
+		t.Errorf("El correo debería estar verificado: %v", ana.EmailVerificadoEn)
+	}
+	for _, hash := range []string{"v1", "v2"} {
+		if _, err := almacen.VerificarEmailConToken(hash, ahora); !errors.Is(err, models.ErrTokenUsuarioInvalido) {
+			t.Errorf("El token %s no debería poder usarse, obtenido: %v", hash, err)
+		}
+	}
+
+	// Restablecer la contraseña, lo que revoca los tokens de API y cierra las sesiones
+	agregar("r1", models.PropositoRestablecer, ahora, models.DuracionTokenRestablecer)
+	if err := almacen.AgregarTokenAPI(models.NuevoTokenAPI(ana.ID, "script", "le_1234", "hash-api", models.RolLector)); err != nil {
+		t.Fatalf("Error al agregar token de API: %v", err)
+	}
+	sesion := &models.Sesion{Hash: "s1", UsuarioID: ana.ID, Datos: []byte{}, CreadaEn: ahora, UltimoAcceso: ahora, ExpiraEn: ahora.Add(time.Hour)}
+	if err := almacen.GuardarSesion(sesion); err != nil {
+		t.Fatalf("Error al guardar sesión: %v", err)
+	}
+	if _, err := almacen.ObtenerTokenUsuario("r1", models.PropositoRestablecer, ahora); err != nil {
+		t.Errorf("El token de restablecimiento debería valer: %v", err)
+	}
+	if _, err := almacen.RestablecerPasswordConToken("r1", "nuevo-hash", ahora); err != nil {
+		t.Fatalf("Error al restablecer: %v", err)
+	}
+	if ana, _ = almacen.ObtenerUsuarioPorID(ana.ID); ana.Password != "nuevo-hash" {
+		t.Errorf("La contraseña no se cambió: %q", ana.Password)
+	}
+	if tokens, _ := almacen.ListarTokensAPIPorUsuario(ana.ID); len(tokens) != 1 || tokens[0].RevocadoEn == nil || !tokens[0].RevocadoEn.Equal(ahora) {
+		t.Errorf("El token de API debería estar revocado: %+v", tokens)
+	}
+	if sesiones, _ := almacen.ListarSesionesPorUsuario(ana.ID); len(sesiones) != 0 {
+		t.Errorf("Deberían haberse cerrado las sesiones: %d", len(sesiones))
+	}
+	if _, err := almacen.RestablecerPasswordConToken("r1", "otro-hash", ahora); !errors.Is(err, models.ErrTokenUsuarioInvalido) {
+		t.Errorf("Un token usado no debería valer, obtenido: %v", err)
+	}
+
+	// Solo quedan los tokens usados, que la limpieza borra cuando caducan
+	if n, err := almacen.LimpiarTokensUsuario(ahora.Add(models.DuracionTokenRestablecer + time.Minute)); err != nil || n != 1 {
+		t.Errorf("Se esperaba borrar el token de restablecimiento: %d, %v", n, err)
+	}
+	if n, err := almacen.LimpiarTokensUsuario(ahora.Add(models.DuracionTokenVerificacion + time.Minute)); err != nil || n != 1 {
+		t.Errorf("Se esperaba borrar el token de verificación: %d, %v", n, err)
+	}
+}
@@ -0,0 +1,99 @@
+package db
+
+import (
+	"database/sql"
+
+	"libroselectronicos/models"
+)
+
+// --- Exportación ---
+
+// tamanoLoteExportacion es cuántas filas se leen por consulta al recorrer una tabla
+// entera. Entre lote y lote no queda ninguna lectura abierta, así que un cliente lento
+// descargando la exportación no retiene la base de datos.
+const tamanoLoteExportacion = 500
+
+// RecorrerLibros llama a 'fn' con cada libro del catálogo, por orden de ID y con sus
+// autores, géneros, etiquetas y archivos. Si 'fn' devuelve un error, se detiene y lo devuelve.
+func (s *sqliteAlmacenamiento) RecorrerLibros(fn func(*models.Libro) error) error {
+	return recorrerEnLotes(s.db, "SELECT "+columnasLibro+" FROM libros WHERE id > ? ORDER BY id LIMIT ?",
+		func(rows *sql.Rows) (*models.Libro, int, error) {
+			libro, err := escanearLibro(rows)
+			if err != nil {
+				return nil, 0, err
+			}
+			return libro, libro.ID, nil
+		},
+		func(libros []*models.Libro) error { return cargarRelaciones(s.db, libros...) },
+		fn)
+}
+
+// RecorrerUsuarios llama a 'fn' con cada usuario por orden de ID. El hash de la
+// contraseña no se lee: Password queda vacío.
+func (s *sqliteAlmacenamiento) RecorrerUsuarios(fn func(*models.Usuario) error) error {
+	return recorrerEnLotes(s.db, "SELECT id, username, email, rol FROM usuarios WHERE id > ? ORDER BY id LIMIT ?",
+		func(rows *sql.Rows) (*models.Usuario, int, error) {
+			usuario := &models.Usuario{}
+			err := rows.Scan(&usuario.ID, &usuario.Username, &usuario.Email, &usuario.Rol)
+			return usuario, usuario.ID, err
+		}, nil, fn)
+}
+
+// RecorrerAlquileres llama a 'fn' con cada alquiler, devuelto o no, por orden de ID.
+func (s *sqliteAlmacenamiento) RecorrerAlquileres(fn func(*models.Alquiler) error) error {
+	return recorrerEnLotes(s.db, "SELECT id, usuario_id, libro_id, fecha_alquiler, fecha_vencimiento, fecha_devolucion FROM alquileres WHERE id > ? ORDER BY id LIMIT ?",
+		func(rows *sql.Rows) (*models.Alquiler, int, error) {
+			alquiler := &models.Alquiler{}
+			var devolucion sql.NullTime
+			err := rows.Scan(&alquiler.ID, &alquiler.UsuarioID, &alquiler.LibroID, &alquiler.FechaAlquiler, &alquiler.FechaVencimiento, &devolucion)
+			if devolucion.Valid {
+				alquiler.FechaDevolucion = &devolucion.Time
+			}
+			return alquiler, alquiler.ID, err
+		}, nil, fn)
+}
+
+// recorrerEnLotes ejecuta 'query', que recibe el último ID leído y el tamaño del lote,
+// hasta que no devuelve filas. 'escanear' lee una fila y devuelve su ID; 'completar',
+// si no es nil, rellena cada lote antes de pasar sus elementos a 'fn'.
+func recorrerEnLotes[T any](q consultor, query string, escanear func(*sql.Rows) (T, int, error), completar func([]T) error, fn func(T) error) error {
+	ultimo := 0
+	for {
+		lote, id, err := leerLote(q, query, ultimo, escanear)
+		if err != nil || len(lote) == 0 {
+			return err
+		}
+		if completar != nil {
+			if err := completar(lote); err != nil {
+				return err
+			}
+		}
+		for _, elemento := range lote {
+			if err := fn(elemento); err != nil {
+				return err
+			}
+		}
+		ultimo = id
+	}
+}
+
+// leerLote lee el lote que sigue al ID 'desde' y devuelve también el ID de su último elemento.
+func leerLote[T any](q consultor, query string, desde int, escanear func(*sql.Rows) (T, int, error)) ([]T, int, error) {
+	rows, err := q.Query(query, desde, tamanoLoteExportacion)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var lote []T
+	ultimo := desde
+	for rows.Next() {
+		elemento, id, err := escanear(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		lote = append(lote, elemento)
+		ultimo = id
+	}
+	return lote, ultimo, rows.Err()
+}
@@ -0,0 +1,86 @@
+package db_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"libroselectronicos/models"
+)
+
+// TestRecorrerLibros comprueba que se recorren todos los libros, en orden y con sus
+// relaciones, aunque ocupen más de un lote.
+func TestRecorrerLibros(t *testing.T) {
+	almacen := setupTestDB(t)
+	defer teardownTestDB(almacen)
+
+	var filas []models.FilaImportacion
+	for i := 1; i <= 1203; i++ {
+		libro := models.NuevoLibro(0, fmt.Sprintf("Libro %d", i), "Autor", 2000)
+		libro.Etiquetas = []string{"lote"}
+		filas = append(filas, models.FilaImportacion{Numero: i, Libro: libro})
+	}
+	if errores, _, err := almacen.ImportarLibros(filas, false); err != nil || len(errores) > 0 {
+		t.Fatalf("Error al preparar los libros: %+v, %v", errores, err)
+	}
+
+	anterior, total := 0, 0
+	err := almacen.RecorrerLibros(func(l *models.Libro) error {
+		if l.ID <= anterior {
+			t.Fatalf("Libro %d después del %d", l.ID, anterior)
+		}
+		if len(l.Autores) != 1 || len(l.Etiquetas) != 1 {
+			t.Fatalf("Libro %d sin relaciones: %+v", l.ID, l)
+		}
+		anterior = l.ID
+		total++
+		return nil
+	})
+	if err != nil || total != len(filas) {
+		t.Errorf("Se esperaban %d libros, se recorrieron %d: %v", len(filas), total, err)
+	}
+
+	// Un error de la función detiene el recorrido
+	parar := errors.New("parar")
+	total = 0
+	err = almacen.RecorrerLibros(func(*models.Libro) error {
+		total++
+		return parar
+	})
+	if !errors.Is(err, parar) || total != 1 {
+		t.Errorf("Se esperaba detenerse en el primer libro, se recorrieron %d: %v", total, err)
+	}
+}
+
+// TestRecorrerUsuariosYAlquileres
+func TestRecorrerUsuariosYAlquileres(t *testing.T) {
+	almacen := setupTestDB(t)
+	defer teardownTestDB(almacen)
+
+	usuario := &models.Usuario{Username: "lector", Password: "hash-secreto", Email: "lector@example.com", Rol: models.RolLector}
+	if err := almacen.AgregarUsuario(usuario); err != nil {
+		t.Fatal(err)
+	}
+	libro, _ := almacen.AgregarLibro(models.NuevoLibro(0, "Niebla", "Miguel de Unamuno", 1914))
+	almacen.AlquilarLibro(usuario.ID, libro.ID)
+	almacen.DevolverLibro(usuario.ID, libro.ID)
+	almacen.AlquilarLibro(usuario.ID, libro.ID)
+
+	var usuarios []*models.Usuario
+	almacen.RecorrerUsuarios(func(u *models.Usuario) error {
+		usuarios = append(usuarios, u)
+		return nil
+	})
+	if len(usuarios) != 1 || usuarios[0].Email != "lector@example.com" || usuarios[0].Password != "" {
+		t.Errorf("Usuarios incorrectos (sin contraseña): %+v", usuarios)
+	}
+
+	var alquileres []*models.Alquiler
+	almacen.RecorrerAlquileres(func(a *models.Alquiler) error {
+		alquileres = append(alquileres, a)
+		return nil
+	})
+	if len(alquileres) != 2 || !alquileres[0].EstaDevuelto() || alquileres[1].EstaDevuelto() {
+		t.Errorf("Se esperaban un alquiler devuelto y otro activo: %+v", alquileres)
+	}
+}
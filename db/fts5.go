@@ -0,0 +1,9 @@
+//go:build !sqlite_fts5 && !fts5
+
+package db
+
+// La búsqueda de texto completo usa FTS5, que go-sqlite3 solo incluye al compilar con la
+// etiqueta sqlite_fts5; sin ella el binario fallaría al aplicar la migración 0015. Este
+// archivo solo se compila cuando falta la etiqueta y detiene la compilación a propósito:
+// la constante no es un int, así que el compilador muestra el mensaje en el error.
+const requiereEtiquetaSqliteFts5 int = "falta la etiqueta sqlite_fts5: use go build -tags sqlite_fts5 o exporte GOFLAGS=-tags=sqlite_fts5"
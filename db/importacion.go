@@ -0,0 +1,123 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+
+	"libroselectronicos/models"
+)
+
+// --- Importación de Libros ---
+
+// ImportarLibros guarda las filas en una sola transacción, comprobando cada una como
+// AgregarLibro. Una fila es además un duplicado si su ISBN, o su título y autor si no
+// tiene ISBN, ya está en el catálogo o en una fila anterior. Si alguna fila tiene
+// errores, o si 'simular' es true, no se guarda ninguna. Devuelve los errores de cada
+// fila y cuántas se guardaron.
+func (s *sqliteAlmacenamiento) ImportarLibros(filas []models.FilaImportacion, simular bool) ([]models.ErrorFila, int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer tx.Rollback() // No tiene efecto si ya se hizo Commit
+
+	existentes, err := clavesCatalogo(tx)
+	if err != nil {
+		return nil, 0, err
+	}
+	enArchivo := map[string]int{} // Clave de duplicado -> fila en que apareció
+
+	var errores []models.ErrorFila
+	for _, fila := range filas {
+		clave := claveDuplicado(fila.Libro)
+		if id, ok := existentes[clave]; ok {
+			errores = append(errores, models.ErrorFila{Fila: fila.Numero, Duplicado: fmt.Sprintf("coincide con el libro %d del catálogo", id)})
+			continue
+		}
+		if anterior, ok := enArchivo[clave]; ok {
+			errores = append(errores, models.ErrorFila{Fila: fila.Numero, Duplicado: fmt.Sprintf("repite la fila %d", anterior)})
+			continue
+		}
+		for _, c := range clavesRegistro(fila.Libro) {
+			if _, ok := enArchivo[c]; !ok {
+				enArchivo[c] = fila.Numero
+			}
+		}
+
+		// Un punto de guardado por fila para deshacer solo la fila que falla
+		if _, err := tx.Exec("SAVEPOINT fila"); err != nil {
+			return nil, 0, err
+		}
+		_, err := insertarLibro(tx, fila.Libro)
+		if err != nil {
+			if _, errRB := tx.Exec("ROLLBACK TO fila"); errRB != nil {
+				return nil, 0, errRB
+			}
+		}
+		if _, errRel := tx.Exec("RELEASE fila"); errRel != nil {
+			return nil, 0, errRel
+		}
+		var campos models.ErroresValidacion
+		if errors.As(err, &campos) {
+			errores = append(errores, models.ErrorFila{Fila: fila.Numero, Campos: campos})
+		} else if errors.Is(err, models.ErrISBNDuplicado) {
+			// El ISBN coincide con otro escrito de forma que la clave no reconoce
+			errores = append(errores, models.ErrorFila{Fila: fila.Numero, Duplicado: err.Error()})
+		} else if err != nil {
+			return nil, 0, fmt.Errorf("fila %d: %w", fila.Numero, err)
+		}
+	}
+
+	if simular || len(errores) > 0 {
+		return errores, 0, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, 0, err
+	}
+	return nil, len(filas), nil
+}
+
+// claveDuplicado identifica un libro para detectar duplicados: su ISBN normalizado o,
+// sin ISBN, su título y autor sin mayúsculas, tildes ni puntuación.
+func claveDuplicado(libro *models.Libro) string {
+	if libro.ISBN != "" {
+		if isbn, err := models.NormalizarISBN(libro.ISBN); err == nil {
+			return "isbn:" + isbn
+		}
+	}
+	return "titulo:" + models.GenerarSlug(libro.Titulo) + "|" + models.GenerarSlugAutor(libro.Autor)
+}
+
+// clavesRegistro son las claves con que un libro ya visto detecta duplicados. Un libro
+// con ISBN también se registra por título y autor, para detectar una fila sin ISBN del
+// mismo libro; dos filas con distinto ISBN son ediciones distintas.
+func clavesRegistro(libro *models.Libro) []string {
+	claves := []string{claveDuplicado(libro)}
+	if libro.ISBN != "" {
+		claves = append(claves, claveDuplicado(&models.Libro{Titulo: libro.Titulo, Autor: libro.Autor}))
+	}
+	return claves
+}
+
+// clavesCatalogo devuelve las claves de registro de los libros del catálogo con su ID.
+func clavesCatalogo(q consultor) (map[string]int, error) {
+	rows, err := q.Query("SELECT id, titulo, autor, IFNULL(isbn, '') FROM libros ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	claves := map[string]int{}
+	for rows.Next() {
+		libro := &models.Libro{}
+		if err := rows.Scan(&libro.ID, &libro.Titulo, &libro.Autor, &libro.ISBN); err != nil {
+			return nil, err
+		}
+		for _, c := range clavesRegistro(libro) {
+			if _, ok := claves[c]; !ok {
+				claves[c] = libro.ID
+			}
+		}
+	}
+	return claves, rows.Err()
+}
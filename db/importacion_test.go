@@ -0,0 +1,94 @@
+package db_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"libroselectronicos/models"
+)
+
+func filaLibro(numero int, titulo, autor string, anio int, isbn string) models.FilaImportacion {
+	libro := models.NuevoLibro(0, titulo, autor, anio)
+	libro.ISBN = isbn
+	return models.FilaImportacion{Numero: numero, Libro: libro}
+}
+
+// TestImportarLibros
+func TestImportarLibros(t *testing.T) {
+	almacen := setupTestDB(t)
+	defer teardownTestDB(almacen)
+
+	existente, err := almacen.AgregarLibro(models.NuevoLibro(0, "La Regenta", "Leopoldo Alas", 1884))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filas := []models.FilaImportacion{
+		filaLibro(2, "Niebla", "Miguel de Unamuno", 1914, "978-84-376-0494-7"),
+		filaLibro(3, "la regenta", "LEOPOLDO ALAS", 1885, ""),             // Ya en el catálogo
+		filaLibro(4, "Niebla (2ª ed.)", "Unamuno", 1935, "9788437604947"), // Mismo ISBN que la fila 2
+		filaLibro(5, "NIEBLA", "Miguel de Unamuno", 2000, ""),             // Mismo título y autor que la fila 2
+		filaLibro(6, "Fortunata y Jacinta", "Benito Pérez Galdós", 1887, ""),
+	}
+	errores, importados, err := almacen.ImportarLibros(filas, false)
+	if err != nil {
+		t.Fatalf("Error al importar: %v", err)
+	}
+	if importados != 0 || len(errores) != 3 {
+		t.Fatalf("Se esperaban 3 errores y ningún libro importado, se obtuvo %d: %+v", importados, errores)
+	}
+	esperados := map[int]string{
+		3: fmt.Sprintf("libro %d", existente.ID),
+		4: "fila 2",
+		5: "fila 2",
+	}
+	for _, e := range errores {
+		if !strings.Contains(e.Duplicado, esperados[e.Fila]) {
+			t.Errorf("Fila %d: duplicado inesperado %q", e.Fila, e.Duplicado)
+		}
+	}
+	if n := len(listarLibros(t, almacen)); n != 1 {
+		t.Errorf("Con errores no debería importarse nada, hay %d libros", n)
+	}
+
+	// Sin los duplicados, la simulación no guarda y la importación guarda todo
+	validas := []models.FilaImportacion{filas[0], filas[4]}
+	errores, importados, err = almacen.ImportarLibros(validas, true)
+	if err != nil || len(errores) != 0 || importados != 0 {
+		t.Fatalf("Simulación incorrecta: %d, %+v, %v", importados, errores, err)
+	}
+	if n := len(listarLibros(t, almacen)); n != 1 {
+		t.Errorf("La simulación no debería guardar libros, hay %d", n)
+	}
+	errores, importados, err = almacen.ImportarLibros(validas, false)
+	if err != nil || len(errores) != 0 || importados != 2 {
+		t.Fatalf("Importación incorrecta: %d, %+v, %v", importados, errores, err)
+	}
+	libro, err := almacen.ObtenerLibroPorISBN("9788437604947")
+	if err != nil || libro.Titulo != "Niebla" || libro.Slug == "" {
+		t.Errorf("Libro importado incorrecto: %+v, %v", libro, err)
+	}
+}
+
+// TestImportarLibrosInvalido comprueba que una fila que no valida el almacén se informa
+// sin abortar la importación.
+func TestImportarLibrosInvalido(t *testing.T) {
+	almacen := setupTestDB(t)
+	defer teardownTestDB(almacen)
+
+	filas := []models.FilaImportacion{
+		filaLibro(1, "Niebla", "Miguel de Unamuno", 1914, ""),
+		filaLibro(2, "Libro", "Autor", 1900, "123"),
+	}
+	errores, importados, err := almacen.ImportarLibros(filas, false)
+	if err != nil {
+		t.Fatalf("Error al importar: %v", err)
+	}
+	if importados != 0 || len(errores) != 1 || errores[0].Fila != 2 || errores[0].Campos["isbn"] == "" {
+		t.Errorf("Se esperaba el ISBN inválido de la fila 2: %d, %+v", importados, errores)
+	}
+	if n := len(listarLibros(t, almacen)); n != 0 {
+		t.Errorf("No debería haberse importado nada, hay %d libros", n)
+	}
+}
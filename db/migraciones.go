@@ -0,0 +1,220 @@
+package db
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Las migraciones viven en db/migraciones como pares NNNN_nombre.up.sql / NNNN_nombre.down.sql.
+// Para cambiar el esquema se añade un par nuevo con el siguiente número; nunca se edita uno ya publicado.
+//
+//go:embed migraciones/*.sql
+var archivosMigraciones embed.FS
+
+const createSchemaMigrationsTableSQL = `
+    CREATE TABLE IF NOT EXISTS schema_migrations (
+        version INTEGER PRIMARY KEY,
+        nombre TEXT NOT NULL,
+        aplicada_en DATETIME NOT NULL
+    );`
+
+// Migracion es un cambio de esquema con su SQL de subida y de bajada.
+type Migracion struct {
+	Version int
+	Nombre  string
+	Subida  string
+	Bajada  string
+}
+
+// EstadoMigracion describe si una migración está aplicada en la base de datos.
+type EstadoMigracion struct {
+	Migracion
+	Aplicada   bool
+	AplicadaEn time.Time
+}
+
+// Migrador aplica y revierte las migraciones embebidas sobre una base de datos.
+type Migrador struct {
+	db          *sql.DB
+	migraciones []Migracion
+}
+
+// NuevoMigrador prepara un Migrador y crea la tabla schema_migrations si no existe.
+func NuevoMigrador(db *sql.DB) (*Migrador, error) {
+	migraciones, err := cargarMigraciones(archivosMigraciones)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(createSchemaMigrationsTableSQL); err != nil {
+		return nil, fmt.Errorf("crear tabla schema_migrations: %w", err)
+	}
+	return &Migrador{db: db, migraciones: migraciones}, nil
+}
+
+// cargarMigraciones lee y ordena las migraciones de 'archivos'. Cada versión debe tener
+// su archivo .up.sql y su .down.sql.
+func cargarMigraciones(archivos fs.FS) ([]Migracion, error) {
+	nombres, err := fs.Glob(archivos, "migraciones/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	porVersion := map[int]*Migracion{}
+	for _, ruta := range nombres {
+		base := path.Base(ruta)
+		var direccion string
+		switch {
+		case strings.HasSuffix(base, ".up.sql"):
+			direccion = "up"
+		case strings.HasSuffix(base, ".down.sql"):
+			direccion = "down"
+		default:
+			return nil, fmt.Errorf("migración %s: debe terminar en .up.sql o .down.sql", base)
+		}
+		numero, nombre, ok := strings.Cut(strings.TrimSuffix(base, "."+direccion+".sql"), "_")
+		version, err := strconv.Atoi(numero)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migración %s: el nombre debe tener la forma NNNN_nombre", base)
+		}
+
+		contenido, err := fs.ReadFile(archivos, ruta)
+		if err != nil {
+			return nil, err
+		}
+		m, existe := porVersion[version]
+		if !existe {
+			m = &Migracion{Version: version, Nombre: nombre}
+			porVersion[version] = m
+		} else if m.Nombre != nombre {
+			return nil, fmt.Errorf("migración %d: nombres distintos %q y %q", version, m.Nombre, nombre)
+		}
+		if direccion == "up" {
+			m.Subida = string(contenido)
+		} else {
+			m.Bajada = string(contenido)
+		}
+	}
+
+	migraciones := make([]Migracion, 0, len(porVersion))
+	for _, m := range porVersion {
+		if m.Subida == "" || m.Bajada == "" {
+			return nil, fmt.Errorf("migración %04d_%s: falta el archivo .up.sql o .down.sql", m.Version, m.Nombre)
+		}
+		migraciones = append(migraciones, *m)
+	}
+	sort.Slice(migraciones, func(i, j int) bool { return migraciones[i].Version < migraciones[j].Version })
+	return migraciones, nil
+}
+
+// UltimaVersion es la versión de la migración más reciente disponible.
+func (m *Migrador) UltimaVersion() int {
+	if len(m.migraciones) == 0 {
+		return 0
+	}
+	return m.migraciones[len(m.migraciones)-1].Version
+}
+
+// VersionActual es la versión aplicada más alta, o 0 si la base de datos está vacía.
+func (m *Migrador) VersionActual() (int, error) {
+	var version sql.NullInt64
+	err := m.db.QueryRow("SELECT MAX(version) FROM schema_migrations").Scan(&version)
+	return int(version.Int64), err
+}
+
+// Estado devuelve todas las migraciones conocidas indicando cuáles están aplicadas.
+func (m *Migrador) Estado() ([]EstadoMigracion, error) {
+	rows, err := m.db.Query("SELECT version, aplicada_en FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	aplicadas := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var aplicadaEn time.Time
+		if err := rows.Scan(&version, &aplicadaEn); err != nil {
+			return nil, err
+		}
+		aplicadas[version] = aplicadaEn
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	estados := make([]EstadoMigracion, 0, len(m.migraciones))
+	for _, mig := range m.migraciones {
+		aplicadaEn, aplicada := aplicadas[mig.Version]
+		estados = append(estados, EstadoMigracion{Migracion: mig, Aplicada: aplicada, AplicadaEn: aplicadaEn})
+	}
+	return estados, nil
+}
+
+// Subir aplica todas las migraciones pendientes.
+func (m *Migrador) Subir() error {
+	return m.MigrarA(m.UltimaVersion())
+}
+
+// MigrarA sube o baja el esquema hasta dejar aplicada exactamente la versión 'destino'
+// (0 revierte todas). Cada migración se ejecuta en su propia transacción.
+func (m *Migrador) MigrarA(destino int) error {
+	if destino < 0 || destino > m.UltimaVersion() {
+		return fmt.Errorf("versión de destino %d fuera de rango (0-%d)", destino, m.UltimaVersion())
+	}
+	estados, err := m.Estado()
+	if err != nil {
+		return err
+	}
+
+	// Subida en orden ascendente
+	for _, e := range estados {
+		if e.Version <= destino && !e.Aplicada {
+			if err := m.ejecutar(e.Migracion, true); err != nil {
+				return err
+			}
+		}
+	}
+	// Bajada en orden descendente
+	for i := len(estados) - 1; i >= 0; i-- {
+		e := estados[i]
+		if e.Version > destino && e.Aplicada {
+			if err := m.ejecutar(e.Migracion, false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (m *Migrador) ejecutar(mig Migracion, subir bool) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	sentencias, direccion := mig.Subida, "subida"
+	if !subir {
+		sentencias, direccion = mig.Bajada, "bajada"
+	}
+	if _, err := tx.Exec(sentencias); err != nil {
+		return fmt.Errorf("migración %04d_%s (%s): %w", mig.Version, mig.Nombre, direccion, err)
+	}
+
+	if subir {
+		_, err = tx.Exec("INSERT INTO schema_migrations(version, nombre, aplicada_en) VALUES(?, ?, ?)", mig.Version, mig.Nombre, time.Now().UTC())
+	} else {
+		_, err = tx.Exec("DELETE FROM schema_migrations WHERE version = ?", mig.Version)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,2 @@
+DROP TABLE usuarios;
+DROP TABLE libros;
@@ -0,0 +1,18 @@
+-- Esquema original: libros y usuarios.
+-- IF NOT EXISTS permite adoptar bases de datos creadas antes del sistema de migraciones.
+CREATE TABLE IF NOT EXISTS libros (
+    id INTEGER PRIMARY KEY,
+    titulo TEXT NOT NULL,
+    autor TEXT NOT NULL,
+    anio INTEGER NOT NULL,
+    caratula_url TEXT,
+    sinopsis TEXT
+);
+
+CREATE TABLE IF NOT EXISTS usuarios (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username TEXT NOT NULL UNIQUE,
+    password TEXT NOT NULL,
+    email TEXT,
+    rol TEXT NOT NULL DEFAULT 'lector'
+);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS alquileres (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    usuario_id INTEGER NOT NULL REFERENCES usuarios(id),
+    libro_id INTEGER NOT NULL REFERENCES libros(id),
+    fecha_alquiler DATETIME NOT NULL,
+    fecha_vencimiento DATETIME NOT NULL,
+    fecha_devolucion DATETIME -- NULL mientras el alquiler está activo
+);
@@ -0,0 +1,14 @@
+CREATE TABLE libros_anterior (
+    id INTEGER PRIMARY KEY,
+    titulo TEXT NOT NULL,
+    autor TEXT NOT NULL,
+    anio INTEGER NOT NULL,
+    caratula_url TEXT,
+    sinopsis TEXT
+);
+
+INSERT INTO libros_anterior (id, titulo, autor, anio, caratula_url, sinopsis)
+SELECT id, titulo, autor, anio, caratula_url, sinopsis FROM libros;
+
+DROP TABLE libros;
+ALTER TABLE libros_anterior RENAME TO libros;
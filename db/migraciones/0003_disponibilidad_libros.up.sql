@@ -0,0 +1,20 @@
+-- Añade 'disponible' reconstruyendo la tabla, para que funcione tanto si la columna
+-- no existe como si la añadió una versión anterior de la aplicación. El estado se
+-- recalcula a partir de los alquileres activos.
+CREATE TABLE libros_nueva (
+    id INTEGER PRIMARY KEY,
+    titulo TEXT NOT NULL,
+    autor TEXT NOT NULL,
+    anio INTEGER NOT NULL,
+    caratula_url TEXT,
+    sinopsis TEXT,
+    disponible INTEGER NOT NULL DEFAULT 1 -- 0 mientras el libro está alquilado
+);
+
+INSERT INTO libros_nueva (id, titulo, autor, anio, caratula_url, sinopsis, disponible)
+SELECT id, titulo, autor, anio, caratula_url, sinopsis,
+       NOT EXISTS (SELECT 1 FROM alquileres a WHERE a.libro_id = libros.id AND a.fecha_devolucion IS NULL)
+FROM libros;
+
+DROP TABLE libros;
+ALTER TABLE libros_nueva RENAME TO libros;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS tokens_api (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    usuario_id INTEGER NOT NULL REFERENCES usuarios(id),
+    nombre TEXT NOT NULL,
+    prefijo TEXT NOT NULL,
+    hash TEXT NOT NULL UNIQUE, -- SHA-256 del token, nunca el token en claro
+    alcance TEXT NOT NULL,
+    creado_en DATETIME NOT NULL,
+    ultimo_uso DATETIME,
+    revocado_en DATETIME
+);
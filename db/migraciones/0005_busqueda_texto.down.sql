@@ -0,0 +1,5 @@
+DROP TRIGGER libros_fts_despues_insert;
+DROP TRIGGER libros_fts_despues_update;
+DROP TRIGGER libros_fts_antes_delete;
+DROP TRIGGER libros_fts_antes_update;
+DROP TABLE libros_fts;
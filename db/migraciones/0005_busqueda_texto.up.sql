@@ -0,0 +1,32 @@
+-- Índice de texto completo sobre título, autor y sinopsis.
+-- Se usa FTS4 porque viene compilado por defecto en github.com/mattn/go-sqlite3
+-- (FTS5 exige compilar con la etiqueta sqlite_fts5). El índice guarda solo los
+-- términos: el contenido se lee de 'libros' (content=) y los triggers lo sincronizan.
+CREATE VIRTUAL TABLE libros_fts USING fts4(
+    content="libros",
+    titulo,
+    autor,
+    sinopsis,
+    tokenize=unicode61 "remove_diacritics=1"
+);
+
+-- Con content= externo, FTS4 lee los valores antiguos de 'libros' al borrar del
+-- índice, así que el borrado debe ocurrir ANTES de modificar la fila.
+CREATE TRIGGER libros_fts_antes_update BEFORE UPDATE ON libros BEGIN
+    DELETE FROM libros_fts WHERE docid = old.id;
+END;
+
+CREATE TRIGGER libros_fts_antes_delete BEFORE DELETE ON libros BEGIN
+    DELETE FROM libros_fts WHERE docid = old.id;
+END;
+
+CREATE TRIGGER libros_fts_despues_update AFTER UPDATE ON libros BEGIN
+    INSERT INTO libros_fts(docid, titulo, autor, sinopsis) VALUES (new.id, new.titulo, new.autor, new.sinopsis);
+END;
+
+CREATE TRIGGER libros_fts_despues_insert AFTER INSERT ON libros BEGIN
+    INSERT INTO libros_fts(docid, titulo, autor, sinopsis) VALUES (new.id, new.titulo, new.autor, new.sinopsis);
+END;
+
+-- Indexar los libros que ya existían
+INSERT INTO libros_fts(libros_fts) VALUES ('rebuild');
@@ -0,0 +1,3 @@
+DROP INDEX idx_libros_anio;
+DROP INDEX idx_libros_autor;
+DROP INDEX idx_libros_titulo;
@@ -0,0 +1,5 @@
+-- Índices para la paginación por cursor de ListarLibros: cada orden recorre
+-- (campo, id), con la misma intercalación que usa la consulta.
+CREATE INDEX idx_libros_titulo ON libros(titulo COLLATE NOCASE, id);
+CREATE INDEX idx_libros_autor ON libros(autor COLLATE NOCASE, id);
+CREATE INDEX idx_libros_anio ON libros(anio, id);
@@ -0,0 +1,35 @@
+CREATE TABLE libros_anterior (
+    id INTEGER PRIMARY KEY,
+    titulo TEXT NOT NULL,
+    autor TEXT NOT NULL,
+    anio INTEGER NOT NULL,
+    caratula_url TEXT,
+    sinopsis TEXT,
+    disponible INTEGER NOT NULL DEFAULT 1
+);
+
+INSERT INTO libros_anterior (id, titulo, autor, anio, caratula_url, sinopsis, disponible)
+SELECT id, titulo, autor, anio, caratula_url, sinopsis, disponible FROM libros;
+
+DROP TABLE libros;
+ALTER TABLE libros_anterior RENAME TO libros;
+
+CREATE INDEX idx_libros_titulo ON libros(titulo COLLATE NOCASE, id);
+CREATE INDEX idx_libros_autor ON libros(autor COLLATE NOCASE, id);
+CREATE INDEX idx_libros_anio ON libros(anio, id);
+
+CREATE TRIGGER libros_fts_antes_update BEFORE UPDATE ON libros BEGIN
+    DELETE FROM libros_fts WHERE docid = old.id;
+END;
+
+CREATE TRIGGER libros_fts_antes_delete BEFORE DELETE ON libros BEGIN
+    DELETE FROM libros_fts WHERE docid = old.id;
+END;
+
+CREATE TRIGGER libros_fts_despues_update AFTER UPDATE ON libros BEGIN
+    INSERT INTO libros_fts(docid, titulo, autor, sinopsis) VALUES (new.id, new.titulo, new.autor, new.sinopsis);
+END;
+
+CREATE TRIGGER libros_fts_despues_insert AFTER INSERT ON libros BEGIN
+    INSERT INTO libros_fts(docid, titulo, autor, sinopsis) VALUES (new.id, new.titulo, new.autor, new.sinopsis);
+END;
@@ -0,0 +1,47 @@
+-- El almacén asigna los IDs: AUTOINCREMENT evita que se reutilice el ID de un libro
+-- eliminado, que podría seguir en alquileres antiguos o en enlaces guardados.
+-- Se añade además un slug único para las URLs. Los de los libros existentes se
+-- generan con slug() (la misma función que usa la aplicación); si dos títulos dan el
+-- mismo slug, el más reciente lleva su ID como sufijo.
+CREATE TABLE libros_nueva (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    slug TEXT NOT NULL UNIQUE,
+    titulo TEXT NOT NULL,
+    autor TEXT NOT NULL,
+    anio INTEGER NOT NULL,
+    caratula_url TEXT,
+    sinopsis TEXT,
+    disponible INTEGER NOT NULL DEFAULT 1 -- 0 mientras el libro está alquilado
+);
+
+INSERT INTO libros_nueva (id, slug, titulo, autor, anio, caratula_url, sinopsis, disponible)
+SELECT id,
+       slug(titulo) || CASE
+           WHEN EXISTS (SELECT 1 FROM libros o WHERE o.id < libros.id AND slug(o.titulo) = slug(libros.titulo))
+           THEN '-' || id ELSE '' END,
+       titulo, autor, anio, caratula_url, sinopsis, disponible
+FROM libros;
+
+-- Al eliminar la tabla se eliminan también sus índices y triggers
+DROP TABLE libros;
+ALTER TABLE libros_nueva RENAME TO libros;
+
+CREATE INDEX idx_libros_titulo ON libros(titulo COLLATE NOCASE, id);
+CREATE INDEX idx_libros_autor ON libros(autor COLLATE NOCASE, id);
+CREATE INDEX idx_libros_anio ON libros(anio, id);
+
+CREATE TRIGGER libros_fts_antes_update BEFORE UPDATE ON libros BEGIN
+    DELETE FROM libros_fts WHERE docid = old.id;
+END;
+
+CREATE TRIGGER libros_fts_antes_delete BEFORE DELETE ON libros BEGIN
+    DELETE FROM libros_fts WHERE docid = old.id;
+END;
+
+CREATE TRIGGER libros_fts_despues_update AFTER UPDATE ON libros BEGIN
+    INSERT INTO libros_fts(docid, titulo, autor, sinopsis) VALUES (new.id, new.titulo, new.autor, new.sinopsis);
+END;
+
+CREATE TRIGGER libros_fts_despues_insert AFTER INSERT ON libros BEGIN
+    INSERT INTO libros_fts(docid, titulo, autor, sinopsis) VALUES (new.id, new.titulo, new.autor, new.sinopsis);
+END;
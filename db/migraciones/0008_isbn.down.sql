@@ -0,0 +1,2 @@
+DROP INDEX idx_libros_isbn;
+ALTER TABLE libros DROP COLUMN isbn;
@@ -0,0 +1,4 @@
+-- ISBN-13 normalizado de cada libro (ver models.NormalizarISBN). Es opcional: los
+-- libros sin ISBN lo tienen a NULL, y el índice único no compara los NULL entre sí.
+ALTER TABLE libros ADD COLUMN isbn TEXT;
+CREATE UNIQUE INDEX idx_libros_isbn ON libros(isbn);
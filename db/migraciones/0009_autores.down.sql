@@ -0,0 +1,4 @@
+-- libros.autor ya contiene los nombres de los autores; se pierden traductores y editores
+DROP TRIGGER libros_autores_al_eliminar;
+DROP TABLE libros_autores;
+DROP TABLE autores;
@@ -0,0 +1,36 @@
+-- Los autores pasan a ser una entidad propia, enlazada con los libros en que participan
+-- y con qué papel. libros.autor se mantiene como texto con los nombres de los autores
+-- con rol 'autor', para mostrar, ordenar, filtrar y buscar sin joins; lo actualiza el
+-- almacén cada vez que cambian los créditos de un libro.
+CREATE TABLE autores (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    slug TEXT NOT NULL UNIQUE, -- slug_autor(nombre): identifica al autor
+    nombre TEXT NOT NULL
+);
+
+CREATE TABLE libros_autores (
+    libro_id INTEGER NOT NULL REFERENCES libros(id),
+    autor_id INTEGER NOT NULL REFERENCES autores(id),
+    rol TEXT NOT NULL CHECK (rol IN ('autor', 'traductor', 'editor')),
+    posicion INTEGER NOT NULL, -- Orden en que se muestran los créditos del libro
+    PRIMARY KEY (libro_id, autor_id, rol)
+);
+
+CREATE INDEX idx_libros_autores_autor ON libros_autores(autor_id, libro_id);
+
+-- Las claves foráneas no están activadas, así que los créditos se borran con el libro
+CREATE TRIGGER libros_autores_al_eliminar AFTER DELETE ON libros BEGIN
+    DELETE FROM libros_autores WHERE libro_id = old.id;
+END;
+
+-- Un autor por cada nombre distinto de libros.autor. Los nombres que solo difieren en
+-- mayúsculas o tildes son el mismo autor, con el nombre del libro más antiguo.
+INSERT INTO autores (slug, nombre)
+SELECT slug_autor(autor), trim(autor)
+FROM libros l
+WHERE l.id = (SELECT MIN(o.id) FROM libros o WHERE slug_autor(o.autor) = slug_autor(l.autor))
+ORDER BY l.id;
+
+INSERT INTO libros_autores (libro_id, autor_id, rol, posicion)
+SELECT l.id, a.id, 'autor', 0
+FROM libros l JOIN autores a ON a.slug = slug_autor(l.autor);
@@ -0,0 +1,4 @@
+DROP TRIGGER libros_clasificacion_al_eliminar;
+DROP TABLE libros_etiquetas;
+DROP TABLE libros_generos;
+DROP TABLE generos;
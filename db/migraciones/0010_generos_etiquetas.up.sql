@@ -0,0 +1,32 @@
+-- Géneros jerárquicos (padre_id NULL en los géneros raíz) y etiquetas libres.
+CREATE TABLE generos (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    slug TEXT NOT NULL UNIQUE,
+    nombre TEXT NOT NULL,
+    padre_id INTEGER REFERENCES generos(id)
+);
+
+CREATE INDEX idx_generos_padre ON generos(padre_id);
+
+CREATE TABLE libros_generos (
+    libro_id INTEGER NOT NULL REFERENCES libros(id),
+    genero_id INTEGER NOT NULL REFERENCES generos(id),
+    PRIMARY KEY (libro_id, genero_id)
+);
+
+CREATE INDEX idx_libros_generos_genero ON libros_generos(genero_id, libro_id);
+
+-- Las etiquetas no tienen tabla propia: son el texto normalizado (NormalizarEtiqueta)
+CREATE TABLE libros_etiquetas (
+    libro_id INTEGER NOT NULL REFERENCES libros(id),
+    etiqueta TEXT NOT NULL,
+    PRIMARY KEY (libro_id, etiqueta)
+);
+
+CREATE INDEX idx_libros_etiquetas_etiqueta ON libros_etiquetas(etiqueta, libro_id);
+
+-- Igual que los créditos de autores, se borran con el libro
+CREATE TRIGGER libros_clasificacion_al_eliminar AFTER DELETE ON libros BEGIN
+    DELETE FROM libros_generos WHERE libro_id = old.id;
+    DELETE FROM libros_etiquetas WHERE libro_id = old.id;
+END;
@@ -0,0 +1,3 @@
+-- El contenido de los archivos queda en el almacén; "archivos limpiar" ya no lo verá referenciado
+DROP TRIGGER archivos_libro_al_eliminar;
+DROP TABLE archivos_libro;
@@ -0,0 +1,20 @@
+-- Archivos EPUB y PDF de cada libro. El contenido está en el almacén de archivos,
+-- con el SHA-256 como clave; aquí solo se guardan sus datos.
+CREATE TABLE archivos_libro (
+    libro_id INTEGER NOT NULL REFERENCES libros(id),
+    formato TEXT NOT NULL CHECK (formato IN ('epub', 'pdf')),
+    mime TEXT NOT NULL,
+    tamano INTEGER NOT NULL,
+    sha256 TEXT NOT NULL,
+    nombre TEXT NOT NULL,
+    subido_en DATETIME NOT NULL,
+    PRIMARY KEY (libro_id, formato)
+);
+
+-- Para saber si otro libro usa el mismo contenido antes de borrarlo
+CREATE INDEX idx_archivos_libro_sha256 ON archivos_libro(sha256);
+
+-- El contenido que deja de usarse lo borra "archivos limpiar"
+CREATE TRIGGER archivos_libro_al_eliminar AFTER DELETE ON libros BEGIN
+    DELETE FROM archivos_libro WHERE libro_id = old.id;
+END;
@@ -0,0 +1,2 @@
+-- Todas las sesiones abiertas se pierden: los usuarios tendrán que volver a iniciar sesión
+DROP TABLE sesiones;
@@ -0,0 +1,15 @@
+-- Sesiones de navegador guardadas en el servidor, para poder listarlas y revocarlas.
+-- La cookie solo lleva el identificador firmado; aquí se guarda su hash, nunca el valor.
+CREATE TABLE sesiones (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    hash TEXT NOT NULL UNIQUE, -- SHA-256 del identificador de la cookie
+    usuario_id INTEGER REFERENCES usuarios(id), -- NULL mientras no se inicia sesión
+    datos BLOB NOT NULL, -- Valores de la sesión codificados con gob
+    user_agent TEXT NOT NULL DEFAULT '',
+    creada_en DATETIME NOT NULL,
+    ultimo_acceso DATETIME NOT NULL,
+    expira_en DATETIME NOT NULL
+);
+
+CREATE INDEX idx_sesiones_usuario ON sesiones(usuario_id);
+CREATE INDEX idx_sesiones_expira_en ON sesiones(expira_en);
@@ -0,0 +1,2 @@
+DROP TABLE intentos_login;
+DROP TABLE bloqueos_login;
@@ -0,0 +1,24 @@
+-- Fallos de inicio de sesión por usuario y por IP, para bloquear temporalmente los
+-- ataques de fuerza bruta. Se guardan en la base de datos para que reiniciar el
+-- servidor no los ponga a cero.
+CREATE TABLE bloqueos_login (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tipo TEXT NOT NULL CHECK (tipo IN ('usuario', 'ip')),
+    clave TEXT NOT NULL, -- Nombre de usuario en minúsculas o dirección IP
+    fallos INTEGER NOT NULL,
+    ultimo_fallo DATETIME NOT NULL,
+    bloqueado_hasta DATETIME, -- NULL si aún no se ha bloqueado
+    UNIQUE (tipo, clave)
+);
+
+-- Registro de auditoría de los inicios de sesión fallidos
+CREATE TABLE intentos_login (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username TEXT NOT NULL,
+    ip TEXT NOT NULL,
+    user_agent TEXT NOT NULL DEFAULT '',
+    motivo TEXT NOT NULL,
+    fecha DATETIME NOT NULL
+);
+
+CREATE INDEX idx_intentos_login_fecha ON intentos_login(fecha);
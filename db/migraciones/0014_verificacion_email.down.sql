@@ -0,0 +1,2 @@
+DROP TABLE tokens_usuario;
+ALTER TABLE usuarios DROP COLUMN email_verificado_en;
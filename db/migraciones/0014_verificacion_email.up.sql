@@ -0,0 +1,18 @@
+-- Verificación del correo y restablecimiento de contraseña por enlaces de un solo uso.
+ALTER TABLE usuarios ADD COLUMN email_verificado_en DATETIME;
+
+-- Las cuentas creadas antes de la verificación por correo se dan por verificadas; si
+-- no, dejarían de poder iniciar sesión.
+UPDATE usuarios SET email_verificado_en = CURRENT_TIMESTAMP;
+
+CREATE TABLE tokens_usuario (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    usuario_id INTEGER NOT NULL REFERENCES usuarios(id),
+    proposito TEXT NOT NULL CHECK (proposito IN ('verificacion', 'restablecer')),
+    hash TEXT NOT NULL UNIQUE, -- SHA-256 del token; el token solo va en el correo
+    creado_en DATETIME NOT NULL,
+    expira_en DATETIME NOT NULL,
+    usado_en DATETIME
+);
+
+CREATE INDEX idx_tokens_usuario_usuario ON tokens_usuario(usuario_id, proposito);
@@ -0,0 +1,31 @@
+DROP TRIGGER libros_fts_update;
+DROP TRIGGER libros_fts_delete;
+DROP TRIGGER libros_fts_insert;
+DROP TABLE libros_fts;
+
+-- Vuelve al índice FTS4 de 0005
+CREATE VIRTUAL TABLE libros_fts USING fts4(
+    content="libros",
+    titulo,
+    autor,
+    sinopsis,
+    tokenize=unicode61 "remove_diacritics=1"
+);
+
+CREATE TRIGGER libros_fts_antes_update BEFORE UPDATE ON libros BEGIN
+    DELETE FROM libros_fts WHERE docid = old.id;
+END;
+
+CREATE TRIGGER libros_fts_antes_delete BEFORE DELETE ON libros BEGIN
+    DELETE FROM libros_fts WHERE docid = old.id;
+END;
+
+CREATE TRIGGER libros_fts_despues_update AFTER UPDATE ON libros BEGIN
+    INSERT INTO libros_fts(docid, titulo, autor, sinopsis) VALUES (new.id, new.titulo, new.autor, new.sinopsis);
+END;
+
+CREATE TRIGGER libros_fts_despues_insert AFTER INSERT ON libros BEGIN
+    INSERT INTO libros_fts(docid, titulo, autor, sinopsis) VALUES (new.id, new.titulo, new.autor, new.sinopsis);
+END;
+
+INSERT INTO libros_fts(libros_fts) VALUES ('rebuild');
@@ -0,0 +1,36 @@
+-- Sustituye el índice FTS4 de 0005 por uno FTS5, que trae bm25(), highlight() y
+-- snippet() integrados. FTS5 exige compilar github.com/mattn/go-sqlite3 con la
+-- etiqueta sqlite_fts5 (ver db/fts5.go). Como antes, el índice guarda solo los
+-- términos: el contenido se lee de 'libros' (content=) y los triggers lo sincronizan.
+DROP TRIGGER libros_fts_despues_insert;
+DROP TRIGGER libros_fts_despues_update;
+DROP TRIGGER libros_fts_antes_delete;
+DROP TRIGGER libros_fts_antes_update;
+DROP TABLE libros_fts;
+
+CREATE VIRTUAL TABLE libros_fts USING fts5(
+    titulo,
+    autor,
+    sinopsis,
+    content = 'libros',
+    content_rowid = 'id',
+    tokenize = 'unicode61 remove_diacritics 2'
+);
+
+-- Con content= externo, FTS5 no sabe qué términos tenía la fila: al borrarla del
+-- índice hay que pasarle los valores antiguos con el comando 'delete'.
+CREATE TRIGGER libros_fts_insert AFTER INSERT ON libros BEGIN
+    INSERT INTO libros_fts(rowid, titulo, autor, sinopsis) VALUES (new.id, new.titulo, new.autor, new.sinopsis);
+END;
+
+CREATE TRIGGER libros_fts_delete AFTER DELETE ON libros BEGIN
+    INSERT INTO libros_fts(libros_fts, rowid, titulo, autor, sinopsis) VALUES ('delete', old.id, old.titulo, old.autor, old.sinopsis);
+END;
+
+CREATE TRIGGER libros_fts_update AFTER UPDATE OF titulo, autor, sinopsis ON libros BEGIN
+    INSERT INTO libros_fts(libros_fts, rowid, titulo, autor, sinopsis) VALUES ('delete', old.id, old.titulo, old.autor, old.sinopsis);
+    INSERT INTO libros_fts(rowid, titulo, autor, sinopsis) VALUES (new.id, new.titulo, new.autor, new.sinopsis);
+END;
+
+-- Indexar los libros que ya existían
+INSERT INTO libros_fts(libros_fts) VALUES ('rebuild');
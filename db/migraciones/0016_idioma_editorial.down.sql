@@ -0,0 +1,2 @@
+ALTER TABLE libros DROP COLUMN editorial;
+ALTER TABLE libros DROP COLUMN idioma;
@@ -0,0 +1,3 @@
+-- Idioma (etiqueta BCP 47) y editorial de cada libro; "" si no se conocen.
+ALTER TABLE libros ADD COLUMN idioma TEXT NOT NULL DEFAULT '';
+ALTER TABLE libros ADD COLUMN editorial TEXT NOT NULL DEFAULT '';
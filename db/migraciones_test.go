@@ -0,0 +1,152 @@
+package db_test
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+
+	"libroselectronicos/db"
+)
+
+const testMigracionesDBPath = "test_migraciones.db"
+
+func abrirDBMigraciones(t *testing.T) (*sql.DB, *db.Migrador) {
+	os.Remove(testMigracionesDBPath)
+	conexion, err := db.AbrirSQLite(testMigracionesDBPath)
+	if err != nil {
+		t.Fatalf("Error al abrir la base de datos: %v", err)
+	}
+	t.Cleanup(func() {
+		conexion.Close()
+		os.Remove(testMigracionesDBPath)
+	})
+
+	migrador, err := db.NuevoMigrador(conexion)
+	if err != nil {
+		t.Fatalf("Error al crear el migrador: %v", err)
+	}
+	return conexion, migrador
+}
+
+func contarTablas(t *testing.T, conexion *sql.DB) int {
+	var n int
+	err := conexion.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name NOT IN ('schema_migrations', 'sqlite_sequence')").Scan(&n)
+	if err != nil {
+		t.Fatalf("Error al contar tablas: %v", err)
+	}
+	return n
+}
+
+// TestMigrarSubirYBajar
+func TestMigrarSubirYBajar(t *testing.T) {
+	conexion, migrador := abrirDBMigraciones(t)
+
+	if err := migrador.Subir(); err != nil {
+		t.Fatalf("Error al subir migraciones: %v", err)
+	}
+	version, _ := migrador.VersionActual()
+	if version != migrador.UltimaVersion() {
+		t.Errorf("Versión incorrecta tras subir: esperada %d, obtenida %d", migrador.UltimaVersion(), version)
+	}
+
+	// Subir dos veces no hace nada
+	if err := migrador.Subir(); err != nil {
+		t.Fatalf("Error al subir migraciones por segunda vez: %v", err)
+	}
+
+	if err := migrador.MigrarA(0); err != nil {
+		t.Fatalf("Error al revertir todas las migraciones: %v", err)
+	}
+	if n := contarTablas(t, conexion); n != 0 {
+		t.Errorf("Se esperaban 0 tablas tras revertir todo, quedan %d", n)
+	}
+
+	if err := migrador.Subir(); err != nil {
+		t.Fatalf("Error al volver a subir migraciones: %v", err)
+	}
+	estados, _ := migrador.Estado()
+	for _, e := range estados {
+		if !e.Aplicada {
+			t.Errorf("Migración %04d_%s pendiente tras subir", e.Version, e.Nombre)
+		}
+	}
+
+	if err := migrador.MigrarA(migrador.UltimaVersion() + 1); err == nil {
+		t.Errorf("Se esperaba error al migrar a una versión inexistente")
+	}
+}
+
+// TestMigrarBaseDeDatosExistente comprueba que una base de datos creada antes de las
+// migraciones se adopta sin perder datos.
+func TestMigrarBaseDeDatosExistente(t *testing.T) {
+	conexion, migrador := abrirDBMigraciones(t)
+
+	_, err := conexion.Exec(`
+		CREATE TABLE libros (id INTEGER PRIMARY KEY, titulo TEXT NOT NULL, autor TEXT NOT NULL, anio INTEGER NOT NULL, caratula_url TEXT, sinopsis TEXT);
+		CREATE TABLE usuarios (id INTEGER PRIMARY KEY AUTOINCREMENT, username TEXT NOT NULL UNIQUE, password TEXT NOT NULL, email TEXT, rol TEXT NOT NULL DEFAULT 'lector');
+		CREATE TABLE alquileres (id INTEGER PRIMARY KEY AUTOINCREMENT, usuario_id INTEGER NOT NULL, libro_id INTEGER NOT NULL,
+			fecha_alquiler DATETIME NOT NULL, fecha_vencimiento DATETIME NOT NULL, fecha_devolucion DATETIME);
+		INSERT INTO libros VALUES (1, 'Alquilado', 'Autor', 2000, '', ''), (2, 'Libre', 'Autor', 2001, '', '');
+		INSERT INTO usuarios(username, password, rol) VALUES ('ana', 'hash', 'administrador');
+		INSERT INTO alquileres(usuario_id, libro_id, fecha_alquiler, fecha_vencimiento) VALUES (1, 1, '2024-01-01', '2024-01-15');`)
+	if err != nil {
+		t.Fatalf("Error al crear el esquema antiguo: %v", err)
+	}
+
+	if err := migrador.Subir(); err != nil {
+		t.Fatalf("Error al migrar la base de datos existente: %v", err)
+	}
+
+	var libros, usuarios int
+	conexion.QueryRow("SELECT COUNT(*) FROM libros").Scan(&libros)
+	conexion.QueryRow("SELECT COUNT(*) FROM usuarios").Scan(&usuarios)
+	if libros != 2 || usuarios != 1 {
+		t.Errorf("Se perdieron datos: %d libros, %d usuarios", libros, usuarios)
+	}
+
+	var disponible1, disponible2 bool
+	conexion.QueryRow("SELECT disponible FROM libros WHERE id = 1").Scan(&disponible1)
+	conexion.QueryRow("SELECT disponible FROM libros WHERE id = 2").Scan(&disponible2)
+	if disponible1 || !disponible2 {
+		t.Errorf("Disponibilidad mal calculada: libro 1 = %v, libro 2 = %v", disponible1, disponible2)
+	}
+
+	// Los dos libros tienen el mismo autor, que pasa a la tabla de autores una sola vez
+	var autores, creditos int
+	conexion.QueryRow("SELECT COUNT(*) FROM autores").Scan(&autores)
+	conexion.QueryRow("SELECT COUNT(*) FROM libros_autores WHERE rol = 'autor'").Scan(&creditos)
+	if autores != 1 || creditos != 2 {
+		t.Errorf("Autores mal migrados: %d autores, %d créditos", autores, creditos)
+	}
+}
+
+// TestMigrarBusquedaAFTS5 comprueba que una base de datos que ya tenía el índice FTS4
+// de 0005 pasa a FTS5 con los libros existentes indexados.
+func TestMigrarBusquedaAFTS5(t *testing.T) {
+	conexion, migrador := abrirDBMigraciones(t)
+
+	if err := migrador.MigrarA(14); err != nil {
+		t.Fatalf("Error al migrar a la versión 14: %v", err)
+	}
+	if _, err := conexion.Exec(`INSERT INTO libros(titulo, autor, anio, caratula_url, sinopsis, slug) VALUES ('Niebla', 'Miguel de Unamuno', 1914, '', '', 'niebla')`); err != nil {
+		t.Fatalf("Error al insertar libro: %v", err)
+	}
+
+	if err := migrador.Subir(); err != nil {
+		t.Fatalf("Error al migrar a FTS5: %v", err)
+	}
+	var titulo string
+	err := conexion.QueryRow(`SELECT highlight(libros_fts, 0, '[', ']') FROM libros_fts WHERE libros_fts MATCH 'niebla' ORDER BY bm25(libros_fts)`).Scan(&titulo)
+	if err != nil || titulo != "[Niebla]" {
+		t.Errorf("Índice FTS5 incorrecto tras migrar: %q, %v", titulo, err)
+	}
+
+	// Al revertir vuelve el índice FTS4 con los mismos libros
+	if err := migrador.MigrarA(14); err != nil {
+		t.Fatalf("Error al revertir a FTS4: %v", err)
+	}
+	var n int
+	if err := conexion.QueryRow(`SELECT COUNT(*) FROM libros_fts WHERE libros_fts MATCH 'unamuno'`).Scan(&n); err != nil || n != 1 {
+		t.Errorf("Índice FTS4 incorrecto tras revertir: %d coincidencias, %v", n, err)
+	}
+}
@@ -0,0 +1,111 @@
+package db
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"libroselectronicos/models"
+)
+
+// columnasOrden traduce cada campo de ordenación a su expresión SQL. Solo se ordena
+// por las claves de este mapa, así que nunca se concatena texto del usuario.
+var columnasOrden = map[string]string{
+	models.OrdenID:     "id",
+	models.OrdenTitulo: "titulo COLLATE NOCASE",
+	models.OrdenAutor:  "autor COLLATE NOCASE",
+	models.OrdenAnio:   "anio",
+}
+
+// cursorLibros identifica el libro desde el que continúa una página. Se guarda el
+// valor del campo de ordenación y el ID, que desempata entre libros con el mismo valor.
+type cursorLibros struct {
+	Orden string      `json:"o"` // Orden y dirección en que se generó, ej. "titulo:asc"
+	Valor interface{} `json:"v"`
+	ID    int         `json:"id"`
+	Atras bool        `json:"a,omitempty"` // Pide la página anterior a este libro
+}
+
+func claveOrden(consulta models.ConsultaLibros) string {
+	return consulta.Orden + ":" + consulta.Direccion
+}
+
+// codificarCursor genera el cursor opaco que continúa la consulta desde 'libro'.
+func codificarCursor(consulta models.ConsultaLibros, libro *models.Libro, atras bool) string {
+	c := cursorLibros{Orden: claveOrden(consulta), ID: libro.ID, Atras: atras}
+	switch consulta.Orden {
+	case models.OrdenTitulo:
+		c.Valor = libro.Titulo
+	case models.OrdenAutor:
+		c.Valor = libro.Autor
+	case models.OrdenAnio:
+		c.Valor = libro.Anio
+	default:
+		c.Valor = libro.ID
+	}
+	datos, _ := json.Marshal(c) // Solo contiene cadenas y números
+	return base64.RawURLEncoding.EncodeToString(datos)
+}
+
+// decodificarCursor lee un cursor y comprueba que se generó para el mismo orden.
+func decodificarCursor(valor string, consulta models.ConsultaLibros) (*cursorLibros, error) {
+	datos, err := base64.RawURLEncoding.DecodeString(valor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: cursor mal formado", models.ErrConsultaInvalida)
+	}
+	c := &cursorLibros{}
+	if err := json.Unmarshal(datos, c); err != nil || c.Valor == nil {
+		return nil, fmt.Errorf("%w: cursor mal formado", models.ErrConsultaInvalida)
+	}
+	if c.Orden != claveOrden(consulta) {
+		return nil, fmt.Errorf("%w: el cursor corresponde a otro orden", models.ErrConsultaInvalida)
+	}
+	return c, nil
+}
+
+// filtroLibros devuelve las condiciones SQL y sus argumentos para los filtros de la consulta.
+func filtroLibros(consulta models.ConsultaLibros) ([]string, []interface{}) {
+	var condiciones []string
+	var args []interface{}
+	if consulta.Autor != "" {
+		condiciones = append(condiciones, `autor LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+escaparLike(consulta.Autor)+"%")
+	}
+	if consulta.AnioDesde != 0 {
+		condiciones = append(condiciones, "anio >= ?")
+		args = append(args, consulta.AnioDesde)
+	}
+	if consulta.AnioHasta != 0 {
+		condiciones = append(condiciones, "anio <= ?")
+		args = append(args, consulta.AnioHasta)
+	}
+	if consulta.Disponible != nil {
+		condiciones = append(condiciones, "disponible = ?")
+		args = append(args, *consulta.Disponible)
+	}
+	if consulta.Genero != "" {
+		// El género y todos sus subgéneros
+		condiciones = append(condiciones, `id IN (SELECT libro_id FROM libros_generos WHERE genero_id IN (
+			WITH RECURSIVE rama(id) AS (
+				SELECT id FROM generos WHERE slug = ?
+				UNION SELECT g.id FROM generos g JOIN rama ON g.padre_id = rama.id
+			) SELECT id FROM rama))`)
+		args = append(args, consulta.Genero)
+	}
+	for _, etiqueta := range consulta.Etiquetas {
+		condiciones = append(condiciones, "id IN (SELECT libro_id FROM libros_etiquetas WHERE etiqueta = ?)")
+		args = append(args, etiqueta)
+	}
+	return condiciones, args
+}
+
+func clausulaWhere(condiciones []string) string {
+	if len(condiciones) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(condiciones, " AND ")
+}
+
+// escaparLike hace que %, _ y \ se busquen literalmente en un patrón LIKE ... ESCAPE '\'.
+var escaparLike = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace
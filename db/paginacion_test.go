@@ -0,0 +1,111 @@
+package db_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"libroselectronicos/db"
+	"libroselectronicos/models"
+)
+
+func idsDe(libros []*models.Libro) []int {
+	ids := make([]int, len(libros))
+	for i, libro := range libros {
+		ids[i] = libro.GetID()
+	}
+	return ids
+}
+
+// recorrerPaginas sigue los cursores siguientes desde la primera página y devuelve
+// los IDs de cada página.
+func recorrerPaginas(t *testing.T, almacen db.LibroAlmacenamiento, consulta models.ConsultaLibros) [][]int {
+	t.Helper()
+	var paginas [][]int
+	for {
+		pagina, err := almacen.ListarLibros(consulta)
+		if err != nil {
+			t.Fatalf("Error al listar libros: %v", err)
+		}
+		paginas = append(paginas, idsDe(pagina.Libros))
+		if pagina.CursorSiguiente == "" {
+			return paginas
+		}
+		consulta.Cursor = pagina.CursorSiguiente
+	}
+}
+
+// TestListarLibrosPaginado
+func TestListarLibrosPaginado(t *testing.T) {
+	almacen := setupTestDB(t)
+	defer teardownTestDB(almacen)
+
+	// Dos libros comparten año y autor para comprobar el desempate por ID
+	almacen.AgregarLibro(models.NuevoLibro(1, "Ensayo sobre la ceguera", "José Saramago", 1995))
+	almacen.AgregarLibro(models.NuevoLibro(2, "alef", "Jorge Luis Borges", 1949))
+	almacen.AgregarLibro(models.NuevoLibro(3, "Ficciones", "Jorge Luis Borges", 1944))
+	almacen.AgregarLibro(models.NuevoLibro(4, "Pedro Páramo", "Juan Rulfo", 1955))
+	almacen.AgregarLibro(models.NuevoLibro(5, "El llano en llamas", "Juan Rulfo", 1955))
+	almacen.AlquilarLibro(1, 4)
+
+	tests := []struct {
+		name     string
+		consulta models.ConsultaLibros
+		paginas  string
+	}{
+		{"Por ID", models.ConsultaLibros{Limite: 2}, "[[1 2] [3 4] [5]]"},
+		{"Por título sin distinguir mayúsculas", models.ConsultaLibros{Limite: 2, Orden: models.OrdenTitulo}, "[[2 5] [1 3] [4]]"},
+		{"Por año descendente", models.ConsultaLibros{Limite: 2, Orden: models.OrdenAnio, Direccion: models.DireccionDesc}, "[[1 5] [4 2] [3]]"},
+		{"Filtro por autor", models.ConsultaLibros{Autor: "borges"}, "[[2 3]]"},
+		{"Filtro por años", models.ConsultaLibros{AnioDesde: 1945, AnioHasta: 1960}, "[[2 4 5]]"},
+		{"Filtro por disponibilidad", models.ConsultaLibros{Disponible: new(bool)}, "[[4]]"},
+		{"Autor con comodines literales", models.ConsultaLibros{Autor: "%"}, "[[]]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fmt.Sprint(recorrerPaginas(t, almacen, tt.consulta)); got != tt.paginas {
+				t.Errorf("Páginas incorrectas: esperadas %s, obtenidas %s", tt.paginas, got)
+			}
+		})
+	}
+}
+
+// TestListarLibrosCursores comprueba el total, el retroceso y los cursores inválidos.
+func TestListarLibrosCursores(t *testing.T) {
+	almacen := setupTestDB(t)
+	defer teardownTestDB(almacen)
+
+	for id := 1; id <= 5; id++ {
+		almacen.AgregarLibro(models.NuevoLibro(id, fmt.Sprintf("Libro %d", id), "Autor", 2000+id))
+	}
+
+	consulta := models.ConsultaLibros{Limite: 2, Orden: models.OrdenAnio}
+	primera, _ := almacen.ListarLibros(consulta)
+	if primera.Total != 5 || primera.CursorAnterior != "" {
+		t.Errorf("Primera página incorrecta: total %d, cursor anterior %q", primera.Total, primera.CursorAnterior)
+	}
+
+	segunda, _ := almacen.ListarLibros(consulta.ConCursor(primera.CursorSiguiente))
+	if fmt.Sprint(idsDe(segunda.Libros)) != "[3 4]" || segunda.CursorAnterior == "" {
+		t.Fatalf("Segunda página incorrecta: %v", idsDe(segunda.Libros))
+	}
+
+	// Volver atrás desde la segunda página da otra vez la primera
+	anterior, _ := almacen.ListarLibros(consulta.ConCursor(segunda.CursorAnterior))
+	if fmt.Sprint(idsDe(anterior.Libros)) != "[1 2]" || anterior.CursorAnterior != "" || anterior.CursorSiguiente == "" {
+		t.Errorf("Página anterior incorrecta: %v (anterior %q, siguiente %q)", idsDe(anterior.Libros), anterior.CursorAnterior, anterior.CursorSiguiente)
+	}
+
+	// Un cursor de otro orden o manipulado se rechaza
+	otroOrden := models.ConsultaLibros{Limite: 2, Orden: models.OrdenTitulo, Cursor: primera.CursorSiguiente}
+	if _, err := almacen.ListarLibros(otroOrden); !errors.Is(err, models.ErrConsultaInvalida) {
+		t.Errorf("Se esperaba ErrConsultaInvalida con un cursor de otro orden, obtenido: %v", err)
+	}
+	if _, err := almacen.ListarLibros(consulta.ConCursor("no-es-un-cursor")); !errors.Is(err, models.ErrConsultaInvalida) {
+		t.Errorf("Se esperaba ErrConsultaInvalida con un cursor mal formado, obtenido: %v", err)
+	}
+	if _, err := almacen.ListarLibros(models.ConsultaLibros{Orden: "sinopsis; DROP TABLE libros"}); !errors.Is(err, models.ErrConsultaInvalida) {
+		t.Errorf("Se esperaba ErrConsultaInvalida con un orden desconocido, obtenido: %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+
+	"libroselectronicos/models"
+)
+
+// --- Operaciones de Sesiones ---
+
+// GuardarSesion crea la sesión o, si ya existe una con su hash, actualiza sus datos,
+// usuario, user agent, último acceso y caducidad. Asigna el ID de la sesión.
+func (s *sqliteAlmacenamiento) GuardarSesion(sesion *models.Sesion) error {
+	var usuarioID sql.NullInt64
+	if sesion.UsuarioID != 0 {
+		usuarioID = sql.NullInt64{Int64: int64(sesion.UsuarioID), Valid: true}
+	}
+	return s.db.QueryRow(`INSERT INTO sesiones(hash, usuario_id, datos, user_agent, creada_en, ultimo_acceso, expira_en)
+		VALUES(?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(hash) DO UPDATE SET usuario_id = excluded.usuario_id, datos = excluded.datos,
+			user_agent = excluded.user_agent, ultimo_acceso = excluded.ultimo_acceso, expira_en = excluded.expira_en
+		RETURNING id`,
+		sesion.Hash, usuarioID, sesion.Datos, sesion.UserAgent, sesion.CreadaEn.UTC(), sesion.UltimoAcceso.UTC(), sesion.ExpiraEn.UTC()).Scan(&sesion.ID)
+}
+
+// ObtenerSesionPorHash busca una sesión que no haya caducado por el hash de su identificador.
+func (s *sqliteAlmacenamiento) ObtenerSesionPorHash(hash string) (*models.Sesion, error) {
+	row := s.db.QueryRow("SELECT "+columnasSesion+" FROM sesiones WHERE hash = ? AND expira_en > ?", hash, time.Now().UTC())
+	sesion, err := escanearSesion(row)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrSesionNoEncontrada
+	}
+	return sesion, err
+}
+
+// RegistrarAccesoSesion actualiza el último acceso de una sesión y alarga su caducidad.
+func (s *sqliteAlmacenamiento) RegistrarAccesoSesion(sesionID int, expiraEn time.Time) error {
+	_, err := s.db.Exec("UPDATE sesiones SET ultimo_acceso = ?, expira_en = ? WHERE id = ?", time.Now().UTC(), expiraEn.UTC(), sesionID)
+	return err
+}
+
+// ListarSesionesPorUsuario devuelve las sesiones abiertas de un usuario, de la usada más
+// recientemente a la que menos.
+func (s *sqliteAlmacenamiento) ListarSesionesPorUsuario(usuarioID int) ([]*models.Sesion, error) {
+	rows, err := s.db.Query("SELECT "+columnasSesion+" FROM sesiones WHERE usuario_id = ? AND expira_en > ? ORDER BY ultimo_acceso DESC, id DESC",
+		usuarioID, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sesiones := []*models.Sesion{}
+	for rows.Next() {
+		sesion, err := escanearSesion(rows)
+		if err != nil {
+			return nil, err
+		}
+		sesiones = append(sesiones, sesion)
+	}
+	return sesiones, rows.Err()
+}
+
+// EliminarSesion revoca una sesión del usuario.
+func (s *sqliteAlmacenamiento) EliminarSesion(usuarioID, sesionID int) error {
+	res, err := s.db.Exec("DELETE FROM sesiones WHERE id = ? AND usuario_id = ?", sesionID, usuarioID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return models.ErrSesionNoEncontrada
+	}
+	return nil
+}
+
+// EliminarSesionPorHash borra una sesión por el hash de su identificador, p. ej. al
+// cerrarla. No es un error que ya no exista.
+func (s *sqliteAlmacenamiento) EliminarSesionPorHash(hash string) error {
+	_, err := s.db.Exec("DELETE FROM sesiones WHERE hash = ?", hash)
+	return err
+}
+
+// EliminarSesionesDeUsuario revoca todas las sesiones de un usuario salvo, si no es 0,
+// la sesión 'exceptoID'. Devuelve cuántas se revocaron.
+func (s *sqliteAlmacenamiento) EliminarSesionesDeUsuario(usuarioID, exceptoID int) (int, error) {
+	res, err := s.db.Exec("DELETE FROM sesiones WHERE usuario_id = ? AND id != ?", usuarioID, exceptoID)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// LimpiarSesionesCaducadas borra las sesiones caducadas y devuelve cuántas eran.
+func (s *sqliteAlmacenamiento) LimpiarSesionesCaducadas() (int, error) {
+	res, err := s.db.Exec("DELETE FROM sesiones WHERE expira_en <= ?", time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+const columnasSesion = "id, hash, IFNULL(usuario_id, 0), datos, user_agent, creada_en, ultimo_acceso, expira_en"
+
+func escanearSesion(fila filaEscaneable) (*models.Sesion, error) {
+	sesion := &models.Sesion{}
+	err := fila.Scan(&sesion.ID, &sesion.Hash, &sesion.UsuarioID, &sesion.Datos, &sesion.UserAgent, &sesion.CreadaEn, &sesion.UltimoAcceso, &sesion.ExpiraEn)
+	if err != nil {
+		return nil, err
+	}
+	return sesion, nil
+}
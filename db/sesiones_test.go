@@ -0,0 +1,118 @@
+package db_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"libroselectronicos/models"
+)
+
+// TestSesiones
+func TestSesiones(t *testing.T) {
+	almacen := setupTestDB(t)
+	defer teardownTestDB(almacen)
+
+	ahora := time.Now()
+	nueva := func(hash string, usuarioID int, expiraEn time.Time) *models.Sesion {
+		sesion := &models.Sesion{Hash: hash, UsuarioID: usuarioID, Datos: []byte("datos"), UserAgent: "Firefox",
+			CreadaEn: ahora, UltimoAcceso: ahora, ExpiraEn: expiraEn}
+		if err := almacen.GuardarSesion(sesion); err != nil {
+			t.Fatalf("Error al guardar sesión %s: %v", hash, err)
+		}
+		return sesion
+	}
+
+	anonima := nueva("hash-anonima", 0, ahora.Add(time.Hour))
+	if anonima.GetID() == 0 {
+		t.Errorf("Se esperaba un ID de sesión asignado")
+	}
+	// Guardarla de nuevo con el mismo hash la actualiza, p. ej. al iniciar sesión
+	actualizada := nueva("hash-anonima", 1, ahora.Add(time.Hour))
+	if actualizada.GetID() != anonima.GetID() {
+		t.Errorf("La sesión debería actualizarse, no duplicarse: %d != %d", actualizada.GetID(), anonima.GetID())
+	}
+	obtenida, err := almacen.ObtenerSesionPorHash("hash-anonima")
+	if err != nil {
+		t.Fatalf("Error al obtener sesión por hash: %v", err)
+	}
+	if obtenida.UsuarioID != 1 || string(obtenida.Datos) != "datos" || obtenida.GetUserAgent() != "Firefox" {
+		t.Errorf("Sesión obtenida incorrecta: %+v", obtenida)
+	}
+
+	otra := nueva("hash-otra", 1, ahora.Add(time.Hour))
+	ajena := nueva("hash-ajena", 2, ahora.Add(time.Hour))
+	nueva("hash-caducada", 1, ahora.Add(-time.Minute))
+
+	// Una sesión caducada ni autentica ni aparece en el listado
+	if _, err := almacen.ObtenerSesionPorHash("hash-caducada"); !errors.Is(err, models.ErrSesionNoEncontrada) {
+		t.Errorf("Se esperaba ErrSesionNoEncontrada para una sesión caducada, obtenido: %v", err)
+	}
+	sesiones, err := almacen.ListarSesionesPorUsuario(1)
+	if err != nil {
+		t.Fatalf("Error al listar sesiones: %v", err)
+	}
+	if len(sesiones) != 2 {
+		t.Errorf("Se esperaban 2 sesiones abiertas, obtenidas %d", len(sesiones))
+	}
+
+	// Registrar un acceso alarga la caducidad
+	if err := almacen.RegistrarAccesoSesion(otra.GetID(), ahora.Add(48*time.Hour)); err != nil {
+		t.Fatalf("Error al registrar acceso: %v", err)
+	}
+	obtenida, err = almacen.ObtenerSesionPorHash("hash-otra")
+	if err != nil {
+		t.Fatalf("Error al obtener sesión por hash: %v", err)
+	}
+	if !obtenida.ExpiraEn.After(ahora.Add(47 * time.Hour)) {
+		t.Errorf("La caducidad debería haberse alargado: %v", obtenida.ExpiraEn)
+	}
+
+	// Otro usuario no puede revocarla
+	if err := almacen.EliminarSesion(2, otra.GetID()); !errors.Is(err, models.ErrSesionNoEncontrada) {
+		t.Errorf("Se esperaba ErrSesionNoEncontrada al revocar una sesión ajena, obtenido: %v", err)
+	}
+	if err := almacen.EliminarSesion(1, otra.GetID()); err != nil {
+		t.Fatalf("Error al revocar sesión: %v", err)
+	}
+	if _, err := almacen.ObtenerSesionPorHash("hash-otra"); !errors.Is(err, models.ErrSesionNoEncontrada) {
+		t.Errorf("Se esperaba ErrSesionNoEncontrada para una sesión revocada, obtenido: %v", err)
+	}
+
+	// Revocar todas salvo una deja solo esa, y no toca las de otros usuarios
+	nueva("hash-tercera", 1, ahora.Add(time.Hour))
+	n, err := almacen.EliminarSesionesDeUsuario(1, anonima.GetID())
+	if err != nil {
+		t.Fatalf("Error al revocar sesiones del usuario: %v", err)
+	}
+	if n != 2 { // hash-tercera y hash-caducada
+		t.Errorf("Se esperaban 2 sesiones revocadas, obtenidas %d", n)
+	}
+	if _, err := almacen.ObtenerSesionPorHash("hash-anonima"); err != nil {
+		t.Errorf("La sesión exceptuada debería seguir abierta: %v", err)
+	}
+	if _, err := almacen.ObtenerSesionPorHash("hash-ajena"); err != nil {
+		t.Errorf("La sesión de otro usuario debería seguir abierta: %v", err)
+	}
+
+	// La limpieza borra solo las caducadas
+	nueva("hash-caducada-2", 2, ahora.Add(-time.Minute))
+	n, err = almacen.LimpiarSesionesCaducadas()
+	if err != nil {
+		t.Fatalf("Error al limpiar sesiones caducadas: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("Se esperaba 1 sesión caducada borrada, obtenidas %d", n)
+	}
+
+	if err := almacen.EliminarSesionPorHash("hash-ajena"); err != nil {
+		t.Fatalf("Error al borrar sesión por hash: %v", err)
+	}
+	sesiones, err = almacen.ListarSesionesPorUsuario(ajena.UsuarioID)
+	if err != nil {
+		t.Fatalf("Error al listar sesiones: %v", err)
+	}
+	if len(sesiones) != 0 {
+		t.Errorf("No deberían quedar sesiones del usuario 2: %+v", sesiones)
+	}
+}
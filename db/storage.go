@@ -2,207 +2,525 @@ package db
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
 	"log" // Asegúrate de que esta importación esté aquí
+	"slices"
+	"strings"
+	"time"
 
 	"libroselectronicos/models"
 
-	_ "github.com/mattn/go-sqlite3" // Driver SQLite
+	"github.com/mattn/go-sqlite3" // Driver SQLite
 )
 
 // Extendemos la interfaz para incluir operaciones de Usuario y Alquiler
 type LibroAlmacenamiento interface {
-	AgregarLibro(libro *models.Libro) error
+	AgregarLibro(libro *models.Libro) (*models.Libro, error)
 	ObtenerLibro(id int) (*models.Libro, error)
-	ListarLibros() []*models.Libro
-	ActualizarLibro(id int, updates map[string]interface{}) error
+	ObtenerLibroPorSlug(slug string) (*models.Libro, error)
+	ObtenerLibroPorISBN(isbn string) (*models.Libro, error)
+	ListarLibros(consulta models.ConsultaLibros) (*models.PaginaLibros, error)
+	ActualizarLibro(id int, patch models.LibroPatch) error
 	EliminarLibro(id int) error
+	BuscarLibros(consulta string, opts models.OpcionesBusqueda) ([]*models.ResultadoBusqueda, error)
+	ImportarLibros(filas []models.FilaImportacion, simular bool) ([]models.ErrorFila, int, error)
+	RecorrerLibros(fn func(*models.Libro) error) error
+
+	// --- Operaciones para Autores ---
+	ObtenerAutorPorSlug(slug string) (*models.Autor, error)
+	ListarAutores() ([]*models.Autor, error)
+	ListarObrasDeAutor(autorID int) ([]*models.ObraAutor, error)
+	FusionarAutores(origenID, destinoID int) error
+
+	// --- Operaciones para Géneros y Etiquetas ---
+	ListarGeneros() ([]*models.Genero, error)
+	AgregarGenero(genero *models.Genero) error
+	ActualizarGenero(genero *models.Genero) error
+	EliminarGenero(id int) error
+	ListarEtiquetas() ([]*models.Etiqueta, error)
+	RenombrarEtiqueta(anterior, nueva string) error
+	EliminarEtiqueta(etiqueta string) error
+	ContarFacetas(consulta models.ConsultaLibros) (*models.FacetasLibros, error)
+
+	// --- Operaciones para Archivos de Libros ---
+	GuardarArchivoLibro(archivo *models.ArchivoLibro) (string, error)
+	ObtenerArchivoLibro(libroID int, formato string) (*models.ArchivoLibro, error)
+	EliminarArchivoLibro(libroID int, formato string) error
+	ArchivoEnUso(sha256 string) (bool, error)
+
+	// --- Operaciones para Carátulas ---
+	LibrosConCaratulaExterna() ([]*models.Libro, error)
+	CaratulaEnUso(clave string) (bool, error)
 
 	// --- Nuevas operaciones para Usuarios ---
 	AgregarUsuario(usuario *models.Usuario) error
 	ObtenerUsuarioPorID(id int) (*models.Usuario, error)
 	ObtenerUsuarioPorUsername(username string) (*models.Usuario, error)
-
-	// --- Nuevas operaciones para Alquileres (en un paso posterior) ---
-	// Esto lo añadiremos después de definir el modelo Alquiler
+	RecorrerUsuarios(fn func(*models.Usuario) error) error
+	ListarUsuarios() ([]*models.Usuario, error)
+	ContarUsuariosPorRol(rol string) (int, error)
+	CambiarRolUsuario(id int, rol string) error
+
+	// --- Operaciones para Alquileres ---
+	AlquilarLibro(usuarioID, libroID int) (*models.Alquiler, error)
+	DevolverLibro(usuarioID, libroID int) error
+	ListarAlquileresPorUsuario(usuarioID int) ([]*models.Alquiler, error)
+	TieneAlquilerActivo(usuarioID, libroID int) (bool, error)
+	RecorrerAlquileres(fn func(*models.Alquiler) error) error
+
+	// --- Operaciones para Tokens de API ---
+	AgregarTokenAPI(token *models.TokenAPI) error
+	ObtenerTokenAPIPorHash(hash string) (*models.TokenAPI, error)
+	ListarTokensAPIPorUsuario(usuarioID int) ([]*models.TokenAPI, error)
+	RevocarTokenAPI(usuarioID, tokenID int) error
+	RegistrarUsoTokenAPI(tokenID int) error
+
+	// --- Operaciones para Sesiones ---
+	GuardarSesion(sesion *models.Sesion) error
+	ObtenerSesionPorHash(hash string) (*models.Sesion, error)
+	RegistrarAccesoSesion(sesionID int, expiraEn time.Time) error
+	ListarSesionesPorUsuario(usuarioID int) ([]*models.Sesion, error)
+	EliminarSesion(usuarioID, sesionID int) error
+	EliminarSesionPorHash(hash string) error
+	EliminarSesionesDeUsuario(usuarioID, exceptoID int) (int, error)
+	LimpiarSesionesCaducadas() (int, error)
+
+	// --- Operaciones para Bloqueos de Inicio de Sesión ---
+	ObtenerBloqueoLogin(tipo, clave string) (*models.BloqueoLogin, error)
+	RegistrarFalloLogin(tipo, clave string, politica models.PoliticaBloqueo, ahora time.Time) (*models.BloqueoLogin, error)
+	ReiniciarBloqueoLogin(tipo, clave string) error
+	ListarBloqueosLogin() ([]*models.BloqueoLogin, error)
+	EliminarBloqueoLogin(id int) error
+	LimpiarBloqueosLogin(antes time.Time) (int, error)
+	RegistrarIntentoLogin(intento *models.IntentoLogin) error
+	ListarIntentosLogin(limite int) ([]*models.IntentoLogin, error)
+	LimpiarIntentosLogin(antes time.Time) (int, error)
+
+	// --- Operaciones para Verificación de Correo y Restablecimiento de Contraseña ---
+	ListarUsuariosPorEmail(email string) ([]*models.Usuario, error)
+	AgregarTokenUsuario(token *models.TokenUsuario) error
+	ObtenerTokenUsuario(hash, proposito string, ahora time.Time) (*models.TokenUsuario, error)
+	ContarTokensUsuarioDesde(usuarioID int, proposito string, desde time.Time) (int, error)
+	VerificarEmailConToken(hash string, ahora time.Time) (*models.TokenUsuario, error)
+	RestablecerPasswordConToken(hash, password string, ahora time.Time) (*models.TokenUsuario, error)
+	LimpiarTokensUsuario(antes time.Time) (int, error)
 
 	Close() error // Método para cerrar la conexión a la base de datos
 }
 
+// opcionesDSN hace que las transacciones tomen el bloqueo de escritura al empezar
+// (BEGIN IMMEDIATE) y que las conexiones esperen en lugar de fallar con "database is locked".
+const opcionesDSN = "?_txlock=immediate&_busy_timeout=5000"
+
+// driverSQLite es el driver de go-sqlite3 con las funciones SQL propias de la aplicación:
+// slug() y slug_autor(), que las migraciones usan para generar los slugs de los datos
+// existentes igual que GenerarSlug y GenerarSlugAutor.
+const driverSQLite = "sqlite3_libros"
+
+func init() {
+	sql.Register(driverSQLite, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			if err := conn.RegisterFunc("slug", models.GenerarSlug, true); err != nil {
+				return err
+			}
+			return conn.RegisterFunc("slug_autor", models.GenerarSlugAutor, true)
+		},
+	})
+}
+
 type sqliteAlmacenamiento struct {
 	db *sql.DB
 }
 
-// NuevoAlmacen crea una nueva instancia de sqliteAlmacenamiento.
-func NuevoAlmacen() LibroAlmacenamiento {
-	db, err := sql.Open("sqlite3", "./libros.db")
+// AbrirSQLite abre la base de datos SQLite de 'ruta' con las opciones de la aplicación.
+func AbrirSQLite(ruta string) (*sql.DB, error) {
+	return sql.Open(driverSQLite, ruta+opcionesDSN)
+}
+
+// nuevoAlmacenSQLite abre la base de datos y aplica las migraciones pendientes.
+func nuevoAlmacenSQLite(ruta string) (LibroAlmacenamiento, error) {
+	db, err := AbrirSQLite(ruta)
 	if err != nil {
-		log.Printf("Error al abrir la base de datos: %v", err)
-		return nil
+		return nil, err
 	}
 
-	// Crear la tabla 'libros' si no existe
-	createLibrosTableSQL := `
-	CREATE TABLE IF NOT EXISTS libros (
-		id INTEGER PRIMARY KEY,
-		titulo TEXT NOT NULL,
-		autor TEXT NOT NULL,
-		anio INTEGER NOT NULL,
-		caratula_url TEXT,
-		sinopsis TEXT -- Campo para la sinopsis
-	);`
-	_, err = db.Exec(createLibrosTableSQL)
+	migrador, err := NuevoMigrador(db)
+	if err == nil {
+		err = migrador.Subir()
+	}
 	if err != nil {
-		log.Printf("Error al crear la tabla 'libros': %v", err)
-		return nil
+		db.Close()
+		return nil, err
 	}
 
-	// Crear la tabla 'usuarios' si no existe
-	createUsuariosTableSQL := `
-    CREATE TABLE IF NOT EXISTS usuarios (
-        id INTEGER PRIMARY KEY AUTOINCREMENT,
-        username TEXT NOT NULL UNIQUE,
-        password TEXT NOT NULL,
-        email TEXT,
-        rol TEXT NOT NULL DEFAULT 'lector'
-    );`
-	_, err = db.Exec(createUsuariosTableSQL)
+	return &sqliteAlmacenamiento{db: db}, nil
+}
+
+// NuevoAlmacen crea una nueva instancia de sqliteAlmacenamiento sobre el archivo 'rutaDB'.
+func NuevoAlmacen(rutaDB string) LibroAlmacenamiento {
+	almacen, err := nuevoAlmacenSQLite(rutaDB)
 	if err != nil {
-		log.Printf("Error al crear la tabla 'usuarios': %v", err)
+		log.Printf("Error al inicializar la base de datos: %v", err)
 		return nil
 	}
-
-	return &sqliteAlmacenamiento{db: db}
+	return almacen
 }
 
 // NuevoAlmacenForTest existe para que los tests puedan usar una DB separada
 func NewAlmacenForTest(dbPath string) LibroAlmacenamiento {
-	db, err := sql.Open("sqlite3", dbPath)
+	almacen, err := nuevoAlmacenSQLite(dbPath)
 	if err != nil {
-		log.Printf("Error al abrir la base de datos de prueba: %v", err)
+		log.Printf("Error al inicializar la base de datos de prueba: %v", err)
 		return nil
 	}
+	return almacen
+}
 
-	// Crear la tabla 'libros' si no existe (para tests)
-	createLibrosTableSQL := `
-    CREATE TABLE IF NOT EXISTS libros (
-        id INTEGER PRIMARY KEY,
-        titulo TEXT NOT NULL,
-        autor TEXT NOT NULL,
-        anio INTEGER NOT NULL,
-        caratula_url TEXT,
-        sinopsis TEXT
-    );`
-	_, err = db.Exec(createLibrosTableSQL)
+func (s *sqliteAlmacenamiento) Close() error {
+	return s.db.Close()
+}
+
+// --- Operaciones de Libros ---
+
+// columnasLibro son las columnas que lee escanearLibro, en su orden. Los libros sin
+// ISBN lo tienen a NULL en la base de datos y a "" en models.Libro.
+const columnasLibro = "id, slug, titulo, autor, anio, IFNULL(isbn, ''), idioma, editorial, caratula_url, sinopsis, disponible"
+
+func escanearLibro(fila filaEscaneable) (*models.Libro, error) {
+	libro := &models.Libro{}
+	err := fila.Scan(&libro.ID, &libro.Slug, &libro.Titulo, &libro.Autor, &libro.Anio, &libro.ISBN, &libro.Idioma, &libro.Editorial, &libro.CaratulaURL, &libro.Sinopsis, &libro.Disponible)
 	if err != nil {
-		log.Printf("Error al crear la tabla 'libros' para tests: %v", err)
-		return nil
+		return nil, err
 	}
+	return libro, nil
+}
 
-	// Crear la tabla 'usuarios' si no existe (para tests)
-	createUsuariosTableSQL := `
-    CREATE TABLE IF NOT EXISTS usuarios (
-        id INTEGER PRIMARY KEY AUTOINCREMENT,
-        username TEXT NOT NULL UNIQUE,
-        password TEXT NOT NULL,
-        email TEXT,
-        rol TEXT NOT NULL DEFAULT 'lector'
-    );`
-	_, err = db.Exec(createUsuariosTableSQL)
+// AgregarLibro guarda un libro nuevo y lo devuelve tal como quedó almacenado. El ID
+// de 'libro' se ignora: lo asigna la base de datos, igual que el slug, que se genera
+// a partir del título y lleva un sufijo numérico si ya estaba en uso. El ISBN, si
+// lo hay, se guarda normalizado; devuelve ErrISBNDuplicado si ya lo tiene otro libro.
+// Los créditos se toman de libro.Autores o, si está vacío, de libro.Autor. Los géneros
+// se indican por su slug; uno que no existe es un error de validación.
+func (s *sqliteAlmacenamiento) AgregarLibro(libro *models.Libro) (*models.Libro, error) {
+	// La transacción toma el bloqueo de escritura al empezar, así que nadie puede
+	// ocupar el slug entre la comprobación y la inserción.
+	tx, err := s.db.Begin()
 	if err != nil {
-		log.Printf("Error al crear la tabla 'usuarios' para tests: %v", err)
-		return nil
+		return nil, err
 	}
+	defer tx.Rollback() // No tiene efecto si ya se hizo Commit
 
-	return &sqliteAlmacenamiento{db: db}
-}
-
-func (s *sqliteAlmacenamiento) Close() error {
-	return s.db.Close()
+	creado, err := insertarLibro(tx, libro)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return creado, nil
 }
 
-// --- Operaciones de Libros (sin cambios, solo se incluyen para la referencia completa) ---
-func (s *sqliteAlmacenamiento) AgregarLibro(libro *models.Libro) error {
-	existingBook, err := s.ObtenerLibro(libro.ID)
-	if err == nil && existingBook != nil {
-		return models.ErrLibroYaExiste
+// insertarLibro es AgregarLibro dentro de una transacción ya empezada.
+func insertarLibro(tx *sql.Tx, libro *models.Libro) (*models.Libro, error) {
+	isbn, err := valorISBN(libro.ISBN)
+	if err != nil {
+		return nil, err
 	}
-	if err != nil && err != models.ErrLibroNoEncontrado {
-		return err
+
+	base := models.GenerarSlug(libro.Titulo)
+	slug := base
+	for n := 2; ; n++ {
+		var enUso bool
+		if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM libros WHERE slug = ?)", slug).Scan(&enUso); err != nil {
+			return nil, err
+		}
+		if !enUso {
+			break
+		}
+		slug = fmt.Sprintf("%s-%d", base, n)
 	}
 
-	stmt, err := s.db.Prepare("INSERT INTO libros(id, titulo, autor, anio, caratula_url, sinopsis) VALUES(?, ?, ?, ?, ?, ?)")
+	res, err := tx.Exec("INSERT INTO libros(slug, titulo, autor, anio, isbn, idioma, editorial, caratula_url, sinopsis) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		slug, libro.Titulo, libro.Autor, libro.Anio, isbn, libro.Idioma, libro.Editorial, libro.CaratulaURL, libro.Sinopsis)
+	if esISBNDuplicado(err) {
+		return nil, models.ErrISBNDuplicado
+	}
 	if err != nil {
-		return err
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	creditos := libro.Autores
+	if len(creditos) == 0 {
+		creditos = []models.CreditoAutor{{Nombre: libro.Autor, Rol: models.RolAutor}}
+	}
+	guardados, err := guardarCreditos(tx, int(id), creditos)
+	if err != nil {
+		return nil, err
+	}
+	slugs := make([]string, len(libro.Generos))
+	for i, g := range libro.Generos {
+		slugs[i] = g.Slug
+	}
+	generos, err := guardarGeneros(tx, int(id), slugs)
+	if err != nil {
+		return nil, err
+	}
+	etiquetas, err := guardarEtiquetas(tx, int(id), libro.Etiquetas)
+	if err != nil {
+		return nil, err
 	}
-	defer stmt.Close()
 
-	_, err = stmt.Exec(libro.ID, libro.Titulo, libro.Autor, libro.Anio, libro.CaratulaURL, libro.Sinopsis)
-	return err
+	creado := *libro
+	creado.ID = int(id)
+	creado.Autor = models.NombresAutores(guardados)
+	creado.Autores = guardados
+	creado.Generos = generos
+	creado.Etiquetas = etiquetas
+	creado.Slug = slug
+	creado.ISBN, _ = isbn.(string) // nil si el libro no tiene ISBN
+	creado.Disponible = true       // Todo libro nuevo empieza disponible
+	return &creado, nil
 }
 
 func (s *sqliteAlmacenamiento) ObtenerLibro(id int) (*models.Libro, error) {
-	row := s.db.QueryRow("SELECT id, titulo, autor, anio, caratula_url, sinopsis FROM libros WHERE id = ?", id)
-	libro := &models.Libro{}
-	err := row.Scan(&libro.ID, &libro.Titulo, &libro.Autor, &libro.Anio, &libro.CaratulaURL, &libro.Sinopsis)
+	return s.obtenerLibroPor("id", id)
+}
+
+// ObtenerLibroPorSlug busca un libro por el slug de sus URLs.
+func (s *sqliteAlmacenamiento) ObtenerLibroPorSlug(slug string) (*models.Libro, error) {
+	return s.obtenerLibroPor("slug", slug)
+}
+
+// obtenerLibroPor busca un libro por una columna única, con sus autores.
+func (s *sqliteAlmacenamiento) obtenerLibroPor(columna string, valor interface{}) (*models.Libro, error) {
+	libro, err := escanearLibro(s.db.QueryRow("SELECT "+columnasLibro+" FROM libros WHERE "+columna+" = ?", valor))
 	if err == sql.ErrNoRows {
 		return nil, models.ErrLibroNoEncontrado
 	}
-	return libro, err
+	if err != nil {
+		return nil, err
+	}
+	return libro, cargarRelaciones(s.db, libro)
 }
 
-func (s *sqliteAlmacenamiento) ListarLibros() []*models.Libro {
-	rows, err := s.db.Query("SELECT id, titulo, autor, anio, caratula_url, sinopsis FROM libros")
+// ObtenerLibroPorISBN busca un libro por su ISBN-10 o ISBN-13, con o sin guiones.
+// Devuelve ErrISBNInvalido si 'isbn' no es un ISBN válido.
+func (s *sqliteAlmacenamiento) ObtenerLibroPorISBN(isbn string) (*models.Libro, error) {
+	normalizado, err := models.NormalizarISBN(isbn)
 	if err != nil {
-		log.Printf("Error al listar libros: %v", err)
-		return nil
+		return nil, err
+	}
+	return s.obtenerLibroPor("isbn", normalizado)
+}
+
+// valorISBN devuelve el ISBN tal como se guarda: normalizado a ISBN-13, o nil (NULL)
+// si el libro no tiene. Si no es válido devuelve el ErroresValidacion de LibroPatch.
+func valorISBN(isbn string) (interface{}, error) {
+	if isbn == "" {
+		return nil, nil
+	}
+	normalizado, err := models.NormalizarISBN(isbn)
+	if err != nil {
+		return nil, models.LibroPatch{ISBN: &isbn}.Validar()
+	}
+	return normalizado, nil
+}
+
+// esISBNDuplicado indica si 'err' es la violación del índice único de libros.isbn.
+func esISBNDuplicado(err error) bool {
+	var errSQLite sqlite3.Error
+	return errors.As(err, &errSQLite) && errSQLite.ExtendedCode == sqlite3.ErrConstraintUnique &&
+		strings.Contains(errSQLite.Error(), "libros.isbn")
+}
+
+// ListarLibros devuelve una página de libros filtrada y ordenada según 'consulta'.
+// La paginación es por cursor (keyset): cada página continúa desde el último libro de
+// la anterior, así que el coste no crece con el número de página y no se repiten ni se
+// saltan libros si se agregan o eliminan otros entre peticiones.
+func (s *sqliteAlmacenamiento) ListarLibros(consulta models.ConsultaLibros) (*models.PaginaLibros, error) {
+	if err := consulta.Normalizar(); err != nil {
+		return nil, err
+	}
+	columna := columnasOrden[consulta.Orden]
+	condiciones, args := filtroLibros(consulta)
+
+	pagina := &models.PaginaLibros{Libros: []*models.Libro{}}
+	err := s.db.QueryRow("SELECT COUNT(*) FROM libros"+clausulaWhere(condiciones), args...).Scan(&pagina.Total)
+	if err != nil {
+		return nil, err
+	}
+
+	var desde *cursorLibros
+	if consulta.Cursor != "" {
+		if desde, err = decodificarCursor(consulta.Cursor, consulta); err != nil {
+			return nil, err
+		}
+	}
+	haciaAtras := desde != nil && desde.Atras
+
+	// Para retroceder se recorre el orden al revés y después se invierte la página
+	descendente := (consulta.Direccion == models.DireccionDesc) != haciaAtras
+	comparacion, direccion := ">", "ASC"
+	if descendente {
+		comparacion, direccion = "<", "DESC"
+	}
+	if desde != nil {
+		condiciones = append(condiciones, fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", columna, comparacion))
+		args = append(args, desde.Valor, desde.Valor, desde.ID)
+	}
+
+	// Se pide un libro de más para saber si hay otra página en esa dirección
+	query := fmt.Sprintf("SELECT %s FROM libros%s ORDER BY %s %s, id %s LIMIT ?",
+		columnasLibro, clausulaWhere(condiciones), columna, direccion, direccion)
+	rows, err := s.db.Query(query, append(args, consulta.Limite+1)...)
+	if err != nil {
+		return nil, err
 	}
 	defer rows.Close()
 
-	libros := []*models.Libro{}
 	for rows.Next() {
-		libro := &models.Libro{}
-		if err := rows.Scan(&libro.ID, &libro.Titulo, &libro.Autor, &libro.Anio, &libro.CaratulaURL, &libro.Sinopsis); err != nil {
-			log.Printf("Error al escanear libro: %v", err)
-			continue
+		libro, err := escanearLibro(rows)
+		if err != nil {
+			return nil, err
 		}
-		libros = append(libros, libro)
+		pagina.Libros = append(pagina.Libros, libro)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	hayMas := len(pagina.Libros) > consulta.Limite
+	if hayMas {
+		pagina.Libros = pagina.Libros[:consulta.Limite]
+	}
+	if haciaAtras {
+		slices.Reverse(pagina.Libros)
+	}
+	if len(pagina.Libros) == 0 {
+		return pagina, nil
+	}
+	if err := cargarRelaciones(s.db, pagina.Libros...); err != nil {
+		return nil, err
+	}
+
+	// Al avanzar, hay página anterior si se partió de un cursor; al retroceder, siempre
+	// hay siguiente (la página de la que se venía).
+	haySiguiente, hayAnterior := hayMas, desde != nil
+	if haciaAtras {
+		haySiguiente, hayAnterior = true, hayMas
 	}
-	return libros
+	if haySiguiente {
+		pagina.CursorSiguiente = codificarCursor(consulta, pagina.Libros[len(pagina.Libros)-1], false)
+	}
+	if hayAnterior {
+		pagina.CursorAnterior = codificarCursor(consulta, pagina.Libros[0], true)
+	}
+	return pagina, nil
 }
 
-func (s *sqliteAlmacenamiento) ActualizarLibro(id int, updates map[string]interface{}) error {
-	query := "UPDATE libros SET "
-	args := []interface{}{}
-	i := 0
-	for key, value := range updates {
-		query += key + " = ?"
-		args = append(args, value)
-		if i < len(updates)-1 {
-			query += ", "
+// ActualizarLibro aplica los campos presentes en 'patch'. Las columnas vienen de los
+// campos tipados de LibroPatch, nunca de datos del cliente. Devuelve ErrISBNDuplicado
+// si el nuevo ISBN ya lo tiene otro libro. patch.Autor reemplaza solo los créditos con
+// rol autor; patch.Autores los reemplaza todos. patch.Generos y patch.Etiquetas
+// reemplazan los géneros y las etiquetas del libro.
+func (s *sqliteAlmacenamiento) ActualizarLibro(id int, patch models.LibroPatch) error {
+	if err := patch.Validar(); err != nil {
+		return err
+	}
+
+	var asignaciones []string
+	var args []interface{}
+	asignar := func(columna string, valor interface{}) {
+		asignaciones = append(asignaciones, columna+" = ?")
+		args = append(args, valor)
+	}
+	if patch.Titulo != nil {
+		asignar("titulo", *patch.Titulo)
+	}
+	if patch.Anio != nil {
+		asignar("anio", *patch.Anio)
+	}
+	if patch.ISBN != nil {
+		isbn, err := valorISBN(*patch.ISBN)
+		if err != nil {
+			return err
 		}
-		i++
+		asignar("isbn", isbn)
+	}
+	if patch.Idioma != nil {
+		asignar("idioma", *patch.Idioma)
+	}
+	if patch.Editorial != nil {
+		asignar("editorial", *patch.Editorial)
+	}
+	if patch.CaratulaURL != nil {
+		asignar("caratula_url", *patch.CaratulaURL)
+	}
+	if patch.Sinopsis != nil {
+		asignar("sinopsis", *patch.Sinopsis)
 	}
-	query += " WHERE id = ?"
-	args = append(args, id)
 
-	stmt, err := s.db.Prepare(query)
+	tx, err := s.db.Begin()
 	if err != nil {
 		return err
 	}
-	defer stmt.Close()
+	defer tx.Rollback() // No tiene efecto si ya se hizo Commit
 
-	res, err := stmt.Exec(args...)
-	if err != nil {
+	var existe bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM libros WHERE id = ?)", id).Scan(&existe); err != nil {
 		return err
 	}
-	rowsAffected, err := res.RowsAffected()
-	if err != nil {
-		return err
+	if !existe {
+		return models.ErrLibroNoEncontrado
 	}
-	if rowsAffected == 0 {
-		return models.ErrLibroNoEncontrado // Si no se actualizó ninguna fila, es porque no existe
+
+	if len(asignaciones) > 0 {
+		_, err := tx.Exec("UPDATE libros SET "+strings.Join(asignaciones, ", ")+" WHERE id = ?", append(args, id)...)
+		if esISBNDuplicado(err) {
+			return models.ErrISBNDuplicado
+		}
+		if err != nil {
+			return err
+		}
 	}
-	return nil
+
+	var creditos []models.CreditoAutor
+	switch {
+	case patch.Autores != nil:
+		creditos = *patch.Autores
+	case patch.Autor != nil:
+		// Se conservan los traductores y editores
+		creditos = []models.CreditoAutor{{Nombre: *patch.Autor, Rol: models.RolAutor}}
+		anteriores, err := creditosDeLibro(tx, id)
+		if err != nil {
+			return err
+		}
+		for _, c := range anteriores {
+			if c.Rol != models.RolAutor {
+				creditos = append(creditos, c)
+			}
+		}
+	}
+	if creditos != nil {
+		if _, err := guardarCreditos(tx, id, creditos); err != nil {
+			return err
+		}
+	}
+	if patch.Generos != nil {
+		if _, err := guardarGeneros(tx, id, *patch.Generos); err != nil {
+			return err
+		}
+	}
+	if patch.Etiquetas != nil {
+		if _, err := guardarEtiquetas(tx, id, *patch.Etiquetas); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
 func (s *sqliteAlmacenamiento) EliminarLibro(id int) error {
@@ -233,36 +551,30 @@ func (s *sqliteAlmacenamiento) AgregarUsuario(usuario *models.Usuario) error {
 	// Verificar si el usuario ya existe por nombre de usuario
 	existingUser, err := s.ObtenerUsuarioPorUsername(usuario.Username)
 	if err == nil && existingUser != nil {
-		log.Printf("DEBUG: Usuario %s ya existe en la DB.", usuario.Username) // NUEVO LOG
-		return models.ErrUsuarioYaExiste                                      // El usuario ya existe
+		return models.ErrUsuarioYaExiste
 	}
 	if err != nil && err != models.ErrUsuarioNoEncontrado {
 		log.Printf("ERROR: Fallo al verificar existencia de usuario %s: %v", usuario.Username, err) // NUEVO LOG
 		return err                                                                                  // Otro tipo de error
 	}
 
-	log.Printf("DEBUG: Preparando sentencia SQL para insertar usuario %s.", usuario.Username) // NUEVO LOG
-	stmt, err := s.db.Prepare("INSERT INTO usuarios(username, password, email, rol) VALUES(?, ?, ?, ?)")
+	stmt, err := s.db.Prepare("INSERT INTO usuarios(username, password, email, rol, email_verificado_en) VALUES(?, ?, ?, ?, ?)")
 	if err != nil {
 		log.Printf("ERROR: Fallo al preparar sentencia INSERT para usuario %s: %v", usuario.Username, err) // NUEVO LOG
 		return err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(usuario.Username, usuario.Password, usuario.Email, usuario.Rol)
+	_, err = stmt.Exec(usuario.Username, usuario.Password, usuario.Email, usuario.Rol, usuario.EmailVerificadoEn)
 	if err != nil {
 		log.Printf("ERROR: Fallo al ejecutar INSERT para usuario %s: %v", usuario.Username, err) // NUEVO LOG
-	} else {
-		log.Printf("DEBUG: Sentencia INSERT ejecutada para usuario %s.", usuario.Username) // NUEVO LOG
 	}
 	return err
 }
 
 // ObtenerUsuarioPorID recupera un usuario por su ID.
 func (s *sqliteAlmacenamiento) ObtenerUsuarioPorID(id int) (*models.Usuario, error) {
-	row := s.db.QueryRow("SELECT id, username, password, email, rol FROM usuarios WHERE id = ?", id)
-	usuario := &models.Usuario{}
-	err := row.Scan(&usuario.ID, &usuario.Username, &usuario.Password, &usuario.Email, &usuario.Rol)
+	usuario, err := escanearUsuario(s.db.QueryRow("SELECT "+columnasUsuario+" FROM usuarios WHERE id = ?", id))
 	if err == sql.ErrNoRows {
 		return nil, models.ErrUsuarioNoEncontrado
 	}
@@ -271,11 +583,81 @@ func (s *sqliteAlmacenamiento) ObtenerUsuarioPorID(id int) (*models.Usuario, err
 
 // ObtenerUsuarioPorUsername recupera un usuario por su nombre de usuario.
 func (s *sqliteAlmacenamiento) ObtenerUsuarioPorUsername(username string) (*models.Usuario, error) {
-	row := s.db.QueryRow("SELECT id, username, password, email, rol FROM usuarios WHERE username = ?", username)
-	usuario := &models.Usuario{}
-	err := row.Scan(&usuario.ID, &usuario.Username, &usuario.Password, &usuario.Email, &usuario.Rol)
+	usuario, err := escanearUsuario(s.db.QueryRow("SELECT "+columnasUsuario+" FROM usuarios WHERE username = ?", username))
 	if err == sql.ErrNoRows {
 		return nil, models.ErrUsuarioNoEncontrado
 	}
 	return usuario, err
 }
+
+// ListarUsuarios devuelve todos los usuarios por orden alfabético.
+func (s *sqliteAlmacenamiento) ListarUsuarios() ([]*models.Usuario, error) {
+	rows, err := s.db.Query("SELECT " + columnasUsuario + " FROM usuarios ORDER BY username COLLATE NOCASE, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usuarios := []*models.Usuario{}
+	for rows.Next() {
+		usuario, err := escanearUsuario(rows)
+		if err != nil {
+			return nil, err
+		}
+		usuarios = append(usuarios, usuario)
+	}
+	return usuarios, rows.Err()
+}
+
+// ContarUsuariosPorRol devuelve cuántos usuarios tienen el rol.
+func (s *sqliteAlmacenamiento) ContarUsuariosPorRol(rol string) (int, error) {
+	var n int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM usuarios WHERE rol = ?", rol).Scan(&n)
+	return n, err
+}
+
+// CambiarRolUsuario cambia el rol de un usuario. Devuelve ErrUltimoAdministrador si es
+// el único administrador y el rol nuevo no lo es.
+func (s *sqliteAlmacenamiento) CambiarRolUsuario(id int, rol string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // No tiene efecto si ya se hizo Commit
+
+	var actual string
+	err = tx.QueryRow("SELECT rol FROM usuarios WHERE id = ?", id).Scan(&actual)
+	if err == sql.ErrNoRows {
+		return models.ErrUsuarioNoEncontrado
+	} else if err != nil {
+		return err
+	}
+	if actual == models.RolAdministrador && rol != models.RolAdministrador {
+		var administradores int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM usuarios WHERE rol = ?", models.RolAdministrador).Scan(&administradores); err != nil {
+			return err
+		}
+		if administradores <= 1 {
+			return models.ErrUltimoAdministrador
+		}
+	}
+	if _, err := tx.Exec("UPDATE usuarios SET rol = ? WHERE id = ?", rol, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+const columnasUsuario = "id, username, password, email, rol, email_verificado_en"
+
+func escanearUsuario(fila filaEscaneable) (*models.Usuario, error) {
+	usuario := &models.Usuario{}
+	var verificado sql.NullTime
+	err := fila.Scan(&usuario.ID, &usuario.Username, &usuario.Password, &usuario.Email, &usuario.Rol, &verificado)
+	if err != nil {
+		return nil, err
+	}
+	if verificado.Valid {
+		usuario.EmailVerificadoEn = &verificado.Time
+	}
+	return usuario, nil
+}
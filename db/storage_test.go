@@ -32,19 +32,32 @@ func teardownTestDB(almacen db.LibroAlmacenamiento) { // CAMBIO: de *db.AlmacenS
 	os.Remove(testDBPath)
 }
 
+// listarLibros devuelve la primera página de libros con la consulta por defecto.
+func listarLibros(t *testing.T, almacen db.LibroAlmacenamiento) []*models.Libro {
+	t.Helper()
+	pagina, err := almacen.ListarLibros(models.ConsultaLibros{})
+	if err != nil {
+		t.Fatalf("Error al listar libros: %v", err)
+	}
+	return pagina.Libros
+}
+
 // TestAgregarLibro
 func TestAgregarLibro(t *testing.T) {
 	almacen := setupTestDB(t)
 	defer teardownTestDB(almacen)
 
-	libro := models.NuevoLibroConCaratula(1, "El Gran Go", "Gopher", 2023, "http://example.com/gopher.jpg")
-	err := almacen.AgregarLibro(libro)
+	libro := models.NuevoLibroConCaratula(0, "El Gran Go", "Gopher", 2023, "http://example.com/gopher.jpg")
+	creado, err := almacen.AgregarLibro(libro)
 	if err != nil {
 		t.Fatalf("Error al agregar libro: %v", err)
 	}
+	if creado.GetID() == 0 || creado.GetSlug() != "el-gran-go" || !creado.EstaDisponible() {
+		t.Errorf("Libro creado incorrecto: ID %d, slug %q, disponible %v", creado.GetID(), creado.GetSlug(), creado.EstaDisponible())
+	}
 
 	// Verificar que el libro fue agregado
-	libros := almacen.ListarLibros()
+	libros := listarLibros(t, almacen)
 	if len(libros) != 1 {
 		t.Errorf("Se esperaba 1 libro, se obtuvieron %d", len(libros))
 	}
@@ -52,10 +65,90 @@ func TestAgregarLibro(t *testing.T) {
 		t.Errorf("Título incorrecto: esperado 'El Gran Go', obtenido '%s'", libros[0].GetTitulo())
 	}
 
-	// Intentar agregar un libro con el mismo ID (debería fallar)
-	err = almacen.AgregarLibro(libro)
-	if !errors.Is(err, models.ErrLibroYaExiste) { // Uso de errors.Is para comparar errores centinela
-		t.Errorf("Se esperaba un error de libro duplicado, obtenido: %v", err)
+	// El ID del cliente se ignora y un título repetido recibe otro slug
+	libro.ID = creado.GetID()
+	otro, err := almacen.AgregarLibro(libro)
+	if err != nil {
+		t.Fatalf("Error al agregar libro con el mismo título: %v", err)
+	}
+	if otro.GetID() == creado.GetID() || otro.GetSlug() != "el-gran-go-2" {
+		t.Errorf("Se esperaba un ID nuevo y el slug 'el-gran-go-2', obtenidos %d y %q", otro.GetID(), otro.GetSlug())
+	}
+
+	// Los IDs de libros eliminados no se reutilizan
+	almacen.EliminarLibro(otro.GetID())
+	tercero, _ := almacen.AgregarLibro(libro)
+	if tercero.GetID() <= otro.GetID() {
+		t.Errorf("Se reutilizó el ID %d de un libro eliminado", tercero.GetID())
+	}
+
+	porSlug, err := almacen.ObtenerLibroPorSlug("el-gran-go")
+	if err != nil || porSlug.GetID() != creado.GetID() {
+		t.Errorf("ObtenerLibroPorSlug devolvió %v, %v", porSlug, err)
+	}
+	if _, err := almacen.ObtenerLibroPorSlug("no-existe"); !errors.Is(err, models.ErrLibroNoEncontrado) { // Uso de errors.Is para comparar errores centinela
+		t.Errorf("Se esperaba ErrLibroNoEncontrado, obtenido: %v", err)
+	}
+}
+
+// TestISBN comprueba la normalización, la búsqueda y la unicidad de los ISBN.
+func TestISBN(t *testing.T) {
+	almacen := setupTestDB(t)
+	defer teardownTestDB(almacen)
+
+	// Un ISBN-10 con guiones se guarda como ISBN-13
+	libro := models.NuevoLibro(0, "Rayuela", "Julio Cortázar", 1963)
+	libro.ISBN = "84-376-0494-x"
+	creado, err := almacen.AgregarLibro(libro)
+	if err != nil {
+		t.Fatalf("Error al agregar libro con ISBN: %v", err)
+	}
+	if creado.ISBN != "9788437604947" || creado.GetISBN10() != "843760494X" {
+		t.Errorf("ISBN mal normalizado: %q (ISBN-10 %q)", creado.ISBN, creado.GetISBN10())
+	}
+
+	for _, isbn := range []string{"843760494X", "978-84-376-0494-7", "978 84 376 0494 7"} {
+		obtenido, err := almacen.ObtenerLibroPorISBN(isbn)
+		if err != nil || obtenido.ID != creado.ID {
+			t.Errorf("ObtenerLibroPorISBN(%q) devolvió %v, %v", isbn, obtenido, err)
+		}
+	}
+	if _, err := almacen.ObtenerLibroPorISBN("9780306406157"); !errors.Is(err, models.ErrLibroNoEncontrado) {
+		t.Errorf("Se esperaba ErrLibroNoEncontrado, obtenido: %v", err)
+	}
+	for _, isbn := range []string{"8437604940", "9788437604940", "978843760494", "1234567890123", "978-84-376-O494-7"} {
+		if _, err := almacen.ObtenerLibroPorISBN(isbn); !errors.Is(err, models.ErrISBNInvalido) {
+			t.Errorf("Se esperaba ErrISBNInvalido para %q, obtenido: %v", isbn, err)
+		}
+	}
+
+	// El mismo ISBN en otra forma es un duplicado, tanto al agregar como al actualizar
+	duplicado := models.NuevoLibro(0, "Rayuela (otra edición)", "Julio Cortázar", 1963)
+	duplicado.ISBN = "9788437604947"
+	if _, err := almacen.AgregarLibro(duplicado); !errors.Is(err, models.ErrISBNDuplicado) {
+		t.Errorf("Se esperaba ErrISBNDuplicado al agregar, obtenido: %v", err)
+	}
+	sinISBN, _ := almacen.AgregarLibro(models.NuevoLibro(0, "Bestiario", "Julio Cortázar", 1951))
+	otroSinISBN, err := almacen.AgregarLibro(models.NuevoLibro(0, "Final del juego", "Julio Cortázar", 1956))
+	if err != nil || sinISBN.ISBN != "" || otroSinISBN.ISBN != "" {
+		t.Fatalf("Varios libros sin ISBN deberían poder coexistir: %v", err)
+	}
+	isbn := "843760494X"
+	if err := almacen.ActualizarLibro(sinISBN.ID, models.LibroPatch{ISBN: &isbn}); !errors.Is(err, models.ErrISBNDuplicado) {
+		t.Errorf("Se esperaba ErrISBNDuplicado al actualizar, obtenido: %v", err)
+	}
+	invalido := "84-376-0494-0"
+	if err := almacen.ActualizarLibro(sinISBN.ID, models.LibroPatch{ISBN: &invalido}); !errors.Is(err, models.ErrValidacion) {
+		t.Errorf("Se esperaba ErrValidacion con un ISBN inválido, obtenido: %v", err)
+	}
+
+	// Un ISBN vacío lo elimina
+	vacio := ""
+	if err := almacen.ActualizarLibro(creado.ID, models.LibroPatch{ISBN: &vacio}); err != nil {
+		t.Fatalf("Error al eliminar el ISBN: %v", err)
+	}
+	if actualizado, _ := almacen.ObtenerLibro(creado.ID); actualizado.ISBN != "" {
+		t.Errorf("El ISBN debería haberse eliminado, obtenido %q", actualizado.ISBN)
 	}
 }
 
@@ -89,7 +182,7 @@ func TestListarLibros(t *testing.T) {
 	defer teardownTestDB(almacen)
 
 	// Lista vacía inicialmente
-	libros := almacen.ListarLibros()
+	libros := listarLibros(t, almacen)
 	if len(libros) != 0 {
 		t.Errorf("Se esperaba lista vacía, se obtuvieron %d libros", len(libros))
 	}
@@ -99,7 +192,7 @@ func TestListarLibros(t *testing.T) {
 	almacen.AgregarLibro(libro1)
 	almacen.AgregarLibro(libro2)
 
-	libros = almacen.ListarLibros()
+	libros = listarLibros(t, almacen)
 	if len(libros) != 2 {
 		t.Errorf("Se esperaban 2 libros, se obtuvieron %d", len(libros))
 	}
@@ -113,11 +206,9 @@ func TestActualizarLibro(t *testing.T) {
 	libro := models.NuevoLibroConCaratula(1, "Titulo Original", "Autor Original", 2020, "original.jpg")
 	almacen.AgregarLibro(libro)
 
-	updates := map[string]interface{}{
-		"titulo":       "Titulo Actualizado",
-		"anio":         2022,
-		"caratula_url": "updated.jpg",
-	}
+	titulo, anio, caratula := "Titulo Actualizado", 2022, "http://example.com/updated.jpg"
+	idioma, editorial := "pt-BR", "Companhia das Letras"
+	updates := models.LibroPatch{Titulo: &titulo, Anio: &anio, CaratulaURL: &caratula, Idioma: &idioma, Editorial: &editorial}
 	err := almacen.ActualizarLibro(1, updates)
 	if err != nil {
 		t.Fatalf("Error al actualizar libro: %v", err)
@@ -134,8 +225,21 @@ func TestActualizarLibro(t *testing.T) {
 	if actualizado.GetAnio() != 2022 {
 		t.Errorf("Año no actualizado: esperado 2022, obtenido %d", actualizado.GetAnio())
 	}
-	if actualizado.GetCaratulaURL() != "updated.jpg" {
-		t.Errorf("Carátula no actualizada: esperado 'updated.jpg', obtenido '%s'", actualizado.GetCaratulaURL())
+	if actualizado.GetCaratulaURL() != caratula {
+		t.Errorf("Carátula no actualizada: esperado '%s', obtenido '%s'", caratula, actualizado.GetCaratulaURL())
+	}
+	if actualizado.GetIdioma() != idioma || actualizado.GetEditorial() != editorial {
+		t.Errorf("Idioma o editorial no actualizados: '%s', '%s'", actualizado.GetIdioma(), actualizado.GetEditorial())
+	}
+	if actualizado.GetAutor() != "Autor Original" {
+		t.Errorf("Un campo ausente del patch cambió: autor '%s'", actualizado.GetAutor())
+	}
+
+	// Un patch inválido no modifica nada
+	vacio := ""
+	err = almacen.ActualizarLibro(1, models.LibroPatch{Titulo: &vacio})
+	if !errors.Is(err, models.ErrValidacion) {
+		t.Errorf("Se esperaba ErrValidacion con un título vacío, obtenido: %v", err)
 	}
 
 	// Intentar actualizar un libro no existente
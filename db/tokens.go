@@ -0,0 +1,100 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+
+	"libroselectronicos/models"
+)
+
+// --- Operaciones de Tokens de API ---
+
+// AgregarTokenAPI guarda un nuevo token y le asigna su ID.
+func (s *sqliteAlmacenamiento) AgregarTokenAPI(token *models.TokenAPI) error {
+	res, err := s.db.Exec("INSERT INTO tokens_api(usuario_id, nombre, prefijo, hash, alcance, creado_en) VALUES(?, ?, ?, ?, ?, ?)",
+		token.UsuarioID, token.Nombre, token.Prefijo, token.Hash, token.Alcance, token.CreadoEn)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	token.ID = int(id)
+	return nil
+}
+
+// ObtenerTokenAPIPorHash busca un token no revocado por su hash.
+func (s *sqliteAlmacenamiento) ObtenerTokenAPIPorHash(hash string) (*models.TokenAPI, error) {
+	row := s.db.QueryRow(`SELECT id, usuario_id, nombre, prefijo, hash, alcance, creado_en, ultimo_uso, revocado_en
+		FROM tokens_api WHERE hash = ? AND revocado_en IS NULL`, hash)
+	token, err := escanearTokenAPI(row)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrTokenNoEncontrado
+	}
+	return token, err
+}
+
+// ListarTokensAPIPorUsuario devuelve todos los tokens de un usuario, incluidos los revocados.
+func (s *sqliteAlmacenamiento) ListarTokensAPIPorUsuario(usuarioID int) ([]*models.TokenAPI, error) {
+	rows, err := s.db.Query(`SELECT id, usuario_id, nombre, prefijo, hash, alcance, creado_en, ultimo_uso, revocado_en
+		FROM tokens_api WHERE usuario_id = ? ORDER BY id`, usuarioID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*models.TokenAPI{}
+	for rows.Next() {
+		token, err := escanearTokenAPI(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+// RevocarTokenAPI revoca un token activo del usuario.
+func (s *sqliteAlmacenamiento) RevocarTokenAPI(usuarioID, tokenID int) error {
+	res, err := s.db.Exec("UPDATE tokens_api SET revocado_en = ? WHERE id = ? AND usuario_id = ? AND revocado_en IS NULL",
+		time.Now().UTC(), tokenID, usuarioID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return models.ErrTokenNoEncontrado
+	}
+	return nil
+}
+
+// RegistrarUsoTokenAPI actualiza la fecha de último uso de un token.
+func (s *sqliteAlmacenamiento) RegistrarUsoTokenAPI(tokenID int) error {
+	_, err := s.db.Exec("UPDATE tokens_api SET ultimo_uso = ? WHERE id = ?", time.Now().UTC(), tokenID)
+	return err
+}
+
+// filaEscaneable permite reutilizar el escaneo con *sql.Row y *sql.Rows.
+type filaEscaneable interface {
+	Scan(dest ...interface{}) error
+}
+
+func escanearTokenAPI(fila filaEscaneable) (*models.TokenAPI, error) {
+	token := &models.TokenAPI{}
+	var ultimoUso, revocadoEn sql.NullTime
+	err := fila.Scan(&token.ID, &token.UsuarioID, &token.Nombre, &token.Prefijo, &token.Hash, &token.Alcance, &token.CreadoEn, &ultimoUso, &revocadoEn)
+	if err != nil {
+		return nil, err
+	}
+	if ultimoUso.Valid {
+		token.UltimoUso = &ultimoUso.Time
+	}
+	if revocadoEn.Valid {
+		token.RevocadoEn = &revocadoEn.Time
+	}
+	return token, nil
+}
@@ -0,0 +1,57 @@
+package db_test
+
+import (
+	"errors"
+	"testing"
+
+	"libroselectronicos/models"
+)
+
+// TestTokensAPI
+func TestTokensAPI(t *testing.T) {
+	almacen := setupTestDB(t)
+	defer teardownTestDB(almacen)
+
+	token := models.NuevoTokenAPI(1, "script", "le_abcdefgh", "hash-1", models.RolLector)
+	if err := almacen.AgregarTokenAPI(token); err != nil {
+		t.Fatalf("Error al agregar token: %v", err)
+	}
+	if token.GetID() == 0 {
+		t.Errorf("Se esperaba un ID de token asignado")
+	}
+
+	obtenido, err := almacen.ObtenerTokenAPIPorHash("hash-1")
+	if err != nil {
+		t.Fatalf("Error al obtener token por hash: %v", err)
+	}
+	if obtenido.UsuarioID != 1 || obtenido.GetAlcance() != models.RolLector {
+		t.Errorf("Token obtenido incorrecto: %+v", obtenido)
+	}
+
+	if err := almacen.RegistrarUsoTokenAPI(token.GetID()); err != nil {
+		t.Fatalf("Error al registrar uso del token: %v", err)
+	}
+
+	// Otro usuario no puede revocarlo
+	err = almacen.RevocarTokenAPI(2, token.GetID())
+	if !errors.Is(err, models.ErrTokenNoEncontrado) {
+		t.Errorf("Se esperaba ErrTokenNoEncontrado al revocar un token ajeno, obtenido: %v", err)
+	}
+
+	if err := almacen.RevocarTokenAPI(1, token.GetID()); err != nil {
+		t.Fatalf("Error al revocar token: %v", err)
+	}
+
+	// Un token revocado ya no autentica, pero sigue apareciendo en el listado
+	_, err = almacen.ObtenerTokenAPIPorHash("hash-1")
+	if !errors.Is(err, models.ErrTokenNoEncontrado) {
+		t.Errorf("Se esperaba ErrTokenNoEncontrado para un token revocado, obtenido: %v", err)
+	}
+	tokens, err := almacen.ListarTokensAPIPorUsuario(1)
+	if err != nil {
+		t.Fatalf("Error al listar tokens: %v", err)
+	}
+	if len(tokens) != 1 || !tokens[0].EstaRevocado() || tokens[0].UltimoUso == nil {
+		t.Errorf("Listado de tokens incorrecto: %+v", tokens)
+	}
+}
@@ -0,0 +1,48 @@
+package db_test
+
+import (
+	"errors"
+	"testing"
+
+	"libroselectronicos/models"
+)
+
+// TestCambiarRolUsuario
+func TestCambiarRolUsuario(t *testing.T) {
+	almacen := setupTestDB(t)
+	defer teardownTestDB(almacen)
+
+	for _, u := range []*models.Usuario{
+		models.NuevoUsuario(0, "bea", "hash", "bea@example.com", models.RolLector),
+		models.NuevoUsuario(0, "Ana", "hash", "ana@example.com", models.RolAdministrador),
+	} {
+		if err := almacen.AgregarUsuario(u); err != nil {
+			t.Fatalf("Error al agregar usuario: %v", err)
+		}
+	}
+	usuarios, err := almacen.ListarUsuarios()
+	if err != nil || len(usuarios) != 2 || usuarios[0].Username != "Ana" {
+		t.Fatalf("Listado de usuarios incorrecto: %+v, %v", usuarios, err)
+	}
+	ana, bea := usuarios[0], usuarios[1]
+
+	if err := almacen.CambiarRolUsuario(ana.ID, models.RolLector); !errors.Is(err, models.ErrUltimoAdministrador) {
+		t.Errorf("Se esperaba ErrUltimoAdministrador, obtenido: %v", err)
+	}
+	if err := almacen.CambiarRolUsuario(bea.ID, models.RolAdministrador); err != nil {
+		t.Fatalf("Error al hacer administradora a bea: %v", err)
+	}
+	if n, err := almacen.ContarUsuariosPorRol(models.RolAdministrador); err != nil || n != 2 {
+		t.Errorf("Se esperaban 2 administradores: %d, %v", n, err)
+	}
+	// Con otro administrador, ya se le puede quitar el rol
+	if err := almacen.CambiarRolUsuario(ana.ID, models.RolLector); err != nil {
+		t.Fatalf("Error al quitar el rol a ana: %v", err)
+	}
+	if ana, _ = almacen.ObtenerUsuarioPorID(ana.ID); ana.Rol != models.RolLector {
+		t.Errorf("El rol no cambió: %q", ana.Rol)
+	}
+	if err := almacen.CambiarRolUsuario(999, models.RolLector); !errors.Is(err, models.ErrUsuarioNoEncontrado) {
+		t.Errorf("Se esperaba ErrUsuarioNoEncontrado, obtenido: %v", err)
+	}
+}
@@ -0,0 +1,345 @@
+// Package epub lee los metadatos del paquete OPF de un EPUB (2 o 3): título,
+// creadores, idioma, editorial, identificadores, descripción, fecha y portada.
+// No depende del resto de la aplicación.
+package epub
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrNoEsEPUB se devuelve si el contenido no es un ZIP con META-INF/container.xml.
+	ErrNoEsEPUB = errors.New("el archivo no es un EPUB")
+	// ErrPaqueteInvalido se devuelve si falta el paquete OPF o no se puede leer.
+	ErrPaqueteInvalido = errors.New("paquete OPF del EPUB inválido")
+)
+
+// Límites al leer entradas del ZIP, para no cargar en memoria un archivo manipulado.
+const (
+	tamanoMaximoXML     = 4 << 20
+	TamanoMaximoPortada = 10 << 20
+)
+
+const (
+	nsDC  = "http://purl.org/dc/elements/1.1/"
+	nsOPF = "http://www.idpf.org/2007/opf"
+)
+
+// Metadatos son los datos de un EPUB. Los campos que el paquete no incluye quedan vacíos.
+type Metadatos struct {
+	Titulo          string
+	Creadores       []Creador // Autores y colaboradores, en el orden del paquete
+	Idioma          string    // Etiqueta BCP 47, ej. "es" o "en-US"
+	Editorial       string
+	Identificadores []Identificador
+	Descripcion     string // Texto plano, sin el HTML que suelen incluir
+	Fecha           string // Tal como aparece, ej. "1967" o "1967-05-30"
+	Portada         *Portada
+}
+
+// Creador es una persona que participa en el libro. Rol es el código MARC relator
+// ("aut" autor, "trl" traductor, "edt" editor, ...); "aut" si el paquete no lo indica.
+type Creador struct {
+	Nombre string
+	Rol    string
+}
+
+// Identificador es un dc:identifier. Esquema va en minúsculas ("isbn", "uuid", "doi",
+// ...) o vacío si no se conoce; el prefijo "urn:<esquema>:" se quita de Valor.
+type Identificador struct {
+	Esquema string
+	Valor   string
+}
+
+// Portada es la imagen de portada declarada en el paquete.
+type Portada struct {
+	Ruta  string // Dentro del EPUB
+	MIME  string
+	Datos []byte
+}
+
+// ISBN devuelve el primer identificador con esquema ISBN, o "" si no hay. No comprueba
+// que sea válido.
+func (m *Metadatos) ISBN() string {
+	for _, id := range m.Identificadores {
+		if id.Esquema == "isbn" {
+			return id.Valor
+		}
+	}
+	return ""
+}
+
+// Anio devuelve el año de Fecha, o 0 si no empieza por un año de cuatro cifras.
+func (m *Metadatos) Anio() int {
+	if len(m.Fecha) < 4 {
+		return 0
+	}
+	anio, err := strconv.Atoi(m.Fecha[:4])
+	if err != nil || (len(m.Fecha) > 4 && m.Fecha[4] >= '0' && m.Fecha[4] <= '9') {
+		return 0
+	}
+	return anio
+}
+
+// Leer extrae los metadatos del EPUB de 'tamano' bytes que hay en 'r'.
+func Leer(r io.ReaderAt, tamano int64) (*Metadatos, error) {
+	zr, err := zip.NewReader(r, tamano)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNoEsEPUB, err)
+	}
+	archivos := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		archivos[f.Name] = f
+	}
+
+	var contenedor struct {
+		Rootfiles []struct {
+			FullPath  string `xml:"full-path,attr"`
+			MediaType string `xml:"media-type,attr"`
+		} `xml:"rootfiles>rootfile"`
+	}
+	f, ok := archivos["META-INF/container.xml"]
+	if !ok {
+		return nil, ErrNoEsEPUB
+	}
+	if err := leerXML(f, &contenedor); err != nil {
+		return nil, fmt.Errorf("%w: container.xml: %v", ErrNoEsEPUB, err)
+	}
+	rutaOPF := ""
+	for _, rf := range contenedor.Rootfiles {
+		if rf.MediaType == "" || rf.MediaType == "application/oebps-package+xml" {
+			rutaOPF = rf.FullPath
+			break
+		}
+	}
+	opf, ok := archivos[rutaOPF]
+	if !ok {
+		return nil, fmt.Errorf("%w: no se encuentra %q", ErrPaqueteInvalido, rutaOPF)
+	}
+	var p paquete
+	if err := leerXML(opf, &p); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPaqueteInvalido, err)
+	}
+
+	m := p.metadatos()
+	if item := p.itemPortada(); item != nil {
+		ruta := resolver(rutaOPF, item.Href)
+		if f, ok := archivos[ruta]; ok {
+			datos, err := leerEntrada(f, TamanoMaximoPortada)
+			if err != nil {
+				return nil, fmt.Errorf("leer portada %s: %w", ruta, err)
+			}
+			m.Portada = &Portada{Ruta: ruta, MIME: item.MediaType, Datos: datos}
+		}
+	}
+	return m, nil
+}
+
+// paquete es la parte del OPF que interesa.
+type paquete struct {
+	Metadata struct {
+		Titulos         []elementoDC `xml:"http://purl.org/dc/elements/1.1/ title"`
+		Creadores       []elementoDC `xml:"http://purl.org/dc/elements/1.1/ creator"`
+		Contribuidores  []elementoDC `xml:"http://purl.org/dc/elements/1.1/ contributor"`
+		Idiomas         []elementoDC `xml:"http://purl.org/dc/elements/1.1/ language"`
+		Editoriales     []elementoDC `xml:"http://purl.org/dc/elements/1.1/ publisher"`
+		Identificadores []elementoDC `xml:"http://purl.org/dc/elements/1.1/ identifier"`
+		Descripciones   []elementoDC `xml:"http://purl.org/dc/elements/1.1/ description"`
+		Fechas          []elementoDC `xml:"http://purl.org/dc/elements/1.1/ date"`
+		Metas           []meta       `xml:"meta"`
+	} `xml:"metadata"`
+	Items []item `xml:"manifest>item"`
+}
+
+type elementoDC struct {
+	ID      string `xml:"id,attr"`
+	Rol     string `xml:"http://www.idpf.org/2007/opf role,attr"`   // EPUB 2
+	Esquema string `xml:"http://www.idpf.org/2007/opf scheme,attr"` // EPUB 2
+	Valor   string `xml:",chardata"`
+}
+
+// meta es un <meta name content> de EPUB 2 o un <meta refines property> de EPUB 3.
+type meta struct {
+	Name     string `xml:"name,attr"`
+	Content  string `xml:"content,attr"`
+	Refines  string `xml:"refines,attr"`
+	Property string `xml:"property,attr"`
+	Valor    string `xml:",chardata"`
+}
+
+type item struct {
+	ID         string `xml:"id,attr"`
+	Href       string `xml:"href,attr"`
+	MediaType  string `xml:"media-type,attr"`
+	Properties string `xml:"properties,attr"`
+}
+
+// refinado devuelve el valor de la primera propiedad EPUB 3 que refina al elemento 'id'.
+func (p *paquete) refinado(id, propiedad string) string {
+	if id == "" {
+		return ""
+	}
+	for _, m := range p.Metadata.Metas {
+		if m.Refines == "#"+id && m.Property == propiedad {
+			return strings.TrimSpace(m.Valor)
+		}
+	}
+	return ""
+}
+
+func (p *paquete) metadatos() *Metadatos {
+	md := &p.Metadata
+	m := &Metadatos{
+		Titulo:      primero(md.Titulos, true),
+		Idioma:      primero(md.Idiomas, true),
+		Editorial:   primero(md.Editoriales, true),
+		Descripcion: textoPlano(primero(md.Descripciones, false)),
+		Fecha:       primero(md.Fechas, true),
+	}
+
+	for i, e := range append(md.Creadores, md.Contribuidores...) {
+		nombre := limpiar(e.Valor)
+		if nombre == "" {
+			continue
+		}
+		rol := strings.ToLower(strings.TrimSpace(e.Rol))
+		if rol == "" {
+			rol = strings.ToLower(p.refinado(e.ID, "role"))
+		}
+		if rol == "" && i < len(md.Creadores) {
+			rol = "aut"
+		}
+		m.Creadores = append(m.Creadores, Creador{Nombre: nombre, Rol: rol})
+	}
+
+	for _, e := range md.Identificadores {
+		valor := limpiar(e.Valor)
+		if valor == "" {
+			continue
+		}
+		esquema := strings.ToLower(strings.TrimSpace(e.Esquema))
+		if esquema == "" {
+			esquema = esquemaONIX[p.refinado(e.ID, "identifier-type")]
+		}
+		// "urn:isbn:978..." o "urn:uuid:..." llevan el esquema en el valor
+		if partes := strings.SplitN(valor, ":", 3); len(partes) == 3 && strings.EqualFold(partes[0], "urn") {
+			if esquema == "" {
+				esquema = strings.ToLower(partes[1])
+			}
+			if strings.EqualFold(partes[1], esquema) {
+				valor = partes[2]
+			}
+		}
+		m.Identificadores = append(m.Identificadores, Identificador{Esquema: esquema, Valor: valor})
+	}
+	return m
+}
+
+// esquemaONIX traduce los códigos de la lista ONIX 5, que EPUB 3 usa en identifier-type.
+var esquemaONIX = map[string]string{"02": "isbn", "06": "doi", "15": "isbn"}
+
+// itemPortada busca la portada como la declaran EPUB 3 (properties="cover-image") o
+// EPUB 2 (<meta name="cover" content="id-del-item">).
+func (p *paquete) itemPortada() *item {
+	for i, it := range p.Items {
+		if strings.Contains(" "+it.Properties+" ", " cover-image ") {
+			return &p.Items[i]
+		}
+	}
+	for _, m := range p.Metadata.Metas {
+		if m.Name != "cover" {
+			continue
+		}
+		for i, it := range p.Items {
+			if it.ID == m.Content && strings.HasPrefix(it.MediaType, "image/") {
+				return &p.Items[i]
+			}
+		}
+	}
+	return nil
+}
+
+// resolver convierte un href del OPF, relativo a él, en el nombre de su entrada en el ZIP.
+func resolver(rutaOPF, href string) string {
+	if sinEscapes, err := url.PathUnescape(href); err == nil {
+		href = sinEscapes
+	}
+	return path.Join(path.Dir(rutaOPF), href)
+}
+
+func leerEntrada(f *zip.File, maximo int64) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	datos, err := io.ReadAll(io.LimitReader(rc, maximo+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(datos)) > maximo {
+		return nil, fmt.Errorf("%s supera %d bytes", f.Name, maximo)
+	}
+	return datos, nil
+}
+
+func leerXML(f *zip.File, destino interface{}) error {
+	datos, err := leerEntrada(f, tamanoMaximoXML)
+	if err != nil {
+		return err
+	}
+	dec := xml.NewDecoder(strings.NewReader(string(datos)))
+	dec.Strict = false // Hay muchos EPUB con entidades HTML en la descripción
+	dec.Entity = xml.HTMLEntity
+	dec.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil // Se asume UTF-8, como exige EPUB
+	}
+	return dec.Decode(destino)
+}
+
+// primero devuelve el primer valor no vacío, limpio si se pide.
+func primero(elementos []elementoDC, limpio bool) string {
+	for _, e := range elementos {
+		if limpiar(e.Valor) == "" {
+			continue
+		}
+		if limpio {
+			return limpiar(e.Valor)
+		}
+		return e.Valor
+	}
+	return ""
+}
+
+// limpiar une en un espacio los espacios en blanco seguidos y quita los de los extremos.
+func limpiar(texto string) string {
+	return strings.Join(strings.Fields(texto), " ")
+}
+
+var (
+	etiquetaBloque = regexp.MustCompile(`(?i)<\s*(br|/p|/div|/li|/h[1-6])\b[^>]*>`)
+	etiquetaHTML   = regexp.MustCompile(`<[^>]*>`)
+)
+
+// textoPlano convierte la descripción, que a menudo es HTML, en párrafos de texto.
+func textoPlano(descripcion string) string {
+	texto := etiquetaBloque.ReplaceAllString(descripcion, "\n")
+	texto = html.UnescapeString(etiquetaHTML.ReplaceAllString(texto, ""))
+	var parrafos []string
+	for _, linea := range strings.Split(texto, "\n") {
+		if linea = limpiar(linea); linea != "" {
+			parrafos = append(parrafos, linea)
+		}
+	}
+	return strings.Join(parrafos, "\n\n")
+}
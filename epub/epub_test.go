@@ -0,0 +1,113 @@
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func leerEjemplo(t *testing.T, nombre string) *Metadatos {
+	t.Helper()
+	datos, err := os.ReadFile("testdata/" + nombre)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := Leer(bytes.NewReader(datos), int64(len(datos)))
+	if err != nil {
+		t.Fatalf("Error al leer %s: %v", nombre, err)
+	}
+	return m
+}
+
+func TestLeerEPUB2(t *testing.T) {
+	m := leerEjemplo(t, "epub2.epub")
+
+	if m.Titulo != "Cien años de soledad" || m.Idioma != "es" || m.Editorial != "Editorial Sudamericana" {
+		t.Errorf("Datos básicos incorrectos: %+v", m)
+	}
+	creadores := []Creador{{"Gabriel García Márquez", "aut"}, {"Jacques Joset", "edt"}}
+	if !reflect.DeepEqual(m.Creadores, creadores) {
+		t.Errorf("Se esperaban los creadores %v, se obtuvo %v", creadores, m.Creadores)
+	}
+	identificadores := []Identificador{{"uuid", "5b3f2c1e-8a8e-4c1a-9b7a-2f1d3c4b5a69"}, {"isbn", "978-84-376-0494-7"}}
+	if !reflect.DeepEqual(m.Identificadores, identificadores) {
+		t.Errorf("Se esperaban los identificadores %v, se obtuvo %v", identificadores, m.Identificadores)
+	}
+	if m.ISBN() != "978-84-376-0494-7" || m.Anio() != 1967 {
+		t.Errorf("ISBN o año incorrectos: %q, %d", m.ISBN(), m.Anio())
+	}
+	descripcion := "La historia de la familia Buendía a lo largo de siete generaciones.\n\nMacondo & sus habitantes."
+	if m.Descripcion != descripcion {
+		t.Errorf("Se esperaba la descripción %q, se obtuvo %q", descripcion, m.Descripcion)
+	}
+	if m.Portada == nil || m.Portada.Ruta != "OEBPS/Images/cover.png" || m.Portada.MIME != "image/png" ||
+		!bytes.HasPrefix(m.Portada.Datos, []byte("\x89PNG")) {
+		t.Errorf("Portada incorrecta: %+v", m.Portada)
+	}
+}
+
+func TestLeerEPUB3(t *testing.T) {
+	m := leerEjemplo(t, "epub3.epub")
+
+	if m.Titulo != "One Hundred Years of Solitude" || m.Idioma != "en-US" || m.Editorial != "" || m.Descripcion != "" {
+		t.Errorf("Datos básicos incorrectos: %+v", m)
+	}
+	creadores := []Creador{{"Gabriel García Márquez", "aut"}, {"Gregory Rabassa", "trl"}}
+	if !reflect.DeepEqual(m.Creadores, creadores) {
+		t.Errorf("Se esperaban los creadores %v, se obtuvo %v", creadores, m.Creadores)
+	}
+	identificadores := []Identificador{{"isbn", "9780060883287"}, {"doi", "10.1000/182"}}
+	if !reflect.DeepEqual(m.Identificadores, identificadores) {
+		t.Errorf("Se esperaban los identificadores %v, se obtuvo %v", identificadores, m.Identificadores)
+	}
+	if m.Anio() != 2006 {
+		t.Errorf("Se esperaba el año 2006, se obtuvo %d", m.Anio())
+	}
+	if m.Portada == nil || m.Portada.Ruta != "img/cover art.png" {
+		t.Errorf("Portada incorrecta: %+v", m.Portada)
+	}
+}
+
+func TestLeerInvalido(t *testing.T) {
+	zipCon := func(entradas map[string]string) []byte {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		for nombre, contenido := range entradas {
+			w, _ := zw.Create(nombre)
+			w.Write([]byte(contenido))
+		}
+		zw.Close()
+		return buf.Bytes()
+	}
+	contenedor := `<container><rootfiles><rootfile full-path="content.opf" media-type="application/oebps-package+xml"/></rootfiles></container>`
+
+	casos := []struct {
+		nombre   string
+		datos    []byte
+		esperado error
+	}{
+		{"No es un ZIP", []byte("%PDF-1.4"), ErrNoEsEPUB},
+		{"ZIP sin container.xml", zipCon(map[string]string{"leeme.txt": "hola"}), ErrNoEsEPUB},
+		{"Falta el OPF", zipCon(map[string]string{"META-INF/container.xml": contenedor}), ErrPaqueteInvalido},
+		{"OPF mal formado", zipCon(map[string]string{"META-INF/container.xml": contenedor, "content.opf": "<package><metadata>"}), ErrPaqueteInvalido},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			if _, err := Leer(bytes.NewReader(c.datos), int64(len(c.datos))); !errors.Is(err, c.esperado) {
+				t.Errorf("Se esperaba %v, se obtuvo %v", c.esperado, err)
+			}
+		})
+	}
+}
+
+func TestAnio(t *testing.T) {
+	casos := map[string]int{"1967": 1967, "1967-05-30": 1967, "2006-02-21T00:00:00Z": 2006, "": 0, "mayo de 1967": 0, "967": 0}
+	for fecha, esperado := range casos {
+		if anio := (&Metadatos{Fecha: fecha}).Anio(); anio != esperado {
+			t.Errorf("Anio(%q) = %d, se esperaba %d", fecha, anio, esperado)
+		}
+	}
+}
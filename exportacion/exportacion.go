@@ -0,0 +1,168 @@
+// Package exportacion vuelca el catálogo, los usuarios y los alquileres en CSV, JSON
+// Lines o MARCXML, leyendo la base de datos por lotes para no cargarla entera en memoria.
+package exportacion
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"libroselectronicos/db"
+	"libroselectronicos/models"
+)
+
+// FormatoMARCXML es MARC 21 en XML (MARCXML), que leen los programas de bibliotecas.
+const FormatoMARCXML = "marcxml"
+
+// Datos que se pueden exportar.
+const (
+	DatosLibros     = "libros"
+	DatosUsuarios   = "usuarios"   // Sin el hash de la contraseña
+	DatosAlquileres = "alquileres" // Incluidos los ya devueltos
+)
+
+// ErrNoSoportada se devuelve con datos o un formato desconocidos, o con una combinación
+// que no existe, como los usuarios en MARCXML.
+var ErrNoSoportada = errors.New("exportación no soportada")
+
+// formatos son los formatos en que se puede exportar cada tipo de datos, en el orden
+// en que se ofrecen.
+var formatos = map[string][]string{
+	DatosLibros:     {models.FormatoCSV, models.FormatoJSONL, FormatoMARCXML},
+	DatosUsuarios:   {models.FormatoCSV, models.FormatoJSONL},
+	DatosAlquileres: {models.FormatoCSV, models.FormatoJSONL},
+}
+
+// Formatos devuelve los formatos en que se pueden exportar 'datos'.
+func Formatos(datos string) []string {
+	return formatos[datos]
+}
+
+// Comprobar devuelve ErrNoSoportada si 'datos' no se pueden exportar en 'formato'.
+func Comprobar(datos, formato string) error {
+	if !slices.Contains(formatos[datos], formato) {
+		return fmt.Errorf("%w: %q en %q", ErrNoSoportada, datos, formato)
+	}
+	return nil
+}
+
+// TipoContenido devuelve el Content-Type de un formato de exportación.
+func TipoContenido(formato string) string {
+	switch formato {
+	case models.FormatoCSV:
+		return "text/csv; charset=utf-8"
+	case models.FormatoJSONL:
+		return "application/x-ndjson"
+	case FormatoMARCXML:
+		return "application/marcxml+xml"
+	}
+	return "application/octet-stream"
+}
+
+// NombreArchivo propone un nombre para el archivo exportado, ej. "libros-2024-05-01.csv".
+func NombreArchivo(datos, formato string, fecha time.Time) string {
+	extension := formato
+	if formato == FormatoMARCXML {
+		extension = "xml"
+	}
+	return datos + "-" + fecha.Format("2006-01-02") + "." + extension
+}
+
+// Exportar escribe en 'w' los datos pedidos en el formato indicado. Comprueba la
+// combinación antes de escribir nada, así que un error de Comprobar nunca deja una
+// salida a medias.
+func Exportar(almacen db.LibroAlmacenamiento, w io.Writer, datos, formato string) error {
+	if err := Comprobar(datos, formato); err != nil {
+		return err
+	}
+
+	switch {
+	case formato == FormatoMARCXML:
+		return exportarMARCXML(almacen, w)
+	case formato == models.FormatoJSONL:
+		return exportarJSONL(almacen, w, datos)
+	case datos == DatosLibros:
+		return exportarCSV(w, ColumnasLibro, func(fila func([]string) error) error {
+			return almacen.RecorrerLibros(func(l *models.Libro) error { return fila(filaLibro(l)) })
+		})
+	case datos == DatosUsuarios:
+		return exportarCSV(w, columnasUsuario, func(fila func([]string) error) error {
+			return almacen.RecorrerUsuarios(func(u *models.Usuario) error {
+				return fila([]string{strconv.Itoa(u.ID), u.Username, u.Email, u.Rol})
+			})
+		})
+	default:
+		return exportarCSV(w, columnasAlquiler, func(fila func([]string) error) error {
+			return almacen.RecorrerAlquileres(func(a *models.Alquiler) error {
+				devolucion := ""
+				if a.FechaDevolucion != nil {
+					devolucion = a.FechaDevolucion.Format(time.RFC3339)
+				}
+				return fila([]string{strconv.Itoa(a.ID), strconv.Itoa(a.UsuarioID), strconv.Itoa(a.LibroID),
+					a.FechaAlquiler.Format(time.RFC3339), a.FechaVencimiento.Format(time.RFC3339), devolucion})
+			})
+		})
+	}
+}
+
+// ColumnasLibro son las columnas del CSV de libros. Son las que admite la importación
+// más id, slug y disponible, que la importación ignora porque los asigna el servidor.
+// En generos (por su slug) y etiquetas los valores se separan con punto y coma.
+var ColumnasLibro = []string{"id", "slug", "titulo", "autor", "anio", "isbn", "idioma", "editorial", "caratula_url", "sinopsis", "generos", "etiquetas", "disponible"}
+
+var (
+	columnasUsuario  = []string{"id", "username", "email", "rol"}
+	columnasAlquiler = []string{"id", "usuario_id", "libro_id", "fecha_alquiler", "fecha_vencimiento", "fecha_devolucion"}
+)
+
+func filaLibro(l *models.Libro) []string {
+	generos := make([]string, len(l.Generos))
+	for i, g := range l.Generos {
+		generos[i] = g.Slug
+	}
+	return []string{strconv.Itoa(l.ID), l.Slug, l.Titulo, l.Autor, strconv.Itoa(l.Anio), l.ISBN, l.Idioma, l.Editorial, l.CaratulaURL, l.Sinopsis,
+		strings.Join(generos, ";"), strings.Join(l.Etiquetas, ";"), strconv.FormatBool(l.Disponible)}
+}
+
+// exportarCSV escribe la cabecera y las filas que produce 'recorrer'.
+func exportarCSV(w io.Writer, cabecera []string, recorrer func(fila func([]string) error) error) error {
+	escritor := csv.NewWriter(w)
+	if err := escritor.Write(cabecera); err != nil {
+		return err
+	}
+	if err := recorrer(escritor.Write); err != nil {
+		return err
+	}
+	escritor.Flush()
+	return escritor.Error()
+}
+
+// usuarioExportado es un usuario sin el hash de la contraseña.
+type usuarioExportado struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Rol      string `json:"rol"`
+}
+
+// exportarJSONL escribe un objeto JSON por línea. Los libros y los alquileres tienen
+// la misma forma que en la API.
+func exportarJSONL(almacen db.LibroAlmacenamiento, w io.Writer, datos string) error {
+	encoder := json.NewEncoder(w)
+	switch datos {
+	case DatosLibros:
+		return almacen.RecorrerLibros(func(l *models.Libro) error { return encoder.Encode(l) })
+	case DatosUsuarios:
+		return almacen.RecorrerUsuarios(func(u *models.Usuario) error {
+			return encoder.Encode(usuarioExportado{ID: u.ID, Username: u.Username, Email: u.Email, Rol: u.Rol})
+		})
+	default:
+		return almacen.RecorrerAlquileres(func(a *models.Alquiler) error { return encoder.Encode(a) })
+	}
+}
@@ -0,0 +1,183 @@
+package exportacion_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"libroselectronicos/db"
+	"libroselectronicos/exportacion"
+	"libroselectronicos/importacion"
+	"libroselectronicos/models"
+)
+
+func nuevoAlmacen(t *testing.T) db.LibroAlmacenamiento {
+	t.Helper()
+	almacen := db.NewAlmacenForTest(filepath.Join(t.TempDir(), "libros.db"))
+	if almacen == nil {
+		t.Fatal("No se pudo crear la base de datos de prueba")
+	}
+	t.Cleanup(func() { almacen.Close() })
+	return almacen
+}
+
+// catalogo crea un libro con traductor, ISBN, idioma, editorial, género y etiquetas, y
+// otro mínimo.
+func catalogo(t *testing.T, almacen db.LibroAlmacenamiento) {
+	t.Helper()
+	if err := almacen.AgregarGenero(&models.Genero{Nombre: "Novela"}); err != nil {
+		t.Fatal(err)
+	}
+	libro := models.NuevoLibro(0, "Cien años de soledad", "", 1967)
+	libro.ISBN = "978-0-06-088328-7"
+	libro.Idioma, libro.Editorial = "es", "Editorial Sudamericana"
+	libro.Sinopsis = "Macondo & los Buendía"
+	libro.Autores = []models.CreditoAutor{{Nombre: "Gabriel García Márquez", Rol: models.RolAutor}, {Nombre: "Gregory Rabassa", Rol: models.RolTraductor}}
+	libro.Generos = []models.Genero{{Slug: "novela"}}
+	libro.Etiquetas = []string{"clásico", "realismo mágico"}
+	for _, l := range []*models.Libro{libro, models.NuevoLibro(0, "Niebla", "Miguel de Unamuno", 1914)} {
+		if _, err := almacen.AgregarLibro(l); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestExportarCSV(t *testing.T) {
+	almacen := nuevoAlmacen(t)
+	catalogo(t, almacen)
+
+	var buf bytes.Buffer
+	if err := exportacion.Exportar(almacen, &buf, exportacion.DatosLibros, models.FormatoCSV); err != nil {
+		t.Fatalf("Error al exportar: %v", err)
+	}
+	registros, err := csv.NewReader(bytes.NewReader(buf.Bytes())).ReadAll()
+	if err != nil || len(registros) != 3 {
+		t.Fatalf("Se esperaban la cabecera y 2 libros: %v, %v", registros, err)
+	}
+	if strings.Join(registros[0], ",") != strings.Join(exportacion.ColumnasLibro, ",") {
+		t.Errorf("Cabecera incorrecta: %v", registros[0])
+	}
+	if fila := strings.Join(registros[1], "|"); fila != "1|cien-anos-de-soledad|Cien años de soledad|Gabriel García Márquez|1967|9780060883287|es|Editorial Sudamericana||Macondo & los Buendía|novela|clásico;realismo mágico|true" {
+		t.Errorf("Fila incorrecta: %s", fila)
+	}
+
+	// El CSV exportado se importa en otro catálogo
+	otro := nuevoAlmacen(t)
+	otro.AgregarGenero(&models.Genero{Nombre: "Novela"})
+	informe, err := importacion.Importar(otro, &buf, models.FormatoCSV, false)
+	if err != nil || !informe.Correcto() || informe.Importados != 2 {
+		t.Fatalf("No se pudo importar el CSV exportado: %+v, %v", informe, err)
+	}
+	importado, err := otro.ObtenerLibroPorISBN("9780060883287")
+	if err != nil || len(importado.Generos) != 1 || len(importado.Etiquetas) != 2 || importado.Editorial != "Editorial Sudamericana" {
+		t.Errorf("Libro importado incorrecto: %+v, %v", importado, err)
+	}
+}
+
+func TestExportarJSONL(t *testing.T) {
+	almacen := nuevoAlmacen(t)
+	catalogo(t, almacen)
+	almacen.AgregarUsuario(&models.Usuario{Username: "ana", Password: "hash-secreto", Email: "ana@example.com", Rol: models.RolLector})
+
+	var buf bytes.Buffer
+	if err := exportacion.Exportar(almacen, &buf, exportacion.DatosLibros, models.FormatoJSONL); err != nil {
+		t.Fatalf("Error al exportar: %v", err)
+	}
+	var libros []models.Libro
+	for escaner := bufio.NewScanner(&buf); escaner.Scan(); {
+		var libro models.Libro
+		if err := json.Unmarshal(escaner.Bytes(), &libro); err != nil {
+			t.Fatalf("Línea inválida %q: %v", escaner.Text(), err)
+		}
+		libros = append(libros, libro)
+	}
+	if len(libros) != 2 || len(libros[0].Autores) != 2 || libros[1].Titulo != "Niebla" {
+		t.Errorf("Libros exportados incorrectos: %+v", libros)
+	}
+
+	buf.Reset()
+	if err := exportacion.Exportar(almacen, &buf, exportacion.DatosUsuarios, models.FormatoJSONL); err != nil {
+		t.Fatalf("Error al exportar usuarios: %v", err)
+	}
+	if salida := buf.String(); strings.Contains(salida, "password") || strings.Contains(salida, "hash-secreto") || !strings.Contains(salida, "ana@example.com") {
+		t.Errorf("La exportación de usuarios no debe incluir la contraseña: %s", salida)
+	}
+}
+
+func TestExportarMARCXML(t *testing.T) {
+	almacen := nuevoAlmacen(t)
+	catalogo(t, almacen)
+
+	var buf bytes.Buffer
+	if err := exportacion.Exportar(almacen, &buf, exportacion.DatosLibros, exportacion.FormatoMARCXML); err != nil {
+		t.Fatalf("Error al exportar: %v", err)
+	}
+	var coleccion struct {
+		XMLName   xml.Name `xml:"http://www.loc.gov/MARC21/slim collection"`
+		Registros []struct {
+			Cabecera string `xml:"leader"`
+			Control  []struct {
+				Tag   string `xml:"tag,attr"`
+				Valor string `xml:",chardata"`
+			} `xml:"controlfield"`
+			Datos []struct {
+				Tag       string `xml:"tag,attr"`
+				Subcampos []struct {
+					Codigo string `xml:"code,attr"`
+					Valor  string `xml:",chardata"`
+				} `xml:"subfield"`
+			} `xml:"datafield"`
+		} `xml:"record"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &coleccion); err != nil {
+		t.Fatalf("MARCXML inválido: %v\n%s", err, buf.String())
+	}
+	if len(coleccion.Registros) != 2 {
+		t.Fatalf("Se esperaban 2 registros, hay %d", len(coleccion.Registros))
+	}
+	registro := coleccion.Registros[0]
+	if len(registro.Cabecera) != 24 || len(registro.Control) != 2 || len(registro.Control[1].Valor) != 40 || registro.Control[1].Valor[7:11] != "1967" {
+		t.Errorf("Cabecera o campos de control incorrectos: %+v", registro)
+	}
+	campos := map[string]string{}
+	for _, d := range registro.Datos {
+		var valores []string
+		for _, s := range d.Subcampos {
+			valores = append(valores, s.Codigo+"="+s.Valor)
+		}
+		campos[d.Tag] += strings.Join(valores, ",") + ";"
+	}
+	esperados := map[string]string{
+		"020": "a=9780060883287;",
+		"100": "a=Gabriel García Márquez,4=aut;",
+		"245": "a=Cien años de soledad;",
+		"264": "b=Editorial Sudamericana,c=1967;",
+		"520": "a=Macondo & los Buendía;",
+		"650": "a=Novela;",
+		"653": "a=clásico;a=realismo mágico;",
+		"700": "a=Gregory Rabassa,4=trl;",
+	}
+	for tag, valor := range esperados {
+		if campos[tag] != valor {
+			t.Errorf("Campo %s: se esperaba %q, se obtuvo %q", tag, valor, campos[tag])
+		}
+	}
+}
+
+func TestComprobar(t *testing.T) {
+	if err := exportacion.Comprobar(exportacion.DatosAlquileres, models.FormatoCSV); err != nil {
+		t.Errorf("Los alquileres se pueden exportar en CSV: %v", err)
+	}
+	for _, c := range [][2]string{{exportacion.DatosUsuarios, exportacion.FormatoMARCXML}, {"contraseñas", models.FormatoCSV}, {exportacion.DatosLibros, "xls"}} {
+		var buf bytes.Buffer
+		if err := exportacion.Exportar(nil, &buf, c[0], c[1]); !errors.Is(err, exportacion.ErrNoSoportada) || buf.Len() > 0 {
+			t.Errorf("%s en %s: se esperaba ErrNoSoportada sin salida, se obtuvo %v", c[0], c[1], err)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package exportacion
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+
+	"libroselectronicos/db"
+	"libroselectronicos/models"
+)
+
+// espacioMARCXML es el espacio de nombres de MARC 21 en XML (MARCXML "slim").
+const espacioMARCXML = "http://www.loc.gov/MARC21/slim"
+
+// cabeceraMARC es la cabecera (leader) de todos los registros: registro nuevo (n) de
+// texto (a) monográfico (m) en Unicode (a), de nivel mínimo (7). Las longitudes y
+// direcciones van a cero, como es habitual en MARCXML.
+const cabeceraMARC = "00000nam a22000007u 4500"
+
+// codigosMARC son los códigos MARC relator ($4) de los papeles de los autores.
+var codigosMARC = map[string]string{models.RolAutor: "aut", models.RolTraductor: "trl", models.RolEditor: "edt"}
+
+type registroMARC struct {
+	XMLName  xml.Name       `xml:"record"`
+	Cabecera string         `xml:"leader"`
+	Control  []campoControl `xml:"controlfield"`
+	Datos    []campoMARC    `xml:"datafield"`
+}
+
+type campoControl struct {
+	Etiqueta string `xml:"tag,attr"`
+	Valor    string `xml:",chardata"`
+}
+
+type campoMARC struct {
+	Etiqueta   string         `xml:"tag,attr"`
+	Indicador1 string         `xml:"ind1,attr"`
+	Indicador2 string         `xml:"ind2,attr"`
+	Subcampos  []subcampoMARC `xml:"subfield"`
+}
+
+type subcampoMARC struct {
+	Codigo string `xml:"code,attr"`
+	Valor  string `xml:",chardata"`
+}
+
+// exportarMARCXML escribe el catálogo como una colección MARCXML, un registro por libro.
+func exportarMARCXML(almacen db.LibroAlmacenamiento, w io.Writer) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	coleccion := xml.StartElement{Name: xml.Name{Local: "collection"}, Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: espacioMARCXML}}}
+	if err := encoder.EncodeToken(coleccion); err != nil {
+		return err
+	}
+	err := almacen.RecorrerLibros(func(l *models.Libro) error { return encoder.Encode(registroDeLibro(l)) })
+	if err != nil {
+		return err
+	}
+	if err := encoder.EncodeToken(coleccion.End()); err != nil {
+		return err
+	}
+	if err := encoder.Flush(); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+// registroDeLibro convierte un libro en un registro MARC 21 bibliográfico:
+//
+//	001 ID del libro           020 $a ISBN          100 $a primer autor
+//	245 $a título              264 $b editorial     264 $c año           520 $a sinopsis
+//	650 $a géneros             653 $a etiquetas     700 $a demás autores, traductores y editores
+//
+// Los nombres van en el orden en que se guardan, no invertidos ("Apellido, Nombre").
+func registroDeLibro(l *models.Libro) registroMARC {
+	registro := registroMARC{
+		Cabecera: cabeceraMARC,
+		Control: []campoControl{
+			{Etiqueta: "001", Valor: strconv.Itoa(l.ID)},
+			{Etiqueta: "008", Valor: campo008(l.Anio)},
+		},
+	}
+	agregar := func(etiqueta, ind1, ind2 string, subcampos ...subcampoMARC) {
+		registro.Datos = append(registro.Datos, campoMARC{Etiqueta: etiqueta, Indicador1: ind1, Indicador2: ind2, Subcampos: subcampos})
+	}
+
+	if l.ISBN != "" {
+		agregar("020", " ", " ", subcampoMARC{"a", l.ISBN})
+	}
+	creditos := l.Autores
+	if len(creditos) == 0 && l.Autor != "" {
+		creditos = []models.CreditoAutor{{Nombre: l.Autor, Rol: models.RolAutor}}
+	}
+	principal := -1 // El primer autor es el asiento principal (100); los demás créditos van en 700
+	for i, c := range creditos {
+		if c.Rol == models.RolAutor {
+			principal = i
+			agregar("100", "0", " ", subcampoMARC{"a", c.Nombre}, subcampoMARC{"4", codigosMARC[c.Rol]})
+			break
+		}
+	}
+	indTitulo := "0"
+	if principal >= 0 {
+		indTitulo = "1" // Hay asiento principal de autor
+	}
+	agregar("245", indTitulo, "0", subcampoMARC{"a", l.Titulo})
+	var publicacion []subcampoMARC
+	if l.Editorial != "" {
+		publicacion = append(publicacion, subcampoMARC{"b", l.Editorial})
+	}
+	if l.Anio > 0 {
+		publicacion = append(publicacion, subcampoMARC{"c", strconv.Itoa(l.Anio)})
+	}
+	if len(publicacion) > 0 {
+		agregar("264", " ", "1", publicacion...)
+	}
+	if l.Sinopsis != "" {
+		agregar("520", " ", " ", subcampoMARC{"a", l.Sinopsis})
+	}
+	for _, g := range l.Generos {
+		agregar("650", " ", "4", subcampoMARC{"a", g.Nombre})
+	}
+	for _, e := range l.Etiquetas {
+		agregar("653", " ", " ", subcampoMARC{"a", e})
+	}
+	for i, c := range creditos {
+		if i != principal {
+			agregar("700", "0", " ", subcampoMARC{"a", c.Nombre}, subcampoMARC{"4", codigosMARC[c.Rol]})
+		}
+	}
+	return registro
+}
+
+// campo008 genera los 40 caracteres del campo de control 008 con el año de publicación
+// (posiciones 7 a 10). Lo que la aplicación no conoce va con el carácter de relleno "|".
+func campo008(anio int) string {
+	tipoFecha, fecha := "s", fmt.Sprintf("%04d", anio) // Fecha única conocida
+	if anio <= 0 || anio > 9999 {
+		tipoFecha, fecha = "n", "uuuu" // Fecha desconocida
+	}
+	return "||||||" + tipoFecha + fecha + "    " + "xx " + "|||||||||||||||||" + "und" + "|" + "d"
+}
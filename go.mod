@@ -8,8 +8,7 @@ require github.com/mattn/go-sqlite3 v1.14.28
 
 require (
 	github.com/gorilla/mux v1.8.1
+	github.com/gorilla/securecookie v1.1.2
 	github.com/gorilla/sessions v1.4.0
 	golang.org/x/crypto v0.39.0
 )
-
-require github.com/gorilla/securecookie v1.1.2 // indirect
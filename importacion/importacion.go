@@ -0,0 +1,191 @@
+// Package importacion carga libros en bloque desde archivos CSV o JSON Lines.
+package importacion
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"libroselectronicos/db"
+	"libroselectronicos/models"
+)
+
+// ErrFormatoDesconocido se devuelve con un formato que no es CSV ni JSON Lines.
+var ErrFormatoDesconocido = errors.New("formato de importación desconocido: use csv o jsonl")
+
+// columnasCSV son las columnas que admite un CSV, con los nombres de los campos JSON.
+// En generos y etiquetas los valores se separan con punto y coma. Las columnas que
+// valen false son las que añade la exportación y asigna el servidor: se ignoran, para
+// poder importar un CSV exportado.
+var columnasCSV = map[string]bool{
+	"titulo": true, "autor": true, "anio": true, "isbn": true, "idioma": true, "editorial": true,
+	"caratula_url": true, "sinopsis": true, "generos": true, "etiquetas": true,
+	"id": false, "slug": false, "disponible": false,
+}
+
+// tamanoMaximoLinea limita cada línea de un JSON Lines.
+const tamanoMaximoLinea = 1 << 20
+
+// Importar lee los libros de 'r' en el formato indicado y los guarda en una sola
+// transacción. Si alguna fila tiene errores, o si 'simular' es true, no guarda ninguno;
+// el informe indica los errores de cada fila. Un error de lectura del archivo entero,
+// como un CSV sin cabecera válida, se devuelve como error.
+func Importar(almacen db.LibroAlmacenamiento, r io.Reader, formato string, simular bool) (*models.InformeImportacion, error) {
+	filas, errores, err := Leer(r, formato)
+	if err != nil {
+		return nil, err
+	}
+
+	// Con filas ilegibles no se guarda nada, pero se comprueban igualmente las demás
+	errs, importados, err := almacen.ImportarLibros(filas, simular || len(errores) > 0)
+	if err != nil {
+		return nil, err
+	}
+	informe := &models.InformeImportacion{
+		Simulacion: simular,
+		Filas:      len(filas) + len(errores),
+		Validas:    len(filas) - len(errs),
+		Importados: importados,
+		Errores:    append(errores, errs...),
+	}
+	if informe.Errores == nil {
+		informe.Errores = []models.ErrorFila{}
+	}
+	sort.SliceStable(informe.Errores, func(i, j int) bool { return informe.Errores[i].Fila < informe.Errores[j].Fila })
+	return informe, nil
+}
+
+// Leer devuelve las filas válidas del archivo y los errores de las que no lo son.
+func Leer(r io.Reader, formato string) ([]models.FilaImportacion, []models.ErrorFila, error) {
+	switch formato {
+	case models.FormatoCSV:
+		return leerCSV(r)
+	case models.FormatoJSONL:
+		return leerJSONL(r)
+	default:
+		return nil, nil, ErrFormatoDesconocido
+	}
+}
+
+func leerCSV(r io.Reader) ([]models.FilaImportacion, []models.ErrorFila, error) {
+	lector := csv.NewReader(r)
+	lector.FieldsPerRecord = -1 // Las filas cortas se comprueban aquí, con su número
+	cabecera, err := lector.Read()
+	if err == io.EOF {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("leer cabecera CSV: %w", err)
+	}
+	cabecera[0] = strings.TrimPrefix(cabecera[0], "\uFEFF") // BOM de las hojas de cálculo
+	vistas := map[string]bool{}
+	for i, columna := range cabecera {
+		columna = strings.ToLower(strings.TrimSpace(columna))
+		if _, ok := columnasCSV[columna]; !ok {
+			return nil, nil, models.ErroresValidacion{"cabecera": fmt.Sprintf("columna desconocida %q", cabecera[i])}
+		}
+		if vistas[columna] {
+			return nil, nil, models.ErroresValidacion{"cabecera": fmt.Sprintf("columna repetida %q", columna)}
+		}
+		vistas[columna] = true
+		cabecera[i] = columna
+	}
+
+	var filas []models.FilaImportacion
+	var errores []models.ErrorFila
+	for {
+		registro, err := lector.Read()
+		if err == io.EOF {
+			break
+		}
+		var errCSV *csv.ParseError
+		if errors.As(err, &errCSV) {
+			errores = append(errores, models.ErrorFila{Fila: errCSV.StartLine, Campos: models.ErroresValidacion{"csv": errCSV.Err.Error()}})
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		linea, _ := lector.FieldPos(0)
+		if len(registro) != len(cabecera) {
+			errores = append(errores, models.ErrorFila{Fila: linea, Campos: models.ErroresValidacion{
+				"csv": fmt.Sprintf("tiene %d columnas y la cabecera %d", len(registro), len(cabecera))}})
+			continue
+		}
+
+		campos := map[string]json.RawMessage{}
+		for i, valor := range registro {
+			if valor = strings.TrimSpace(valor); valor != "" && columnasCSV[cabecera[i]] {
+				campos[cabecera[i]] = valorCSV(cabecera[i], valor)
+			}
+		}
+		filas, errores = agregarFila(filas, errores, linea, campos)
+	}
+	return filas, errores, nil
+}
+
+// valorCSV convierte una celda en el valor JSON de su campo.
+func valorCSV(columna, valor string) json.RawMessage {
+	var v interface{} = valor
+	switch columna {
+	case "anio":
+		if n, err := strconv.Atoi(valor); err == nil {
+			v = n
+		}
+	case "generos", "etiquetas":
+		lista := []string{}
+		for _, elemento := range strings.Split(valor, ";") {
+			if elemento = strings.TrimSpace(elemento); elemento != "" {
+				lista = append(lista, elemento)
+			}
+		}
+		v = lista
+	}
+	datos, _ := json.Marshal(v)
+	return datos
+}
+
+func leerJSONL(r io.Reader) ([]models.FilaImportacion, []models.ErrorFila, error) {
+	escaner := bufio.NewScanner(r)
+	escaner.Buffer(make([]byte, 64<<10), tamanoMaximoLinea)
+
+	var filas []models.FilaImportacion
+	var errores []models.ErrorFila
+	for linea := 1; escaner.Scan(); linea++ {
+		texto := bytes.TrimSpace(escaner.Bytes())
+		if len(texto) == 0 {
+			continue
+		}
+		var campos map[string]json.RawMessage
+		if err := json.Unmarshal(texto, &campos); err != nil {
+			errores = append(errores, models.ErrorFila{Fila: linea, Campos: models.ErroresValidacion{"json": "objeto JSON inválido: " + err.Error()}})
+			continue
+		}
+		filas, errores = agregarFila(filas, errores, linea, campos)
+	}
+	if err := escaner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("leer JSON Lines: %w", err)
+	}
+	return filas, errores, nil
+}
+
+// agregarFila valida los campos de una fila como POST /api/v1/libros y la añade a las
+// filas válidas o a los errores.
+func agregarFila(filas []models.FilaImportacion, errores []models.ErrorFila, linea int, campos map[string]json.RawMessage) ([]models.FilaImportacion, []models.ErrorFila) {
+	libro, err := models.LibroDesdeJSON(campos)
+	if err != nil {
+		var errs models.ErroresValidacion
+		if !errors.As(err, &errs) {
+			errs = models.ErroresValidacion{"libro": err.Error()}
+		}
+		return filas, append(errores, models.ErrorFila{Fila: linea, Campos: errs})
+	}
+	return append(filas, models.FilaImportacion{Numero: linea, Libro: libro}), errores
+}
@@ -0,0 +1,98 @@
+package importacion_test
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"libroselectronicos/db"
+	"libroselectronicos/importacion"
+	"libroselectronicos/models"
+)
+
+func TestLeerCSV(t *testing.T) {
+	csv := "\uFEFFTitulo,autor,anio,isbn,generos,etiquetas\n" +
+		"Cien años de soledad,Gabriel García Márquez,1967,978-0-06-088328-7,novela; realismo-magico,clásico;\n" +
+		"\"Sin autor\",,1900,,,\n" +
+		"Corta,Autor\n" +
+		"Año raro,Autor,mil,,,\n"
+	filas, errores, err := importacion.Leer(strings.NewReader(csv), models.FormatoCSV)
+	if err != nil {
+		t.Fatalf("Error al leer CSV: %v", err)
+	}
+	if len(filas) != 1 {
+		t.Fatalf("Se esperaba 1 fila válida, se obtuvieron %d", len(filas))
+	}
+	libro := filas[0].Libro
+	if filas[0].Numero != 2 || libro.Titulo != "Cien años de soledad" || libro.Anio != 1967 || libro.ISBN == "" {
+		t.Errorf("Fila mal leída: %d %+v", filas[0].Numero, libro)
+	}
+	if len(libro.Etiquetas) != 1 {
+		t.Errorf("Se esperaba 1 etiqueta, se obtuvo %+v", libro.Etiquetas)
+	}
+
+	esperados := map[int]string{3: "autor", 4: "csv", 5: "anio"}
+	if len(errores) != len(esperados) {
+		t.Fatalf("Se esperaban %d errores: %+v", len(esperados), errores)
+	}
+	for _, e := range errores {
+		if _, ok := e.Campos[esperados[e.Fila]]; !ok {
+			t.Errorf("Fila %d: se esperaba un error en %q, se obtuvo %v", e.Fila, esperados[e.Fila], e.Campos)
+		}
+	}
+
+	_, _, err = importacion.Leer(strings.NewReader("titulo,precio\nX,3\n"), models.FormatoCSV)
+	var errs models.ErroresValidacion
+	if !errors.As(err, &errs) || errs["cabecera"] == "" {
+		t.Errorf("Se esperaba un error de cabecera con una columna desconocida, se obtuvo %v", err)
+	}
+}
+
+func TestLeerJSONL(t *testing.T) {
+	jsonl := `{"titulo": "Niebla", "autor": "Miguel de Unamuno", "anio": 1914}` + "\n\n" +
+		"{roto\n" +
+		`{"titulo": "Con ID", "autor": "X", "anio": 2000, "id": 7}` + "\n"
+	filas, errores, err := importacion.Leer(strings.NewReader(jsonl), models.FormatoJSONL)
+	if err != nil {
+		t.Fatalf("Error al leer JSON Lines: %v", err)
+	}
+	if len(filas) != 1 || filas[0].Numero != 1 || filas[0].Libro.Titulo != "Niebla" {
+		t.Errorf("Filas mal leídas: %+v", filas)
+	}
+	if len(errores) != 2 || errores[0].Fila != 3 || errores[1].Fila != 4 || errores[1].Campos["id"] == "" {
+		t.Errorf("Errores inesperados: %+v", errores)
+	}
+
+	if _, _, err := importacion.Leer(strings.NewReader(""), "xml"); !errors.Is(err, importacion.ErrFormatoDesconocido) {
+		t.Errorf("Se esperaba ErrFormatoDesconocido, se obtuvo %v", err)
+	}
+}
+
+func TestImportar(t *testing.T) {
+	almacen := db.NewAlmacenForTest(filepath.Join(t.TempDir(), "libros.db"))
+	if almacen == nil {
+		t.Fatal("No se pudo crear la base de datos de prueba")
+	}
+	defer almacen.Close()
+
+	// Una fila ilegible impide importar las demás, pero se siguen comprobando
+	csv := "titulo,autor,anio\nNiebla,Miguel de Unamuno,1914\nNiebla,Miguel de Unamuno,1914\nSin año,X,\n"
+	informe, err := importacion.Importar(almacen, strings.NewReader(csv), models.FormatoCSV, false)
+	if err != nil {
+		t.Fatalf("Error al importar: %v", err)
+	}
+	if informe.Correcto() || informe.Filas != 3 || informe.Validas != 1 || informe.Importados != 0 ||
+		len(informe.Errores) != 2 || informe.Errores[0].Fila != 3 || informe.Errores[1].Fila != 4 {
+		t.Errorf("Informe incorrecto: %+v", informe)
+	}
+
+	informe, err = importacion.Importar(almacen, strings.NewReader("titulo,autor,anio\nNiebla,Miguel de Unamuno,1914\n"), models.FormatoCSV, true)
+	if err != nil || !informe.Correcto() || !informe.Simulacion || informe.Importados != 0 {
+		t.Errorf("Simulación incorrecta: %+v, %v", informe, err)
+	}
+	informe, err = importacion.Importar(almacen, strings.NewReader("titulo,autor,anio\nNiebla,Miguel de Unamuno,1914\n"), models.FormatoCSV, false)
+	if err != nil || !informe.Correcto() || informe.Importados != 1 || informe.Errores == nil {
+		t.Errorf("Importación incorrecta: %+v, %v", informe, err)
+	}
+}
@@ -1,47 +1,289 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"time"
 
+	"libroselectronicos/archivos"
+	"libroselectronicos/bloqueos"
+	"libroselectronicos/caratulas"
+	"libroselectronicos/config"
+	"libroselectronicos/controllers"
+	"libroselectronicos/correo"
+	"libroselectronicos/cuentas"
 	"libroselectronicos/db"
+	"libroselectronicos/models"
+	"libroselectronicos/opds"
 	"libroselectronicos/views"
 
 	"github.com/gorilla/mux"
 )
 
 func main() {
-	almacen := db.NuevoAlmacen()
+	cfg, args, err := config.Cargar(os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Println(usoComandos)
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(args) > 0 {
+		if err := ejecutarComando(cfg, args[0], args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if cfg.ClaveSesion == config.ClaveSesionPorDefecto {
+		log.Printf("AVISO: se está usando la clave de sesión por defecto; configure %s antes de desplegar.", config.EnvClaveSesion)
+	}
+
+	almacen := db.NuevoAlmacen(cfg.RutaDB)
 	if almacen == nil {
 		log.Fatalf("No se pudo inicializar la base de datos.")
 	}
 	defer almacen.Close()
+	go limpiarCaducados(almacen, time.Hour)
 
-	viewsController := views.NewMenuController(almacen)
+	contenidos, err := archivos.NuevoAlmacenLocal(cfg.Archivos)
+	if err != nil {
+		log.Fatalf("No se pudo inicializar el almacén de archivos: %v", err)
+	}
+	servicioArchivos := archivos.NuevoServicio(contenidos, almacen)
+	imagenes, err := archivos.NuevoAlmacenLocal(cfg.Caratulas)
+	if err != nil {
+		log.Fatalf("No se pudo inicializar el almacén de carátulas: %v", err)
+	}
+	servicioCaratulas := caratulas.NuevoServicio(imagenes, almacen)
+	servicioCuentas := cuentas.NuevoServicio(almacen, nuevoMailer(cfg), cfg.URLPublica)
+
+	viewsController := views.NewMenuController(almacen, views.NuevoAlmacenSesiones(almacen, cfg.ClaveSesion), servicioArchivos, servicioCaratulas, servicioCuentas)
+	apiController := controllers.NuevoLibroController(almacen)
+	tokenController := controllers.NuevoTokenController(almacen)
+	autorController := controllers.NuevoAutorController(almacen)
+	clasificacionController := controllers.NuevoClasificacionController(almacen)
+	archivoController := controllers.NuevoArchivoController(servicioArchivos)
+	caratulaController := controllers.NuevoCaratulaController(almacen, servicioCaratulas)
+	usuarioController := controllers.NuevoUsuarioController(almacen)
+	catalogoOPDS := opds.NuevoCatalogo(almacen, servicioArchivos)
 
 	router := mux.NewRouter()
 
+	// Política de acceso: roles permitidos por nombre de ruta. Las rutas que no
+	// aparecen aquí son públicas.
+	lectores := []string{models.RolLector, models.RolAdministrador}
+	soloAdmin := []string{models.RolAdministrador}
+	politica := views.PoliticaAcceso{
+		"libros.crear":         soloAdmin,
+		"libros.crear.submit":  soloAdmin,
+		"libros.crear.epub":    soloAdmin,
+		"libros.editar":        soloAdmin,
+		"libros.editar.submit": soloAdmin,
+		"libros.eliminar":      soloAdmin,
+		"archivos.subir":       soloAdmin,
+		"archivos.descargar":   lectores,
+		"archivos.eliminar":    soloAdmin,
+		"generos.listar":       soloAdmin,
+		"generos.crear":        soloAdmin,
+		"generos.editar":       soloAdmin,
+		"generos.eliminar":     soloAdmin,
+		"etiquetas.listar":     soloAdmin,
+		"etiquetas.renombrar":  soloAdmin,
+		"etiquetas.eliminar":   soloAdmin,
+		"exportar.listar":      soloAdmin,
+		"exportar.descargar":   soloAdmin,
+		"alquileres.listar":    lectores,
+		"alquileres.alquilar":  lectores,
+		"alquileres.devolver":  lectores,
+		"sesiones.listar":      lectores,
+		"sesiones.revocar":     lectores,
+		"sesiones.revocarlas":  lectores,
+		"bloqueos.listar":      soloAdmin,
+		"bloqueos.eliminar":    soloAdmin,
+		"usuarios.listar":      soloAdmin,
+		"usuarios.rol":         soloAdmin,
+		"usuarios.sesiones":    soloAdmin,
+	}
+	router.Use(viewsController.MiddlewareAutorizacion(politica))
+	// Los formularios HTML llevan un token CSRF; la API y el catálogo OPDS se autentican
+	// con la cabecera Authorization, que otra web no puede enviar, y no lo necesitan. Los
+	// archivos estáticos y las carátulas tampoco: solo se leen y no usan la sesión.
+	router.Use(viewsController.MiddlewareCSRF("/api/", opds.RutaRaiz, "/static/", models.RutaCaratulas))
+
+	// Política de la API: se autentica con "Authorization: Bearer <token>" en lugar de la cookie
+	politicaAPI := controllers.PoliticaAPI{
+		"api.libros.crear":       soloAdmin,
+		"api.libros.editar":      soloAdmin,
+		"api.libros.eliminar":    soloAdmin,
+		"api.libros.importar":    soloAdmin,
+		"api.autores.fusionar":   soloAdmin,
+		"api.archivos.subir":     soloAdmin,
+		"api.archivos.descargar": lectores,
+		"api.archivos.eliminar":  soloAdmin,
+		"api.caratulas.subir":    soloAdmin,
+		"api.tokens.crear":       lectores,
+		"api.tokens.listar":      lectores,
+		"api.tokens.revocar":     lectores,
+		"api.usuarios.sesiones":  soloAdmin,
+	}
+
 	// Rutas de Autenticación
 	router.HandleFunc("/registro", viewsController.RegistrarUsuarioHTML).Methods("GET")
 	router.HandleFunc("/registro", viewsController.RegistrarUsuarioSubmit).Methods("POST")
 	router.HandleFunc("/login", viewsController.LoginHTML).Methods("GET")
 	router.HandleFunc("/login", viewsController.LoginSubmit).Methods("POST")
 	router.HandleFunc("/logout", viewsController.Logout).Methods("POST") // Normalmente un POST para logout
+	router.HandleFunc("/verificar", viewsController.VerificarEmail).Methods("GET")
+	router.HandleFunc("/verificar/reenviar", viewsController.ReenviarVerificacionHTML).Methods("GET")
+	router.HandleFunc("/verificar/reenviar", viewsController.ReenviarVerificacionSubmit).Methods("POST")
+	router.HandleFunc("/recuperar", viewsController.RecuperarHTML).Methods("GET")
+	router.HandleFunc("/recuperar", viewsController.RecuperarSubmit).Methods("POST")
+	router.HandleFunc("/restablecer", viewsController.RestablecerHTML).Methods("GET")
+	router.HandleFunc("/restablecer", viewsController.RestablecerSubmit).Methods("POST")
 
 	// Rutas para las vistas HTML de libros
 	router.HandleFunc("/", viewsController.Index).Methods("GET")
 	router.HandleFunc("/libros", viewsController.ListarLibrosHTML).Methods("GET")
-	router.HandleFunc("/libros/crear", viewsController.CrearLibroHTML).Methods("GET")
-	router.HandleFunc("/libros/crear", viewsController.CrearLibroHTMLSubmit).Methods("POST")
-	router.HandleFunc("/libros/{id}/editar", viewsController.EditarLibroHTML).Methods("GET")
-	router.HandleFunc("/libros/{id}/editar", viewsController.EditarLibroHTMLSubmit).Methods("POST")
-	router.HandleFunc("/libros/{id}/eliminar", viewsController.EliminarLibroHTMLSubmit).Methods("POST")
+	router.HandleFunc("/libros/crear", viewsController.CrearLibroHTML).Methods("GET").Name("libros.crear")
+	router.HandleFunc("/libros/crear", viewsController.CrearLibroHTMLSubmit).Methods("POST").Name("libros.crear.submit")
+	router.HandleFunc("/libros/crear/epub", viewsController.CrearLibroDesdeEPUBSubmit).Methods("POST").Name("libros.crear.epub")
+	router.HandleFunc("/libros/{id}/editar", viewsController.EditarLibroHTML).Methods("GET").Name("libros.editar")
+	router.HandleFunc("/libros/{id}/editar", viewsController.EditarLibroHTMLSubmit).Methods("POST").Name("libros.editar.submit")
+	router.HandleFunc("/libros/{id}/eliminar", viewsController.EliminarLibroHTMLSubmit).Methods("POST").Name("libros.eliminar")
 	router.HandleFunc("/libros/{id}/sinopsis", viewsController.VerSinopsisHTML).Methods("GET")
+	router.HandleFunc("/libros/isbn/{isbn}", viewsController.VerLibroPorISBNHTML).Methods("GET")
+	router.HandleFunc("/libros/{id}/archivos", viewsController.SubirArchivoSubmit).Methods("POST").Name("archivos.subir")
+	router.HandleFunc("/libros/{id}/archivos/{formato}", viewsController.DescargarArchivoHTML).Methods("GET").Name("archivos.descargar")
+	router.HandleFunc("/libros/{id}/archivos/{formato}/eliminar", viewsController.EliminarArchivoSubmit).Methods("POST").Name("archivos.eliminar")
+	// Después de /libros/crear, que tiene prioridad; los slugs nunca son "crear"
+	router.HandleFunc("/libros/{slug:[a-z0-9-]+}", viewsController.VerLibroHTML).Methods("GET")
+	router.HandleFunc("/autores/{slug}", viewsController.VerAutorHTML).Methods("GET")
+	router.HandleFunc(models.RutaCaratulas+"{clave}/{tamano}", viewsController.VerCaratula).Methods("GET")
+
+	// Administración de géneros y etiquetas
+	router.HandleFunc("/admin/generos", viewsController.AdminGenerosHTML).Methods("GET").Name("generos.listar")
+	router.HandleFunc("/admin/generos", viewsController.CrearGeneroSubmit).Methods("POST").Name("generos.crear")
+	router.HandleFunc("/admin/generos/{id}/editar", viewsController.EditarGeneroSubmit).Methods("POST").Name("generos.editar")
+	router.HandleFunc("/admin/generos/{id}/eliminar", viewsController.EliminarGeneroSubmit).Methods("POST").Name("generos.eliminar")
+	router.HandleFunc("/admin/etiquetas", viewsController.AdminEtiquetasHTML).Methods("GET").Name("etiquetas.listar")
+	router.HandleFunc("/admin/etiquetas/renombrar", viewsController.RenombrarEtiquetaSubmit).Methods("POST").Name("etiquetas.renombrar")
+	router.HandleFunc("/admin/etiquetas/eliminar", viewsController.EliminarEtiquetaSubmit).Methods("POST").Name("etiquetas.eliminar")
+
+	// Exportación de datos
+	router.HandleFunc("/admin/exportar", viewsController.AdminExportarHTML).Methods("GET").Name("exportar.listar")
+	router.HandleFunc("/admin/exportar/{datos}/{formato}", viewsController.ExportarDescargar).Methods("GET").Name("exportar.descargar")
+
+	// Bloqueos de inicio de sesión
+	router.HandleFunc("/admin/bloqueos", viewsController.AdminBloqueosHTML).Methods("GET").Name("bloqueos.listar")
+	router.HandleFunc("/admin/bloqueos/{id}/eliminar", viewsController.DesbloquearSubmit).Methods("POST").Name("bloqueos.eliminar")
+	router.HandleFunc("/admin/usuarios", viewsController.AdminUsuariosHTML).Methods("GET").Name("usuarios.listar")
+	router.HandleFunc("/admin/usuarios/{id:[0-9]+}/rol", viewsController.CambiarRolSubmit).Methods("POST").Name("usuarios.rol")
+	router.HandleFunc("/admin/usuarios/{id:[0-9]+}/sesiones/revocar", viewsController.CerrarSesionesUsuarioSubmit).Methods("POST").Name("usuarios.sesiones")
+
+	// Rutas de Alquileres (requieren sesión iniciada)
+	router.HandleFunc("/alquileres", viewsController.MisAlquileresHTML).Methods("GET").Name("alquileres.listar")
+	router.HandleFunc("/libros/{id}/alquilar", viewsController.AlquilarLibroSubmit).Methods("POST").Name("alquileres.alquilar")
+	router.HandleFunc("/libros/{id}/devolver", viewsController.DevolverLibroSubmit).Methods("POST").Name("alquileres.devolver")
+
+	// Sesiones abiertas del usuario
+	router.HandleFunc("/cuenta/sesiones", viewsController.MisSesionesHTML).Methods("GET").Name("sesiones.listar")
+	router.HandleFunc("/cuenta/sesiones/{id:[0-9]+}/revocar", viewsController.RevocarSesionSubmit).Methods("POST").Name("sesiones.revocar")
+	router.HandleFunc("/cuenta/sesiones/revocar", viewsController.RevocarSesionesSubmit).Methods("POST").Name("sesiones.revocarlas")
+
+	// API JSON de libros
+	api := router.PathPrefix("/api/v1").Subrouter()
+	api.Use(controllers.MiddlewareAutenticacion(almacen, politicaAPI))
+	api.HandleFunc("/libros", apiController.ObtenerLibros).Methods("GET")
+	api.HandleFunc("/libros", apiController.CrearLibro).Methods("POST").Name("api.libros.crear")
+	api.HandleFunc("/libros/facetas", clasificacionController.ObtenerFacetas).Methods("GET") // Antes de /libros/{id}
+	api.HandleFunc("/libros/importar", apiController.ImportarLibros).Methods("POST").Name("api.libros.importar")
+	api.HandleFunc("/libros/{id}", apiController.ObtenerLibroPorID).Methods("GET")
+	api.HandleFunc("/libros/slug/{slug}", apiController.ObtenerLibroPorSlug).Methods("GET")
+	api.HandleFunc("/libros/isbn/{isbn}", apiController.ObtenerLibroPorISBN).Methods("GET")
+	api.HandleFunc("/libros/{id}/archivos", archivoController.SubirArchivo).Methods("POST").Name("api.archivos.subir")
+	api.HandleFunc("/libros/{id}/archivos/{formato}", archivoController.DescargarArchivo).Methods("GET").Name("api.archivos.descargar")
+	api.HandleFunc("/libros/{id}/archivos/{formato}", archivoController.EliminarArchivo).Methods("DELETE").Name("api.archivos.eliminar")
+	api.HandleFunc("/libros/{id}/caratula", caratulaController.SubirCaratula).Methods("POST").Name("api.caratulas.subir")
+	api.HandleFunc("/generos", clasificacionController.ListarGeneros).Methods("GET")
+	api.HandleFunc("/etiquetas", clasificacionController.ListarEtiquetas).Methods("GET")
+	api.HandleFunc("/autores/{slug}", autorController.ObtenerAutor).Methods("GET")
+	api.HandleFunc("/autores/{id:[0-9]+}/fusionar", autorController.FusionarAutor).Methods("POST").Name("api.autores.fusionar")
+	api.HandleFunc("/libros/{id}", apiController.ActualizarLibro).Methods("PUT", "PATCH").Name("api.libros.editar")
+	api.HandleFunc("/libros/{id}", apiController.EliminarLibro).Methods("DELETE").Name("api.libros.eliminar")
+	api.HandleFunc("/tokens", tokenController.CrearToken).Methods("POST").Name("api.tokens.crear")
+	api.HandleFunc("/tokens", tokenController.ListarTokens).Methods("GET").Name("api.tokens.listar")
+	api.HandleFunc("/tokens/{id}", tokenController.RevocarToken).Methods("DELETE").Name("api.tokens.revocar")
+	api.HandleFunc("/usuarios/{id}/sesiones", usuarioController.RevocarSesiones).Methods("DELETE").Name("api.usuarios.sesiones")
+
+	// Catálogo OPDS para aplicaciones de lectura: todo él requiere una cuenta, con
+	// usuario y contraseña o un token de API como contraseña.
+	politicaOPDS := controllers.PoliticaAPI{
+		"opds.raiz":       lectores,
+		"opds.novedades":  lectores,
+		"opds.autores":    lectores,
+		"opds.autor":      lectores,
+		"opds.generos":    lectores,
+		"opds.genero":     lectores,
+		"opds.buscar":     lectores,
+		"opds.opensearch": lectores,
+		"opds.descargar":  lectores,
+	}
+	catalogo := router.PathPrefix(opds.RutaRaiz).Subrouter()
+	catalogo.Use(controllers.MiddlewareAutenticacionBasic(almacen, politicaOPDS, "Libros Electrónicos"))
+	catalogo.HandleFunc("", catalogoOPDS.Raiz).Methods("GET").Name("opds.raiz")
+	catalogo.HandleFunc("/novedades", catalogoOPDS.Novedades).Methods("GET").Name("opds.novedades")
+	catalogo.HandleFunc("/autores", catalogoOPDS.Autores).Methods("GET").Name("opds.autores")
+	catalogo.HandleFunc("/autores/{slug}", catalogoOPDS.Autor).Methods("GET").Name("opds.autor")
+	catalogo.HandleFunc("/generos", catalogoOPDS.Generos).Methods("GET").Name("opds.generos")
+	catalogo.HandleFunc("/generos/{slug}", catalogoOPDS.Genero).Methods("GET").Name("opds.genero")
+	catalogo.HandleFunc("/buscar", catalogoOPDS.Buscar).Methods("GET").Name("opds.buscar")
+	catalogo.HandleFunc("/opensearch.xml", catalogoOPDS.DescripcionBusqueda).Methods("GET").Name("opds.opensearch")
+	catalogo.HandleFunc("/libros/{id:[0-9]+}/{formato}", catalogoOPDS.Descargar).Methods("GET").Name("opds.descargar")
 
 	// Servir archivos estáticos (CSS, JS, imágenes)
 	router.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("./static"))))
 
-	port := ":8080"
-	log.Printf("Servidor iniciado en http://localhost%s\n", port)
-	log.Fatal(http.ListenAndServe(port, router))
+	log.Printf("Servidor iniciado en %s (entorno: %s, base de datos: %s)\n", cfg.Direccion, cfg.Entorno, cfg.RutaDB)
+	log.Fatal(http.ListenAndServe(cfg.Direccion, router))
+}
+
+// limpiarCaducados borra cada 'intervalo' las sesiones caducadas, que el almacén de
+// sesiones ya ignora, los enlaces de verificación y restablecimiento caducados, y los
+// fallos e intentos de inicio de sesión que ya no cuentan, para que no se acumulen.
+func limpiarCaducados(almacen db.LibroAlmacenamiento, intervalo time.Duration) {
+	servicioBloqueos := bloqueos.NuevoServicio(almacen)
+	for range time.Tick(intervalo) {
+		borradas, err := almacen.LimpiarSesionesCaducadas()
+		if err != nil {
+			log.Printf("Error al borrar sesiones caducadas: %v", err)
+		} else if borradas > 0 {
+			log.Printf("%d sesión(es) caducada(s) borrada(s)", borradas)
+		}
+		if _, err := almacen.LimpiarTokensUsuario(time.Now()); err != nil {
+			log.Printf("Error al borrar enlaces caducados: %v", err)
+		}
+		if err := servicioBloqueos.Limpiar(); err != nil {
+			log.Printf("Error al borrar fallos de inicio de sesión antiguos: %v", err)
+		}
+	}
+}
+
+// nuevoMailer envía los correos por SMTP si hay servidor configurado y, si no, los
+// guarda en archivos, lo que solo sirve en desarrollo.
+func nuevoMailer(cfg config.Config) correo.Mailer {
+	if cfg.SMTP != "" {
+		return correo.NuevoSMTP(cfg.SMTP, cfg.SMTPUsuario, cfg.SMTPContrasena, cfg.Remitente)
+	}
+	if cfg.EsProduccion() {
+		log.Printf("AVISO: no hay servidor SMTP; configure %s para que los correos lleguen a los usuarios.", config.EnvSMTP)
+	}
+	log.Printf("Los correos se guardan en %s en lugar de enviarse.", cfg.Correos)
+	return correo.NuevoArchivo(cfg.Correos, cfg.Remitente)
 }
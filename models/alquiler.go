@@ -0,0 +1,62 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrAlquilerNoEncontrado es un error que se devuelve cuando no existe un alquiler activo.
+var ErrAlquilerNoEncontrado = errors.New("alquiler no encontrado")
+
+// ErrLibroNoDisponible es un error que se devuelve cuando se intenta alquilar un libro ya alquilado.
+var ErrLibroNoDisponible = errors.New("libro no disponible para alquiler")
+
+// DiasAlquilerPorDefecto es la duración de un alquiler si no se indica otra.
+const DiasAlquilerPorDefecto = 14
+
+// Alquiler representa el préstamo de un libro a un usuario.
+type Alquiler struct {
+	ID               int        `json:"id"`
+	UsuarioID        int        `json:"usuario_id"`
+	LibroID          int        `json:"libro_id"`
+	FechaAlquiler    time.Time  `json:"fecha_alquiler"`
+	FechaVencimiento time.Time  `json:"fecha_vencimiento"`
+	FechaDevolucion  *time.Time `json:"fecha_devolucion,omitempty"` // nil mientras no se haya devuelto
+	Libro            *Libro     `json:"libro,omitempty"`            // Datos del libro, si se cargaron
+}
+
+// NuevoAlquiler crea un alquiler que empieza en 'desde' y vence tras 'dias' días.
+func NuevoAlquiler(usuarioID, libroID int, desde time.Time, dias int) *Alquiler {
+	return &Alquiler{
+		UsuarioID:        usuarioID,
+		LibroID:          libroID,
+		FechaAlquiler:    desde,
+		FechaVencimiento: desde.AddDate(0, 0, dias),
+	}
+}
+
+func (a *Alquiler) GetID() int {
+	return a.ID
+}
+
+func (a *Alquiler) GetUsuarioID() int {
+	return a.UsuarioID
+}
+
+func (a *Alquiler) GetLibroID() int {
+	return a.LibroID
+}
+
+func (a *Alquiler) GetLibro() *Libro {
+	return a.Libro
+}
+
+// EstaDevuelto indica si el libro ya fue devuelto.
+func (a *Alquiler) EstaDevuelto() bool {
+	return a.FechaDevolucion != nil
+}
+
+// EstaVencido indica si el alquiler sigue activo después de su fecha de vencimiento.
+func (a *Alquiler) EstaVencido() bool {
+	return !a.EstaDevuelto() && time.Now().After(a.FechaVencimiento)
+}
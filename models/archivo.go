@@ -0,0 +1,72 @@
+package models
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrArchivoNoEncontrado se devuelve cuando un libro no tiene archivo en el formato pedido.
+var ErrArchivoNoEncontrado = errors.New("archivo no encontrado")
+
+// ErrFormatoNoSoportado se devuelve al subir un archivo que no es EPUB ni PDF.
+var ErrFormatoNoSoportado = errors.New("formato de archivo no soportado: solo se admiten EPUB y PDF")
+
+// ErrArchivoDemasiadoGrande se devuelve al subir un archivo de más de TamanoMaximoArchivo.
+var ErrArchivoDemasiadoGrande = errors.New("el archivo supera el tamaño máximo")
+
+// TamanoMaximoArchivo es el tamaño máximo de un EPUB o PDF subido, en bytes.
+const TamanoMaximoArchivo = 100 << 20
+
+// Formatos de archivo de un libro.
+const (
+	FormatoEPUB = "epub"
+	FormatoPDF  = "pdf"
+)
+
+// ArchivoLibro es el archivo descargable de un libro en un formato. Un libro tiene a
+// lo sumo un archivo por formato.
+type ArchivoLibro struct {
+	LibroID  int       `json:"libro_id"`
+	Formato  string    `json:"formato"` // FormatoEPUB o FormatoPDF
+	MIME     string    `json:"mime"`
+	Tamano   int64     `json:"tamano"` // En bytes
+	SHA256   string    `json:"sha256"` // En hexadecimal; es también la clave en el almacén de archivos
+	Nombre   string    `json:"nombre"` // Nombre con que se subió
+	SubidoEn time.Time `json:"subido_en"`
+}
+
+func (a ArchivoLibro) GetFormato() string {
+	return a.Formato
+}
+
+func (a ArchivoLibro) GetNombre() string {
+	return a.Nombre
+}
+
+// GetTamanoLegible devuelve el tamaño en KB o MB, ej. "2.4 MB".
+func (a ArchivoLibro) GetTamanoLegible() string {
+	if a.Tamano < 1<<20 {
+		return fmt.Sprintf("%d KB", (a.Tamano+1023)>>10)
+	}
+	return fmt.Sprintf("%.1f MB", float64(a.Tamano)/(1<<20))
+}
+
+// mimetypeEPUB es la primera entrada de todo EPUB: un archivo "mimetype" sin comprimir
+// con este contenido, justo después de la cabecera ZIP de 30 bytes.
+var mimetypeEPUB = []byte("mimetypeapplication/epub+zip")
+
+// DetectarFormato identifica un EPUB o un PDF por sus primeros bytes (al menos 58),
+// sin fiarse de la extensión ni del Content-Type declarado. Devuelve el formato y su
+// tipo MIME, o ErrFormatoNoSoportado.
+func DetectarFormato(cabecera []byte) (formato, mime string, err error) {
+	switch {
+	case bytes.HasPrefix(cabecera, []byte("%PDF-")):
+		return FormatoPDF, "application/pdf", nil
+	case bytes.HasPrefix(cabecera, []byte("PK\x03\x04")) && len(cabecera) >= 30+len(mimetypeEPUB) &&
+		bytes.Equal(cabecera[30:30+len(mimetypeEPUB)], mimetypeEPUB):
+		return FormatoEPUB, "application/epub+zip", nil
+	}
+	return "", "", ErrFormatoNoSoportado
+}
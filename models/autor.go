@@ -0,0 +1,88 @@
+package models
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrAutorNoEncontrado es un error que se devuelve cuando un autor no se encuentra.
+var ErrAutorNoEncontrado = errors.New("autor no encontrado")
+
+// Papeles que puede tener un autor en un libro.
+const (
+	RolAutor     = "autor"
+	RolTraductor = "traductor"
+	RolEditor    = "editor"
+)
+
+// EsRolAutorValido indica si 'rol' es uno de los papeles definidos.
+func EsRolAutorValido(rol string) bool {
+	return rol == RolAutor || rol == RolTraductor || rol == RolEditor
+}
+
+// Autor es una persona que participa en uno o más libros.
+type Autor struct {
+	ID     int    `json:"id"`
+	Slug   string `json:"slug"` // Identificador para URLs, ej. "gabriel-garcia-marquez"
+	Nombre string `json:"nombre"`
+}
+
+func (a *Autor) GetID() int {
+	return a.ID
+}
+
+func (a *Autor) GetSlug() string {
+	return a.Slug
+}
+
+func (a *Autor) GetNombre() string {
+	return a.Nombre
+}
+
+// CreditoAutor es la participación de un autor en un libro. Al crear o editar un libro
+// basta con AutorID, para enlazar un autor existente, o con Nombre, para usar el autor
+// con ese nombre o crearlo si no existe.
+type CreditoAutor struct {
+	AutorID int    `json:"autor_id,omitempty"`
+	Nombre  string `json:"nombre,omitempty"`
+	Slug    string `json:"slug,omitempty"` // Lo rellena el almacén
+	Rol     string `json:"rol"`
+}
+
+func (c CreditoAutor) GetNombre() string {
+	return c.Nombre
+}
+
+func (c CreditoAutor) GetSlug() string {
+	return c.Slug
+}
+
+func (c CreditoAutor) GetRol() string {
+	return c.Rol
+}
+
+// NombresAutores une los nombres de los créditos con rol autor, en su orden. Es el texto
+// que se guarda en Libro.Autor para mostrar, ordenar y buscar.
+func NombresAutores(creditos []CreditoAutor) string {
+	var nombres []string
+	for _, c := range creditos {
+		if c.Rol == RolAutor {
+			nombres = append(nombres, c.Nombre)
+		}
+	}
+	return strings.Join(nombres, ", ")
+}
+
+// ObraAutor es un libro en el que ha participado un autor, con su papel.
+type ObraAutor struct {
+	Libro *Libro `json:"libro"`
+	Rol   string `json:"rol"`
+}
+
+func (o *ObraAutor) GetLibro() *Libro {
+	return o.Libro
+}
+
+func (o *ObraAutor) GetRol() string {
+	return o.Rol
+}
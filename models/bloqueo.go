@@ -0,0 +1,157 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrCredencialesInvalidas es un error que se devuelve cuando el usuario no existe o la
+// contraseña no es la suya; no distingue los dos casos para no revelar qué usuarios existen.
+var ErrCredencialesInvalidas = errors.New("usuario o contraseña incorrectos")
+
+// ErrDemasiadosIntentos es el error base de un inicio de sesión rechazado porque el
+// usuario o la IP están bloqueados. Se comprueba con errors.Is; el tiempo que falta
+// está en ErrorBloqueo.
+var ErrDemasiadosIntentos = errors.New("demasiados intentos fallidos de inicio de sesión")
+
+// ErrorBloqueo es el error de un inicio de sesión bloqueado, con lo que falta para poder reintentar.
+type ErrorBloqueo struct {
+	Restante time.Duration
+}
+
+func (e *ErrorBloqueo) Error() string {
+	return fmt.Sprintf("%s; reinténtalo dentro de %s", ErrDemasiadosIntentos, EsperaLegible(e.Restante))
+}
+
+func (e *ErrorBloqueo) Unwrap() error {
+	return ErrDemasiadosIntentos
+}
+
+// SegundosRestantes devuelve lo que falta para poder reintentar, en segundos completos
+// redondeando hacia arriba, como la cabecera Retry-After.
+func (e *ErrorBloqueo) SegundosRestantes() int {
+	return int((e.Restante + time.Second - 1) / time.Second)
+}
+
+// ErrBloqueoNoEncontrado es un error que se devuelve cuando un bloqueo no existe.
+var ErrBloqueoNoEncontrado = errors.New("bloqueo no encontrado")
+
+// Tipos de bloqueo de inicio de sesión.
+const (
+	BloqueoPorUsuario = "usuario"
+	BloqueoPorIP      = "ip"
+)
+
+// Motivos de un intento de inicio de sesión fallido.
+const (
+	MotivoContrasenaIncorrecta = "contraseña incorrecta"
+	MotivoUsuarioInexistente   = "usuario inexistente"
+	MotivoBloqueado            = "bloqueado"
+)
+
+// RetencionIntentosLogin es cuánto se guardan los intentos fallidos en el registro de auditoría.
+const RetencionIntentosLogin = 90 * 24 * time.Hour
+
+// PoliticaBloqueo decide cuánto se bloquea un usuario o una IP según sus fallos seguidos.
+type PoliticaBloqueo struct {
+	FallosPermitidos int           // Fallos sin bloqueo
+	EsperaInicial    time.Duration // Bloqueo tras el primer fallo de más; se dobla con cada uno
+	EsperaMaxima     time.Duration
+	Olvido           time.Duration // Sin fallos durante este tiempo, la cuenta vuelve a 0
+}
+
+// PoliticaBloqueoUsuario protege cada cuenta: tras 5 fallos, 1 minuto, 2, 4... hasta 1 hora.
+var PoliticaBloqueoUsuario = PoliticaBloqueo{
+	FallosPermitidos: 5,
+	EsperaInicial:    time.Minute,
+	EsperaMaxima:     time.Hour,
+	Olvido:           24 * time.Hour,
+}
+
+// PoliticaBloqueoIP frena a quien prueba muchas cuentas desde la misma dirección. Permite
+// más fallos que la de usuario porque varias personas pueden compartir una IP.
+var PoliticaBloqueoIP = PoliticaBloqueo{
+	FallosPermitidos: 20,
+	EsperaInicial:    time.Minute,
+	EsperaMaxima:     time.Hour,
+	Olvido:           24 * time.Hour,
+}
+
+// Espera devuelve cuánto se bloquea tras 'fallos' fallos seguidos, o 0 si aún no se bloquea.
+func (p PoliticaBloqueo) Espera(fallos int) time.Duration {
+	if fallos <= p.FallosPermitidos {
+		return 0
+	}
+	espera := p.EsperaInicial
+	for i := p.FallosPermitidos + 1; i < fallos && espera < p.EsperaMaxima; i++ {
+		espera *= 2
+	}
+	return min(espera, p.EsperaMaxima)
+}
+
+// BloqueoLogin cuenta los fallos seguidos de inicio de sesión de un usuario o una IP.
+type BloqueoLogin struct {
+	ID             int
+	Tipo           string // BloqueoPorUsuario o BloqueoPorIP
+	Clave          string // Nombre de usuario en minúsculas o dirección IP
+	Fallos         int
+	UltimoFallo    time.Time
+	BloqueadoHasta *time.Time
+}
+
+func (b *BloqueoLogin) GetID() int {
+	return b.ID
+}
+
+func (b *BloqueoLogin) GetTipo() string {
+	return b.Tipo
+}
+
+func (b *BloqueoLogin) GetClave() string {
+	return b.Clave
+}
+
+func (b *BloqueoLogin) GetFallos() int {
+	return b.Fallos
+}
+
+// EstaBloqueado indica si el bloqueo sigue vigente.
+func (b *BloqueoLogin) EstaBloqueado() bool {
+	return b.Restante(time.Now()) > 0
+}
+
+// Restante devuelve cuánto le queda al bloqueo en 'ahora', o 0 si no está bloqueado.
+func (b *BloqueoLogin) Restante(ahora time.Time) time.Duration {
+	if b.BloqueadoHasta == nil || !b.BloqueadoHasta.After(ahora) {
+		return 0
+	}
+	return b.BloqueadoHasta.Sub(ahora)
+}
+
+// IntentoLogin es un inicio de sesión fallido del registro de auditoría.
+type IntentoLogin struct {
+	ID        int
+	Username  string
+	IP        string
+	UserAgent string
+	Motivo    string // MotivoContrasenaIncorrecta, MotivoUsuarioInexistente o MotivoBloqueado
+	Fecha     time.Time
+}
+
+// EsperaLegible expresa una espera en minutos completos, redondeando hacia arriba, o en
+// segundos si es menos de un minuto, p. ej. "3 minutos".
+func EsperaLegible(d time.Duration) string {
+	segundos := int((d + time.Second - 1) / time.Second)
+	if segundos < 60 {
+		if segundos == 1 {
+			return "1 segundo"
+		}
+		return fmt.Sprintf("%d segundos", segundos)
+	}
+	minutos := (segundos + 59) / 60
+	if minutos == 1 {
+		return "1 minuto"
+	}
+	return fmt.Sprintf("%d minutos", minutos)
+}
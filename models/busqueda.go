@@ -0,0 +1,20 @@
+package models
+
+// LimiteBusquedaPorDefecto es el número de resultados que se devuelve si no se indica otro.
+const LimiteBusquedaPorDefecto = 20
+
+// OpcionesBusqueda controla qué parte de los resultados de una búsqueda se devuelve.
+type OpcionesBusqueda struct {
+	Limite         int // Máximo de resultados; 0 usa LimiteBusquedaPorDefecto
+	Desplazamiento int // Resultados a saltar desde el más relevante
+}
+
+// ResultadoBusqueda es un libro encontrado por una búsqueda de texto completo.
+type ResultadoBusqueda struct {
+	Libro      *Libro  `json:"libro"`
+	Puntuacion float64 `json:"puntuacion"` // Relevancia BM25; mayor es mejor
+	// Titulo y Fragmento son HTML ya escapado con los términos encontrados entre <mark> y
+	// </mark>: el título completo y un extracto de la columna donde más aparecen.
+	Titulo    string `json:"titulo"`
+	Fragmento string `json:"fragmento"`
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrImagenInvalida se devuelve con una carátula que no es una imagen JPEG, PNG o GIF.
+var ErrImagenInvalida = errors.New("la carátula debe ser una imagen JPEG, PNG o GIF")
+
+// ErrImagenDemasiadoGrande se devuelve con una carátula de más de TamanoMaximoCaratula
+// bytes o de dimensiones desmesuradas.
+var ErrImagenDemasiadoGrande = errors.New("la imagen de la carátula es demasiado grande")
+
+// ErrDescargaCaratula se devuelve cuando no se puede descargar una carátula de su URL.
+var ErrDescargaCaratula = errors.New("no se pudo descargar la carátula")
+
+// ErrCaratulaNoEncontrada se devuelve al pedir una carátula local que no existe.
+var ErrCaratulaNoEncontrada = errors.New("carátula no encontrada")
+
+// TamanoMaximoCaratula es el tamaño máximo de una imagen de carátula, en bytes.
+const TamanoMaximoCaratula = 10 << 20
+
+// RutaCaratulas es el prefijo de las carátulas guardadas en el servidor. Su CaratulaURL
+// es RutaCaratulas + clave + "/" + tamaño, ej. "/caratulas/ab12.../detalle".
+const RutaCaratulas = "/caratulas/"
+
+// Tamaños en que se sirven las carátulas locales.
+const (
+	CaratulaMiniatura = "miniatura" // Listado de libros
+	CaratulaDetalle   = "detalle"   // Página del libro
+)
+
+// URLCaratula devuelve la CaratulaURL de la carátula local guardada con 'clave'.
+func URLCaratula(clave string) string {
+	return RutaCaratulas + clave + "/" + CaratulaDetalle
+}
+
+// ClaveCaratula devuelve la clave de una carátula local, o "" si 'url' es externa.
+func ClaveCaratula(url string) string {
+	resto, ok := strings.CutPrefix(url, RutaCaratulas)
+	if !ok {
+		return ""
+	}
+	clave, _, _ := strings.Cut(resto, "/")
+	return clave
+}
+
+// EsCaratulaExterna indica si 'url' apunta a otro servidor.
+func EsCaratulaExterna(url string) bool {
+	return strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://")
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrGeneroNoEncontrado es un error que se devuelve cuando un género no se encuentra.
+var ErrGeneroNoEncontrado = errors.New("género no encontrado")
+
+// ErrGeneroYaExiste se devuelve al crear o renombrar un género con el slug de otro.
+var ErrGeneroYaExiste = errors.New("ya existe un género con ese nombre")
+
+// ErrEtiquetaNoEncontrada se devuelve al renombrar o eliminar una etiqueta que ningún libro tiene.
+var ErrEtiquetaNoEncontrada = errors.New("etiqueta no encontrada")
+
+// LongitudMaximaEtiqueta limita el texto de una etiqueta.
+const LongitudMaximaEtiqueta = 50
+
+// Genero es una categoría del catálogo. Los géneros forman un árbol: un libro de
+// "Novela negra" aparece también al filtrar por su padre, "Novela".
+type Genero struct {
+	ID      int    `json:"id"`
+	Slug    string `json:"slug"` // Se usa en ?genero= y en LibroPatch.Generos
+	Nombre  string `json:"nombre"`
+	PadreID int    `json:"padre_id,omitempty"` // 0 en los géneros raíz
+	Nivel   int    `json:"nivel,omitempty"`    // Profundidad en ListarGeneros; 0 en los géneros raíz
+}
+
+func (g *Genero) GetID() int {
+	return g.ID
+}
+
+func (g *Genero) GetSlug() string {
+	return g.Slug
+}
+
+func (g *Genero) GetNombre() string {
+	return g.Nombre
+}
+
+func (g *Genero) GetPadreID() int {
+	return g.PadreID
+}
+
+func (g *Genero) GetNivel() int {
+	return g.Nivel
+}
+
+// Etiqueta es una etiqueta libre con el número de libros que la tienen.
+type Etiqueta struct {
+	Nombre   string `json:"nombre"`
+	Cantidad int    `json:"cantidad"`
+}
+
+func (e *Etiqueta) GetNombre() string {
+	return e.Nombre
+}
+
+func (e *Etiqueta) GetCantidad() int {
+	return e.Cantidad
+}
+
+// NormalizarEtiqueta pasa una etiqueta a minúsculas y une los espacios, de modo que
+// "Ciencia  Ficción" y "ciencia ficción" sean la misma. Devuelve "" si no queda texto.
+func NormalizarEtiqueta(etiqueta string) string {
+	return strings.Join(strings.Fields(strings.ToLower(etiqueta)), " ")
+}
+
+// GenerarSlugGenero es GenerarSlug para el nombre de un género, con "genero" como prefijo.
+func GenerarSlugGenero(nombre string) string {
+	return generarSlug(nombre, "genero")
+}
+
+// FacetaGenero es un género con el número de libros del listado actual que tiene él o
+// alguno de sus descendientes.
+type FacetaGenero struct {
+	Genero
+	Cantidad int `json:"cantidad"`
+}
+
+func (f *FacetaGenero) GetCantidad() int {
+	return f.Cantidad
+}
+
+// FacetasLibros cuenta, para los libros que cumplen los filtros de una consulta,
+// cuántos hay de cada género y con cada etiqueta. Solo aparecen los valores con algún libro.
+type FacetasLibros struct {
+	Generos   []*FacetaGenero `json:"generos"`   // En el orden del árbol, como ListarGeneros
+	Etiquetas []*Etiqueta     `json:"etiquetas"` // De la más usada a la menos
+}
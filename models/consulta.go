@@ -0,0 +1,174 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ErrConsultaInvalida es un error que se devuelve cuando los parámetros de un listado no son válidos.
+var ErrConsultaInvalida = errors.New("consulta inválida")
+
+// Límites del tamaño de página de los listados.
+const (
+	LimitePorDefecto = 20
+	LimiteMaximo     = 100
+)
+
+// Campos por los que se puede ordenar un listado de libros.
+const (
+	OrdenID     = "id"
+	OrdenTitulo = "titulo"
+	OrdenAutor  = "autor"
+	OrdenAnio   = "anio"
+)
+
+// Direcciones de ordenación.
+const (
+	DireccionAsc  = "asc"
+	DireccionDesc = "desc"
+)
+
+// ConsultaLibros describe qué página de libros se pide, en qué orden y con qué filtros.
+// El valor cero lista la primera página ordenada por ID.
+type ConsultaLibros struct {
+	Limite    int    // Libros por página; 0 usa LimitePorDefecto
+	Cursor    string // Cursor opaco devuelto en PaginaLibros; vacío pide la primera página
+	Orden     string // Uno de OrdenID, OrdenTitulo, OrdenAutor u OrdenAnio
+	Direccion string // DireccionAsc o DireccionDesc
+
+	// Filtros; los valores cero no filtran
+	Autor      string // Parte del nombre del autor, sin distinguir mayúsculas
+	AnioDesde  int
+	AnioHasta  int
+	Disponible *bool
+	Genero     string   // Slug del género; incluye los libros de sus subgéneros
+	Etiquetas  []string // Los libros deben tener todas, ya normalizadas
+}
+
+// PaginaLibros es el resultado de un listado paginado.
+type PaginaLibros struct {
+	Libros          []*Libro
+	Total           int    // Libros que cumplen los filtros, en todas las páginas
+	CursorSiguiente string // Vacío si esta es la última página
+	CursorAnterior  string // Vacío si esta es la primera página
+}
+
+// Normalizar aplica los valores por defecto y comprueba que la consulta sea válida.
+func (c *ConsultaLibros) Normalizar() error {
+	if c.Limite == 0 {
+		c.Limite = LimitePorDefecto
+	}
+	if c.Orden == "" {
+		c.Orden = OrdenID
+	}
+	if c.Direccion == "" {
+		c.Direccion = DireccionAsc
+	}
+
+	switch {
+	case c.Limite < 0 || c.Limite > LimiteMaximo:
+		return fmt.Errorf("%w: el límite debe estar entre 1 y %d", ErrConsultaInvalida, LimiteMaximo)
+	case c.Orden != OrdenID && c.Orden != OrdenTitulo && c.Orden != OrdenAutor && c.Orden != OrdenAnio:
+		return fmt.Errorf("%w: no se puede ordenar por %q", ErrConsultaInvalida, c.Orden)
+	case c.Direccion != DireccionAsc && c.Direccion != DireccionDesc:
+		return fmt.Errorf("%w: dirección %q desconocida (use %q o %q)", ErrConsultaInvalida, c.Direccion, DireccionAsc, DireccionDesc)
+	case c.AnioDesde != 0 && c.AnioHasta != 0 && c.AnioDesde > c.AnioHasta:
+		return fmt.Errorf("%w: anio_desde es posterior a anio_hasta", ErrConsultaInvalida)
+	}
+	return nil
+}
+
+// ParsearConsultaLibros lee una ConsultaLibros de los parámetros de una URL:
+// limite, cursor, orden, direccion, autor, anio_desde, anio_hasta, disponible, genero
+// y tag, que se puede repetir.
+func ParsearConsultaLibros(valores url.Values) (ConsultaLibros, error) {
+	c := ConsultaLibros{
+		Cursor:    valores.Get("cursor"),
+		Orden:     valores.Get("orden"),
+		Direccion: strings.ToLower(valores.Get("direccion")),
+		Autor:     strings.TrimSpace(valores.Get("autor")),
+		Genero:    valores.Get("genero"),
+	}
+	for _, etiqueta := range valores["tag"] {
+		if etiqueta = NormalizarEtiqueta(etiqueta); etiqueta != "" {
+			c.Etiquetas = append(c.Etiquetas, etiqueta)
+		}
+	}
+
+	enteros := []struct {
+		nombre  string
+		destino *int
+	}{
+		{"limite", &c.Limite},
+		{"anio_desde", &c.AnioDesde},
+		{"anio_hasta", &c.AnioHasta},
+	}
+	for _, e := range enteros {
+		if v := valores.Get(e.nombre); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return ConsultaLibros{}, fmt.Errorf("%w: %s debe ser un número", ErrConsultaInvalida, e.nombre)
+			}
+			*e.destino = n
+		}
+	}
+
+	if v := valores.Get("disponible"); v != "" {
+		disponible, err := strconv.ParseBool(v)
+		if err != nil {
+			return ConsultaLibros{}, fmt.Errorf("%w: disponible debe ser true o false", ErrConsultaInvalida)
+		}
+		c.Disponible = &disponible
+	}
+
+	if err := c.Normalizar(); err != nil {
+		return ConsultaLibros{}, err
+	}
+	return c, nil
+}
+
+// Valores es la inversa de ParsearConsultaLibros: devuelve los parámetros de URL que
+// reproducen la consulta, omitiendo los que tienen su valor por defecto.
+func (c ConsultaLibros) Valores() url.Values {
+	valores := url.Values{}
+	if c.Limite != 0 && c.Limite != LimitePorDefecto {
+		valores.Set("limite", strconv.Itoa(c.Limite))
+	}
+	if c.Cursor != "" {
+		valores.Set("cursor", c.Cursor)
+	}
+	if c.Orden != "" && c.Orden != OrdenID {
+		valores.Set("orden", c.Orden)
+	}
+	if c.Direccion != "" && c.Direccion != DireccionAsc {
+		valores.Set("direccion", c.Direccion)
+	}
+	if c.Autor != "" {
+		valores.Set("autor", c.Autor)
+	}
+	if c.AnioDesde != 0 {
+		valores.Set("anio_desde", strconv.Itoa(c.AnioDesde))
+	}
+	if c.AnioHasta != 0 {
+		valores.Set("anio_hasta", strconv.Itoa(c.AnioHasta))
+	}
+	if c.Disponible != nil {
+		valores.Set("disponible", strconv.FormatBool(*c.Disponible))
+	}
+	if c.Genero != "" {
+		valores.Set("genero", c.Genero)
+	}
+	for _, etiqueta := range c.Etiquetas {
+		valores.Add("tag", etiqueta)
+	}
+	return valores
+}
+
+// ConCursor devuelve una copia de la consulta que pide la página del cursor indicado.
+func (c ConsultaLibros) ConCursor(cursor string) ConsultaLibros {
+	c.Cursor = cursor
+	return c
+}
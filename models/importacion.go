@@ -0,0 +1,35 @@
+package models
+
+// Formatos de archivo que acepta la importación de libros.
+const (
+	FormatoCSV   = "csv"   // Primera fila con los nombres de los campos
+	FormatoJSONL = "jsonl" // Un objeto JSON por línea, como el de POST /api/v1/libros
+)
+
+// FilaImportacion es un libro ya leído y validado de un archivo de importación.
+type FilaImportacion struct {
+	Numero int // Línea del archivo en que empieza la fila
+	Libro  *Libro
+}
+
+// ErrorFila explica por qué no se puede importar una fila.
+type ErrorFila struct {
+	Fila      int               `json:"fila"`
+	Campos    ErroresValidacion `json:"campos,omitempty"`    // Campos inválidos u obligatorios que faltan
+	Duplicado string            `json:"duplicado,omitempty"` // Con qué libro o fila coincide
+}
+
+// InformeImportacion es el resultado de una importación. Si hay errores no se importa
+// ningún libro, y en una simulación tampoco aunque no los haya.
+type InformeImportacion struct {
+	Simulacion bool        `json:"simulacion"`
+	Filas      int         `json:"filas"`      // Filas leídas del archivo
+	Validas    int         `json:"validas"`    // Filas sin errores
+	Importados int         `json:"importados"` // Libros guardados: 0 si hay errores o es una simulación
+	Errores    []ErrorFila `json:"errores"`
+}
+
+// Correcto indica si todas las filas se pueden importar.
+func (i *InformeImportacion) Correcto() bool {
+	return len(i.Errores) == 0
+}
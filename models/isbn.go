@@ -0,0 +1,102 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrISBNInvalido se devuelve cuando un ISBN no tiene 10 o 13 dígitos o su dígito de
+// control no coincide.
+var ErrISBNInvalido = errors.New("ISBN inválido")
+
+// ErrISBNDuplicado se devuelve al guardar un ISBN que ya tiene otro libro.
+var ErrISBNDuplicado = errors.New("ya existe un libro con ese ISBN")
+
+// NormalizarISBN acepta un ISBN-10 o ISBN-13, con o sin guiones o espacios, y lo
+// devuelve como ISBN-13 sin separadores, que es la forma en que se guarda y se compara.
+// Así "84-376-0494-X" y "978-84-376-0494-7" son el mismo libro.
+func NormalizarISBN(valor string) (string, error) {
+	var b strings.Builder
+	for _, r := range valor {
+		switch {
+		case r == '-' || r == ' ':
+			// Separadores habituales, no forman parte del ISBN
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == 'X' || r == 'x':
+			b.WriteByte('X')
+		default:
+			return "", fmt.Errorf("%w: carácter %q no permitido", ErrISBNInvalido, r)
+		}
+	}
+	digitos := b.String()
+
+	switch len(digitos) {
+	case 10:
+		if !esISBN10Valido(digitos) {
+			return "", fmt.Errorf("%w: el dígito de control no coincide", ErrISBNInvalido)
+		}
+		base := "978" + digitos[:9]
+		return base + string(controlISBN13(base)), nil
+	case 13:
+		if strings.ContainsRune(digitos, 'X') || controlISBN13(digitos[:12]) != digitos[12] {
+			return "", fmt.Errorf("%w: el dígito de control no coincide", ErrISBNInvalido)
+		}
+		if !strings.HasPrefix(digitos, "978") && !strings.HasPrefix(digitos, "979") {
+			return "", fmt.Errorf("%w: un ISBN-13 empieza por 978 o 979", ErrISBNInvalido)
+		}
+		return digitos, nil
+	}
+	return "", fmt.Errorf("%w: debe tener 10 o 13 dígitos", ErrISBNInvalido)
+}
+
+// ISBN10 devuelve la forma ISBN-10 de un ISBN-13 normalizado, o "" si no la tiene
+// (los que empiezan por 979 solo existen como ISBN-13).
+func ISBN10(isbn13 string) string {
+	if len(isbn13) != 13 || !strings.HasPrefix(isbn13, "978") {
+		return ""
+	}
+	base := isbn13[3:12]
+	suma := 0
+	for i := 0; i < 9; i++ {
+		suma += (10 - i) * int(base[i]-'0')
+	}
+	control := (11 - suma%11) % 11
+	if control == 10 {
+		return base + "X"
+	}
+	return base + string(rune('0'+control))
+}
+
+// esISBN10Valido comprueba la suma ponderada módulo 11; solo el último carácter puede ser X (10).
+func esISBN10Valido(digitos string) bool {
+	suma := 0
+	for i := 0; i < 10; i++ {
+		var valor int
+		switch c := digitos[i]; {
+		case c >= '0' && c <= '9':
+			valor = int(c - '0')
+		case c == 'X' && i == 9:
+			valor = 10
+		default:
+			return false
+		}
+		suma += (10 - i) * valor
+	}
+	return suma%11 == 0
+}
+
+// controlISBN13 calcula el dígito de control de los 12 primeros dígitos de un ISBN-13,
+// con pesos alternos 1 y 3.
+func controlISBN13(digitos string) byte {
+	suma := 0
+	for i := 0; i < 12; i++ {
+		valor := int(digitos[i] - '0')
+		if i%2 == 1 {
+			valor *= 3
+		}
+		suma += valor
+	}
+	return byte('0' + (10-suma%10)%10)
+}
@@ -5,26 +5,34 @@ import "errors"
 // ErrLibroNoEncontrado es un error que se devuelve cuando un libro no se encuentra.
 var ErrLibroNoEncontrado = errors.New("libro no encontrado")
 
-// ErrLibroYaExiste es un error que se devuelve cuando un libro con el mismo ID ya existe.
-var ErrLibroYaExiste = errors.New("libro ya existe")
-
 // Libro representa la estructura de un libro en la aplicación.
 type Libro struct {
-	ID          int    `json:"id"`
+	ID          int    `json:"id"`   // Lo asigna el almacén al guardar el libro
+	Slug        string `json:"slug"` // Identificador legible y único para URLs, ej. "cien-anos-de-soledad"
 	Titulo      string `json:"titulo"`
-	Autor       string `json:"autor"`
+	Autor       string `json:"autor"` // Nombres de los autores con rol autor, separados por comas
 	Anio        int    `json:"anio"`
+	ISBN        string `json:"isbn"`   // ISBN-13 normalizado, o "" si no se conoce
+	Idioma      string `json:"idioma"` // Etiqueta BCP 47, ej. "es" o "en-US"; "" si no se conoce
+	Editorial   string `json:"editorial"`
 	CaratulaURL string `json:"caratula_url"` // URL a la imagen de la carátula
 	Sinopsis    string `json:"sinopsis"`     // ¡NUEVO CAMPO PARA LA SINOPSIS!
+	Disponible  bool   `json:"disponible"`   // false mientras el libro tiene un alquiler activo
+
+	Autores   []CreditoAutor `json:"autores,omitempty"`   // Autores, traductores y editores, si se cargaron
+	Generos   []Genero       `json:"generos,omitempty"`   // Si se cargaron
+	Etiquetas []string       `json:"etiquetas,omitempty"` // Normalizadas con NormalizarEtiqueta
+	Archivos  []ArchivoLibro `json:"archivos,omitempty"`  // EPUB y PDF descargables, si se cargaron
 }
 
 // NuevoLibro crea una nueva instancia de Libro.
 func NuevoLibro(id int, titulo, autor string, anio int) *Libro {
 	return &Libro{
-		ID:     id,
-		Titulo: titulo,
-		Autor:  autor,
-		Anio:   anio,
+		ID:         id,
+		Titulo:     titulo,
+		Autor:      autor,
+		Anio:       anio,
+		Disponible: true,
 	}
 }
 
@@ -36,6 +44,7 @@ func NuevoLibroConCaratula(id int, titulo, autor string, anio int, caratulaURL s
 		Autor:       autor,
 		Anio:        anio,
 		CaratulaURL: caratulaURL,
+		Disponible:  true,
 	}
 }
 
@@ -48,6 +57,7 @@ func NuevoLibroCompleto(id int, titulo, autor string, anio int, caratulaURL, sin
 		Anio:        anio,
 		CaratulaURL: caratulaURL,
 		Sinopsis:    sinopsis, // Incluir la sinopsis
+		Disponible:  true,
 	}
 }
 
@@ -56,6 +66,10 @@ func (l *Libro) GetID() int {
 	return l.ID
 }
 
+func (l *Libro) GetSlug() string {
+	return l.Slug
+}
+
 func (l *Libro) GetTitulo() string {
 	return l.Titulo
 }
@@ -64,14 +78,69 @@ func (l *Libro) GetAutor() string {
 	return l.Autor
 }
 
+// GetAutores devuelve los créditos del libro en su orden.
+func (l *Libro) GetAutores() []CreditoAutor {
+	return l.Autores
+}
+
+func (l *Libro) GetGeneros() []Genero {
+	return l.Generos
+}
+
+func (l *Libro) GetEtiquetas() []string {
+	return l.Etiquetas
+}
+
+func (l *Libro) GetArchivos() []ArchivoLibro {
+	return l.Archivos
+}
+
 func (l *Libro) GetAnio() int {
 	return l.Anio
 }
 
+func (l *Libro) GetISBN() string {
+	return l.ISBN
+}
+
+// GetISBN10 devuelve el ISBN en su forma de 10 dígitos, si la tiene.
+func (l *Libro) GetISBN10() string {
+	return ISBN10(l.ISBN)
+}
+
+func (l *Libro) GetIdioma() string {
+	return l.Idioma
+}
+
+func (l *Libro) GetEditorial() string {
+	return l.Editorial
+}
+
 func (l *Libro) GetCaratulaURL() string {
 	return l.CaratulaURL
 }
 
+// GetCaratulaMiniatura devuelve la carátula en tamaño de listado si está guardada en
+// el servidor, o la URL tal cual si es externa.
+func (l *Libro) GetCaratulaMiniatura() string {
+	if clave := ClaveCaratula(l.CaratulaURL); clave != "" {
+		return RutaCaratulas + clave + "/" + CaratulaMiniatura
+	}
+	return l.CaratulaURL
+}
+
 func (l *Libro) GetSinopsis() string { // ¡NUEVO GETTER!
 	return l.Sinopsis
 }
+
+func (l *Libro) EstaDisponible() bool {
+	return l.Disponible
+}
+
+// GetEstado devuelve el estado del libro tal como se muestra en las vistas.
+func (l *Libro) GetEstado() string {
+	if l.Disponible {
+		return "Disponible"
+	}
+	return "Alquilado"
+}
@@ -0,0 +1,293 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrValidacion es el error base de los datos que no superan la validación.
+// Se comprueba con errors.Is; los detalles por campo están en ErroresValidacion.
+var ErrValidacion = errors.New("datos inválidos")
+
+// AnioMinimo es el año más antiguo que se acepta para un libro.
+const AnioMinimo = -3000
+
+// ErroresValidacion asocia cada campo inválido con el motivo.
+type ErroresValidacion map[string]string
+
+func (e ErroresValidacion) Error() string {
+	campos := make([]string, 0, len(e))
+	for campo := range e {
+		campos = append(campos, campo)
+	}
+	sort.Strings(campos)
+
+	detalles := make([]string, len(campos))
+	for i, campo := range campos {
+		detalles[i] = campo + ": " + e[campo]
+	}
+	return ErrValidacion.Error() + ": " + strings.Join(detalles, "; ")
+}
+
+func (e ErroresValidacion) Unwrap() error {
+	return ErrValidacion
+}
+
+// agregar añade los campos de 'err', si es un ErroresValidacion, sin sobrescribir
+// el motivo que ya tuviera un campo.
+func (e ErroresValidacion) agregar(err error) {
+	var otros ErroresValidacion
+	if errors.As(err, &otros) {
+		for campo, motivo := range otros {
+			if _, ok := e[campo]; !ok {
+				e[campo] = motivo
+			}
+		}
+	}
+}
+
+// LibroPatch es una actualización parcial de un libro. Los campos nil no se modifican.
+// Solo estos campos se pueden cambiar; el ID y la disponibilidad no son editables.
+type LibroPatch struct {
+	Titulo      *string `json:"titulo,omitempty"`
+	Autor       *string `json:"autor,omitempty"` // Reemplaza los autores con rol autor por este
+	Anio        *int    `json:"anio,omitempty"`
+	ISBN        *string `json:"isbn,omitempty"` // ISBN-10 o ISBN-13; "" lo elimina
+	Idioma      *string `json:"idioma,omitempty"`
+	Editorial   *string `json:"editorial,omitempty"`
+	CaratulaURL *string `json:"caratula_url,omitempty"`
+	Sinopsis    *string `json:"sinopsis,omitempty"`
+
+	Autores   *[]CreditoAutor `json:"autores,omitempty"`   // Reemplaza todos los créditos
+	Generos   *[]string       `json:"generos,omitempty"`   // Slugs; reemplaza todos los géneros
+	Etiquetas *[]string       `json:"etiquetas,omitempty"` // Reemplaza todas las etiquetas
+}
+
+// EstaVacio indica si el patch no modifica ningún campo.
+func (p LibroPatch) EstaVacio() bool {
+	return p.Titulo == nil && p.Autor == nil && p.Anio == nil && p.ISBN == nil && p.Idioma == nil && p.Editorial == nil && p.CaratulaURL == nil && p.Sinopsis == nil && p.Autores == nil &&
+		p.Generos == nil && p.Etiquetas == nil
+}
+
+// Validar comprueba cada campo presente y devuelve ErroresValidacion con todos los
+// inválidos, o nil si el patch es válido.
+func (p LibroPatch) Validar() error {
+	errs := ErroresValidacion{}
+	if p.Titulo != nil && strings.TrimSpace(*p.Titulo) == "" {
+		errs["titulo"] = "no puede estar vacío"
+	}
+	if p.Autor != nil && strings.TrimSpace(*p.Autor) == "" {
+		errs["autor"] = "no puede estar vacío"
+	}
+	if p.Autor != nil && p.Autores != nil {
+		errs["autores"] = "no se puede indicar junto con autor"
+	} else if p.Autores != nil {
+		validarCreditos(*p.Autores, errs)
+	}
+	if p.Anio != nil {
+		if maximo := time.Now().Year() + 1; *p.Anio < AnioMinimo || *p.Anio > maximo {
+			errs["anio"] = fmt.Sprintf("debe estar entre %d y %d", AnioMinimo, maximo)
+		}
+	}
+	if p.Generos != nil && slices.Contains(*p.Generos, "") {
+		errs["generos"] = "los slugs no pueden estar vacíos"
+	}
+	if p.Etiquetas != nil {
+		for _, etiqueta := range *p.Etiquetas {
+			if n := utf8.RuneCountInString(NormalizarEtiqueta(etiqueta)); n == 0 || n > LongitudMaximaEtiqueta {
+				errs["etiquetas"] = fmt.Sprintf("cada etiqueta debe tener entre 1 y %d caracteres", LongitudMaximaEtiqueta)
+			}
+		}
+	}
+	if p.ISBN != nil && *p.ISBN != "" {
+		if _, err := NormalizarISBN(*p.ISBN); err != nil {
+			errs["isbn"] = "no es un ISBN-10 o ISBN-13 válido"
+		}
+	}
+	if p.Idioma != nil && *p.Idioma != "" && !EsEtiquetaIdioma(*p.Idioma) {
+		errs["idioma"] = "debe ser una etiqueta de idioma como es o en-US"
+	}
+	if p.CaratulaURL != nil && *p.CaratulaURL != "" && !esURLCaratula(*p.CaratulaURL) {
+		errs["caratula_url"] = "debe ser una URL http(s) o una ruta que empiece por /"
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// validarCreditos añade a 'errs' los créditos inválidos. Un libro necesita al menos un
+// autor con rol autor.
+func validarCreditos(creditos []CreditoAutor, errs ErroresValidacion) {
+	hayAutor := false
+	for i, c := range creditos {
+		campo := fmt.Sprintf("autores[%d]", i)
+		switch {
+		case !EsRolAutorValido(c.Rol):
+			errs[campo+".rol"] = "debe ser autor, traductor o editor"
+		case c.AutorID <= 0 && strings.TrimSpace(c.Nombre) == "":
+			errs[campo] = "debe indicar autor_id o nombre"
+		}
+		hayAutor = hayAutor || c.Rol == RolAutor
+	}
+	if !hayAutor {
+		errs["autores"] = "debe incluir al menos un autor con rol autor"
+	}
+}
+
+var etiquetaIdioma = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{1,8})*$`)
+
+// EsEtiquetaIdioma comprueba la forma de una etiqueta de idioma BCP 47: un código de
+// dos o tres letras seguido de subetiquetas de hasta ocho letras o cifras, como "es",
+// "pt-BR" o "zh-Hant-TW". No comprueba que los códigos estén registrados.
+func EsEtiquetaIdioma(valor string) bool {
+	return etiquetaIdioma.MatchString(valor)
+}
+
+// esURLCaratula acepta URLs absolutas http(s) y rutas locales como /static/caratula.jpg.
+func esURLCaratula(valor string) bool {
+	u, err := url.Parse(valor)
+	if err != nil {
+		return false
+	}
+	if u.Scheme == "" {
+		return u.Host == "" && strings.HasPrefix(u.Path, "/") && !strings.HasPrefix(valor, "//")
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// LibroPatchDesdeJSON construye un LibroPatch a partir de un objeto JSON ya separado
+// en campos. A diferencia de json.Unmarshal, no se detiene en el primer problema:
+// devuelve ErroresValidacion con todos los campos desconocidos, de tipo incorrecto o
+// que no superan Validar.
+func LibroPatchDesdeJSON(campos map[string]json.RawMessage) (LibroPatch, error) {
+	var patch LibroPatch
+	destinos := map[string]interface{}{
+		"titulo":       &patch.Titulo,
+		"autor":        &patch.Autor,
+		"anio":         &patch.Anio,
+		"isbn":         &patch.ISBN,
+		"idioma":       &patch.Idioma,
+		"editorial":    &patch.Editorial,
+		"caratula_url": &patch.CaratulaURL,
+		"sinopsis":     &patch.Sinopsis,
+		"autores":      &patch.Autores,
+		"generos":      &patch.Generos,
+		"etiquetas":    &patch.Etiquetas,
+	}
+
+	errs := ErroresValidacion{}
+	for nombre, valor := range campos {
+		destino, ok := destinos[nombre]
+		switch {
+		case !ok:
+			errs[nombre] = "campo desconocido"
+		case string(valor) == "null":
+			errs[nombre] = "no puede ser null"
+		case json.Unmarshal(valor, destino) != nil:
+			errs[nombre] = "tipo inválido"
+		}
+	}
+
+	errs.agregar(patch.Validar())
+
+	if len(errs) > 0 {
+		return LibroPatch{}, errs
+	}
+	return patch, nil
+}
+
+// Aplicar copia en 'libro' los campos presentes en el patch.
+func (p LibroPatch) Aplicar(libro *Libro) {
+	if p.Titulo != nil {
+		libro.Titulo = *p.Titulo
+	}
+	if p.Autor != nil {
+		libro.Autor = *p.Autor
+	}
+	if p.Anio != nil {
+		libro.Anio = *p.Anio
+	}
+	if p.ISBN != nil {
+		libro.ISBN = *p.ISBN
+	}
+	if p.Idioma != nil {
+		libro.Idioma = *p.Idioma
+	}
+	if p.Editorial != nil {
+		libro.Editorial = *p.Editorial
+	}
+	if p.CaratulaURL != nil {
+		libro.CaratulaURL = *p.CaratulaURL
+	}
+	if p.Sinopsis != nil {
+		libro.Sinopsis = *p.Sinopsis
+	}
+	if p.Autores != nil {
+		libro.Autores = *p.Autores
+		libro.Autor = NombresAutores(libro.Autores)
+	}
+	if p.Generos != nil {
+		libro.Generos = make([]Genero, len(*p.Generos))
+		for i, slug := range *p.Generos {
+			libro.Generos[i] = Genero{Slug: slug}
+		}
+	}
+	if p.Etiquetas != nil {
+		libro.Etiquetas = make([]string, len(*p.Etiquetas))
+		for i, etiqueta := range *p.Etiquetas {
+			libro.Etiquetas[i] = NormalizarEtiqueta(etiqueta)
+		}
+	}
+}
+
+// NuevoLibroDesdePatch crea un libro nuevo, sin ID, con los campos del patch. El
+// título, el autor (o la lista de autores) y el año son obligatorios.
+func NuevoLibroDesdePatch(p LibroPatch) (*Libro, error) {
+	errs := ErroresValidacion{}
+	errs.agregar(p.Validar())
+	if p.Titulo == nil {
+		errs["titulo"] = "es obligatorio"
+	}
+	if p.Autor == nil && p.Autores == nil {
+		errs["autor"] = "es obligatorio"
+	}
+	if p.Anio == nil {
+		errs["anio"] = "es obligatorio"
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	libro := &Libro{Disponible: true}
+	p.Aplicar(libro)
+	return libro, nil
+}
+
+// LibroDesdeJSON es NuevoLibroDesdePatch para un objeto JSON ya separado en campos:
+// devuelve a la vez los campos inválidos y los obligatorios que faltan.
+func LibroDesdeJSON(campos map[string]json.RawMessage) (*Libro, error) {
+	patch, err := LibroPatchDesdeJSON(campos)
+	if err == nil {
+		return NuevoLibroDesdePatch(patch)
+	}
+
+	errs := ErroresValidacion{}
+	errs.agregar(err)
+	_, hayAutores := campos["autores"] // Los autores pueden venir en la lista en lugar de en "autor"
+	for _, campo := range []string{"titulo", "autor", "anio"} {
+		if _, ok := campos[campo]; !ok && !(campo == "autor" && hayAutores) {
+			errs[campo] = "es obligatorio"
+		}
+	}
+	return nil, errs
+}
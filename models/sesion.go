@@ -0,0 +1,38 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrSesionNoEncontrada es un error que se devuelve cuando una sesión no existe, caducó o fue revocada.
+var ErrSesionNoEncontrada = errors.New("sesión no encontrada")
+
+// Sesion es una sesión de navegador guardada en el servidor. La cookie solo lleva su
+// identificador; revocarla es borrarla, y la cookie deja de valer en la siguiente petición.
+type Sesion struct {
+	ID           int
+	Hash         string // SHA-256 del identificador de la cookie
+	UsuarioID    int    // 0 si aún no se ha iniciado sesión
+	Datos        []byte // Valores de la sesión codificados
+	UserAgent    string
+	CreadaEn     time.Time
+	UltimoAcceso time.Time
+	ExpiraEn     time.Time
+}
+
+func (s *Sesion) GetID() int {
+	return s.ID
+}
+
+func (s *Sesion) GetUserAgent() string {
+	return s.UserAgent
+}
+
+func (s *Sesion) GetCreadaEn() time.Time {
+	return s.CreadaEn
+}
+
+func (s *Sesion) GetUltimoAcceso() time.Time {
+	return s.UltimoAcceso
+}
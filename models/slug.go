@@ -0,0 +1,67 @@
+package models
+
+import (
+	"strings"
+	"unicode"
+)
+
+// longitudMaximaSlug limita el slug para que las URLs sigan siendo legibles.
+const longitudMaximaSlug = 80
+
+// slugsReservados son segmentos de /libros/... y /autores/... que ya usa una ruta fija.
+var slugsReservados = map[string]bool{"crear": true}
+
+// sinTildes traduce las letras latinas acentuadas más comunes a su forma ASCII.
+var sinTildes = strings.NewReplacer(
+	"á", "a", "à", "a", "ä", "a", "â", "a", "ã", "a", "å", "a",
+	"é", "e", "è", "e", "ë", "e", "ê", "e",
+	"í", "i", "ì", "i", "ï", "i", "î", "i",
+	"ó", "o", "ò", "o", "ö", "o", "ô", "o", "õ", "o", "ø", "o",
+	"ú", "u", "ù", "u", "ü", "u", "û", "u",
+	"ñ", "n", "ç", "c", "ß", "ss", "æ", "ae", "œ", "oe",
+)
+
+// GenerarSlug convierte un título en un identificador legible para URLs, como
+// "cien-anos-de-soledad". Nunca devuelve un slug vacío, solo numérico (se confundiría
+// con un ID) ni reservado: en esos casos usa "libro" o antepone "libro-". No garantiza
+// que sea único; de eso se encarga el almacén.
+func GenerarSlug(titulo string) string {
+	return generarSlug(titulo, "libro")
+}
+
+// GenerarSlugAutor es GenerarSlug para el nombre de un autor, con "autor" como prefijo.
+// Dos nombres que solo difieren en mayúsculas, tildes o puntuación dan el mismo slug, y
+// el almacén los trata como el mismo autor.
+func GenerarSlugAutor(nombre string) string {
+	return generarSlug(nombre, "autor")
+}
+
+func generarSlug(texto, prefijo string) string {
+	texto = sinTildes.Replace(strings.ToLower(texto))
+
+	var b strings.Builder
+	guion := false
+	for _, r := range texto {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			if guion && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			guion = false
+		} else {
+			guion = true
+		}
+		if b.Len() >= longitudMaximaSlug {
+			break
+		}
+	}
+	slug := strings.TrimRight(b.String(), "-")
+
+	switch {
+	case slug == "":
+		return prefijo
+	case slugsReservados[slug] || strings.Trim(slug, "0123456789") == "":
+		return prefijo + "-" + slug
+	}
+	return slug
+}
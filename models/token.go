@@ -0,0 +1,72 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// ErrTokenNoEncontrado es un error que se devuelve cuando un token no existe o fue revocado.
+var ErrTokenNoEncontrado = errors.New("token no encontrado")
+
+// TokenAPI es una credencial para usar la API JSON sin sesión de navegador.
+// Solo se guarda el hash del token; el valor en claro se muestra una única vez al crearlo.
+type TokenAPI struct {
+	ID         int        `json:"id"`
+	UsuarioID  int        `json:"usuario_id"`
+	Nombre     string     `json:"nombre"`  // Descripción libre, ej. "script de copias"
+	Prefijo    string     `json:"prefijo"` // Primeros caracteres del token, para reconocerlo en listados
+	Hash       string     `json:"-"`
+	Alcance    string     `json:"alcance"` // Uno de los roles: RolLector o RolAdministrador
+	CreadoEn   time.Time  `json:"creado_en"`
+	UltimoUso  *time.Time `json:"ultimo_uso,omitempty"`
+	RevocadoEn *time.Time `json:"revocado_en,omitempty"`
+}
+
+// NuevoTokenAPI crea un TokenAPI a partir del hash de un token recién generado.
+func NuevoTokenAPI(usuarioID int, nombre, prefijo, hash, alcance string) *TokenAPI {
+	return &TokenAPI{
+		UsuarioID: usuarioID,
+		Nombre:    nombre,
+		Prefijo:   prefijo,
+		Hash:      hash,
+		Alcance:   alcance,
+		CreadoEn:  time.Now().UTC(),
+	}
+}
+
+func (t *TokenAPI) GetID() int {
+	return t.ID
+}
+
+func (t *TokenAPI) GetAlcance() string {
+	return t.Alcance
+}
+
+// EstaRevocado indica si el token ya no puede usarse.
+func (t *TokenAPI) EstaRevocado() bool {
+	return t.RevocadoEn != nil
+}
+
+// RolEfectivo es el rol con el que actúa el token: nunca supera el rol actual del usuario,
+// de modo que un administrador degradado a lector pierde también sus tokens de administrador.
+func (t *TokenAPI) RolEfectivo(usuario *Usuario) string {
+	if t.Alcance == RolAdministrador && usuario.GetRol() == RolAdministrador {
+		return RolAdministrador
+	}
+	return RolLector
+}
+
+// EsRolValido indica si 'rol' es uno de los roles reconocidos.
+func EsRolValido(rol string) bool {
+	return rol == RolLector || rol == RolAdministrador
+}
+
+// HashToken calcula el hash con el que se guarda un secreto aleatorio: un token de API, el
+// identificador de una sesión o el token de un enlace enviado por correo. Al ser aleatorios
+// de 256 bits, basta con SHA-256; no hace falta un hash lento como bcrypt.
+func HashToken(token string) string {
+	suma := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(suma[:])
+}
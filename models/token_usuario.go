@@ -0,0 +1,38 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrTokenUsuarioInvalido es un error que se devuelve cuando un enlace de verificación
+// o de restablecimiento de contraseña no existe, ya se usó o caducó.
+var ErrTokenUsuarioInvalido = errors.New("el enlace no es válido o ha caducado")
+
+// ErrEmailNoVerificado es un error que se devuelve al iniciar sesión con una cuenta cuyo
+// correo aún no se ha confirmado.
+var ErrEmailNoVerificado = errors.New("el correo de la cuenta no está verificado")
+
+// Propósitos de un TokenUsuario.
+const (
+	PropositoVerificacion = "verificacion"
+	PropositoRestablecer  = "restablecer"
+)
+
+// Validez de los enlaces enviados por correo.
+const (
+	DuracionTokenVerificacion = 48 * time.Hour
+	DuracionTokenRestablecer  = time.Hour
+)
+
+// TokenUsuario es un enlace de un solo uso enviado al correo del usuario para verificar
+// su cuenta o restablecer su contraseña. Solo se guarda el hash del token.
+type TokenUsuario struct {
+	ID        int
+	UsuarioID int
+	Proposito string // PropositoVerificacion o PropositoRestablecer
+	Hash      string
+	CreadoEn  time.Time
+	ExpiraEn  time.Time
+	UsadoEn   *time.Time
+}
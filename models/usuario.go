@@ -1,6 +1,9 @@
 package models
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 // ErrUsuarioNoEncontrado es un error que se devuelve cuando un usuario no se encuentra.
 var ErrUsuarioNoEncontrado = errors.New("usuario no encontrado")
@@ -8,6 +11,20 @@ var ErrUsuarioNoEncontrado = errors.New("usuario no encontrado")
 // ErrUsuarioYaExiste es un error que se devuelve cuando un usuario con el mismo nombre de usuario ya existe.
 var ErrUsuarioYaExiste = errors.New("nombre de usuario ya existe")
 
+// ErrUltimoAdministrador es un error que se devuelve al quitar el rol de administrador
+// al único usuario que lo tiene, porque nadie podría volver a administrar la aplicación.
+var ErrUltimoAdministrador = errors.New("no se puede quitar el rol al último administrador")
+
+// ErrYaHayAdministrador es un error que se devuelve al crear el administrador inicial
+// cuando ya existe alguno.
+var ErrYaHayAdministrador = errors.New("ya existe un administrador")
+
+// Roles de usuario reconocidos por la aplicación.
+const (
+	RolLector        = "lector"
+	RolAdministrador = "administrador"
+)
+
 // Usuario representa la estructura de un usuario en la aplicación.
 type Usuario struct {
 	ID       int    `json:"id"`
@@ -15,6 +32,8 @@ type Usuario struct {
 	Password string `json:"password"` // Aquí se almacenará la contraseña HASHED
 	Email    string `json:"email"`
 	Rol      string `json:"rol"` // Ej. "lector", "administrador"
+
+	EmailVerificadoEn *time.Time `json:"email_verificado_en,omitempty"` // nil hasta que se abre el enlace de verificación
 }
 
 // NuevoUsuario crea una nueva instancia de Usuario.
@@ -46,6 +65,11 @@ func (u *Usuario) GetEmail() string {
 	return u.Email
 }
 
+// EmailVerificado indica si el usuario ha confirmado que el correo es suyo.
+func (u *Usuario) EmailVerificado() bool {
+	return u.EmailVerificadoEn != nil
+}
+
 func (u *Usuario) GetRol() string {
 	return u.Rol
 }
@@ -0,0 +1,118 @@
+// Package opds publica el catálogo como OPDS 1.2, los feeds Atom que leen las
+// aplicaciones de lectura: feeds de navegación (novedades, autores y géneros), búsqueda
+// con OpenSearch y enlaces de adquisición para descargar los EPUB y PDF.
+package opds
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// Tipos de contenido de OPDS y OpenSearch.
+const (
+	TipoNavegacion  = "application/atom+xml;profile=opds-catalog;kind=navigation"
+	TipoAdquisicion = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+	TipoOpenSearch  = "application/opensearchdescription+xml"
+)
+
+// Relaciones de los enlaces de OPDS.
+const (
+	relAdquisicion = "http://opds-spec.org/acquisition"
+	relImagen      = "http://opds-spec.org/image"
+	relMiniatura   = "http://opds-spec.org/image/thumbnail"
+	relNovedades   = "http://opds-spec.org/sort/new"
+)
+
+// Espacios de nombres que usan los feeds. encoding/xml no sabe declarar prefijos, así
+// que se declaran como atributos del feed y los elementos llevan el prefijo en el nombre.
+const (
+	espacioAtom       = "http://www.w3.org/2005/Atom"
+	espacioDC         = "http://purl.org/dc/terms/"
+	espacioOpenSearch = "http://a9.com/-/spec/opensearch/1.1/"
+)
+
+// feed es un feed Atom de OPDS, de navegación o de adquisición.
+type feed struct {
+	XMLName      xml.Name  `xml:"feed"`
+	Xmlns        string    `xml:"xmlns,attr"`
+	XmlnsDC      string    `xml:"xmlns:dc,attr"`
+	XmlnsOS      string    `xml:"xmlns:opensearch,attr"`
+	ID           string    `xml:"id"`
+	Titulo       string    `xml:"title"`
+	Actualizado  time.Time `xml:"updated"`
+	Autor        *persona  `xml:"author,omitempty"`
+	Enlaces      []enlace  `xml:"link"`
+	TotalResults int       `xml:"opensearch:totalResults,omitempty"`
+	Entradas     []entrada `xml:"entry"`
+}
+
+type persona struct {
+	Nombre string `xml:"name"`
+	URI    string `xml:"uri,omitempty"`
+}
+
+type enlace struct {
+	Rel    string `xml:"rel,attr,omitempty"`
+	Href   string `xml:"href,attr"`
+	Tipo   string `xml:"type,attr,omitempty"`
+	Titulo string `xml:"title,attr,omitempty"`
+}
+
+type categoria struct {
+	Termino  string `xml:"term,attr"`
+	Etiqueta string `xml:"label,attr,omitempty"`
+	Esquema  string `xml:"scheme,attr,omitempty"`
+}
+
+type texto struct {
+	Tipo  string `xml:"type,attr,omitempty"`
+	Valor string `xml:",chardata"`
+}
+
+// entrada es un libro en un feed de adquisición o un subcatálogo en uno de navegación.
+type entrada struct {
+	ID            string      `xml:"id"`
+	Titulo        string      `xml:"title"`
+	Actualizado   time.Time   `xml:"updated"`
+	Autores       []persona   `xml:"author"`
+	Colaboradores []persona   `xml:"contributor"`
+	Identificador string      `xml:"dc:identifier,omitempty"`
+	Idioma        string      `xml:"dc:language,omitempty"`
+	Editorial     string      `xml:"dc:publisher,omitempty"`
+	Publicado     string      `xml:"dc:issued,omitempty"`
+	Categorias    []categoria `xml:"category"`
+	Resumen       *texto      `xml:"summary,omitempty"`
+	Contenido     *texto      `xml:"content,omitempty"`
+	Enlaces       []enlace    `xml:"link"`
+}
+
+// nuevoFeed prepara un feed vacío con los espacios de nombres y los enlaces comunes:
+// el propio feed, la raíz del catálogo y la búsqueda.
+func nuevoFeed(id, titulo, self, tipo string, ahora time.Time) *feed {
+	return &feed{
+		Xmlns:       espacioAtom,
+		XmlnsDC:     espacioDC,
+		XmlnsOS:     espacioOpenSearch,
+		ID:          "urn:libroselectronicos:" + id,
+		Titulo:      titulo,
+		Actualizado: ahora,
+		Enlaces: []enlace{
+			{Rel: "self", Href: self, Tipo: tipo},
+			{Rel: "start", Href: RutaRaiz, Tipo: TipoNavegacion},
+			{Rel: "search", Href: RutaRaiz + "/opensearch.xml", Tipo: TipoOpenSearch},
+		},
+	}
+}
+
+// descripcionOpenSearch es el documento OpenSearch que indica cómo buscar en el catálogo.
+type descripcionOpenSearch struct {
+	XMLName      xml.Name `xml:"OpenSearchDescription"`
+	Xmlns        string   `xml:"xmlns,attr"`
+	NombreCorto  string   `xml:"ShortName"`
+	Descripcion  string   `xml:"Description"`
+	Codificacion string   `xml:"InputEncoding"`
+	URL          struct {
+		Tipo      string `xml:"type,attr"`
+		Plantilla string `xml:"template,attr"`
+	} `xml:"Url"`
+}
@@ -0,0 +1,385 @@
+package opds
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"libroselectronicos/archivos"
+	"libroselectronicos/controllers"
+	"libroselectronicos/db"
+	"libroselectronicos/models"
+
+	"github.com/gorilla/mux"
+)
+
+// RutaRaiz es la URL del catálogo OPDS, que se configura en la aplicación de lectura.
+const RutaRaiz = "/opds"
+
+// Catalogo sirve los feeds OPDS. Los lectores se autentican con HTTP Basic, con su
+// contraseña o con un token de API (ver controllers.MiddlewareAutenticacionBasic);
+// los enlaces de adquisición solo aparecen en los libros que pueden descargar.
+type Catalogo struct {
+	Almacen  db.LibroAlmacenamiento
+	Archivos *archivos.Servicio
+	Titulo   string           // Título del feed raíz
+	Ahora    func() time.Time // Fecha de los feeds; el esquema no guarda cuándo cambió cada libro
+}
+
+func NuevoCatalogo(almacen db.LibroAlmacenamiento, servicio *archivos.Servicio) *Catalogo {
+	return &Catalogo{Almacen: almacen, Archivos: servicio, Titulo: "Libros Electrónicos", Ahora: time.Now}
+}
+
+// Raiz es el feed de navegación inicial: novedades, autores y géneros.
+func (c *Catalogo) Raiz(w http.ResponseWriter, r *http.Request) {
+	f := nuevoFeed("raiz", c.Titulo, RutaRaiz, TipoNavegacion, c.actualizado())
+	f.Entradas = []entrada{
+		c.subcatalogo("novedades", "Novedades", "Los últimos libros añadidos al catálogo", RutaRaiz+"/novedades", relNovedades, TipoAdquisicion),
+		c.subcatalogo("autores", "Por autor", "Libros de cada autor", RutaRaiz+"/autores", "subsection", TipoNavegacion),
+		c.subcatalogo("generos", "Por género", "Libros de cada género y sus subgéneros", RutaRaiz+"/generos", "subsection", TipoNavegacion),
+	}
+	responder(w, TipoNavegacion, f)
+}
+
+// Novedades es el feed de adquisición con todos los libros, de los más recientes a los
+// más antiguos, por páginas.
+func (c *Catalogo) Novedades(w http.ResponseWriter, r *http.Request) {
+	consulta := models.ConsultaLibros{Orden: models.OrdenID, Direccion: models.DireccionDesc}
+	c.listado(w, r, "novedades", "Novedades", RutaRaiz+"/novedades", consulta)
+}
+
+// Autores es el feed de navegación con un subcatálogo por autor.
+func (c *Catalogo) Autores(w http.ResponseWriter, r *http.Request) {
+	autores, err := c.Almacen.ListarAutores()
+	if err != nil {
+		errorInterno(w, "listar autores", err)
+		return
+	}
+	f := nuevoFeed("autores", "Por autor", RutaRaiz+"/autores", TipoNavegacion, c.actualizado())
+	for _, a := range autores {
+		f.Entradas = append(f.Entradas, c.subcatalogo("autor:"+a.Slug, a.Nombre, "Libros de "+a.Nombre,
+			RutaRaiz+"/autores/"+a.Slug, "subsection", TipoAdquisicion))
+	}
+	responder(w, TipoNavegacion, f)
+}
+
+// Autor es el feed de adquisición con los libros del autor {slug}, en cualquier papel.
+func (c *Catalogo) Autor(w http.ResponseWriter, r *http.Request) {
+	slug := mux.Vars(r)["slug"]
+	autor, err := c.Almacen.ObtenerAutorPorSlug(slug)
+	if errors.Is(err, models.ErrAutorNoEncontrado) {
+		http.Error(w, "Autor no encontrado", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		errorInterno(w, "obtener autor "+slug, err)
+		return
+	}
+	obras, err := c.Almacen.ListarObrasDeAutor(autor.ID)
+	if err != nil {
+		errorInterno(w, "listar obras del autor "+slug, err)
+		return
+	}
+	ids := make([]int, 0, len(obras))
+	for _, o := range obras {
+		if len(ids) == 0 || ids[len(ids)-1] != o.Libro.ID { // Un libro sale una vez por papel, seguidas
+			ids = append(ids, o.Libro.ID)
+		}
+	}
+	libros, err := c.librosCompletos(ids)
+	if err != nil {
+		errorInterno(w, "cargar libros del autor "+slug, err)
+		return
+	}
+
+	self := RutaRaiz + "/autores/" + slug
+	f := nuevoFeed("autor:"+slug, autor.Nombre, self, TipoAdquisicion, c.actualizado())
+	f.Enlaces = append(f.Enlaces, enlace{Rel: "up", Href: RutaRaiz + "/autores", Tipo: TipoNavegacion})
+	c.agregarLibros(r, f, libros)
+	responder(w, TipoAdquisicion, f)
+}
+
+// Generos es el feed de navegación con un subcatálogo por género. Los subgéneros
+// llevan en el título la ruta desde su género raíz.
+func (c *Catalogo) Generos(w http.ResponseWriter, r *http.Request) {
+	generos, err := c.Almacen.ListarGeneros()
+	if err != nil {
+		errorInterno(w, "listar géneros", err)
+		return
+	}
+	rutas := map[int]string{}
+	f := nuevoFeed("generos", "Por género", RutaRaiz+"/generos", TipoNavegacion, c.actualizado())
+	for _, g := range generos { // Cada padre aparece antes que sus subgéneros
+		rutas[g.ID] = g.Nombre
+		if padre, ok := rutas[g.PadreID]; ok {
+			rutas[g.ID] = padre + " › " + g.Nombre
+		}
+		f.Entradas = append(f.Entradas, c.subcatalogo("genero:"+g.Slug, rutas[g.ID], "Libros de "+g.Nombre+" y sus subgéneros",
+			RutaRaiz+"/generos/"+g.Slug, "subsection", TipoAdquisicion))
+	}
+	responder(w, TipoNavegacion, f)
+}
+
+// Genero es el feed de adquisición con los libros del género {slug} y sus subgéneros.
+func (c *Catalogo) Genero(w http.ResponseWriter, r *http.Request) {
+	slug := mux.Vars(r)["slug"]
+	generos, err := c.Almacen.ListarGeneros()
+	if err != nil {
+		errorInterno(w, "listar géneros", err)
+		return
+	}
+	var genero *models.Genero
+	for _, g := range generos {
+		if g.Slug == slug {
+			genero = g
+		}
+	}
+	if genero == nil {
+		http.Error(w, "Género no encontrado", http.StatusNotFound)
+		return
+	}
+	consulta := models.ConsultaLibros{Orden: models.OrdenTitulo, Genero: slug}
+	c.listado(w, r, "genero:"+slug, genero.Nombre, RutaRaiz+"/generos/"+slug, consulta)
+}
+
+// Buscar es el feed de adquisición con los resultados de ?q=, del más relevante al
+// menos, por páginas de ?pagina=.
+func (c *Catalogo) Buscar(w http.ResponseWriter, r *http.Request) {
+	consulta := strings.TrimSpace(r.URL.Query().Get("q"))
+	pagina, err := strconv.Atoi(r.URL.Query().Get("pagina"))
+	if err != nil || pagina < 1 {
+		pagina = 1
+	}
+	var libros []*models.Libro
+	if consulta != "" {
+		resultados, err := c.Almacen.BuscarLibros(consulta, models.OpcionesBusqueda{
+			Limite: models.LimiteBusquedaPorDefecto + 1, Desplazamiento: (pagina - 1) * models.LimiteBusquedaPorDefecto})
+		if err != nil {
+			errorInterno(w, "buscar libros", err)
+			return
+		}
+		ids := make([]int, 0, len(resultados))
+		for _, res := range resultados {
+			ids = append(ids, res.Libro.ID)
+		}
+		if libros, err = c.librosCompletos(ids); err != nil {
+			errorInterno(w, "cargar resultados de búsqueda", err)
+			return
+		}
+	}
+
+	enlaceBusqueda := func(p int) string {
+		return RutaRaiz + "/buscar?" + url.Values{"q": {consulta}, "pagina": {strconv.Itoa(p)}}.Encode()
+	}
+	f := nuevoFeed("buscar:"+url.QueryEscape(consulta), "Resultados de «"+consulta+"»", enlaceBusqueda(pagina), TipoAdquisicion, c.actualizado())
+	if len(libros) > models.LimiteBusquedaPorDefecto { // Se pidió uno de más para saber si hay otra página
+		libros = libros[:models.LimiteBusquedaPorDefecto]
+		f.Enlaces = append(f.Enlaces, enlace{Rel: "next", Href: enlaceBusqueda(pagina + 1), Tipo: TipoAdquisicion})
+	}
+	if pagina > 1 {
+		f.Enlaces = append(f.Enlaces, enlace{Rel: "previous", Href: enlaceBusqueda(pagina - 1), Tipo: TipoAdquisicion})
+	}
+	c.agregarLibros(r, f, libros)
+	responder(w, TipoAdquisicion, f)
+}
+
+// DescripcionBusqueda es el documento OpenSearch al que apunta el enlace "search" de
+// todos los feeds.
+func (c *Catalogo) DescripcionBusqueda(w http.ResponseWriter, r *http.Request) {
+	d := descripcionOpenSearch{
+		Xmlns:        "http://a9.com/-/spec/opensearch/1.1/",
+		NombreCorto:  c.Titulo,
+		Descripcion:  "Buscar por título, autor o sinopsis",
+		Codificacion: "UTF-8",
+	}
+	d.URL.Tipo = TipoAdquisicion
+	d.URL.Plantilla = RutaRaiz + "/buscar?q={searchTerms}"
+	responder(w, TipoOpenSearch, d)
+}
+
+// Descargar envía el archivo {formato} del libro {id}, como controllers.ArchivoController,
+// dentro del catálogo para que la aplicación de lectura use las mismas credenciales.
+func (c *Catalogo) Descargar(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de libro inválido", http.StatusBadRequest)
+		return
+	}
+	permitido, err := c.Archivos.PuedeDescargar(controllers.UsuarioAutenticado(r), id)
+	if err != nil {
+		errorInterno(w, fmt.Sprintf("comprobar el acceso al libro %d", id), err)
+		return
+	}
+	if !permitido {
+		http.Error(w, "Necesitas tener el libro alquilado para descargarlo", http.StatusForbidden)
+		return
+	}
+	if err := c.Archivos.Descargar(w, r, id, mux.Vars(r)["formato"]); err != nil {
+		if errors.Is(err, models.ErrArchivoNoEncontrado) {
+			http.Error(w, "El libro no tiene archivo en ese formato", http.StatusNotFound)
+		} else {
+			errorInterno(w, fmt.Sprintf("descargar archivo del libro %d", id), err)
+		}
+	}
+}
+
+// listado responde con un feed de adquisición paginado de ListarLibros. La página se
+// indica con el cursor de ?cursor=, como en el listado web.
+func (c *Catalogo) listado(w http.ResponseWriter, r *http.Request, id, titulo, ruta string, consulta models.ConsultaLibros) {
+	consulta.Cursor = r.URL.Query().Get("cursor")
+	pagina, err := c.Almacen.ListarLibros(consulta)
+	if errors.Is(err, models.ErrConsultaInvalida) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		errorInterno(w, "listar libros", err)
+		return
+	}
+
+	enlacePagina := func(cursor string) string {
+		if cursor == "" {
+			return ruta
+		}
+		return ruta + "?" + url.Values{"cursor": {cursor}}.Encode()
+	}
+	f := nuevoFeed(id, titulo, enlacePagina(consulta.Cursor), TipoAdquisicion, c.actualizado())
+	f.TotalResults = pagina.Total
+	if pagina.CursorSiguiente != "" {
+		f.Enlaces = append(f.Enlaces, enlace{Rel: "next", Href: enlacePagina(pagina.CursorSiguiente), Tipo: TipoAdquisicion})
+	}
+	if pagina.CursorAnterior != "" {
+		f.Enlaces = append(f.Enlaces,
+			enlace{Rel: "first", Href: ruta, Tipo: TipoAdquisicion},
+			enlace{Rel: "previous", Href: enlacePagina(pagina.CursorAnterior), Tipo: TipoAdquisicion})
+	}
+	c.agregarLibros(r, f, pagina.Libros)
+	responder(w, TipoAdquisicion, f)
+}
+
+// librosCompletos obtiene los libros de 'ids', en ese orden, con sus autores, géneros y
+// archivos. Los que se hayan eliminado entre tanto se omiten.
+func (c *Catalogo) librosCompletos(ids []int) ([]*models.Libro, error) {
+	libros := make([]*models.Libro, 0, len(ids))
+	for _, id := range ids {
+		libro, err := c.Almacen.ObtenerLibro(id)
+		if errors.Is(err, models.ErrLibroNoEncontrado) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		libros = append(libros, libro)
+	}
+	return libros, nil
+}
+
+// agregarLibros añade al feed una entrada por libro, con enlaces de adquisición en los
+// que el usuario puede descargar.
+func (c *Catalogo) agregarLibros(r *http.Request, f *feed, libros []*models.Libro) {
+	usuario := controllers.UsuarioAutenticado(r)
+	for _, l := range libros {
+		descargable := false
+		if len(l.Archivos) > 0 {
+			var err error
+			if descargable, err = c.Archivos.PuedeDescargar(usuario, l.ID); err != nil {
+				log.Printf("Error al comprobar el acceso al libro %d: %v", l.ID, err)
+			}
+		}
+		f.Entradas = append(f.Entradas, c.entradaLibro(l, descargable))
+	}
+}
+
+// entradaLibro describe un libro: créditos, ISBN, idioma, editorial, año, géneros,
+// etiquetas, sinopsis, carátula, su página web y, si 'descargable', sus archivos.
+func (c *Catalogo) entradaLibro(l *models.Libro, descargable bool) entrada {
+	e := entrada{
+		ID:          fmt.Sprintf("urn:libroselectronicos:libro:%d", l.ID),
+		Titulo:      l.Titulo,
+		Actualizado: c.actualizado(),
+		Enlaces:     []enlace{{Rel: "alternate", Href: "/libros/" + l.Slug, Tipo: "text/html", Titulo: "Ver en la web"}},
+	}
+	for _, cr := range l.Autores {
+		p := persona{Nombre: cr.Nombre}
+		if cr.Slug != "" {
+			p.URI = RutaRaiz + "/autores/" + cr.Slug
+		}
+		if cr.Rol == models.RolAutor {
+			e.Autores = append(e.Autores, p)
+		} else {
+			e.Colaboradores = append(e.Colaboradores, p)
+		}
+	}
+	if len(l.Autores) == 0 && l.Autor != "" {
+		e.Autores = []persona{{Nombre: l.Autor}}
+	}
+	if l.ISBN != "" {
+		e.Identificador = "urn:isbn:" + l.ISBN
+	}
+	e.Idioma, e.Editorial = l.Idioma, l.Editorial
+	if l.Anio > 0 {
+		e.Publicado = strconv.Itoa(l.Anio)
+	}
+	for _, g := range l.Generos {
+		e.Categorias = append(e.Categorias, categoria{Termino: g.Slug, Etiqueta: g.Nombre, Esquema: RutaRaiz + "/generos"})
+	}
+	for _, etiqueta := range l.Etiquetas {
+		e.Categorias = append(e.Categorias, categoria{Termino: etiqueta, Etiqueta: etiqueta})
+	}
+	if l.Sinopsis != "" {
+		e.Resumen = &texto{Tipo: "text", Valor: l.Sinopsis}
+	}
+	if l.CaratulaURL != "" {
+		tipo := ""
+		if models.ClaveCaratula(l.CaratulaURL) != "" {
+			tipo = "image/jpeg" // Las carátulas guardadas en el servidor se sirven en JPEG
+		}
+		e.Enlaces = append(e.Enlaces,
+			enlace{Rel: relImagen, Href: l.CaratulaURL, Tipo: tipo},
+			enlace{Rel: relMiniatura, Href: l.GetCaratulaMiniatura(), Tipo: tipo})
+	}
+	if descargable {
+		for _, a := range l.Archivos {
+			e.Enlaces = append(e.Enlaces, enlace{Rel: relAdquisicion, Href: fmt.Sprintf("%s/libros/%d/%s", RutaRaiz, l.ID, a.Formato), Tipo: a.MIME})
+		}
+	}
+	return e
+}
+
+// subcatalogo es la entrada de un feed de navegación que lleva a otro feed.
+func (c *Catalogo) subcatalogo(id, titulo, descripcion, href, rel, tipo string) entrada {
+	return entrada{
+		ID:          "urn:libroselectronicos:" + id,
+		Titulo:      titulo,
+		Actualizado: c.actualizado(),
+		Contenido:   &texto{Tipo: "text", Valor: descripcion},
+		Enlaces:     []enlace{{Rel: rel, Href: href, Tipo: tipo}},
+	}
+}
+
+// responder escribe 'v' como documento XML con el tipo de contenido indicado.
+func responder(w http.ResponseWriter, tipo string, v interface{}) {
+	w.Header().Set("Content-Type", tipo)
+	w.Write([]byte(xml.Header))
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		log.Printf("Error al codificar feed OPDS: %v", err)
+	}
+}
+
+func errorInterno(w http.ResponseWriter, operacion string, err error) {
+	log.Printf("Error al %s para OPDS: %v", operacion, err)
+	http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+}
+
+// actualizado es la fecha de actualización de los feeds y sus entradas, en segundos.
+func (c *Catalogo) actualizado() time.Time {
+	return c.Ahora().UTC().Truncate(time.Second)
+}
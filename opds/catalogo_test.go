@@ -0,0 +1,287 @@
+package opds_test
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"libroselectronicos/archivos"
+	"libroselectronicos/controllers"
+	"libroselectronicos/db"
+	"libroselectronicos/models"
+	"libroselectronicos/opds"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// feedLeido es lo que los tests leen de un feed.
+type feedLeido struct {
+	Titulo   string        `xml:"title"`
+	Total    int           `xml:"totalResults"`
+	Enlaces  []enlaceLeido `xml:"link"`
+	Entradas []struct {
+		ID            string   `xml:"id"`
+		Titulo        string   `xml:"title"`
+		Autores       []string `xml:"author>name"`
+		Colaboradores []string `xml:"contributor>name"`
+		Identificador string   `xml:"identifier"`
+		Idioma        string   `xml:"language"`
+		Editorial     string   `xml:"publisher"`
+		Categorias    []struct {
+			Termino string `xml:"term,attr"`
+		} `xml:"category"`
+		Enlaces []enlaceLeido `xml:"link"`
+	} `xml:"entry"`
+}
+
+type enlaceLeido struct {
+	Rel  string `xml:"rel,attr"`
+	Href string `xml:"href,attr"`
+	Tipo string `xml:"type,attr"`
+}
+
+func (f feedLeido) enlace(rel string) string {
+	for _, e := range f.Enlaces {
+		if e.Rel == rel {
+			return e.Href
+		}
+	}
+	return ""
+}
+
+type entorno struct {
+	router   *mux.Router
+	almacen  db.LibroAlmacenamiento
+	archivos *archivos.Servicio
+	lector   *models.Usuario
+}
+
+// nuevoEntorno monta el catálogo como en main.go, con un lector de contraseña "secreto".
+func nuevoEntorno(t *testing.T) *entorno {
+	t.Helper()
+	dir := t.TempDir()
+	almacen := db.NewAlmacenForTest(filepath.Join(dir, "libros.db"))
+	if almacen == nil {
+		t.Fatal("No se pudo crear la base de datos de prueba")
+	}
+	t.Cleanup(func() { almacen.Close() })
+	contenidos, err := archivos.NuevoAlmacenLocal(filepath.Join(dir, "archivos"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	servicio := archivos.NuevoServicio(contenidos, almacen)
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secreto"), bcrypt.MinCost)
+	verificadoEn := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	lector := &models.Usuario{Username: "lector", Password: string(hash), Rol: models.RolLector, EmailVerificadoEn: &verificadoEn}
+	if err := almacen.AgregarUsuario(lector); err != nil {
+		t.Fatal(err)
+	}
+	lector, _ = almacen.ObtenerUsuarioPorUsername("lector") // AgregarUsuario no rellena el ID
+
+	catalogo := opds.NuevoCatalogo(almacen, servicio)
+	catalogo.Ahora = func() time.Time { return time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC) }
+	lectores := []string{models.RolLector, models.RolAdministrador}
+	router := mux.NewRouter()
+	s := router.PathPrefix(opds.RutaRaiz).Subrouter()
+	s.Use(controllers.MiddlewareAutenticacionBasic(almacen, controllers.PoliticaAPI{
+		"raiz": lectores, "novedades": lectores, "autor": lectores, "generos": lectores,
+		"genero": lectores, "buscar": lectores, "descargar": lectores,
+	}, "Libros"))
+	s.HandleFunc("", catalogo.Raiz).Name("raiz")
+	s.HandleFunc("/novedades", catalogo.Novedades).Name("novedades")
+	s.HandleFunc("/autores/{slug}", catalogo.Autor).Name("autor")
+	s.HandleFunc("/generos", catalogo.Generos).Name("generos")
+	s.HandleFunc("/generos/{slug}", catalogo.Genero).Name("genero")
+	s.HandleFunc("/buscar", catalogo.Buscar).Name("buscar")
+	s.HandleFunc("/libros/{id:[0-9]+}/{formato}", catalogo.Descargar).Name("descargar")
+	return &entorno{router: router, almacen: almacen, archivos: servicio, lector: lector}
+}
+
+func (e *entorno) pedir(url string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", url, nil)
+	req.SetBasicAuth("lector", "secreto")
+	rr := httptest.NewRecorder()
+	e.router.ServeHTTP(rr, req)
+	return rr
+}
+
+func (e *entorno) feed(t *testing.T, url, tipo string) feedLeido {
+	t.Helper()
+	rr := e.pedir(url)
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != tipo {
+		t.Fatalf("%s: estado %d, tipo %q: %s", url, rr.Code, rr.Header().Get("Content-Type"), rr.Body.String())
+	}
+	var f feedLeido
+	if err := xml.Unmarshal(rr.Body.Bytes(), &f); err != nil {
+		t.Fatalf("%s: XML inválido: %v", url, err)
+	}
+	return f
+}
+
+func TestAutenticacion(t *testing.T) {
+	e := nuevoEntorno(t)
+
+	rr := httptest.NewRecorder()
+	e.router.ServeHTTP(rr, httptest.NewRequest("GET", "/opds", nil))
+	if rr.Code != http.StatusUnauthorized || !strings.HasPrefix(rr.Header().Get("WWW-Authenticate"), "Basic ") {
+		t.Errorf("Sin credenciales se esperaba un desafío Basic: %d %q", rr.Code, rr.Header().Get("WWW-Authenticate"))
+	}
+
+	f := e.feed(t, "/opds", opds.TipoNavegacion)
+	if len(f.Entradas) != 3 || f.enlace("search") != "/opds/opensearch.xml" || f.enlace("start") != "/opds" {
+		t.Errorf("Feed raíz incorrecto: %+v", f)
+	}
+
+	// Una cuenta que aún no ha confirmado su correo no puede usar el catálogo
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secreto"), bcrypt.MinCost)
+	if err := e.almacen.AgregarUsuario(&models.Usuario{Username: "nuevo", Password: string(hash), Rol: models.RolLector}); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("GET", "/opds", nil)
+	req.SetBasicAuth("nuevo", "secreto")
+	rr = httptest.NewRecorder()
+	e.router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Sin verificar el correo se esperaba 403, obtenido %d", rr.Code)
+	}
+}
+
+func TestNovedades(t *testing.T) {
+	e := nuevoEntorno(t)
+	for i := 1; i <= models.LimitePorDefecto+5; i++ {
+		e.almacen.AgregarLibro(models.NuevoLibro(0, fmt.Sprintf("Libro %d", i), "Autor", 2000))
+	}
+
+	f := e.feed(t, "/opds/novedades", opds.TipoAdquisicion)
+	if f.Total != models.LimitePorDefecto+5 || len(f.Entradas) != models.LimitePorDefecto {
+		t.Fatalf("Se esperaban %d entradas de %d, obtenidas %d de %d", models.LimitePorDefecto, models.LimitePorDefecto+5, len(f.Entradas), f.Total)
+	}
+	if f.Entradas[0].Titulo != fmt.Sprintf("Libro %d", models.LimitePorDefecto+5) {
+		t.Errorf("La primera novedad debería ser el último libro: %q", f.Entradas[0].Titulo)
+	}
+	siguiente := f.enlace("next")
+	if siguiente == "" {
+		t.Fatal("Falta el enlace a la página siguiente")
+	}
+	f = e.feed(t, siguiente, opds.TipoAdquisicion)
+	if len(f.Entradas) != 5 || f.enlace("next") != "" || f.enlace("previous") == "" || f.Entradas[4].Titulo != "Libro 1" {
+		t.Errorf("Segunda página incorrecta: %d entradas, enlaces %+v", len(f.Entradas), f.Enlaces)
+	}
+
+	if rr := e.pedir("/opds/novedades?cursor=basura"); rr.Code != http.StatusBadRequest {
+		t.Errorf("Se esperaba 400 con un cursor inválido, obtenido %d", rr.Code)
+	}
+}
+
+func TestAutoresGenerosYBusqueda(t *testing.T) {
+	e := nuevoEntorno(t)
+	novela := &models.Genero{Nombre: "Novela"}
+	e.almacen.AgregarGenero(novela)
+	e.almacen.AgregarGenero(&models.Genero{Nombre: "Novela negra", PadreID: novela.ID})
+
+	extranjero := models.NuevoLibro(0, "El extranjero", "", 1942)
+	extranjero.ISBN = "9788420674209"
+	extranjero.Idioma, extranjero.Editorial = "es", "Alianza"
+	extranjero.Autores = []models.CreditoAutor{
+		{Nombre: "Albert Camus", Rol: models.RolAutor},
+		{Nombre: "José Ángel Valente", Rol: models.RolTraductor},
+	}
+	extranjero.Generos = []models.Genero{{Slug: "novela"}}
+	extranjero.Etiquetas = []string{"existencialismo"}
+	e.almacen.AgregarLibro(extranjero)
+	negra := models.NuevoLibro(0, "Diez negritos", "Agatha Christie", 1939)
+	negra.Generos = []models.Genero{{Slug: "novela-negra"}}
+	e.almacen.AgregarLibro(negra)
+	e.almacen.AgregarLibro(models.NuevoLibro(0, "La peste", "Albert Camus", 1947))
+
+	// Las obras del autor, con sus créditos, ISBN, idioma, editorial y clasificación
+	f := e.feed(t, "/opds/autores/albert-camus", opds.TipoAdquisicion)
+	if len(f.Entradas) != 2 || f.Entradas[0].Titulo != "La peste" {
+		t.Fatalf("Obras de Camus incorrectas: %+v", f.Entradas)
+	}
+	libro := f.Entradas[1]
+	if strings.Join(libro.Autores, ",") != "Albert Camus" || strings.Join(libro.Colaboradores, ",") != "José Ángel Valente" {
+		t.Errorf("Créditos incorrectos: %v, %v", libro.Autores, libro.Colaboradores)
+	}
+	if len(libro.Categorias) != 2 || libro.Categorias[0].Termino != "novela" || libro.Categorias[1].Termino != "existencialismo" {
+		t.Errorf("Categorías incorrectas: %+v", libro.Categorias)
+	}
+	if libro.Identificador != "urn:isbn:9788420674209" || libro.Idioma != "es" || libro.Editorial != "Alianza" {
+		t.Errorf("Identificador, idioma o editorial incorrectos: %q, %q, %q", libro.Identificador, libro.Idioma, libro.Editorial)
+	}
+	if e.feed(t, "/opds/autores/jose-angel-valente", opds.TipoAdquisicion).Entradas[0].Titulo != "El extranjero" {
+		t.Error("El traductor debería tener el libro en su feed")
+	}
+	if rr := e.pedir("/opds/autores/nadie"); rr.Code != http.StatusNotFound {
+		t.Errorf("Se esperaba 404 con un autor inexistente, obtenido %d", rr.Code)
+	}
+
+	// Los subgéneros llevan el nombre del padre, y un género incluye los de sus subgéneros
+	f = e.feed(t, "/opds/generos", opds.TipoNavegacion)
+	if len(f.Entradas) != 2 || f.Entradas[1].Titulo != "Novela › Novela negra" {
+		t.Errorf("Géneros incorrectos: %+v", f.Entradas)
+	}
+	if f = e.feed(t, "/opds/generos/novela", opds.TipoAdquisicion); len(f.Entradas) != 2 {
+		t.Errorf("Se esperaban 2 libros de novela, obtenidos %d", len(f.Entradas))
+	}
+	if rr := e.pedir("/opds/generos/poesia"); rr.Code != http.StatusNotFound {
+		t.Errorf("Se esperaba 404 con un género inexistente, obtenido %d", rr.Code)
+	}
+
+	// La búsqueda devuelve los libros completos
+	f = e.feed(t, "/opds/buscar?q=extranjero", opds.TipoAdquisicion)
+	if len(f.Entradas) != 1 || len(f.Entradas[0].Colaboradores) != 1 {
+		t.Errorf("Resultados de búsqueda incorrectos: %+v", f.Entradas)
+	}
+	if f = e.feed(t, "/opds/buscar?q=", opds.TipoAdquisicion); len(f.Entradas) != 0 {
+		t.Errorf("Una búsqueda vacía no debería devolver libros: %d", len(f.Entradas))
+	}
+}
+
+func TestAdquisicion(t *testing.T) {
+	e := nuevoEntorno(t)
+	libro, _ := e.almacen.AgregarLibro(models.NuevoLibro(0, "Niebla", "Miguel de Unamuno", 1914))
+	pdf := "%PDF-1.4\n" + strings.Repeat("contenido ", 100)
+	if _, err := e.archivos.Subir(libro.ID, "niebla.pdf", strings.NewReader(pdf)); err != nil {
+		t.Fatal(err)
+	}
+	descarga := fmt.Sprintf("/opds/libros/%d/pdf", libro.ID)
+	adquisicion := func() []enlaceLeido {
+		var enlaces []enlaceLeido
+		for _, en := range e.feed(t, "/opds/novedades", opds.TipoAdquisicion).Entradas[0].Enlaces {
+			if en.Rel == "http://opds-spec.org/acquisition" {
+				enlaces = append(enlaces, en)
+			}
+		}
+		return enlaces
+	}
+
+	// Sin alquilar el libro no hay enlace de adquisición ni descarga
+	if enlaces := adquisicion(); len(enlaces) != 0 {
+		t.Errorf("No se esperaban enlaces de adquisición: %+v", enlaces)
+	}
+	if rr := e.pedir(descarga); rr.Code != http.StatusForbidden {
+		t.Errorf("Se esperaba 403 sin alquilar el libro, obtenido %d", rr.Code)
+	}
+
+	if _, err := e.almacen.AlquilarLibro(e.lector.ID, libro.ID); err != nil {
+		t.Fatal(err)
+	}
+	enlaces := adquisicion()
+	if len(enlaces) != 1 || enlaces[0].Href != descarga || enlaces[0].Tipo != "application/pdf" {
+		t.Fatalf("Enlace de adquisición incorrecto: %+v", enlaces)
+	}
+	if rr := e.pedir(descarga); rr.Code != http.StatusOK || rr.Body.String() != pdf {
+		t.Errorf("Descarga incorrecta: %d", rr.Code)
+	}
+	if rr := e.pedir(fmt.Sprintf("/opds/libros/%d/epub", libro.ID)); rr.Code != http.StatusNotFound {
+		t.Errorf("Se esperaba 404 sin archivo EPUB, obtenido %d", rr.Code)
+	}
+}
@@ -0,0 +1,152 @@
+package views
+
+import (
+	"encoding/base32"
+	"errors"
+	"net/http"
+	"time"
+
+	"libroselectronicos/db"
+	"libroselectronicos/models"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+const (
+	// DuracionSesion es cuánto dura una sesión iniciada sin usarse; cada acceso la alarga.
+	DuracionSesion = 30 * 24 * time.Hour
+	// DuracionSesionAnonima es cuánto dura una sesión sin usuario, que solo guarda el
+	// token CSRF, para no acumular una por cada visitante.
+	DuracionSesionAnonima = 24 * time.Hour
+	// intervaloAcceso evita escribir en la base de datos en cada petición: el último
+	// acceso se actualiza como mucho una vez por intervalo.
+	intervaloAcceso = time.Minute
+)
+
+// AlmacenSesiones es un sessions.Store que guarda las sesiones en la base de datos, con
+// su usuario, user agent, último acceso y caducidad. La cookie solo lleva el
+// identificador de la sesión, firmado con la clave de sesión, y en la base de datos se
+// guarda su hash, así que borrar la fila revoca la sesión aunque la cookie siga en el
+// navegador. Se basa en sessions.FilesystemStore.
+type AlmacenSesiones struct {
+	Almacen db.LibroAlmacenamiento
+	Codecs  []securecookie.Codec
+	Options *sessions.Options // Opciones de la cookie
+	Ahora   func() time.Time
+}
+
+// NuevoAlmacenSesiones crea el almacén de sesiones en 'almacen' con cookies firmadas con 'clave'.
+func NuevoAlmacenSesiones(almacen db.LibroAlmacenamiento, clave string) *AlmacenSesiones {
+	codecs := securecookie.CodecsFromPairs([]byte(clave))
+	for _, c := range codecs {
+		if sc, ok := c.(*securecookie.SecureCookie); ok {
+			sc.MaxAge(0) // La caducidad la decide la base de datos, que la alarga en cada acceso
+		}
+	}
+	return &AlmacenSesiones{
+		Almacen: almacen,
+		Codecs:  codecs,
+		Options: &sessions.Options{
+			Path:     "/",
+			MaxAge:   int(DuracionSesion / time.Second),
+			HttpOnly: true, // La cookie de sesión no es accesible desde JavaScript
+			SameSite: http.SameSiteLaxMode,
+		},
+		Ahora: time.Now,
+	}
+}
+
+// Get devuelve la sesión 'name' de la petición, la misma en todas las llamadas.
+func (s *AlmacenSesiones) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New carga la sesión de la cookie 'name'. Si no hay cookie, o la sesión caducó o fue
+// revocada, devuelve una sesión nueva y vacía; solo es un error una cookie mal firmada.
+func (s *AlmacenSesiones) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	opts := *s.Options
+	session.Options = &opts
+	session.IsNew = true
+
+	c, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+	var id string
+	if err := securecookie.DecodeMulti(name, c.Value, &id, s.Codecs...); err != nil {
+		return session, err
+	}
+	sesion, err := s.Almacen.ObtenerSesionPorHash(models.HashToken(id))
+	if errors.Is(err, models.ErrSesionNoEncontrada) {
+		return session, nil
+	}
+	if err != nil {
+		return session, err
+	}
+	if err := (securecookie.GobEncoder{}).Deserialize(sesion.Datos, &session.Values); err != nil {
+		return session, err
+	}
+	session.ID = id
+	session.IsNew = false
+
+	ahora := s.Ahora()
+	if ahora.Sub(sesion.UltimoAcceso) >= intervaloAcceso {
+		if err := s.Almacen.RegistrarAccesoSesion(sesion.ID, ahora.Add(s.duracion(sesion.UsuarioID))); err != nil {
+			return session, err
+		}
+	}
+	return session, nil
+}
+
+// Save guarda la sesión y envía su cookie. Con Options.MaxAge <= 0 la borra (cierre de
+// sesión). Una sesión sin ID, como la recién creada, recibe uno nuevo.
+func (s *AlmacenSesiones) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if session.Options.MaxAge <= 0 {
+		if session.ID != "" {
+			if err := s.Almacen.EliminarSesionPorHash(models.HashToken(session.ID)); err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	if session.ID == "" {
+		session.ID = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(securecookie.GenerateRandomKey(32))
+	}
+	datos, err := (securecookie.GobEncoder{}).Serialize(session.Values)
+	if err != nil {
+		return err
+	}
+	usuarioID, _ := session.Values["user_id"].(int)
+	ahora := s.Ahora()
+	sesion := &models.Sesion{
+		Hash:         models.HashToken(session.ID),
+		UsuarioID:    usuarioID,
+		Datos:        datos,
+		UserAgent:    r.UserAgent(),
+		CreadaEn:     ahora, // Solo se usa al crearla
+		UltimoAcceso: ahora,
+		ExpiraEn:     ahora.Add(s.duracion(usuarioID)),
+	}
+	if err := s.Almacen.GuardarSesion(sesion); err != nil {
+		return err
+	}
+
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+// duracion es cuánto dura sin usarse una sesión del usuario, o anónima si es 0.
+func (s *AlmacenSesiones) duracion(usuarioID int) time.Duration {
+	if usuarioID == 0 {
+		return DuracionSesionAnonima
+	}
+	return DuracionSesion
+}
@@ -0,0 +1,96 @@
+package views
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"libroselectronicos/db"
+)
+
+func TestAlmacenSesiones(t *testing.T) {
+	almacen := db.NewAlmacenForTest(filepath.Join(t.TempDir(), "sesiones.db"))
+	if almacen == nil {
+		t.Fatalf("No se pudo inicializar el almacén de prueba")
+	}
+	defer almacen.Close()
+	store := NuevoAlmacenSesiones(almacen, "clave-de-prueba")
+
+	// guardar inicia sesión como 'userID' y devuelve la cookie
+	guardar := func(userID int) *http.Cookie {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("User-Agent", "Navegador de prueba")
+		rr := httptest.NewRecorder()
+		session, err := store.Get(req, sessionName)
+		if err != nil || !session.IsNew {
+			t.Fatalf("Se esperaba una sesión nueva: %v", err)
+		}
+		session.Values["user_id"] = userID
+		if err := session.Save(req, rr); err != nil {
+			t.Fatalf("Error al guardar sesión: %v", err)
+		}
+		cookies := rr.Result().Cookies()
+		if len(cookies) != 1 || !cookies[0].HttpOnly {
+			t.Fatalf("Se esperaba la cookie de sesión HttpOnly: %v", cookies)
+		}
+		return cookies[0]
+	}
+	// cargar devuelve el usuario de la sesión de la cookie, o 0 si no hay sesión
+	cargar := func(c *http.Cookie) int {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.AddCookie(c)
+		session, err := store.Get(req, sessionName)
+		if err != nil {
+			t.Fatalf("Error al cargar sesión: %v", err)
+		}
+		userID, _ := session.Values["user_id"].(int)
+		return userID
+	}
+
+	cookie := guardar(7)
+	if cargar(cookie) != 7 {
+		t.Fatalf("La sesión debería conservar el usuario")
+	}
+	sesiones, err := almacen.ListarSesionesPorUsuario(7)
+	if err != nil || len(sesiones) != 1 || sesiones[0].GetUserAgent() != "Navegador de prueba" {
+		t.Fatalf("Se esperaba una sesión del usuario 7 con su user agent: %v, %+v", err, sesiones)
+	}
+
+	// La cookie no contiene el identificador en claro ni se guarda tal cual
+	if sesiones[0].Hash == cookie.Value {
+		t.Errorf("La base de datos no debería guardar el valor de la cookie")
+	}
+
+	// Revocar la sesión en la base de datos invalida la cookie
+	if err := almacen.EliminarSesion(7, sesiones[0].GetID()); err != nil {
+		t.Fatalf("Error al revocar sesión: %v", err)
+	}
+	if cargar(cookie) != 0 {
+		t.Errorf("Una sesión revocada no debería tener usuario")
+	}
+
+	// Una cookie manipulada da una sesión nueva con error
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: sessionName, Value: "manipulada"})
+	if session, err := store.Get(req, sessionName); err == nil || !session.IsNew {
+		t.Errorf("Se esperaba un error y una sesión nueva con una cookie manipulada")
+	}
+
+	// Cerrar sesión (MaxAge -1) borra la fila y caduca la cookie
+	cookie = guardar(8)
+	req = httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(cookie)
+	rr := httptest.NewRecorder()
+	session, _ := store.Get(req, sessionName)
+	session.Options.MaxAge = -1
+	if err := session.Save(req, rr); err != nil {
+		t.Fatalf("Error al cerrar sesión: %v", err)
+	}
+	if c := rr.Result().Cookies(); len(c) != 1 || c[0].MaxAge >= 0 {
+		t.Errorf("Se esperaba la cookie caducada: %v", c)
+	}
+	if sesiones, _ := almacen.ListarSesionesPorUsuario(8); len(sesiones) != 0 {
+		t.Errorf("La sesión cerrada debería borrarse: %+v", sesiones)
+	}
+}
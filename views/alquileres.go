@@ -0,0 +1,99 @@
+package views
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"libroselectronicos/models"
+
+	"github.com/gorilla/mux"
+)
+
+// --- Manejadores de Alquileres ---
+
+// AlquilarLibroSubmit alquila el libro indicado en la URL para el usuario logueado.
+func (vc *MenuController) AlquilarLibroSubmit(w http.ResponseWriter, r *http.Request) {
+	usuario := vc.getLoggedInUser(r)
+	if usuario == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de libro inválido", http.StatusBadRequest)
+		return
+	}
+
+	_, err = vc.almacen.AlquilarLibro(usuario.GetID(), id)
+	if err != nil {
+		if errors.Is(err, models.ErrLibroNoEncontrado) {
+			http.Error(w, "Libro no encontrado", http.StatusNotFound)
+		} else if errors.Is(err, models.ErrLibroNoDisponible) {
+			http.Error(w, "El libro ya está alquilado.", http.StatusConflict)
+		} else {
+			log.Printf("Error al alquilar libro %d: %v", id, err)
+			http.Error(w, "Error interno del servidor al alquilar libro", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	http.Redirect(w, r, "/alquileres", http.StatusSeeOther)
+}
+
+// DevolverLibroSubmit devuelve el libro indicado en la URL si el usuario logueado lo tiene alquilado.
+func (vc *MenuController) DevolverLibroSubmit(w http.ResponseWriter, r *http.Request) {
+	usuario := vc.getLoggedInUser(r)
+	if usuario == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de libro inválido", http.StatusBadRequest)
+		return
+	}
+
+	err = vc.almacen.DevolverLibro(usuario.GetID(), id)
+	if err != nil {
+		if errors.Is(err, models.ErrAlquilerNoEncontrado) {
+			http.Error(w, "No tienes este libro alquilado.", http.StatusNotFound)
+		} else {
+			log.Printf("Error al devolver libro %d: %v", id, err)
+			http.Error(w, "Error interno del servidor al devolver libro", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	http.Redirect(w, r, "/alquileres", http.StatusSeeOther)
+}
+
+// MisAlquileresHTML muestra los alquileres (activos y devueltos) del usuario logueado.
+func (vc *MenuController) MisAlquileresHTML(w http.ResponseWriter, r *http.Request) {
+	usuario := vc.getLoggedInUser(r)
+	if usuario == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	alquileres, err := vc.almacen.ListarAlquileresPorUsuario(usuario.GetID())
+	if err != nil {
+		log.Printf("Error al listar alquileres del usuario %d: %v", usuario.GetID(), err)
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return
+	}
+
+	data := TemplateData{
+		Alquileres: alquileres,
+		Usuario:    usuario,
+		CSRF:       tokenCSRF(r),
+	}
+	err = vc.alquileresTpl.Execute(w, data)
+	if err != nil {
+		log.Printf("Error al renderizar plantilla mis_alquileres.html: %v", err)
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,133 @@
+package views
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"libroselectronicos/models"
+
+	"github.com/gorilla/mux"
+)
+
+// --- Manejadores de Archivos de Libros ---
+
+// SubirArchivoSubmit guarda el EPUB o PDF del formulario de edición del libro.
+func (vc *MenuController) SubirArchivoSubmit(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de libro inválido", http.StatusBadRequest)
+		return
+	}
+
+	_, err = vc.archivos.SubirDesdeFormulario(w, r, id)
+	if err != nil {
+		if errors.Is(err, models.ErrValidacion) {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		} else if errors.Is(err, models.ErrArchivoDemasiadoGrande) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		} else if errors.Is(err, models.ErrFormatoNoSoportado) {
+			http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		} else if errors.Is(err, models.ErrLibroNoEncontrado) {
+			http.Error(w, "Libro no encontrado", http.StatusNotFound)
+		} else {
+			log.Printf("Error al subir archivo del libro %d: %v", id, err)
+			http.Error(w, "Error interno del servidor al subir archivo", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/libros/%d/editar", id), http.StatusSeeOther)
+}
+
+// CrearLibroDesdeEPUBSubmit lee los metadatos y la portada de un EPUB y muestra el
+// formulario de creación rellenado con ellos. El EPUB se adjunta al libro cuando se envía el formulario.
+func (vc *MenuController) CrearLibroDesdeEPUBSubmit(w http.ResponseWriter, r *http.Request) {
+	libro, portada, err := vc.archivos.PrepararDesdeFormulario(w, r)
+	if err != nil {
+		if errors.Is(err, models.ErrValidacion) {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		} else if errors.Is(err, models.ErrArchivoDemasiadoGrande) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		} else if errors.Is(err, models.ErrFormatoNoSoportado) {
+			http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		} else {
+			log.Printf("Error al leer el EPUB para crear un libro: %v", err)
+			http.Error(w, "Error interno del servidor al leer el EPUB", http.StatusInternalServerError)
+		}
+		return
+	}
+	if portada != nil {
+		// Sin carátula el libro se puede crear igual
+		if url, err := vc.caratulas.Guardar(bytes.NewReader(portada.Datos)); err == nil {
+			libro.CaratulaURL = url
+		} else {
+			log.Printf("Error al guardar la portada del EPUB %s: %v", portada.Ruta, err)
+		}
+	}
+
+	generos, err := vc.almacen.ListarGeneros()
+	if err != nil {
+		log.Printf("Error al listar géneros para el formulario: %v", err)
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return
+	}
+	if err := vc.createTpl.Execute(w, FormularioLibro{Libro: libro, GenerosDisponibles: generos, CSRF: tokenCSRF(r)}); err != nil {
+		log.Printf("Error al renderizar plantilla crear.html: %v", err)
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+	}
+}
+
+// DescargarArchivoHTML envía el archivo del libro en el formato de la URL si el usuario
+// logueado es administrador o tiene el libro alquilado.
+func (vc *MenuController) DescargarArchivoHTML(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de libro inválido", http.StatusBadRequest)
+		return
+	}
+
+	permitido, err := vc.archivos.PuedeDescargar(vc.getLoggedInUser(r), id)
+	if err != nil {
+		log.Printf("Error al comprobar el acceso al libro %d: %v", id, err)
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return
+	}
+	if !permitido {
+		http.Error(w, "Necesitas tener el libro alquilado para descargarlo.", http.StatusForbidden)
+		return
+	}
+
+	if err := vc.archivos.Descargar(w, r, id, mux.Vars(r)["formato"]); err != nil {
+		if errors.Is(err, models.ErrArchivoNoEncontrado) {
+			http.Error(w, "El libro no tiene archivo en ese formato", http.StatusNotFound)
+		} else {
+			log.Printf("Error al descargar archivo del libro %d: %v", id, err)
+			http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		}
+	}
+}
+
+// EliminarArchivoSubmit quita el archivo del libro en el formato de la URL.
+func (vc *MenuController) EliminarArchivoSubmit(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de libro inválido", http.StatusBadRequest)
+		return
+	}
+
+	if err := vc.archivos.Eliminar(id, mux.Vars(r)["formato"]); err != nil {
+		if errors.Is(err, models.ErrArchivoNoEncontrado) {
+			http.Error(w, "El libro no tiene archivo en ese formato", http.StatusNotFound)
+		} else {
+			log.Printf("Error al eliminar archivo del libro %d: %v", id, err)
+			http.Error(w, "Error interno del servidor al eliminar archivo", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/libros/%d/editar", id), http.StatusSeeOther)
+}
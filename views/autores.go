@@ -0,0 +1,44 @@
+package views
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"libroselectronicos/models"
+
+	"github.com/gorilla/mux"
+)
+
+// --- Manejadores de Autores ---
+
+// VerAutorHTML muestra la página de un autor con los libros en que participa.
+func (vc *MenuController) VerAutorHTML(w http.ResponseWriter, r *http.Request) {
+	autor, err := vc.almacen.ObtenerAutorPorSlug(mux.Vars(r)["slug"])
+	if err != nil {
+		if errors.Is(err, models.ErrAutorNoEncontrado) {
+			http.Error(w, "Autor no encontrado", http.StatusNotFound)
+		} else {
+			log.Printf("Error al obtener autor: %v", err)
+			http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	obras, err := vc.almacen.ListarObrasDeAutor(autor.GetID())
+	if err != nil {
+		log.Printf("Error al listar los libros del autor %d: %v", autor.GetID(), err)
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return
+	}
+
+	data := TemplateData{
+		Autor:   autor,
+		Obras:   obras,
+		Usuario: vc.getLoggedInUser(r),
+	}
+	if err := vc.autorTpl.Execute(w, data); err != nil {
+		log.Printf("Error al renderizar plantilla autor.html: %v", err)
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,62 @@
+package views
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"libroselectronicos/models"
+
+	"github.com/gorilla/mux"
+)
+
+// PoliticaAcceso asocia el nombre de una ruta de mux con los roles que pueden usarla.
+// Las rutas sin nombre o cuyo nombre no aparece en la política son públicas.
+type PoliticaAcceso map[string][]string
+
+type claveContexto string
+
+// claveUsuario guarda en el contexto de la petición el usuario ya resuelto por el middleware.
+const claveUsuario claveContexto = "usuario"
+
+// MiddlewareAutorizacion devuelve un middleware de mux que aplica la política de acceso.
+// Los usuarios sin sesión se redirigen a /login y los que no tienen un rol permitido reciben 403.
+func (vc *MenuController) MiddlewareAutorizacion(politica PoliticaAcceso) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ruta := mux.CurrentRoute(r)
+			if ruta == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			roles, protegida := politica[ruta.GetName()]
+			if !protegida {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			usuario := vc.getLoggedInUser(r)
+			if usuario == nil {
+				http.Redirect(w, r, "/login", http.StatusSeeOther)
+				return
+			}
+			if !tieneRol(usuario, roles) {
+				log.Printf("Acceso denegado a %s para el usuario %s (Rol: %s)", ruta.GetName(), usuario.GetUsername(), usuario.GetRol())
+				http.Error(w, "No tienes permiso para acceder a esta página.", http.StatusForbidden)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), claveUsuario, usuario)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func tieneRol(usuario *models.Usuario, roles []string) bool {
+	for _, rol := range roles {
+		if usuario.GetRol() == rol {
+			return true
+		}
+	}
+	return false
+}
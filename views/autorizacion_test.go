@@ -0,0 +1,85 @@
+package views
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"libroselectronicos/db"
+	"libroselectronicos/models"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+)
+
+// almacenUsuarios es un mock mínimo: solo resuelve usuarios por ID.
+type almacenUsuarios struct {
+	db.LibroAlmacenamiento
+	usuarios map[int]*models.Usuario
+}
+
+func (a *almacenUsuarios) ObtenerUsuarioPorID(id int) (*models.Usuario, error) {
+	if u, ok := a.usuarios[id]; ok {
+		return u, nil
+	}
+	return nil, models.ErrUsuarioNoEncontrado
+}
+
+// storeDePrueba firma las cookies de sesión de los tests.
+var storeDePrueba = sessions.NewCookieStore([]byte("clave-de-prueba"))
+
+// cookieDeSesion genera la cookie de sesión de un usuario logueado.
+func cookieDeSesion(t *testing.T, userID int) *http.Cookie {
+	req := httptest.NewRequest("GET", "/", nil)
+	rr := httptest.NewRecorder()
+	session, _ := storeDePrueba.New(req, sessionName)
+	session.Values["user_id"] = userID
+	if err := session.Save(req, rr); err != nil {
+		t.Fatalf("Error al guardar sesión: %v", err)
+	}
+	return rr.Result().Cookies()[0]
+}
+
+func TestMiddlewareAutorizacion(t *testing.T) {
+	vc := &MenuController{store: storeDePrueba, almacen: &almacenUsuarios{usuarios: map[int]*models.Usuario{
+		1: models.NuevoUsuario(1, "lector", "", "", models.RolLector),
+		2: models.NuevoUsuario(2, "admin", "", "", models.RolAdministrador),
+	}}}
+
+	router := mux.NewRouter()
+	router.Use(vc.MiddlewareAutorizacion(PoliticaAcceso{"admin": {models.RolAdministrador}}))
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	router.HandleFunc("/publica", ok)
+	router.HandleFunc("/admin", ok).Name("admin")
+
+	tests := []struct {
+		name           string
+		path           string
+		userID         int
+		expectedStatus int
+		expectedLoc    string
+	}{
+		{"Ruta pública sin sesión", "/publica", 0, http.StatusOK, ""},
+		{"Ruta protegida sin sesión", "/admin", 0, http.StatusSeeOther, "/login"},
+		{"Ruta protegida con rol incorrecto", "/admin", 1, http.StatusForbidden, ""},
+		{"Ruta protegida con rol correcto", "/admin", 2, http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.userID != 0 {
+				req.AddCookie(cookieDeSesion(t, tt.userID))
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Código de estado incorrecto: esperado %d, obtenido %d", tt.expectedStatus, rr.Code)
+			}
+			if loc := rr.Header().Get("Location"); loc != tt.expectedLoc {
+				t.Errorf("Redirección incorrecta: esperada %q, obtenida %q", tt.expectedLoc, loc)
+			}
+		})
+	}
+}
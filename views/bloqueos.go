@@ -0,0 +1,62 @@
+package views
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"libroselectronicos/models"
+
+	"github.com/gorilla/mux"
+)
+
+// intentosMostrados es cuántos intentos fallidos recientes muestra la administración de bloqueos.
+const intentosMostrados = 100
+
+// --- Administración de Bloqueos de Inicio de Sesión ---
+
+// AdminBloqueosHTML muestra los usuarios e IPs con inicios de sesión fallidos, para
+// desbloquearlos, y los últimos intentos fallidos del registro de auditoría.
+func (vc *MenuController) AdminBloqueosHTML(w http.ResponseWriter, r *http.Request) {
+	bloqueos, err := vc.almacen.ListarBloqueosLogin()
+	if err != nil {
+		log.Printf("Error al listar bloqueos de inicio de sesión: %v", err)
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return
+	}
+	intentos, err := vc.almacen.ListarIntentosLogin(intentosMostrados)
+	if err != nil {
+		log.Printf("Error al listar intentos de inicio de sesión: %v", err)
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return
+	}
+
+	data := TemplateData{Usuario: vc.getLoggedInUser(r), CSRF: tokenCSRF(r), Bloqueos: bloqueos, Intentos: intentos}
+	if err := vc.bloqueosTpl.Execute(w, data); err != nil {
+		log.Printf("Error al renderizar plantilla admin_bloqueos.html: %v", err)
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+	}
+}
+
+// DesbloquearSubmit desbloquea el usuario o la IP {id} y pone a cero sus fallos.
+func (vc *MenuController) DesbloquearSubmit(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de bloqueo inválido", http.StatusBadRequest)
+		return
+	}
+
+	if err := vc.almacen.EliminarBloqueoLogin(id); err != nil {
+		if errors.Is(err, models.ErrBloqueoNoEncontrado) {
+			http.Error(w, "Bloqueo no encontrado", http.StatusNotFound)
+		} else {
+			log.Printf("Error al eliminar el bloqueo %d: %v", id, err)
+			http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	log.Printf("AUDITORÍA: %s eliminó el bloqueo de inicio de sesión %d", vc.getLoggedInUser(r).GetUsername(), id)
+	http.Redirect(w, r, "/admin/bloqueos", http.StatusSeeOther)
+}
@@ -0,0 +1,74 @@
+package views
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"libroselectronicos/models"
+
+	"github.com/gorilla/mux"
+)
+
+// --- Manejadores de Carátulas ---
+
+// VerCaratula sirve una carátula guardada en el servidor en el tamaño de la URL.
+func (vc *MenuController) VerCaratula(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if err := vc.caratulas.Servir(w, r, vars["clave"], vars["tamano"]); err != nil {
+		if errors.Is(err, models.ErrCaratulaNoEncontrada) {
+			http.NotFound(w, r)
+		} else {
+			log.Printf("Error al servir la carátula %s: %v", vars["clave"], err)
+			http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		}
+	}
+}
+
+// parsearFormularioLibro lee el formulario de crear o editar un libro, que es
+// multipart/form-data cuando incluye la imagen de la carátula.
+func parsearFormularioLibro(w http.ResponseWriter, r *http.Request) error {
+	r.Body = http.MaxBytesReader(w, r.Body, models.TamanoMaximoCaratula+1<<20)
+	err := r.ParseMultipartForm(models.TamanoMaximoCaratula)
+	if errors.Is(err, http.ErrNotMultipart) {
+		return r.ParseForm()
+	}
+	return err
+}
+
+// caratulaDeFormulario devuelve la CaratulaURL que indica el formulario: la imagen
+// subida en "caratula" si la hay o, si no, "caratula_url", que se descarga al servidor
+// si es externa. Devuelve "" si el formulario no indica ninguna o deja la 'actual'.
+func (vc *MenuController) caratulaDeFormulario(r *http.Request, actual string) (string, error) {
+	archivo, _, err := r.FormFile("caratula")
+	if err == nil {
+		defer archivo.Close()
+		return vc.caratulas.Guardar(archivo)
+	}
+	if !errors.Is(err, http.ErrMissingFile) && !errors.Is(err, http.ErrNotMultipart) {
+		return "", err
+	}
+
+	url := strings.TrimSpace(r.FormValue("caratula_url"))
+	if url == actual {
+		// Una carátula externa antigua no se vuelve a descargar en cada edición; de
+		// eso se encarga "caratulas localizar"
+		return "", nil
+	}
+	if models.EsCaratulaExterna(url) {
+		return vc.caratulas.Descargar(url)
+	}
+	return url, nil
+}
+
+func responderErrorCaratula(w http.ResponseWriter, err error) {
+	if errors.Is(err, models.ErrImagenInvalida) || errors.Is(err, models.ErrDescargaCaratula) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	} else if errors.Is(err, models.ErrImagenDemasiadoGrande) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	} else {
+		log.Printf("Error al guardar la carátula: %v", err)
+		http.Error(w, "Error interno del servidor al guardar la carátula", http.StatusInternalServerError)
+	}
+}
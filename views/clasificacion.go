@@ -0,0 +1,232 @@
+package views
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"libroselectronicos/models"
+
+	"github.com/gorilla/mux"
+)
+
+// EnlaceFaceta es una opción de filtro de la lista de libros con el número de libros
+// que tiene. URL aplica el filtro o, si ya está activo, lo quita.
+type EnlaceFaceta struct {
+	Nombre   string
+	Cantidad int
+	Nivel    int // Profundidad del género, para sangrar los subgéneros
+	URL      string
+	Activo   bool
+}
+
+// enlacesFacetas prepara los enlaces de las facetas a partir de la consulta actual.
+func enlacesFacetas(consulta models.ConsultaLibros, facetas *models.FacetasLibros) (generos, etiquetas []EnlaceFaceta) {
+	consulta = consulta.ConCursor("") // Un filtro nuevo empieza en la primera página
+
+	for _, f := range facetas.Generos {
+		c := consulta
+		activo := c.Genero == f.GetSlug()
+		if activo {
+			c.Genero = ""
+		} else {
+			c.Genero = f.GetSlug()
+		}
+		generos = append(generos, EnlaceFaceta{Nombre: f.GetNombre(), Cantidad: f.GetCantidad(), Nivel: f.GetNivel(), URL: urlListado(c, ""), Activo: activo})
+	}
+
+	for _, e := range facetas.Etiquetas {
+		c := consulta
+		activo := slices.Contains(c.Etiquetas, e.GetNombre())
+		if activo {
+			c.Etiquetas = slices.DeleteFunc(slices.Clone(c.Etiquetas), func(t string) bool { return t == e.GetNombre() })
+		} else {
+			c.Etiquetas = append(slices.Clone(c.Etiquetas), e.GetNombre())
+		}
+		etiquetas = append(etiquetas, EnlaceFaceta{Nombre: e.GetNombre(), Cantidad: e.GetCantidad(), URL: urlListado(c, ""), Activo: activo})
+	}
+	return generos, etiquetas
+}
+
+// FormularioLibro son los datos de crear.html y editar.html: el libro que se edita (nil
+// al crear) y los géneros que se pueden elegir.
+type FormularioLibro struct {
+	*models.Libro
+	GenerosDisponibles []*models.Genero
+	CSRF               string // Token CSRF, como en TemplateData
+}
+
+// TieneGenero indica si el libro del formulario tiene el género 'id'.
+func (f FormularioLibro) TieneGenero(id int) bool {
+	if f.Libro == nil {
+		return false
+	}
+	return slices.ContainsFunc(f.Libro.GetGeneros(), func(g models.Genero) bool { return g.ID == id })
+}
+
+// EtiquetasTexto devuelve las etiquetas del libro separadas por comas, como se escriben en el formulario.
+func (f FormularioLibro) EtiquetasTexto() string {
+	if f.Libro == nil {
+		return ""
+	}
+	return strings.Join(f.Libro.GetEtiquetas(), ", ")
+}
+
+// clasificacionDeFormulario lee los géneros (slugs del select múltiple "generos") y las
+// etiquetas (separadas por comas en "etiquetas") de un formulario de libro.
+func clasificacionDeFormulario(r *http.Request) (generos, etiquetas []string) {
+	generos = []string{}
+	for _, slug := range r.Form["generos"] {
+		if slug != "" {
+			generos = append(generos, slug)
+		}
+	}
+	etiquetas = []string{}
+	for _, etiqueta := range strings.Split(r.FormValue("etiquetas"), ",") {
+		if etiqueta = models.NormalizarEtiqueta(etiqueta); etiqueta != "" {
+			etiquetas = append(etiquetas, etiqueta)
+		}
+	}
+	return generos, etiquetas
+}
+
+// --- Administración de Géneros y Etiquetas ---
+
+// AdminGenerosHTML muestra el árbol de géneros con los formularios para gestionarlo.
+func (vc *MenuController) AdminGenerosHTML(w http.ResponseWriter, r *http.Request) {
+	generos, err := vc.almacen.ListarGeneros()
+	if err != nil {
+		log.Printf("Error al listar géneros: %v", err)
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return
+	}
+
+	data := TemplateData{Usuario: vc.getLoggedInUser(r), CSRF: tokenCSRF(r), Generos: generos}
+	if err := vc.generosTpl.Execute(w, data); err != nil {
+		log.Printf("Error al renderizar plantilla admin_generos.html: %v", err)
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+	}
+}
+
+// CrearGeneroSubmit crea un género con el nombre y el padre del formulario.
+func (vc *MenuController) CrearGeneroSubmit(w http.ResponseWriter, r *http.Request) {
+	genero, ok := generoDeFormulario(w, r)
+	if !ok {
+		return
+	}
+	vc.guardarGenero(w, r, vc.almacen.AgregarGenero(genero))
+}
+
+// EditarGeneroSubmit cambia el nombre y el padre del género {id}.
+func (vc *MenuController) EditarGeneroSubmit(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de género inválido", http.StatusBadRequest)
+		return
+	}
+	genero, ok := generoDeFormulario(w, r)
+	if !ok {
+		return
+	}
+	genero.ID = id
+	vc.guardarGenero(w, r, vc.almacen.ActualizarGenero(genero))
+}
+
+// EliminarGeneroSubmit elimina el género {id}; sus subgéneros pasan a su padre.
+func (vc *MenuController) EliminarGeneroSubmit(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de género inválido", http.StatusBadRequest)
+		return
+	}
+	vc.guardarGenero(w, r, vc.almacen.EliminarGenero(id))
+}
+
+// generoDeFormulario lee los campos "nombre" y "padre_id" (vacío en los géneros raíz).
+func generoDeFormulario(w http.ResponseWriter, r *http.Request) (*models.Genero, bool) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error al parsear el formulario", http.StatusBadRequest)
+		return nil, false
+	}
+	genero := &models.Genero{Nombre: r.FormValue("nombre")}
+	if val := r.FormValue("padre_id"); val != "" {
+		padreID, err := strconv.Atoi(val)
+		if err != nil {
+			http.Error(w, "Género padre inválido", http.StatusBadRequest)
+			return nil, false
+		}
+		genero.PadreID = padreID
+	}
+	return genero, true
+}
+
+// guardarGenero responde a un formulario de géneros según el resultado del almacén.
+func (vc *MenuController) guardarGenero(w http.ResponseWriter, r *http.Request, err error) {
+	if err != nil {
+		if errors.Is(err, models.ErrValidacion) {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		} else if errors.Is(err, models.ErrGeneroYaExiste) {
+			http.Error(w, "Ya existe un género con ese nombre", http.StatusConflict)
+		} else if errors.Is(err, models.ErrGeneroNoEncontrado) {
+			http.Error(w, "Género no encontrado", http.StatusNotFound)
+		} else {
+			log.Printf("Error al guardar género: %v", err)
+			http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		}
+		return
+	}
+	http.Redirect(w, r, "/admin/generos", http.StatusSeeOther)
+}
+
+// AdminEtiquetasHTML muestra las etiquetas en uso con los formularios para renombrarlas o eliminarlas.
+func (vc *MenuController) AdminEtiquetasHTML(w http.ResponseWriter, r *http.Request) {
+	etiquetas, err := vc.almacen.ListarEtiquetas()
+	if err != nil {
+		log.Printf("Error al listar etiquetas: %v", err)
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return
+	}
+
+	data := TemplateData{Usuario: vc.getLoggedInUser(r), CSRF: tokenCSRF(r), Etiquetas: etiquetas}
+	if err := vc.etiquetasTpl.Execute(w, data); err != nil {
+		log.Printf("Error al renderizar plantilla admin_etiquetas.html: %v", err)
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+	}
+}
+
+// RenombrarEtiquetaSubmit cambia la etiqueta "anterior" por "nueva" en todos los libros.
+func (vc *MenuController) RenombrarEtiquetaSubmit(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error al parsear el formulario", http.StatusBadRequest)
+		return
+	}
+	vc.guardarEtiqueta(w, r, vc.almacen.RenombrarEtiqueta(r.FormValue("anterior"), r.FormValue("nueva")))
+}
+
+// EliminarEtiquetaSubmit quita la etiqueta del formulario de todos los libros.
+func (vc *MenuController) EliminarEtiquetaSubmit(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error al parsear el formulario", http.StatusBadRequest)
+		return
+	}
+	vc.guardarEtiqueta(w, r, vc.almacen.EliminarEtiqueta(r.FormValue("etiqueta")))
+}
+
+// guardarEtiqueta responde a un formulario de etiquetas según el resultado del almacén.
+func (vc *MenuController) guardarEtiqueta(w http.ResponseWriter, r *http.Request, err error) {
+	if err != nil {
+		if errors.Is(err, models.ErrValidacion) {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		} else if errors.Is(err, models.ErrEtiquetaNoEncontrada) {
+			http.Error(w, "Etiqueta no encontrada", http.StatusNotFound)
+		} else {
+			log.Printf("Error al guardar etiqueta: %v", err)
+			http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		}
+		return
+	}
+	http.Redirect(w, r, "/admin/etiquetas", http.StatusSeeOther)
+}
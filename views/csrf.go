@@ -0,0 +1,171 @@
+package views
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+)
+
+const (
+	// campoCSRF es el campo oculto de los formularios con el token CSRF. En los
+	// formularios multipart/form-data debe ser el primer campo (ver tokenMultipart).
+	campoCSRF = "csrf_token"
+	// cabeceraCSRF permite enviar el token desde JavaScript.
+	cabeceraCSRF = "X-CSRF-Token"
+	// claveSesionCSRF guarda el token en la sesión.
+	claveSesionCSRF = "csrf_token"
+)
+
+// claveCSRF guarda en el contexto de la petición el emisorCSRF de la sesión.
+const claveCSRF claveContexto = "csrf"
+
+// MiddlewareCSRF protege los formularios HTML frente a CSRF con un token sincronizado:
+// cada sesión tiene un token aleatorio que las plantillas incluyen en sus formularios
+// (TemplateData.CSRF), y las peticiones POST, PUT, PATCH y DELETE que no lo envían se
+// rechazan con 403. Las rutas bajo 'exentas' no se comprueban: la API y el catálogo
+// OPDS, que no usan la cookie de sesión sino la cabecera Authorization, y los archivos
+// estáticos y las carátulas, que solo se leen.
+//
+// El token no se crea aquí sino la primera vez que una página lo pide con tokenCSRF, así
+// que las peticiones sin cookie que no muestran ningún formulario, como las de un
+// rastreador, no guardan una sesión.
+func (vc *MenuController) MiddlewareCSRF(exentas ...string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, prefijo := range exentas {
+				if strings.HasPrefix(r.URL.Path, prefijo) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			session, err := vc.store.Get(r, sessionName)
+			if err != nil {
+				// Una cookie inválida (p. ej. firmada con otra clave) da una sesión nueva
+				log.Printf("Error al obtener sesión para CSRF: %v", err)
+			}
+			emisor := &emisorCSRF{w: w, r: r, session: session}
+			emisor.token, _ = session.Values[claveSesionCSRF].(string)
+
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+				// Los métodos seguros no modifican nada y no llevan token
+			default:
+				enviado := tokenEnviado(r)
+				if emisor.token == "" || subtle.ConstantTimeCompare([]byte(emisor.token), []byte(enviado)) != 1 {
+					log.Printf("Petición %s %s rechazada: token CSRF ausente o incorrecto", r.Method, r.URL.Path)
+					vc.mostrarError(w, r, http.StatusForbidden,
+						"El formulario ha caducado o no se envió desde esta web. Vuelve a la página anterior, recárgala e inténtalo de nuevo.")
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), claveCSRF, emisor)))
+		})
+	}
+}
+
+// emisorCSRF da el token CSRF de la sesión de una petición y lo crea si aún no tiene.
+type emisorCSRF struct {
+	w       http.ResponseWriter
+	r       *http.Request
+	session *sessions.Session
+	token   string
+}
+
+// obtener devuelve el token, y si la sesión no tenía lo crea y guarda la sesión. Guardarla
+// envía la cookie, así que debe llamarse antes de escribir la respuesta.
+func (e *emisorCSRF) obtener() string {
+	if e.token != "" {
+		return e.token
+	}
+	token, err := generarTokenCSRF()
+	if err != nil {
+		log.Printf("Error al generar token CSRF: %v", err)
+		return ""
+	}
+	e.session.Values[claveSesionCSRF] = token
+	if err := e.session.Save(e.r, e.w); err != nil {
+		log.Printf("Error al guardar token CSRF en la sesión: %v", err)
+	}
+	e.token = token
+	return token
+}
+
+// tokenCSRF devuelve el token CSRF de la sesión para las plantillas, creándolo si hace
+// falta. Solo deben llamarlo las páginas con formularios POST, y antes de escribir nada.
+func tokenCSRF(r *http.Request) string {
+	emisor, ok := r.Context().Value(claveCSRF).(*emisorCSRF)
+	if !ok {
+		return ""
+	}
+	return emisor.obtener()
+}
+
+// tokenEnviado devuelve el token CSRF de la petición: de la cabecera o del campo del
+// formulario. Nunca de la URL, que acaba en logs, historiales y cabeceras Referer.
+func tokenEnviado(r *http.Request) string {
+	if token := r.Header.Get(cabeceraCSRF); token != "" {
+		return token
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		return tokenMultipart(r)
+	}
+	return r.PostFormValue(campoCSRF)
+}
+
+// tokenMultipart lee el token CSRF de un formulario multipart/form-data, que debe ir en
+// su primer campo. Los manejadores leen estos formularios en streaming con su propio
+// límite de tamaño, así que solo se lee ese campo, y lo leído del cuerpo se vuelve a
+// poner delante para que el manejador reciba el formulario entero.
+func tokenMultipart(r *http.Request) string {
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || params["boundary"] == "" {
+		return ""
+	}
+	var leido bytes.Buffer
+	cuerpo := r.Body
+	defer func() {
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(&leido, cuerpo), cuerpo}
+	}()
+
+	parte, err := multipart.NewReader(io.TeeReader(cuerpo, &leido), params["boundary"]).NextPart()
+	if err != nil || parte.FormName() != campoCSRF {
+		return ""
+	}
+	token, err := io.ReadAll(io.LimitReader(parte, 256)) // Un token ocupa 43 caracteres
+	if err != nil {
+		return ""
+	}
+	return string(token)
+}
+
+func generarTokenCSRF() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// mostrarError renderiza la página de error con el código de estado indicado.
+func (vc *MenuController) mostrarError(w http.ResponseWriter, r *http.Request, estado int, mensaje string) {
+	w.WriteHeader(estado)
+	if err := vc.errorTpl.Execute(w, TemplateData{Usuario: vc.getLoggedInUser(r), Error: mensaje}); err != nil {
+		log.Printf("Error al renderizar plantilla error.html: %v", err)
+	}
+}
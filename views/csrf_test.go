@@ -0,0 +1,141 @@
+package views
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// plantillaError es una página de error mínima para los tests.
+type plantillaError struct{}
+
+func (plantillaError) Execute(w http.ResponseWriter, data interface{}) error {
+	_, err := io.WriteString(w, "error: "+data.(TemplateData).Error)
+	return err
+}
+
+func TestMiddlewareCSRF(t *testing.T) {
+	vc := &MenuController{store: storeDePrueba, almacen: &almacenUsuarios{}, errorTpl: plantillaError{}}
+	router := mux.NewRouter()
+	router.Use(vc.MiddlewareCSRF("/api/", "/static/"))
+	router.HandleFunc("/formulario", func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, tokenCSRF(r)) })
+	router.HandleFunc("/pagina", func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "sin formularios") })
+	router.PathPrefix("/static/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Context().Value(claveCSRF) != nil {
+			t.Error("Los archivos estáticos no deberían pasar por la comprobación CSRF")
+		}
+	})
+	router.HandleFunc("/enviar", func(w http.ResponseWriter, r *http.Request) {
+		// Un formulario multipart debe llegar entero al manejador
+		if r.MultipartForm == nil && strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+			archivo, _, err := r.FormFile("archivo")
+			if err != nil {
+				t.Fatalf("El cuerpo multipart debería seguir disponible: %v", err)
+			}
+			if contenido, _ := io.ReadAll(archivo); string(contenido) != "%PDF-1.4" {
+				t.Errorf("El archivo del formulario multipart no llegó entero: %q", contenido)
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	}).Methods("POST")
+	router.HandleFunc("/api/v1/libros", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }).Methods("POST")
+
+	// Las páginas sin formularios y los archivos estáticos no crean sesión
+	for _, ruta := range []string{"/pagina", "/static/estilo.css"} {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", ruta, nil))
+		if cookies := rr.Result().Cookies(); len(cookies) != 0 {
+			t.Errorf("GET %s no debería guardar una sesión: %v", ruta, cookies)
+		}
+	}
+
+	// Una página con formulario crea el token y lo guarda en la cookie
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/formulario", nil))
+	token := rr.Body.String()
+	cookies := rr.Result().Cookies()
+	if token == "" || len(cookies) != 1 {
+		t.Fatalf("Se esperaba un token y la cookie de sesión: %q, %v", token, cookies)
+	}
+	rr = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/formulario", nil)
+	req.AddCookie(cookies[0])
+	router.ServeHTTP(rr, req)
+	if rr.Body.String() != token || len(rr.Result().Cookies()) != 0 {
+		t.Errorf("El token de la sesión debería mantenerse sin reescribir la cookie: %q", rr.Body.String())
+	}
+
+	formulario := func(valor string) (*bytes.Buffer, string) {
+		return bytes.NewBufferString(url.Values{"csrf_token": {valor}, "nombre": {"x"}}.Encode()), "application/x-www-form-urlencoded"
+	}
+	// multipartConArchivo crea un formulario con un archivo y, si 'antes' o 'despues' no
+	// están vacíos, el token delante o detrás del archivo.
+	multipartConArchivo := func(antes, despues string) func() (*bytes.Buffer, string) {
+		return func() (*bytes.Buffer, string) {
+			var buf bytes.Buffer
+			mw := multipart.NewWriter(&buf)
+			if antes != "" {
+				mw.WriteField("csrf_token", antes)
+			}
+			fw, _ := mw.CreateFormFile("archivo", "libro.pdf")
+			fw.Write([]byte("%PDF-1.4"))
+			if despues != "" {
+				mw.WriteField("csrf_token", despues)
+			}
+			mw.Close()
+			return &buf, mw.FormDataContentType()
+		}
+	}
+
+	tests := []struct {
+		name           string
+		path           string
+		cuerpo         func() (*bytes.Buffer, string)
+		cabecera       string
+		conSesion      bool
+		expectedStatus int
+	}{
+		{"Formulario con el token", "/enviar", func() (*bytes.Buffer, string) { return formulario(token) }, "", true, http.StatusOK},
+		{"Formulario sin token", "/enviar", func() (*bytes.Buffer, string) { return formulario("") }, "", true, http.StatusForbidden},
+		{"Formulario con otro token", "/enviar", func() (*bytes.Buffer, string) { return formulario("otro") }, "", true, http.StatusForbidden},
+		{"Formulario sin sesión", "/enviar", func() (*bytes.Buffer, string) { return formulario(token) }, "", false, http.StatusForbidden},
+		{"Token en la cabecera", "/enviar", func() (*bytes.Buffer, string) { return formulario("") }, token, true, http.StatusOK},
+		{"Multipart con el token como primer campo", "/enviar", multipartConArchivo(token, ""), "", true, http.StatusOK},
+		{"Multipart con otro token", "/enviar", multipartConArchivo("otro", ""), "", true, http.StatusForbidden},
+		{"Multipart con el token después del archivo", "/enviar", multipartConArchivo("", token), "", true, http.StatusForbidden},
+		{"Multipart con el token en la URL", "/enviar?csrf_token=" + url.QueryEscape(token), multipartConArchivo("", ""), "", true, http.StatusForbidden},
+		{"Multipart sin token", "/enviar", multipartConArchivo("", ""), "", true, http.StatusForbidden},
+		{"Multipart con el token en la cabecera", "/enviar", multipartConArchivo("", ""), token, true, http.StatusOK},
+		{"Ruta exenta", "/api/v1/libros", func() (*bytes.Buffer, string) { return formulario("") }, "", false, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cuerpo, tipo := tt.cuerpo()
+			req := httptest.NewRequest("POST", tt.path, cuerpo)
+			req.Header.Set("Content-Type", tipo)
+			if tt.cabecera != "" {
+				req.Header.Set("X-CSRF-Token", tt.cabecera)
+			}
+			if tt.conSesion {
+				req.AddCookie(cookies[0])
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Código de estado incorrecto: esperado %d, obtenido %d", tt.expectedStatus, rr.Code)
+			}
+			if rr.Code == http.StatusForbidden && !strings.HasPrefix(rr.Body.String(), "error: ") {
+				t.Errorf("Se esperaba la página de error, obtenido %q", rr.Body.String())
+			}
+		})
+	}
+}
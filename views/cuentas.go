@@ -0,0 +1,133 @@
+package views
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"libroselectronicos/models"
+)
+
+// --- Manejadores de Verificación del Correo y Restablecimiento de Contraseña ---
+
+const enlaceRestablecerInvalido = "El enlace para restablecer la contraseña no es válido, ya se usó o ha caducado. Pide otro."
+
+// VerificarEmail abre el enlace de verificación enviado al registrarse.
+func (vc *MenuController) VerificarEmail(w http.ResponseWriter, r *http.Request) {
+	usuario, err := vc.cuentas.Verificar(r.URL.Query().Get("token"))
+	if errors.Is(err, models.ErrTokenUsuarioInvalido) {
+		w.WriteHeader(http.StatusBadRequest)
+		vc.renderizarVerificar(w, r, "El enlace de verificación no es válido, ya se usó o ha caducado.")
+		return
+	} else if err != nil {
+		log.Printf("Error al verificar correo: %v", err)
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return
+	}
+	vc.mostrarMensaje(w, r, "Correo verificado", "Gracias, "+usuario.GetUsername()+". Tu correo ha quedado verificado y ya puedes iniciar sesión.")
+}
+
+// ReenviarVerificacionHTML muestra el formulario para pedir otro enlace de verificación.
+func (vc *MenuController) ReenviarVerificacionHTML(w http.ResponseWriter, r *http.Request) {
+	vc.renderizarVerificar(w, r, "")
+}
+
+// ReenviarVerificacionSubmit envía otro enlace de verificación. Responde lo mismo haya o
+// no una cuenta con ese correo.
+func (vc *MenuController) ReenviarVerificacionSubmit(w http.ResponseWriter, r *http.Request) {
+	if err := vc.cuentas.ReenviarVerificacion(r.FormValue("email")); err != nil {
+		log.Printf("Error al reenviar la verificación: %v", err)
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return
+	}
+	vc.mostrarMensaje(w, r, "Revisa tu correo",
+		"Si hay una cuenta sin verificar con ese correo, te hemos enviado un enlace nuevo para confirmarlo.")
+}
+
+// RecuperarHTML muestra el formulario para pedir el enlace de restablecimiento de contraseña.
+func (vc *MenuController) RecuperarHTML(w http.ResponseWriter, r *http.Request) {
+	if err := vc.recuperarTpl.Execute(w, TemplateData{CSRF: tokenCSRF(r)}); err != nil {
+		log.Printf("Error al renderizar plantilla recuperar.html: %v", err)
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+	}
+}
+
+// RecuperarSubmit envía el enlace de restablecimiento a las cuentas con ese correo.
+// Responde lo mismo haya o no alguna, para no revelar qué correos están registrados.
+func (vc *MenuController) RecuperarSubmit(w http.ResponseWriter, r *http.Request) {
+	if err := vc.cuentas.SolicitarRestablecimiento(r.FormValue("email")); err != nil {
+		log.Printf("Error al solicitar el restablecimiento de contraseña: %v", err)
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return
+	}
+	vc.mostrarMensaje(w, r, "Revisa tu correo",
+		"Si hay una cuenta con ese correo, te hemos enviado un enlace para elegir una contraseña nueva. Caduca en una hora.")
+}
+
+// RestablecerHTML muestra el formulario de la contraseña nueva si el enlace es válido.
+func (vc *MenuController) RestablecerHTML(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	usuario, err := vc.cuentas.ComprobarRestablecimiento(token)
+	if errors.Is(err, models.ErrTokenUsuarioInvalido) {
+		vc.mostrarError(w, r, http.StatusBadRequest, enlaceRestablecerInvalido)
+		return
+	} else if err != nil {
+		log.Printf("Error al comprobar el enlace de restablecimiento: %v", err)
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return
+	}
+	vc.renderizarPassword(w, r, usuario, token, "")
+}
+
+// RestablecerSubmit cambia la contraseña con el enlace de restablecimiento, que deja de valer.
+func (vc *MenuController) RestablecerSubmit(w http.ResponseWriter, r *http.Request) {
+	token := r.FormValue("token")
+	password := r.FormValue("password")
+	if password == "" || password != r.FormValue("confirmacion") {
+		usuario, err := vc.cuentas.ComprobarRestablecimiento(token)
+		if err != nil {
+			vc.mostrarError(w, r, http.StatusBadRequest, enlaceRestablecerInvalido)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		vc.renderizarPassword(w, r, usuario, token, "Las contraseñas no coinciden.")
+		return
+	}
+
+	_, err := vc.cuentas.Restablecer(token, password)
+	if errors.Is(err, models.ErrTokenUsuarioInvalido) {
+		vc.mostrarError(w, r, http.StatusBadRequest, enlaceRestablecerInvalido)
+		return
+	} else if err != nil {
+		log.Printf("Error al restablecer la contraseña: %v", err)
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return
+	}
+	vc.mostrarMensaje(w, r, "Contraseña cambiada", "Tu contraseña se ha cambiado, se han cerrado todas tus sesiones y se han revocado tus tokens de API. Ya puedes iniciar sesión con la nueva.")
+}
+
+// renderizarVerificar muestra el formulario de reenvío de la verificación con un error,
+// si lo hay. Quien llama fija antes el código de estado, si no es 200.
+func (vc *MenuController) renderizarVerificar(w http.ResponseWriter, r *http.Request, mensajeError string) {
+	if err := vc.verificarTpl.Execute(w, TemplateData{CSRF: tokenCSRF(r), Error: mensajeError}); err != nil {
+		log.Printf("Error al renderizar plantilla verificar.html: %v", err)
+	}
+}
+
+// renderizarPassword muestra el formulario de la contraseña nueva. 'usuario' es el dueño
+// del enlace, que puede no ser el de la sesión: se muestra por si varias cuentas
+// comparten correo.
+func (vc *MenuController) renderizarPassword(w http.ResponseWriter, r *http.Request, usuario *models.Usuario, token, mensajeError string) {
+	data := TemplateData{Usuario: usuario, CSRF: tokenCSRF(r), Token: token, Error: mensajeError}
+	if err := vc.passwordTpl.Execute(w, data); err != nil {
+		log.Printf("Error al renderizar plantilla restablecer.html: %v", err)
+	}
+}
+
+// mostrarMensaje responde con una página de aviso.
+func (vc *MenuController) mostrarMensaje(w http.ResponseWriter, r *http.Request, titulo, mensaje string) {
+	data := TemplateData{Usuario: vc.getLoggedInUser(r), Titulo: titulo, Mensaje: mensaje}
+	if err := vc.mensajeTpl.Execute(w, data); err != nil {
+		log.Printf("Error al renderizar plantilla mensaje.html: %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package views
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"libroselectronicos/bloqueos"
+	"libroselectronicos/correo"
+	"libroselectronicos/cuentas"
+	"libroselectronicos/db"
+)
+
+// plantillaDatos escribe los campos de TemplateData que usan las páginas de cuentas.
+type plantillaDatos struct{}
+
+func (plantillaDatos) Execute(w http.ResponseWriter, data interface{}) error {
+	d := data.(TemplateData)
+	_, err := fmt.Fprintf(w, "titulo=%s mensaje=%s error=%s token=%s", d.Titulo, d.Mensaje, d.Error, d.Token)
+	return err
+}
+
+// buzon guarda los correos enviados en lugar de enviarlos.
+type buzon struct {
+	mensajes []correo.Mensaje
+}
+
+func (b *buzon) Enviar(m correo.Mensaje) error {
+	b.mensajes = append(b.mensajes, m)
+	return nil
+}
+
+var reEnlaceCorreo = regexp.MustCompile(`http://libros\.example\.com/\S+`)
+
+// enlace devuelve la ruta y la consulta del enlace del último correo.
+func (b *buzon) enlace(t *testing.T) string {
+	t.Helper()
+	if len(b.mensajes) == 0 {
+		t.Fatalf("No se ha enviado ningún correo")
+	}
+	u, err := url.Parse(reEnlaceCorreo.FindString(b.mensajes[len(b.mensajes)-1].Texto))
+	if err != nil || u.Path == "" {
+		t.Fatalf("El correo no tiene enlace: %q", b.mensajes[len(b.mensajes)-1].Texto)
+	}
+	return u.RequestURI()
+}
+
+func TestVerificacionYRestablecimiento(t *testing.T) {
+	almacen := db.NewAlmacenForTest(filepath.Join(t.TempDir(), "libros.db"))
+	if almacen == nil {
+		t.Fatalf("No se pudo inicializar el almacén de prueba")
+	}
+	defer almacen.Close()
+	b := &buzon{}
+	vc := &MenuController{
+		almacen:      almacen,
+		store:        NuevoAlmacenSesiones(almacen, "clave-de-prueba"),
+		bloqueos:     bloqueos.NuevoServicio(almacen),
+		cuentas:      cuentas.NuevoServicio(almacen, b, "http://libros.example.com"),
+		errorTpl:     plantillaError{},
+		verificarTpl: plantillaDatos{},
+		passwordTpl:  plantillaDatos{},
+		mensajeTpl:   plantillaDatos{},
+	}
+	enviar := func(manejador http.HandlerFunc, metodo, ruta string, valores url.Values) *httptest.ResponseRecorder {
+		var cuerpo io.Reader
+		if valores != nil {
+			cuerpo = strings.NewReader(valores.Encode())
+		}
+		req := httptest.NewRequest(metodo, ruta, cuerpo)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		manejador(rr, req)
+		return rr
+	}
+	login := func(password string) int {
+		return enviar(vc.LoginSubmit, "POST", "/login", url.Values{"username": {"ana"}, "password": {password}}).Code
+	}
+
+	// El registro exige un correo válido
+	if rr := enviar(vc.RegistrarUsuarioSubmit, "POST", "/registro", url.Values{"username": {"ana"}, "password": {"secreto"}, "email": {"ana"}}); rr.Code != http.StatusBadRequest {
+		t.Errorf("Se esperaba 400 con un correo inválido, obtenido %d", rr.Code)
+	}
+	rr := enviar(vc.RegistrarUsuarioSubmit, "POST", "/registro", url.Values{"username": {"ana"}, "password": {"secreto"}, "email": {"ana@example.com"}})
+	if rr.Code != http.StatusOK || len(b.mensajes) != 1 || b.mensajes[0].Para != "ana@example.com" {
+		t.Fatalf("El registro debería enviar el correo de verificación: %d %q, %d correos", rr.Code, rr.Body.String(), len(b.mensajes))
+	}
+
+	// Sin verificar no se puede iniciar sesión
+	if codigo := login("secreto"); codigo != http.StatusForbidden {
+		t.Errorf("Se esperaba 403 sin verificar el correo, obtenido %d", codigo)
+	}
+	if rr := enviar(vc.VerificarEmail, "GET", "/verificar?token=inventado", nil); rr.Code != http.StatusBadRequest {
+		t.Errorf("Se esperaba 400 con un enlace inventado, obtenido %d", rr.Code)
+	}
+	if rr := enviar(vc.VerificarEmail, "GET", b.enlace(t), nil); rr.Code != http.StatusOK {
+		t.Fatalf("Se esperaba 200 al verificar, obtenido %d: %s", rr.Code, rr.Body.String())
+	}
+	if codigo := login("secreto"); codigo != http.StatusSeeOther {
+		t.Fatalf("Se esperaba poder iniciar sesión tras verificar, obtenido %d", codigo)
+	}
+
+	// Restablecer la contraseña
+	if rr := enviar(vc.RecuperarSubmit, "POST", "/recuperar", url.Values{"email": {"nadie@example.com"}}); rr.Code != http.StatusOK || len(b.mensajes) != 1 {
+		t.Errorf("Un correo desconocido debería responder igual sin enviar nada: %d, %d correos", rr.Code, len(b.mensajes))
+	}
+	if rr := enviar(vc.RecuperarSubmit, "POST", "/recuperar", url.Values{"email": {"ana@example.com"}}); rr.Code != http.StatusOK || len(b.mensajes) != 2 {
+		t.Fatalf("Se esperaba el correo de restablecimiento: %d, %d correos", rr.Code, len(b.mensajes))
+	}
+	enlace := b.enlace(t)
+	rr = enviar(vc.RestablecerHTML, "GET", enlace, nil)
+	token := strings.TrimPrefix(enlace, "/restablecer?token=")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "token="+token) {
+		t.Fatalf("El formulario debería llevar el token: %d %q", rr.Code, rr.Body.String())
+	}
+	if rr := enviar(vc.RestablecerSubmit, "POST", "/restablecer", url.Values{"token": {token}, "password": {"nueva"}, "confirmacion": {"otra"}}); rr.Code != http.StatusBadRequest {
+		t.Errorf("Se esperaba 400 si las contraseñas no coinciden, obtenido %d", rr.Code)
+	}
+	if rr := enviar(vc.RestablecerSubmit, "POST", "/restablecer", url.Values{"token": {token}, "password": {"nueva"}, "confirmacion": {"nueva"}}); rr.Code != http.StatusOK {
+		t.Fatalf("Se esperaba 200 al restablecer, obtenido %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := enviar(vc.RestablecerSubmit, "POST", "/restablecer", url.Values{"token": {token}, "password": {"otra"}, "confirmacion": {"otra"}}); rr.Code != http.StatusBadRequest {
+		t.Errorf("El enlace no debería valer dos veces, obtenido %d", rr.Code)
+	}
+	if login("secreto") != http.StatusUnauthorized || login("nueva") != http.StatusSeeOther {
+		t.Errorf("Solo la contraseña nueva debería valer")
+	}
+}
@@ -0,0 +1,58 @@
+package views
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"libroselectronicos/exportacion"
+
+	"github.com/gorilla/mux"
+)
+
+// OpcionExportacion es un tipo de datos de la página de exportación con los formatos
+// en que se puede descargar.
+type OpcionExportacion struct {
+	Datos       string
+	Descripcion string
+	Formatos    []string
+}
+
+// opcionesExportacion son los datos que ofrece la página de exportación, en su orden.
+var opcionesExportacion = []OpcionExportacion{
+	{Datos: exportacion.DatosLibros, Descripcion: "Catálogo de libros con sus autores, géneros y etiquetas"},
+	{Datos: exportacion.DatosUsuarios, Descripcion: "Usuarios, sin sus contraseñas"},
+	{Datos: exportacion.DatosAlquileres, Descripcion: "Alquileres, incluidos los ya devueltos"},
+}
+
+// AdminExportarHTML muestra los enlaces para descargar los datos en cada formato.
+func (vc *MenuController) AdminExportarHTML(w http.ResponseWriter, r *http.Request) {
+	opciones := make([]OpcionExportacion, len(opcionesExportacion))
+	for i, o := range opcionesExportacion {
+		o.Formatos = exportacion.Formatos(o.Datos)
+		opciones[i] = o
+	}
+
+	data := TemplateData{Usuario: vc.getLoggedInUser(r), CSRF: tokenCSRF(r), Exportaciones: opciones}
+	if err := vc.exportarTpl.Execute(w, data); err != nil {
+		log.Printf("Error al renderizar plantilla admin_exportar.html: %v", err)
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+	}
+}
+
+// ExportarDescargar descarga los datos {datos} en el formato {formato}. El archivo se
+// genera mientras se envía, así que un error a mitad solo puede registrarse.
+func (vc *MenuController) ExportarDescargar(w http.ResponseWriter, r *http.Request) {
+	datos, formato := mux.Vars(r)["datos"], mux.Vars(r)["formato"]
+	if err := exportacion.Comprobar(datos, formato); err != nil {
+		http.Error(w, "Exportación no disponible", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", exportacion.TipoContenido(formato))
+	w.Header().Set("Content-Disposition", `attachment; filename="`+exportacion.NombreArchivo(datos, formato, time.Now())+`"`)
+	w.Header().Set("Cache-Control", "no-store")
+	if err := exportacion.Exportar(vc.almacen, w, datos, formato); err != nil {
+		log.Printf("Error al exportar %s en %s: %v", datos, formato, err)
+	}
+}
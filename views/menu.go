@@ -2,12 +2,18 @@ package views
 
 import (
 	"errors"
+	"fmt"
 	"html/template"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 
-	// Para manejar fechas en el futuro (alquileres)
+	"libroselectronicos/archivos"
+	"libroselectronicos/bloqueos"
+	"libroselectronicos/caratulas"
+	"libroselectronicos/cuentas"
 	"libroselectronicos/db"
 	"libroselectronicos/models"
 
@@ -16,24 +22,35 @@ import (
 	"golang.org/x/crypto/bcrypt" // Para hashear contraseñas
 )
 
-const (
-	sessionName = "session-name"
-	// Clave secreta para las sesiones. ¡DEBE CAMBIARSE EN PRODUCCIÓN!
-	// Para desarrollo, una cadena aleatoria está bien.
-	sessionKey = "super-secret-key-that-should-be-long-and-random"
-)
-
-var store = sessions.NewCookieStore([]byte(sessionKey))
+const sessionName = "session-name"
 
 type MenuController struct {
-	almacen     db.LibroAlmacenamiento
-	indexTpl    templateExecutor
-	listTpl     templateExecutor
-	createTpl   templateExecutor
-	editTpl     templateExecutor
-	sinopsisTpl templateExecutor
-	registerTpl templateExecutor // Nueva plantilla para registro
-	loginTpl    templateExecutor // Nueva plantilla para login
+	almacen       db.LibroAlmacenamiento
+	store         sessions.Store      // Almacén de sesiones; la clave viene de la configuración
+	archivos      *archivos.Servicio  // EPUB y PDF de los libros
+	caratulas     *caratulas.Servicio // Carátulas guardadas en el servidor
+	bloqueos      *bloqueos.Servicio  // Protección del inicio de sesión frente a fuerza bruta
+	cuentas       *cuentas.Servicio   // Verificación del correo y restablecimiento de contraseña
+	indexTpl      templateExecutor
+	listTpl       templateExecutor
+	createTpl     templateExecutor
+	editTpl       templateExecutor
+	sinopsisTpl   templateExecutor
+	registerTpl   templateExecutor // Nueva plantilla para registro
+	loginTpl      templateExecutor // Nueva plantilla para login
+	alquileresTpl templateExecutor // Plantilla para "Mis Alquileres"
+	autorTpl      templateExecutor // Página de un autor con sus libros
+	generosTpl    templateExecutor // Administración de géneros
+	etiquetasTpl  templateExecutor // Administración de etiquetas
+	exportarTpl   templateExecutor // Exportación de datos
+	errorTpl      templateExecutor // Página de error, p. ej. de un token CSRF incorrecto
+	sesionesTpl   templateExecutor // Sesiones abiertas del usuario
+	bloqueosTpl   templateExecutor // Bloqueos de inicio de sesión e intentos fallidos
+	usuariosTpl   templateExecutor // Administración de usuarios y sus roles
+	verificarTpl  templateExecutor // Reenvío del enlace de verificación del correo
+	recuperarTpl  templateExecutor // Solicitud del enlace para restablecer la contraseña
+	passwordTpl   templateExecutor // Formulario de la contraseña nueva
+	mensajeTpl    templateExecutor // Página de aviso, p. ej. "revisa tu correo"
 }
 
 type templateExecutor interface {
@@ -48,29 +65,95 @@ func (w *htmlTemplateWrapper) Execute(wr http.ResponseWriter, data interface{})
 	return w.tpl.Execute(wr, data)
 }
 
-func NewMenuController(almacen db.LibroAlmacenamiento) *MenuController {
+func NewMenuController(almacen db.LibroAlmacenamiento, store sessions.Store, servicioArchivos *archivos.Servicio, servicioCaratulas *caratulas.Servicio, servicioCuentas *cuentas.Servicio) *MenuController {
 	return &MenuController{
-		almacen:     almacen,
-		indexTpl:    &htmlTemplateWrapper{template.Must(template.ParseFiles("templates/index.html"))},
-		listTpl:     &htmlTemplateWrapper{template.Must(template.ParseFiles("templates/listar.html"))},
-		createTpl:   &htmlTemplateWrapper{template.Must(template.ParseFiles("templates/crear.html"))},
-		editTpl:     &htmlTemplateWrapper{template.Must(template.ParseFiles("templates/editar.html"))},
-		sinopsisTpl: &htmlTemplateWrapper{template.Must(template.ParseFiles("templates/sinopsis.html"))},
-		registerTpl: &htmlTemplateWrapper{template.Must(template.ParseFiles("templates/registro.html"))},
-		loginTpl:    &htmlTemplateWrapper{template.Must(template.ParseFiles("templates/login.html"))},
+		almacen:       almacen,
+		store:         store,
+		archivos:      servicioArchivos,
+		caratulas:     servicioCaratulas,
+		indexTpl:      &htmlTemplateWrapper{template.Must(template.ParseFiles("templates/index.html"))},
+		listTpl:       &htmlTemplateWrapper{template.Must(template.ParseFiles("templates/listar.html"))},
+		createTpl:     &htmlTemplateWrapper{template.Must(template.ParseFiles("templates/crear.html"))},
+		editTpl:       &htmlTemplateWrapper{template.Must(template.ParseFiles("templates/editar.html"))},
+		sinopsisTpl:   &htmlTemplateWrapper{template.Must(template.ParseFiles("templates/sinopsis.html"))},
+		registerTpl:   &htmlTemplateWrapper{template.Must(template.ParseFiles("templates/registro.html"))},
+		loginTpl:      &htmlTemplateWrapper{template.Must(template.ParseFiles("templates/login.html"))},
+		alquileresTpl: &htmlTemplateWrapper{template.Must(template.ParseFiles("templates/mis_alquileres.html"))},
+		autorTpl:      &htmlTemplateWrapper{template.Must(template.ParseFiles("templates/autor.html"))},
+		generosTpl:    &htmlTemplateWrapper{template.Must(template.ParseFiles("templates/admin_generos.html"))},
+		etiquetasTpl:  &htmlTemplateWrapper{template.Must(template.ParseFiles("templates/admin_etiquetas.html"))},
+		exportarTpl:   &htmlTemplateWrapper{template.Must(template.ParseFiles("templates/admin_exportar.html"))},
+		errorTpl:      &htmlTemplateWrapper{template.Must(template.ParseFiles("templates/error.html"))},
+		sesionesTpl:   &htmlTemplateWrapper{template.Must(template.ParseFiles("templates/mis_sesiones.html"))},
+		bloqueosTpl:   &htmlTemplateWrapper{template.Must(template.ParseFiles("templates/admin_bloqueos.html"))},
+		usuariosTpl:   &htmlTemplateWrapper{template.Must(template.ParseFiles("templates/admin_usuarios.html"))},
+		verificarTpl:  &htmlTemplateWrapper{template.Must(template.ParseFiles("templates/verificar.html"))},
+		recuperarTpl:  &htmlTemplateWrapper{template.Must(template.ParseFiles("templates/recuperar.html"))},
+		passwordTpl:   &htmlTemplateWrapper{template.Must(template.ParseFiles("templates/restablecer.html"))},
+		mensajeTpl:    &htmlTemplateWrapper{template.Must(template.ParseFiles("templates/mensaje.html"))},
+		bloqueos:      bloqueos.NuevoServicio(almacen),
+		cuentas:       servicioCuentas,
 	}
 }
 
 // Estructura para pasar datos a las plantillas que necesitan información del usuario
 type TemplateData struct {
-	Libros  []*models.Libro
-	Usuario *models.Usuario // nil si no está logueado
-	Error   string
+	Libros     []*models.Libro
+	Alquileres []*models.Alquiler
+	Usuario    *models.Usuario // nil si no está logueado
+	Error      string
+	CSRF       string // Token que deben enviar los formularios en el campo csrf_token
+
+	// Búsqueda de texto completo en la lista de libros
+	Consulta   string
+	Titulos    map[int]template.HTML // Título resaltado de cada libro encontrado, por ID
+	Fragmentos map[int]template.HTML // Extracto resaltado de cada libro encontrado, por ID
+
+	// Paginación y filtros de la lista de libros
+	Filtros          url.Values // Parámetros del listado actual, sin el cursor
+	Total            int
+	EnlacePrimera    string // Vacíos si no hay página a la que ir
+	EnlaceAnterior   string
+	EnlaceSiguiente  string
+	FacetasGeneros   []EnlaceFaceta // Número de libros de cada género y etiqueta con los filtros actuales
+	FacetasEtiquetas []EnlaceFaceta
+
+	// Página de un autor
+	Autor *models.Autor
+	Obras []*models.ObraAutor
+
+	// Administración de géneros y etiquetas
+	Generos   []*models.Genero
+	Etiquetas []*models.Etiqueta
+
+	// Exportación de datos
+	Exportaciones []OpcionExportacion
+
+	// Sesiones abiertas del usuario
+	Sesiones     []*models.Sesion
+	SesionActual int // ID de la sesión de esta petición
+
+	// Administración de usuarios
+	Usuarios []*models.Usuario
+
+	// Bloqueos de inicio de sesión
+	Bloqueos []*models.BloqueoLogin
+	Intentos []*models.IntentoLogin
+
+	// Verificación del correo y restablecimiento de contraseña
+	Titulo  string // Título de la página de aviso
+	Mensaje string // Texto de la página de aviso
+	Token   string // Token del enlace de restablecimiento, que el formulario reenvía
 }
 
 // Helper para obtener el usuario logueado
 func (vc *MenuController) getLoggedInUser(r *http.Request) *models.Usuario {
-	session, err := store.Get(r, sessionName)
+	// Si el middleware de autorización ya resolvió el usuario, no hace falta volver a la DB
+	if usuario, ok := r.Context().Value(claveUsuario).(*models.Usuario); ok {
+		return usuario
+	}
+
+	session, err := vc.store.Get(r, sessionName)
 	if err != nil {
 		log.Printf("Error al obtener sesión: %v", err)
 		return nil
@@ -91,8 +174,9 @@ func (vc *MenuController) getLoggedInUser(r *http.Request) *models.Usuario {
 
 // Index muestra la página principal.
 func (vc *MenuController) Index(w http.ResponseWriter, r *http.Request) {
-	data := TemplateData{
-		Usuario: vc.getLoggedInUser(r),
+	data := TemplateData{Usuario: vc.getLoggedInUser(r)}
+	if data.Usuario != nil { // Solo la ve con formularios quien ha iniciado sesión
+		data.CSRF = tokenCSRF(r)
 	}
 	err := vc.indexTpl.Execute(w, data)
 	if err != nil {
@@ -101,13 +185,65 @@ func (vc *MenuController) Index(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// ListarLibrosHTML lista todos los libros en HTML y muestra el usuario logueado.
+// ListarLibrosHTML lista los libros en HTML por páginas, con los filtros y el orden de
+// la URL (ver models.ParsearConsultaLibros), y muestra el usuario logueado. Con ?q=
+// muestra en su lugar los resultados de la búsqueda de texto completo.
 func (vc *MenuController) ListarLibrosHTML(w http.ResponseWriter, r *http.Request) {
-	libros := vc.almacen.ListarLibros()
 	data := TemplateData{
-		Libros:  libros,
-		Usuario: vc.getLoggedInUser(r),
+		Usuario:  vc.getLoggedInUser(r),
+		Consulta: strings.TrimSpace(r.URL.Query().Get("q")),
+	}
+	if data.Usuario != nil { // Los formularios de alquilar y eliminar solo se muestran con sesión
+		data.CSRF = tokenCSRF(r)
 	}
+
+	if data.Consulta == "" {
+		consulta, err := models.ParsearConsultaLibros(r.URL.Query())
+		var pagina *models.PaginaLibros
+		var facetas *models.FacetasLibros
+		if err == nil {
+			pagina, err = vc.almacen.ListarLibros(consulta)
+		}
+		if err == nil {
+			facetas, err = vc.almacen.ContarFacetas(consulta)
+		}
+		if errors.Is(err, models.ErrConsultaInvalida) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		} else if err != nil {
+			log.Printf("Error al listar libros: %v", err)
+			http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+			return
+		}
+
+		data.Libros = pagina.Libros
+		data.Total = pagina.Total
+		data.Filtros = consulta.ConCursor("").Valores()
+		if pagina.CursorAnterior != "" {
+			data.EnlacePrimera = urlListado(consulta, "")
+			data.EnlaceAnterior = urlListado(consulta, pagina.CursorAnterior)
+		}
+		if pagina.CursorSiguiente != "" {
+			data.EnlaceSiguiente = urlListado(consulta, pagina.CursorSiguiente)
+		}
+		data.FacetasGeneros, data.FacetasEtiquetas = enlacesFacetas(consulta, facetas)
+	} else {
+		resultados, err := vc.almacen.BuscarLibros(data.Consulta, models.OpcionesBusqueda{})
+		if err != nil {
+			log.Printf("Error al buscar libros: %v", err)
+			http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+			return
+		}
+		data.Titulos = make(map[int]template.HTML, len(resultados))
+		data.Fragmentos = make(map[int]template.HTML, len(resultados))
+		for _, resultado := range resultados {
+			data.Libros = append(data.Libros, resultado.Libro)
+			// El almacén ya devuelve el título y el fragmento escapados, salvo las etiquetas <mark>
+			data.Titulos[resultado.Libro.GetID()] = template.HTML(resultado.Titulo)
+			data.Fragmentos[resultado.Libro.GetID()] = template.HTML(resultado.Fragmento)
+		}
+	}
+
 	err := vc.listTpl.Execute(w, data)
 	if err != nil {
 		log.Printf("Error al renderizar plantilla listar.html: %v", err)
@@ -115,11 +251,19 @@ func (vc *MenuController) ListarLibrosHTML(w http.ResponseWriter, r *http.Reques
 	}
 }
 
+// urlListado devuelve la URL de la lista de libros que pide la página de 'cursor'.
+func urlListado(consulta models.ConsultaLibros, cursor string) string {
+	if valores := consulta.ConCursor(cursor).Valores().Encode(); valores != "" {
+		return "/libros?" + valores
+	}
+	return "/libros"
+}
+
 // --- Manajadores de Autenticación ---
 
 // RegistrarUsuarioHTML muestra el formulario de registro.
 func (vc *MenuController) RegistrarUsuarioHTML(w http.ResponseWriter, r *http.Request) {
-	err := vc.registerTpl.Execute(w, nil)
+	err := vc.registerTpl.Execute(w, TemplateData{CSRF: tokenCSRF(r)})
 	if err != nil {
 		log.Printf("Error al renderizar plantilla registro.html: %v", err)
 		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
@@ -135,11 +279,14 @@ func (vc *MenuController) RegistrarUsuarioSubmit(w http.ResponseWriter, r *http.
 
 	username := r.FormValue("username")
 	password := r.FormValue("password")
-	email := r.FormValue("email")
-	rol := r.FormValue("rol") // Podrías tener un selector o dejarlo por defecto 'lector'
+	email := strings.TrimSpace(r.FormValue("email"))
 
-	if username == "" || password == "" {
-		http.Error(w, "Nombre de usuario y contraseña son requeridos.", http.StatusBadRequest)
+	if username == "" || password == "" || email == "" {
+		http.Error(w, "Nombre de usuario, contraseña y email son requeridos.", http.StatusBadRequest)
+		return
+	}
+	if cuentas.ValidarEmail(email) != nil {
+		http.Error(w, "El email no es válido.", http.StatusBadRequest)
 		return
 	}
 
@@ -151,39 +298,38 @@ func (vc *MenuController) RegistrarUsuarioSubmit(w http.ResponseWriter, r *http.
 		return
 	}
 
-	// rol por defecto si no se selecciona (ej. para admins)
-	if rol == "" {
-		rol = "lector"
-	}
-	nuevoUsuario := models.NuevoUsuario(0, username, string(hashedPassword), email, rol)
-
-	// --- INICIO DE NUEVOS LOGS PARA DEBUGGING ---
-	log.Printf("DEBUG: Intentando agregar usuario: %s (Rol: %s)", nuevoUsuario.GetUsername(), nuevoUsuario.GetRol())
-	// --- FIN DE NUEVOS LOGS PARA DEBUGGING ---
+	// Quien se registra siempre es lector; el rol solo lo cambia un administrador desde
+	// /admin/usuarios. Un campo "rol" en el formulario se ignora.
+	nuevoUsuario := models.NuevoUsuario(0, username, string(hashedPassword), email, models.RolLector)
 
 	err = vc.almacen.AgregarUsuario(nuevoUsuario)
 	if err != nil {
-		// --- LOG MEJORADO ---
-		log.Printf("ERROR: Fallo al agregar usuario %s a la base de datos: %v", nuevoUsuario.GetUsername(), err)
-		// --- FIN LOG MEJORADO ---
 		if errors.Is(err, models.ErrUsuarioYaExiste) {
 			http.Error(w, "El nombre de usuario ya está en uso.", http.StatusConflict)
 		} else {
-			log.Printf("Error al registrar usuario: %v", err) // Este ya lo tenías
+			log.Printf("Error al registrar usuario: %v", err)
 			http.Error(w, "Error interno del servidor al registrar usuario", http.StatusInternalServerError)
 		}
 		return
 	}
-	// --- NUEVO LOG PARA ÉXITO ---
-	log.Printf("DEBUG: Usuario %s agregado exitosamente.", nuevoUsuario.GetUsername())
-	// --- FIN NUEVO LOG PARA ÉXITO ---
 
-	http.Redirect(w, r, "/login", http.StatusSeeOther) // Redirigir al login después del registro exitoso
+	// No podrá iniciar sesión hasta abrir el enlace que le enviamos al correo
+	usuario, err := vc.almacen.ObtenerUsuarioPorUsername(username)
+	if err == nil {
+		err = vc.cuentas.EnviarVerificacion(usuario)
+	}
+	if err != nil {
+		log.Printf("Error al enviar el correo de verificación a %s: %v", username, err)
+		vc.renderizarVerificar(w, r, "Tu cuenta se ha creado, pero no hemos podido enviarte el correo para confirmarla. Pide otro enlace.")
+		return
+	}
+	vc.mostrarMensaje(w, r, "Revisa tu correo",
+		fmt.Sprintf("Te hemos enviado a %s un enlace para confirmar tu correo. Ábrelo antes de iniciar sesión.", email))
 }
 
 // LoginHTML muestra el formulario de inicio de sesión.
 func (vc *MenuController) LoginHTML(w http.ResponseWriter, r *http.Request) {
-	err := vc.loginTpl.Execute(w, nil)
+	err := vc.loginTpl.Execute(w, TemplateData{CSRF: tokenCSRF(r)})
 	if err != nil {
 		log.Printf("Error al renderizar plantilla login.html: %v", err)
 		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
@@ -205,31 +351,42 @@ func (vc *MenuController) LoginSubmit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	usuario, err := vc.almacen.ObtenerUsuarioPorUsername(username)
-	if err != nil {
-		if errors.Is(err, models.ErrUsuarioNoEncontrado) {
-			http.Error(w, "Usuario o contraseña incorrectos.", http.StatusUnauthorized)
-		} else {
-			log.Printf("Error al obtener usuario para login: %v", err)
-			http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
-		}
+	// Comprueba la contraseña salvo que el usuario o la IP estén bloqueados por fallar demasiadas veces
+	usuario, err := vc.bloqueos.Autenticar(r, username, password)
+	var bloqueo *models.ErrorBloqueo
+	if errors.As(err, &bloqueo) {
+		w.Header().Set("Retry-After", strconv.Itoa(bloqueo.SegundosRestantes()))
+		http.Error(w, fmt.Sprintf("Demasiados intentos fallidos. Vuelve a intentarlo dentro de %s.", models.EsperaLegible(bloqueo.Restante)),
+			http.StatusTooManyRequests)
 		return
-	}
-
-	// Comparar la contraseña ingresada con la contraseña hasheada
-	err = bcrypt.CompareHashAndPassword([]byte(usuario.Password), []byte(password))
-	if err != nil {
+	} else if errors.Is(err, models.ErrCredencialesInvalidas) {
 		http.Error(w, "Usuario o contraseña incorrectos.", http.StatusUnauthorized)
 		return
+	} else if errors.Is(err, models.ErrEmailNoVerificado) {
+		w.WriteHeader(http.StatusForbidden)
+		vc.renderizarVerificar(w, r, "Confirma tu correo antes de iniciar sesión: abre el enlace que te enviamos al registrarte.")
+		return
+	} else if err != nil {
+		log.Printf("Error al obtener usuario para login: %v", err)
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return
 	}
 
 	// Iniciar sesión (establecer cookie de sesión)
-	session, err := store.Get(r, sessionName)
+	session, err := vc.store.Get(r, sessionName)
 	if err != nil {
 		log.Printf("Error al obtener sesión para login: %v", err)
 		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
 		return
 	}
+	// Un identificador nuevo al iniciar sesión, para que no valga uno fijado antes por otro.
+	// La sesión anónima anterior ya no se usará.
+	if session.ID != "" {
+		if err := vc.almacen.EliminarSesionPorHash(models.HashToken(session.ID)); err != nil {
+			log.Printf("Error al borrar la sesión anónima anterior: %v", err)
+		}
+	}
+	session.ID = ""
 	session.Values["user_id"] = usuario.ID
 	session.Values["username"] = usuario.Username // Guardamos también el username para conveniencia
 	session.Save(r, w)                            // Guardar la sesión
@@ -239,7 +396,7 @@ func (vc *MenuController) LoginSubmit(w http.ResponseWriter, r *http.Request) {
 
 // Logout cierra la sesión del usuario.
 func (vc *MenuController) Logout(w http.ResponseWriter, r *http.Request) {
-	session, err := store.Get(r, sessionName)
+	session, err := vc.store.Get(r, sessionName)
 	if err != nil {
 		log.Printf("Error al obtener sesión para logout: %v", err)
 		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
@@ -253,7 +410,14 @@ func (vc *MenuController) Logout(w http.ResponseWriter, r *http.Request) {
 
 // CrearLibroHTML muestra el formulario para crear un nuevo libro.
 func (vc *MenuController) CrearLibroHTML(w http.ResponseWriter, r *http.Request) {
-	err := vc.createTpl.Execute(w, nil)
+	generos, err := vc.almacen.ListarGeneros()
+	if err != nil {
+		log.Printf("Error al listar géneros para el formulario: %v", err)
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return
+	}
+
+	err = vc.createTpl.Execute(w, FormularioLibro{Libro: &models.Libro{}, GenerosDisponibles: generos, CSRF: tokenCSRF(r)})
 	if err != nil {
 		log.Printf("Error al renderizar plantilla crear.html: %v", err)
 		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
@@ -262,37 +426,48 @@ func (vc *MenuController) CrearLibroHTML(w http.ResponseWriter, r *http.Request)
 
 // CrearLibroHTMLSubmit maneja el envío del formulario para crear un nuevo libro.
 func (vc *MenuController) CrearLibroHTMLSubmit(w http.ResponseWriter, r *http.Request) {
-	if err := r.ParseForm(); err != nil {
+	if err := parsearFormularioLibro(w, r); err != nil {
 		http.Error(w, "Error al parsear el formulario", http.StatusBadRequest)
 		return
 	}
 
-	idStr := r.FormValue("id")
 	titulo := r.FormValue("titulo")
 	autor := r.FormValue("autor")
-	anioStr := r.FormValue("anio")
-	caratulaURL := r.FormValue("caratula_url")
-	sinopsis := r.FormValue("sinopsis") // Captura la sinopsis
-
-	id, err := strconv.Atoi(idStr)
+	caratulaURL, err := vc.caratulaDeFormulario(r, "")
 	if err != nil {
-		http.Error(w, "ID de libro inválido", http.StatusBadRequest)
+		responderErrorCaratula(w, err)
 		return
 	}
+	sinopsis := r.FormValue("sinopsis") // Captura la sinopsis
+	isbn := r.FormValue("isbn")         // Opcional; el almacén lo guarda normalizado
+	idioma := r.FormValue("idioma")
+	editorial := r.FormValue("editorial")
+	generos, etiquetas := clasificacionDeFormulario(r)
+	patch := models.LibroPatch{Titulo: &titulo, Autor: &autor, ISBN: &isbn, Idioma: &idioma, Editorial: &editorial,
+		CaratulaURL: &caratulaURL, Sinopsis: &sinopsis, Generos: &generos, Etiquetas: &etiquetas}
+
+	if anioStr := r.FormValue("anio"); anioStr != "" {
+		anio, err := strconv.Atoi(anioStr)
+		if err != nil {
+			http.Error(w, "Año de publicación inválido", http.StatusBadRequest)
+			return
+		}
+		patch.Anio = &anio
+	}
 
-	anio, err := strconv.Atoi(anioStr)
+	// El ID y el slug los asigna el almacén
+	nuevoLibro, err := models.NuevoLibroDesdePatch(patch)
 	if err != nil {
-		http.Error(w, "Año de publicación inválido", http.StatusBadRequest)
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
 		return
 	}
 
-	// Usar el constructor NuevoLibroCompleto para incluir la sinopsis
-	nuevoLibro := models.NuevoLibroCompleto(id, titulo, autor, anio, caratulaURL, sinopsis)
-
-	err = vc.almacen.AgregarLibro(nuevoLibro)
+	creado, err := vc.almacen.AgregarLibro(nuevoLibro)
 	if err != nil {
-		if errors.Is(err, models.ErrLibroYaExiste) {
-			http.Error(w, "Un libro con este ID ya existe.", http.StatusConflict)
+		if errors.Is(err, models.ErrValidacion) {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		} else if errors.Is(err, models.ErrISBNDuplicado) {
+			http.Error(w, "Ya existe un libro con ese ISBN", http.StatusConflict)
 		} else {
 			log.Printf("Error al agregar libro: %v", err)
 			http.Error(w, "Error interno del servidor al guardar libro", http.StatusInternalServerError)
@@ -300,7 +475,14 @@ func (vc *MenuController) CrearLibroHTMLSubmit(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	http.Redirect(w, r, "/libros", http.StatusSeeOther)
+	// EPUB ya guardado por CrearLibroDesdeEPUBSubmit
+	if clave := r.FormValue("archivo_sha256"); clave != "" {
+		if _, err := vc.archivos.Adjuntar(creado.ID, clave, r.FormValue("archivo_nombre")); err != nil {
+			log.Printf("Error al adjuntar el EPUB %s al libro %d: %v", clave, creado.ID, err)
+		}
+	}
+
+	http.Redirect(w, r, "/libros/"+creado.GetSlug(), http.StatusSeeOther)
 }
 
 // EditarLibroHTML muestra el formulario para editar un libro existente.
@@ -333,7 +515,14 @@ func (vc *MenuController) EditarLibroHTML(w http.ResponseWriter, r *http.Request
 	log.Printf("DEBUG: Preparando para editar libro con ID %d y Título '%s'", libro.GetID(), libro.GetTitulo())
 	// --- FIN NUEVA LÍNEA DE LOGGING ---
 
-	err = vc.editTpl.Execute(w, libro)
+	generos, err := vc.almacen.ListarGeneros()
+	if err != nil {
+		log.Printf("Error al listar géneros para el formulario: %v", err)
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return
+	}
+
+	err = vc.editTpl.Execute(w, FormularioLibro{Libro: libro, GenerosDisponibles: generos, CSRF: tokenCSRF(r)})
 	if err != nil {
 		log.Printf("Error al renderizar plantilla editar.html: %v", err)
 		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
@@ -350,43 +539,71 @@ func (vc *MenuController) EditarLibroHTMLSubmit(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	if err := r.ParseForm(); err != nil {
+	if err := parsearFormularioLibro(w, r); err != nil {
 		http.Error(w, "Error al parsear el formulario", http.StatusBadRequest)
 		return
 	}
 
-	updates := make(map[string]interface{})
-	if val := r.FormValue("titulo"); val != "" {
-		updates["titulo"] = val
+	// Los campos vacíos del formulario no se modifican
+	var patch models.LibroPatch
+	for campo, destino := range map[string]**string{
+		"titulo":    &patch.Titulo,
+		"autor":     &patch.Autor,
+		"isbn":      &patch.ISBN,
+		"idioma":    &patch.Idioma,
+		"editorial": &patch.Editorial,
+		"sinopsis":  &patch.Sinopsis,
+	} {
+		if val := r.FormValue(campo); val != "" {
+			*destino = &val
+		}
 	}
-	if val := r.FormValue("autor"); val != "" {
-		updates["autor"] = val
+	actual, err := vc.almacen.ObtenerLibro(id)
+	if err != nil {
+		if errors.Is(err, models.ErrLibroNoEncontrado) {
+			http.Error(w, "Libro no encontrado", http.StatusNotFound)
+		} else {
+			log.Printf("Error al obtener libro %d para editarlo: %v", id, err)
+			http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		}
+		return
+	}
+	caratulaURL, err := vc.caratulaDeFormulario(r, actual.CaratulaURL)
+	if err != nil {
+		responderErrorCaratula(w, err)
+		return
+	}
+	if caratulaURL != "" {
+		patch.CaratulaURL = &caratulaURL
 	}
 	if val := r.FormValue("anio"); val != "" {
-		if anio, err := strconv.Atoi(val); err == nil {
-			updates["anio"] = anio
-		} else {
+		anio, err := strconv.Atoi(val)
+		if err != nil {
 			http.Error(w, "Año inválido", http.StatusBadRequest)
 			return
 		}
+		patch.Anio = &anio
 	}
-	if val := r.FormValue("caratula_url"); val != "" {
-		updates["caratula_url"] = val
-	}
-	// Campo para la sinopsis
-	if val := r.FormValue("sinopsis"); val != "" {
-		updates["sinopsis"] = val
+	// Un select sin opciones elegidas no se envía: el campo oculto indica que el
+	// formulario tenía la clasificación, para poder dejar un libro sin géneros
+	if r.FormValue("clasificacion") != "" {
+		generos, etiquetas := clasificacionDeFormulario(r)
+		patch.Generos, patch.Etiquetas = &generos, &etiquetas
 	}
 
-	if len(updates) == 0 {
+	if patch.EstaVacio() {
 		http.Error(w, "No se proporcionaron campos para actualizar", http.StatusBadRequest)
 		return
 	}
 
-	err = vc.almacen.ActualizarLibro(id, updates)
+	err = vc.almacen.ActualizarLibro(id, patch)
 	if err != nil {
-		if errors.Is(err, models.ErrLibroNoEncontrado) {
+		if errors.Is(err, models.ErrValidacion) {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		} else if errors.Is(err, models.ErrLibroNoEncontrado) {
 			http.Error(w, "Libro no encontrado", http.StatusNotFound)
+		} else if errors.Is(err, models.ErrISBNDuplicado) {
+			http.Error(w, "Ya existe un libro con ese ISBN", http.StatusConflict)
 		} else {
 			log.Printf("Error al actualizar libro: %v", err)
 			http.Error(w, "Error interno del servidor al actualizar libro", http.StatusInternalServerError)
@@ -421,7 +638,7 @@ func (vc *MenuController) EliminarLibroHTMLSubmit(w http.ResponseWriter, r *http
 	http.Redirect(w, r, "/libros", http.StatusSeeOther)
 }
 
-// VerSinopsisHTML muestra la sinopsis de un libro.
+// VerSinopsisHTML muestra la sinopsis de un libro identificado por su ID.
 func (vc *MenuController) VerSinopsisHTML(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	idStr := vars["id"]
@@ -432,6 +649,31 @@ func (vc *MenuController) VerSinopsisHTML(w http.ResponseWriter, r *http.Request
 	}
 
 	libro, err := vc.almacen.ObtenerLibro(id)
+	vc.mostrarSinopsis(w, libro, err)
+}
+
+// VerLibroHTML muestra la sinopsis de un libro identificado por el slug de la URL.
+func (vc *MenuController) VerLibroHTML(w http.ResponseWriter, r *http.Request) {
+	libro, err := vc.almacen.ObtenerLibroPorSlug(mux.Vars(r)["slug"])
+	vc.mostrarSinopsis(w, libro, err)
+}
+
+// VerLibroPorISBNHTML busca un libro por su ISBN-10 o ISBN-13 y redirige a su página.
+func (vc *MenuController) VerLibroPorISBNHTML(w http.ResponseWriter, r *http.Request) {
+	libro, err := vc.almacen.ObtenerLibroPorISBN(mux.Vars(r)["isbn"])
+	if errors.Is(err, models.ErrISBNInvalido) {
+		http.Error(w, "ISBN inválido", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		vc.mostrarSinopsis(w, nil, err)
+		return
+	}
+	http.Redirect(w, r, "/libros/"+libro.GetSlug(), http.StatusFound)
+}
+
+// mostrarSinopsis renderiza la página de un libro o el error con que se buscó.
+func (vc *MenuController) mostrarSinopsis(w http.ResponseWriter, libro *models.Libro, err error) {
 	if err != nil {
 		if errors.Is(err, models.ErrLibroNoEncontrado) {
 			http.Error(w, "Libro no encontrado", http.StatusNotFound)
@@ -0,0 +1,101 @@
+package views
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"libroselectronicos/models"
+
+	"github.com/gorilla/mux"
+)
+
+// --- Manejadores de Sesiones ---
+
+// MisSesionesHTML muestra las sesiones abiertas del usuario logueado, marcando la actual.
+func (vc *MenuController) MisSesionesHTML(w http.ResponseWriter, r *http.Request) {
+	usuario := vc.getLoggedInUser(r)
+	if usuario == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	sesiones, err := vc.almacen.ListarSesionesPorUsuario(usuario.GetID())
+	if err != nil {
+		log.Printf("Error al listar sesiones del usuario %d: %v", usuario.GetID(), err)
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return
+	}
+
+	data := TemplateData{
+		Usuario:  usuario,
+		CSRF:     tokenCSRF(r),
+		Sesiones: sesiones,
+	}
+	if session, err := vc.store.Get(r, sessionName); err == nil && session.ID != "" {
+		actual := models.HashToken(session.ID)
+		for _, s := range sesiones {
+			if s.Hash == actual {
+				data.SesionActual = s.ID
+			}
+		}
+	}
+	if err := vc.sesionesTpl.Execute(w, data); err != nil {
+		log.Printf("Error al renderizar plantilla mis_sesiones.html: %v", err)
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+	}
+}
+
+// RevocarSesionSubmit cierra una de las sesiones del usuario logueado, p. ej. la de un
+// dispositivo perdido.
+func (vc *MenuController) RevocarSesionSubmit(w http.ResponseWriter, r *http.Request) {
+	usuario := vc.getLoggedInUser(r)
+	if usuario == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de sesión inválido", http.StatusBadRequest)
+		return
+	}
+
+	if err := vc.almacen.EliminarSesion(usuario.GetID(), id); err != nil {
+		if errors.Is(err, models.ErrSesionNoEncontrada) {
+			http.Error(w, "Sesión no encontrada", http.StatusNotFound)
+		} else {
+			log.Printf("Error al revocar la sesión %d del usuario %d: %v", id, usuario.GetID(), err)
+			http.Error(w, "Error interno del servidor al revocar la sesión", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	http.Redirect(w, r, "/cuenta/sesiones", http.StatusSeeOther)
+}
+
+// RevocarSesionesSubmit cierra todas las sesiones del usuario logueado, incluida la
+// actual ("cerrar sesión en todas partes").
+func (vc *MenuController) RevocarSesionesSubmit(w http.ResponseWriter, r *http.Request) {
+	usuario := vc.getLoggedInUser(r)
+	if usuario == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	revocadas, err := vc.almacen.EliminarSesionesDeUsuario(usuario.GetID(), 0)
+	if err != nil {
+		log.Printf("Error al revocar las sesiones del usuario %d: %v", usuario.GetID(), err)
+		http.Error(w, "Error interno del servidor al revocar las sesiones", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("El usuario %s cerró sus %d sesión(es)", usuario.GetUsername(), revocadas)
+
+	// La sesión actual ya no existe; se borra también su cookie
+	if session, err := vc.store.Get(r, sessionName); err == nil {
+		session.Options.MaxAge = -1
+		session.Save(r, w)
+	}
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
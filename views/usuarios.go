@@ -0,0 +1,96 @@
+package views
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"libroselectronicos/models"
+
+	"github.com/gorilla/mux"
+)
+
+// --- Administración de Usuarios ---
+
+// AdminUsuariosHTML muestra todos los usuarios con su rol, para cambiarlo, y permite
+// cerrar sus sesiones.
+func (vc *MenuController) AdminUsuariosHTML(w http.ResponseWriter, r *http.Request) {
+	usuarios, err := vc.almacen.ListarUsuarios()
+	if err != nil {
+		log.Printf("Error al listar usuarios: %v", err)
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return
+	}
+
+	data := TemplateData{Usuario: vc.getLoggedInUser(r), CSRF: tokenCSRF(r), Usuarios: usuarios}
+	if err := vc.usuariosTpl.Execute(w, data); err != nil {
+		log.Printf("Error al renderizar plantilla admin_usuarios.html: %v", err)
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+	}
+}
+
+// CambiarRolSubmit cambia el rol del usuario {id}. No se le puede quitar al último
+// administrador.
+func (vc *MenuController) CambiarRolSubmit(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de usuario inválido", http.StatusBadRequest)
+		return
+	}
+	rol := r.FormValue("rol")
+	if !models.EsRolValido(rol) {
+		http.Error(w, "Rol inválido", http.StatusBadRequest)
+		return
+	}
+
+	if err := vc.almacen.CambiarRolUsuario(id, rol); err != nil {
+		switch {
+		case errors.Is(err, models.ErrUsuarioNoEncontrado):
+			http.Error(w, "Usuario no encontrado", http.StatusNotFound)
+		case errors.Is(err, models.ErrUltimoAdministrador):
+			vc.mostrarError(w, r, http.StatusConflict, "No se puede quitar el rol de administrador al último administrador. Nombra antes a otro.")
+		default:
+			log.Printf("Error al cambiar el rol del usuario %d: %v", id, err)
+			http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	log.Printf("AUDITORÍA: %s cambió el rol del usuario %d a %s", vc.getLoggedInUser(r).GetUsername(), id, rol)
+	http.Redirect(w, r, "/admin/usuarios", http.StatusSeeOther)
+}
+
+// CerrarSesionesUsuarioSubmit cierra todas las sesiones de navegador del usuario {id},
+// p. ej. si su cuenta se ha visto comprometida. Las propias se cierran en /cuenta/sesiones.
+func (vc *MenuController) CerrarSesionesUsuarioSubmit(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de usuario inválido", http.StatusBadRequest)
+		return
+	}
+	admin := vc.getLoggedInUser(r)
+	if id == admin.GetID() {
+		http.Redirect(w, r, "/cuenta/sesiones", http.StatusSeeOther)
+		return
+	}
+
+	if _, err := vc.almacen.ObtenerUsuarioPorID(id); err != nil {
+		if errors.Is(err, models.ErrUsuarioNoEncontrado) {
+			http.Error(w, "Usuario no encontrado", http.StatusNotFound)
+		} else {
+			log.Printf("Error al obtener el usuario %d: %v", id, err)
+			http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		}
+		return
+	}
+	revocadas, err := vc.almacen.EliminarSesionesDeUsuario(id, 0)
+	if err != nil {
+		log.Printf("Error al revocar las sesiones del usuario %d: %v", id, err)
+		http.Error(w, "Error interno del servidor al revocar las sesiones", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("AUDITORÍA: %s cerró %d sesión(es) del usuario %d", admin.GetUsername(), revocadas, id)
+	http.Redirect(w, r, "/admin/usuarios", http.StatusSeeOther)
+}
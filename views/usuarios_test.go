@@ -0,0 +1,82 @@
+package views
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"libroselectronicos/cuentas"
+	"libroselectronicos/db"
+	"libroselectronicos/models"
+
+	"github.com/gorilla/mux"
+)
+
+func TestRegistroYCambioDeRol(t *testing.T) {
+	almacen := db.NewAlmacenForTest(filepath.Join(t.TempDir(), "libros.db"))
+	if almacen == nil {
+		t.Fatalf("No se pudo inicializar el almacén de prueba")
+	}
+	defer almacen.Close()
+	vc := &MenuController{
+		almacen:      almacen,
+		store:        NuevoAlmacenSesiones(almacen, "clave-de-prueba"),
+		cuentas:      cuentas.NuevoServicio(almacen, &buzon{}, "http://libros.example.com"),
+		errorTpl:     plantillaError{},
+		verificarTpl: plantillaDatos{},
+		mensajeTpl:   plantillaDatos{},
+	}
+
+	// Un campo "rol" en el registro se ignora
+	valores := url.Values{"username": {"eva"}, "password": {"secreto"}, "email": {"eva@example.com"}, "rol": {models.RolAdministrador}}
+	req := httptest.NewRequest("POST", "/registro", strings.NewReader(valores.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	vc.RegistrarUsuarioSubmit(rr, req)
+	eva, err := almacen.ObtenerUsuarioPorUsername("eva")
+	if rr.Code != http.StatusOK || err != nil {
+		t.Fatalf("Error al registrar: %d, %v", rr.Code, err)
+	}
+	if eva.Rol != models.RolLector {
+		t.Errorf("Quien se registra debería ser lector, obtenido %q", eva.Rol)
+	}
+
+	admin, err := cuentas.CrearAdministrador(almacen, "ana", "ana@example.com", "secreto", time.Now())
+	if err != nil {
+		t.Fatalf("Error al crear el administrador: %v", err)
+	}
+	cambiarRol := func(id int, rol string) int {
+		req := httptest.NewRequest("POST", "/admin/usuarios/"+strconv.Itoa(id)+"/rol", strings.NewReader(url.Values{"rol": {rol}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(id)})
+		req = req.WithContext(context.WithValue(req.Context(), claveUsuario, admin))
+		rr := httptest.NewRecorder()
+		vc.CambiarRolSubmit(rr, req)
+		return rr.Code
+	}
+
+	if codigo := cambiarRol(admin.ID, models.RolLector); codigo != http.StatusConflict {
+		t.Errorf("Se esperaba 409 al quitar el rol al último administrador, obtenido %d", codigo)
+	}
+	if codigo := cambiarRol(eva.ID, "superusuario"); codigo != http.StatusBadRequest {
+		t.Errorf("Se esperaba 400 con un rol inválido, obtenido %d", codigo)
+	}
+	if codigo := cambiarRol(999, models.RolAdministrador); codigo != http.StatusNotFound {
+		t.Errorf("Se esperaba 404 con un usuario inexistente, obtenido %d", codigo)
+	}
+	if codigo := cambiarRol(eva.ID, models.RolAdministrador); codigo != http.StatusSeeOther {
+		t.Fatalf("Se esperaba 303 al nombrar administradora a eva, obtenido %d", codigo)
+	}
+	if eva, _ = almacen.ObtenerUsuarioPorID(eva.ID); eva.Rol != models.RolAdministrador {
+		t.Errorf("El rol de eva no cambió: %q", eva.Rol)
+	}
+	if codigo := cambiarRol(admin.ID, models.RolLector); codigo != http.StatusSeeOther {
+		t.Errorf("Con otro administrador sí se puede quitar el rol, obtenido %d", codigo)
+	}
+}